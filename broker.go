@@ -0,0 +1,252 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// defaultBrokerTimeout is the default for BrokerConfig.AcceptTimeout and
+// BrokerConfig.DialTimeout.
+const defaultBrokerTimeout = 5 * time.Second
+
+// ErrBrokerTimeout is returned by the brokers when the other side doesn't
+// dial or accept an ID in time. It is always wrapped in a
+// *BrokerTimeoutError, which has the details:
+//
+//	var timeoutErr *plugin.BrokerTimeoutError
+//	if errors.As(err, &timeoutErr) {
+//		log.Printf("plugin never dialed broker ID %d", timeoutErr.ID)
+//	}
+var ErrBrokerTimeout = errors.New("timeout waiting for broker connection")
+
+// BrokerConfig configures the MuxBroker and GRPCBroker of a plugin, set with
+// ClientConfig.Broker on the host and ServeConfig.Broker in the plugin.
+type BrokerConfig struct {
+	// AcceptTimeout is how long Accept waits for the other side to dial an
+	// ID. For the MuxBroker, it is also how long a connection the other side
+	// dialed waits for Accept. If it is zero, it defaults to 5 seconds.
+	AcceptTimeout time.Duration
+
+	// DialTimeout is how long Dial waits for the other side to accept an
+	// ID. For the GRPCBroker, it is also how long the connection info the
+	// other side sent once it accepted waits for Dial. If it is zero, it
+	// defaults to 5 seconds.
+	DialTimeout time.Duration
+}
+
+// timeouts returns the accept and dial timeouts, applying the defaults.
+func (c *BrokerConfig) timeouts() (accept, dial time.Duration) {
+	accept, dial = defaultBrokerTimeout, defaultBrokerTimeout
+	if c != nil && c.AcceptTimeout > 0 {
+		accept = c.AcceptTimeout
+	}
+	if c != nil && c.DialTimeout > 0 {
+		dial = c.DialTimeout
+	}
+
+	return accept, dial
+}
+
+// BrokerTimeoutError is returned by the brokers when the other side doesn't
+// dial or accept an ID in time. It matches ErrBrokerTimeout with errors.Is.
+type BrokerTimeoutError struct {
+	// ID is the broker ID that timed out.
+	ID uint32
+
+	// Direction is BrokerDirectionAccept if this side was accepting the ID,
+	// and the other side never dialed it, or BrokerDirectionDial if this
+	// side was dialing it, and the other side never accepted it.
+	Direction BrokerDirection
+
+	// Timeout is how long this side waited, see BrokerConfig.
+	Timeout time.Duration
+}
+
+func (e *BrokerTimeoutError) Error() string {
+	peer := "dial"
+	if e.Direction == BrokerDirectionDial {
+		peer = "accept"
+	}
+
+	return fmt.Sprintf("timeout waiting for the other side to %s broker ID %d after %s",
+		peer, e.ID, e.Timeout)
+}
+
+func (e *BrokerTimeoutError) Is(target error) bool {
+	return target == ErrBrokerTimeout
+}
+
+// BrokerDirection is which side of a broker connection this side is.
+type BrokerDirection string
+
+const (
+	// BrokerDirectionAccept is a connection this side accepts, such as a
+	// server it serves with AcceptAndServe.
+	BrokerDirectionAccept BrokerDirection = "accept"
+
+	// BrokerDirectionDial is a connection this side dials.
+	BrokerDirectionDial BrokerDirection = "dial"
+)
+
+// BrokerStream describes a broker ID that is pending or active, as listed by
+// MuxBroker.Streams and GRPCBroker.Streams, to diagnose connections that are
+// never established.
+type BrokerStream struct {
+	ID        uint32
+	Direction BrokerDirection
+
+	// Active is true once the connection is established. Until then, it is
+	// pending, either because this side is waiting for the other side, or
+	// because the other side's half of the connection is waiting for this
+	// side to call Accept or Dial.
+	Active bool
+
+	// Age is how long the ID has been pending, or if it is active, how long
+	// it has been active.
+	Age time.Duration
+}
+
+// brokerStreams tracks the IDs a broker has pending or active.
+type brokerStreams struct {
+	l       sync.Mutex
+	streams map[*brokerStream]struct{}
+}
+
+// brokerStream is a pending or active ID tracked by brokerStreams.
+type brokerStream struct {
+	streams   *brokerStreams
+	id        uint32
+	direction BrokerDirection
+	active    bool
+	since     time.Time
+}
+
+func newBrokerStreams() *brokerStreams {
+	return &brokerStreams{streams: make(map[*brokerStream]struct{})}
+}
+
+// list returns the tracked IDs, sorted by ID.
+func (s *brokerStreams) list() []BrokerStream {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	now := time.Now()
+	result := make([]BrokerStream, 0, len(s.streams))
+	for t := range s.streams {
+		result = append(result, BrokerStream{
+			ID:        t.id,
+			Direction: t.direction,
+			Active:    t.active,
+			Age:       now.Sub(t.since),
+		})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].ID != result[j].ID {
+			return result[i].ID < result[j].ID
+		}
+		return result[i].Direction < result[j].Direction
+	})
+
+	return result
+}
+
+// pending starts tracking a pending ID.
+func (s *brokerStreams) pending(id uint32, direction BrokerDirection) *brokerStream {
+	t := &brokerStream{
+		streams:   s,
+		id:        id,
+		direction: direction,
+		since:     time.Now(),
+	}
+
+	s.l.Lock()
+	s.streams[t] = struct{}{}
+	s.l.Unlock()
+
+	return t
+}
+
+// activate marks the ID as active, if it isn't already.
+func (t *brokerStream) activate() {
+	t.streams.l.Lock()
+	defer t.streams.l.Unlock()
+
+	if !t.active {
+		t.active = true
+		t.since = time.Now()
+	}
+}
+
+// remove stops tracking the ID.
+func (t *brokerStream) remove() {
+	t.streams.l.Lock()
+	defer t.streams.l.Unlock()
+
+	delete(t.streams.streams, t)
+}
+
+// conn marks the ID as active and returns conn, which stops tracking it once
+// it is closed.
+func (t *brokerStream) conn(conn net.Conn) net.Conn {
+	t.activate()
+	return &brokerConn{Conn: conn, stream: t}
+}
+
+// listener returns ln, which marks the ID as active once it accepts a
+// connection, and stops tracking it once it is closed.
+func (t *brokerStream) listener(ln net.Listener) net.Listener {
+	return &brokerListener{Listener: ln, stream: t}
+}
+
+// dialer returns a dialer that tracks each connection it dials for the given
+// ID, which are pending while dial runs.
+func (s *brokerStreams) dialer(id uint32, dial func(string, time.Duration) (net.Conn, error)) func(string, time.Duration) (net.Conn, error) {
+	return func(addr string, timeout time.Duration) (net.Conn, error) {
+		t := s.pending(id, BrokerDirectionDial)
+		conn, err := dial(addr, timeout)
+		if err != nil {
+			t.remove()
+			return nil, err
+		}
+
+		return t.conn(conn), nil
+	}
+}
+
+type brokerConn struct {
+	net.Conn
+	stream *brokerStream
+	once   sync.Once
+}
+
+func (c *brokerConn) Close() error {
+	c.once.Do(c.stream.remove)
+	return c.Conn.Close()
+}
+
+type brokerListener struct {
+	net.Listener
+	stream *brokerStream
+	once   sync.Once
+}
+
+func (l *brokerListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err == nil {
+		l.stream.activate()
+	}
+
+	return conn, err
+}
+
+func (l *brokerListener) Close() error {
+	l.once.Do(l.stream.remove)
+	return l.Listener.Close()
+}
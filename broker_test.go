@@ -0,0 +1,281 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-plugin/internal/grpcmux"
+	"github.com/hashicorp/go-plugin/internal/plugin"
+	"github.com/hashicorp/yamux"
+)
+
+// testMuxBrokers returns two MuxBrokers connected to each other.
+func testMuxBrokers(t *testing.T, config *BrokerConfig) (*MuxBroker, *MuxBroker) {
+	clientConn, serverConn := TestConn(t)
+
+	clientSession, err := yamux.Client(clientConn, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	serverSession, err := yamux.Server(serverConn, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	client := newMuxBroker(clientSession, config)
+	server := newMuxBroker(serverSession, config)
+	go client.Run()
+	go server.Run()
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+
+	return client, server
+}
+
+// testConnInfoStreamer is one end of an in-memory streamer pair.
+type testConnInfoStreamer struct {
+	send    chan<- *plugin.ConnInfo
+	recv    <-chan *plugin.ConnInfo
+	closeCh chan struct{}
+	once    *sync.Once
+}
+
+func (s *testConnInfoStreamer) Send(msg *plugin.ConnInfo) error {
+	select {
+	case s.send <- msg:
+		return nil
+	case <-s.closeCh:
+		return io.EOF
+	}
+}
+
+func (s *testConnInfoStreamer) Recv() (*plugin.ConnInfo, error) {
+	select {
+	case msg := <-s.recv:
+		return msg, nil
+	case <-s.closeCh:
+		return nil, io.EOF
+	}
+}
+
+func (s *testConnInfoStreamer) Close() {
+	s.once.Do(func() { close(s.closeCh) })
+}
+
+// testGRPCBrokers returns two GRPCBrokers connected to each other, without
+// multiplexing.
+func testGRPCBrokers(t *testing.T, config *BrokerConfig) (*GRPCBroker, *GRPCBroker) {
+	aToB := make(chan *plugin.ConnInfo, 16)
+	bToA := make(chan *plugin.ConnInfo, 16)
+	closeCh := make(chan struct{})
+	once := new(sync.Once)
+
+	var muxer *grpcmux.GRPCClientMuxer
+	a := newGRPCBroker(&testConnInfoStreamer{send: aToB, recv: bToA, closeCh: closeCh, once: once},
+		nil, UnixSocketConfig{}, nil, muxer, config)
+	b := newGRPCBroker(&testConnInfoStreamer{send: bToA, recv: aToB, closeCh: closeCh, once: once},
+		nil, UnixSocketConfig{}, nil, muxer, config)
+	go a.Run()
+	go b.Run()
+	t.Cleanup(func() {
+		a.Close()
+		b.Close()
+	})
+
+	return a, b
+}
+
+// waitForStreams waits for fn to return the expected streams, ignoring
+// their ages.
+func waitForStreams(t *testing.T, fn func() []BrokerStream, expected ...BrokerStream) {
+	t.Helper()
+
+	var actual []BrokerStream
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		actual = fn()
+		if brokerStreamsEqual(actual, expected) {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatalf("expected streams %+v, got %+v", expected, actual)
+}
+
+func brokerStreamsEqual(actual, expected []BrokerStream) bool {
+	if len(actual) != len(expected) {
+		return false
+	}
+	for i := range actual {
+		if actual[i].ID != expected[i].ID ||
+			actual[i].Direction != expected[i].Direction ||
+			actual[i].Active != expected[i].Active {
+			return false
+		}
+	}
+	return true
+}
+
+func TestBrokerConfig_timeouts(t *testing.T) {
+	var config *BrokerConfig
+	accept, dial := config.timeouts()
+	if accept != defaultBrokerTimeout || dial != defaultBrokerTimeout {
+		t.Fatalf("bad defaults: %s, %s", accept, dial)
+	}
+
+	config = &BrokerConfig{AcceptTimeout: time.Minute}
+	accept, dial = config.timeouts()
+	if accept != time.Minute || dial != defaultBrokerTimeout {
+		t.Fatalf("bad timeouts: %s, %s", accept, dial)
+	}
+}
+
+func TestMuxBroker_acceptTimeout(t *testing.T) {
+	client, _ := testMuxBrokers(t, &BrokerConfig{AcceptTimeout: 50 * time.Millisecond})
+
+	start := time.Now()
+	_, err := client.Accept(1)
+	if !errors.Is(err, ErrBrokerTimeout) {
+		t.Fatalf("expected ErrBrokerTimeout, got %v", err)
+	}
+	var timeoutErr *BrokerTimeoutError
+	if !errors.As(err, &timeoutErr) {
+		t.Fatalf("expected *BrokerTimeoutError, got %T", err)
+	}
+	if timeoutErr.ID != 1 || timeoutErr.Direction != BrokerDirectionAccept {
+		t.Fatalf("bad error: %+v", timeoutErr)
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Fatal("Accept didn't use the configured timeout")
+	}
+
+	waitForStreams(t, client.Streams)
+}
+
+func TestMuxBroker_dialTimeout(t *testing.T) {
+	client, server := testMuxBrokers(t, &BrokerConfig{
+		AcceptTimeout: time.Minute,
+		DialTimeout:   50 * time.Millisecond,
+	})
+
+	// Nothing accepts the ID on the server, which keeps the stream pending
+	// for the accept timeout, so the client times out waiting for the ack.
+	_, err := client.Dial(2)
+	var timeoutErr *BrokerTimeoutError
+	if !errors.As(err, &timeoutErr) {
+		t.Fatalf("expected *BrokerTimeoutError, got %v", err)
+	}
+	if timeoutErr.ID != 2 || timeoutErr.Direction != BrokerDirectionDial {
+		t.Fatalf("bad error: %+v", timeoutErr)
+	}
+
+	waitForStreams(t, client.Streams)
+	waitForStreams(t, server.Streams, BrokerStream{ID: 2, Direction: BrokerDirectionAccept})
+}
+
+func TestMuxBroker_streams(t *testing.T) {
+	client, server := testMuxBrokers(t, nil)
+
+	acceptCh := make(chan error, 1)
+	go func() {
+		conn, err := server.Accept(3)
+		if err == nil {
+			_, err = io.Copy(io.Discard, conn)
+			conn.Close()
+		}
+		acceptCh <- err
+	}()
+
+	waitForStreams(t, server.Streams, BrokerStream{ID: 3, Direction: BrokerDirectionAccept})
+
+	conn, err := client.Dial(3)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	waitForStreams(t, client.Streams, BrokerStream{ID: 3, Direction: BrokerDirectionDial, Active: true})
+	waitForStreams(t, server.Streams, BrokerStream{ID: 3, Direction: BrokerDirectionAccept, Active: true})
+
+	conn.Close()
+	if err := <-acceptCh; err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	waitForStreams(t, client.Streams)
+	waitForStreams(t, server.Streams)
+}
+
+func TestGRPCBroker_dialTimeout(t *testing.T) {
+	a, _ := testGRPCBrokers(t, &BrokerConfig{DialTimeout: 50 * time.Millisecond})
+
+	_, err := a.Dial(4)
+	var timeoutErr *BrokerTimeoutError
+	if !errors.As(err, &timeoutErr) {
+		t.Fatalf("expected *BrokerTimeoutError, got %v", err)
+	}
+	if timeoutErr.ID != 4 || timeoutErr.Direction != BrokerDirectionDial {
+		t.Fatalf("bad error: %+v", timeoutErr)
+	}
+
+	waitForStreams(t, a.Streams)
+}
+
+func TestGRPCBroker_acceptTimeout(t *testing.T) {
+	_, b := testGRPCBrokers(t, &BrokerConfig{AcceptTimeout: 50 * time.Millisecond})
+
+	ln, err := b.Accept(6)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer ln.Close()
+
+	_, err = ln.Accept()
+	var timeoutErr *BrokerTimeoutError
+	if !errors.As(err, &timeoutErr) {
+		t.Fatalf("expected *BrokerTimeoutError, got %v", err)
+	}
+	if timeoutErr.ID != 6 || timeoutErr.Direction != BrokerDirectionAccept {
+		t.Fatalf("bad error: %+v", timeoutErr)
+	}
+	waitForStreams(t, b.Streams)
+
+	// AcceptAndServe gives up too, rather than serving forever.
+	doneCh := make(chan struct{})
+	go func() {
+		defer close(doneCh)
+		b.AcceptAndServe(7, DefaultGRPCServer)
+	}()
+	select {
+	case <-doneCh:
+	case <-time.After(5 * time.Second):
+		t.Fatal("AcceptAndServe didn't return")
+	}
+	waitForStreams(t, b.Streams)
+}
+
+func TestGRPCBroker_streams(t *testing.T) {
+	a, b := testGRPCBrokers(t, &BrokerConfig{DialTimeout: 500 * time.Millisecond})
+
+	ln, err := b.Accept(5)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The connection info b sent is pending on a until a dials it, or
+	// until the dial timeout drops it.
+	waitForStreams(t, b.Streams, BrokerStream{ID: 5, Direction: BrokerDirectionAccept})
+	waitForStreams(t, a.Streams, BrokerStream{ID: 5, Direction: BrokerDirectionDial})
+	waitForStreams(t, a.Streams)
+
+	ln.Close()
+	waitForStreams(t, b.Streams)
+}
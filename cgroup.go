@@ -0,0 +1,111 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"errors"
+	"time"
+
+	"github.com/hashicorp/go-plugin/internal/cmdrunner"
+)
+
+var (
+	// ErrResourceUsageNotAvailable is returned by Client.ResourceUsage when
+	// the plugin wasn't started in a cgroup, or the client has been killed.
+	ErrResourceUsageNotAvailable = errors.New("resource usage is only available for plugins started with a cgroup")
+
+	// ErrOOMKilled is the reason a plugin exited if it was killed for
+	// exceeding the memory limit of its cgroup.
+	ErrOOMKilled = cmdrunner.ErrOOMKilled
+)
+
+// CgroupConfig configures the cgroup v2 each plugin process is placed in
+// when it is set as ClientConfig.Cgroup. Cgroups are only supported on
+// Linux.
+//
+// On Linux 5.7 and later, the plugin is started directly in its cgroup. On
+// older kernels it is moved into it right after it starts, so anything it
+// does in the first instants isn't accounted for. Any processes it starts
+// are in the same cgroup and are killed along with it.
+type CgroupConfig struct {
+	// Parent is the cgroup v2 directory under which a cgroup is created for
+	// each plugin, for example a subtree delegated to the host process's
+	// user. It must be writable, and the controllers needed for the limits
+	// are enabled in it if they aren't already.
+	Parent string
+
+	// MemoryMax is the memory limit in bytes. The plugin is OOM killed if it
+	// exceeds it. Zero means no limit.
+	MemoryMax uint64
+
+	// CPUQuota is the number of CPUs the plugin can use, e.g. 0.5 for half of
+	// one CPU. Zero means no limit. The kernel doesn't accept quotas below
+	// 0.01.
+	CPUQuota float64
+
+	// PIDsMax is the maximum number of processes and threads. Zero means no
+	// limit.
+	PIDsMax uint64
+}
+
+func (c *CgroupConfig) limits() cmdrunner.CgroupLimits {
+	return cmdrunner.CgroupLimits{
+		MemoryMax: c.MemoryMax,
+		CPUQuota:  c.CPUQuota,
+		PIDsMax:   c.PIDsMax,
+	}
+}
+
+// ResourceUsage is the resource usage of a plugin's cgroup. Values the
+// kernel doesn't report, for example because a controller isn't enabled,
+// are zero.
+type ResourceUsage struct {
+	// MemoryCurrent and MemoryPeak are the current and peak memory usage in
+	// bytes. MemoryPeak requires Linux 5.19 or later.
+	MemoryCurrent uint64
+	MemoryPeak    uint64
+
+	// CPUUsage is the total CPU time used, the sum of CPUUser and CPUSystem.
+	CPUUsage  time.Duration
+	CPUUser   time.Duration
+	CPUSystem time.Duration
+
+	// PIDs is the number of processes and threads.
+	PIDs uint64
+
+	// OOMKills is the number of processes that were OOM killed.
+	OOMKills uint64
+}
+
+// usageRunner is implemented by runners that can report resource usage.
+type usageRunner interface {
+	Usage() (*cmdrunner.CgroupUsage, error)
+}
+
+// ResourceUsage returns the resource usage of the plugin if it was started
+// with ClientConfig.Cgroup. Once the plugin has exited, this is its usage at
+// that time, until the client is killed.
+func (c *Client) ResourceUsage() (*ResourceUsage, error) {
+	c.l.Lock()
+	r, ok := c.runner.(usageRunner)
+	c.l.Unlock()
+	if !ok {
+		return nil, ErrResourceUsageNotAvailable
+	}
+
+	u, err := r.Usage()
+	if err != nil {
+		return nil, err
+	}
+
+	return &ResourceUsage{
+		MemoryCurrent: u.MemoryCurrent,
+		MemoryPeak:    u.MemoryPeak,
+		CPUUsage:      u.CPUUsage,
+		CPUUser:       u.CPUUser,
+		CPUSystem:     u.CPUSystem,
+		PIDs:          u.PIDs,
+		OOMKills:      u.OOMKills,
+	}, nil
+}
@@ -49,6 +49,18 @@ var (
 	// reattach to an existing process and it isn't found.
 	ErrProcessNotFound = cmdrunner.ErrProcessNotFound
 
+	// ErrSealedExecNotSupported is returned when SealedExec is set on a
+	// platform other than Linux.
+	ErrSealedExecNotSupported = cmdrunner.ErrSealedExecNotSupported
+
+	// ErrSandboxNotSupported is returned when Sandbox is set on a platform
+	// other than Linux.
+	ErrSandboxNotSupported = cmdrunner.ErrSandboxNotSupported
+
+	// ErrSandboxInitNotCalled is returned when Sandbox is set but the host
+	// didn't call SandboxInit.
+	ErrSandboxInitNotCalled = cmdrunner.ErrSandboxInitNotCalled
+
 	// ErrChecksumsDoNotMatch is returned when binary's checksum doesn't match
 	// the one provided in the SecureConfig.
 	ErrChecksumsDoNotMatch = errors.New("checksums did not match")
@@ -65,6 +77,10 @@ var (
 	// SecureConfig are set.
 	ErrSecureConfigAndReattach = errors.New("only one of Reattach or SecureConfig can be set")
 
+	// ErrSignatureConfigAndReattach is returned when both Reattach and
+	// SignatureConfig are set.
+	ErrSignatureConfigAndReattach = errors.New("only one of Reattach or SignatureConfig can be set")
+
 	// ErrGRPCBrokerMuxNotSupported is returned when the client requests
 	// multiplexing over the gRPC broker, but the plugin does not support the
 	// feature. In most cases, this should be resolvable by updating and
@@ -76,6 +92,10 @@ var (
 // defaultPluginLogBufferSize is the default size of the buffer used to read from stderr for plugin log lines.
 const defaultPluginLogBufferSize = 64 * 1024
 
+// defaultGracefulShutdownTimeout is the default time a plugin is given to exit
+// on its own before it is killed.
+const defaultGracefulShutdownTimeout = 2 * time.Second
+
 // Client handles the lifecycle of a plugin application. It launches
 // plugins, connects to them, dispenses interface implementations, and handles
 // killing the process.
@@ -116,6 +136,62 @@ type Client struct {
 
 	grpcMuxerOnce sync.Once
 	grpcMuxer     *grpcmux.GRPCClientMuxer
+
+	// serverCapabilities are the capabilities the plugin advertised in its
+	// handshake. This is empty for plugins that predate capabilities.
+	serverCapabilities capabilities
+
+	// stderr captures the plugin's stderr for exitErr, which is set once
+	// the plugin has exited unsuccessfully.
+	stderr  *stderrCapture
+	exitErr *PluginExitError
+
+	// panic is set once the plugin has written a panic to stderr.
+	panic *PluginPanic
+
+	// logLimiter enforces ClientConfig.LogRateLimit, if set.
+	logLimiter *logLimiter
+
+	// tracer creates the spans configured by ClientConfig.Tracing, and is
+	// nil if it isn't set.
+	tracer *tracer
+
+	// droppedLogEntries is the number of entries the plugin reported
+	// dropping while streaming its logs over gRPC. It must be accessed
+	// atomically.
+	droppedLogEntries uint64
+}
+
+// DroppedLogLines returns the number of the plugin's log entries that were
+// dropped because of ClientConfig.LogRateLimit, or by a plugin streaming its
+// entries over gRPC because they weren't read in time.
+func (c *Client) DroppedLogLines() uint64 {
+	dropped := atomic.LoadUint64(&c.droppedLogEntries)
+	if c.logLimiter != nil {
+		dropped += c.logLimiter.droppedLines()
+	}
+
+	return dropped
+}
+
+// Panic returns the Go panic or fatal error the plugin process wrote to
+// stderr, or nil if it hasn't written one. The panic is available once the
+// plugin's stderr has been closed, which is usually as it exits.
+func (c *Client) Panic() *PluginPanic {
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	return c.panic
+}
+
+// ExitStatus returns how the plugin process exited if it exited
+// unsuccessfully, for example with a non-zero exit code, a signal or a panic.
+// It returns nil while the plugin is running, or if it exited successfully.
+func (c *Client) ExitStatus() *PluginExitError {
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	return c.exitErr
 }
 
 // NegotiatedVersion returns the protocol version negotiated with the server.
@@ -124,6 +200,22 @@ func (c *Client) NegotiatedVersion() int {
 	return c.negotiatedVersion
 }
 
+// ServerCapabilities returns the capabilities the plugin advertised during
+// the handshake, as key/value pairs. This is only valid after Start() is
+// called, and is empty for plugins that don't support core protocol version
+// CoreProtocolVersionCapabilities.
+func (c *Client) ServerCapabilities() map[string]string {
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	result := make(map[string]string, len(c.serverCapabilities))
+	for k, v := range c.serverCapabilities {
+		result[k] = v
+	}
+
+	return result
+}
+
 // ID returns a unique ID for the running plugin. By default this is the process
 // ID (pid), but it could take other forms if RunnerFunc was provided.
 func (c *Client) ID() string {
@@ -175,6 +267,35 @@ type ClientConfig struct {
 	// executable. It can not be used with Reattach.
 	SecureConfig *SecureConfig
 
+	// SignatureConfig is configuration for verifying that the executable is
+	// listed in a checksums manifest signed by a trusted key. It can be used
+	// together with SecureConfig, but not with Reattach.
+	SignatureConfig *SignatureConfig
+
+	// SealedExec, if set, copies the executable into a sealed in-memory file
+	// before verifying it with SecureConfig and SignatureConfig, and runs the
+	// plugin from that copy. This closes the window in which the executable
+	// could be replaced between being verified and being run. It is only
+	// supported on Linux, and can't be used with Reattach or RunnerFunc.
+	SealedExec bool
+
+	// Sandbox, if set, runs the plugin in a sandbox on Linux: in its own
+	// user, mount, network and PID namespaces, without capabilities, and with
+	// the restrictions in the SandboxConfig applied. The plugin can only talk
+	// to the host over unix sockets. It can't be used with Reattach,
+	// RunnerFunc or SealedExec. The host's main function must call
+	// SandboxInit first.
+	Sandbox *SandboxConfig
+
+	// Cgroup, if set, places the plugin process in its own cgroup v2 with
+	// the configured limits. Its usage is available from ResourceUsage. It
+	// can't be used with Reattach.
+	Cgroup *CgroupConfig
+
+	// OnExit, if set, is called in its own goroutine once the plugin process
+	// has exited, with nil if it exited successfully. See ExitStatus.
+	OnExit func(*PluginExitError)
+
 	// TLSConfig is used to enable TLS on the RPC client.
 	TLSConfig *tls.Config
 
@@ -194,6 +315,14 @@ type ClientConfig struct {
 	// has started successfully.
 	StartTimeout time.Duration
 
+	// GracefulShutdownTimeout is how long Kill waits for the plugin to exit
+	// in all. It first asks the plugin to exit on its own, and once that
+	// fails, terminates the process and kills it if it hasn't exited by the
+	// end of the timeout. gRPC plugins are given this long to drain
+	// in-flight RPCs and run ServeConfig.OnShutdown. If this is zero, it
+	// defaults to 2 seconds.
+	GracefulShutdownTimeout time.Duration
+
 	// If non-nil, then the stderr of the client will be written to here
 	// (as well as the log). This is the original os.Stderr of the subprocess.
 	// This isn't the output of synced stderr.
@@ -206,6 +335,19 @@ type ClientConfig struct {
 	SyncStdout io.Writer
 	SyncStderr io.Writer
 
+	// SyncStdin, if non-nil, is forwarded to the plugin's os.Stdin over the
+	// RPC connection, so that plugins that prompt for input or run a REPL
+	// can be driven by the host. The plugin's stdin is closed once SyncStdin
+	// reaches EOF. If this is nil, the plugin inherits the host's os.Stdin
+	// instead.
+	//
+	// Plugins built against older versions of this library don't accept
+	// stdin, in which case a warning is logged and their stdin is empty.
+	// When reattaching, stdin is forwarded over gRPC if the client that
+	// started the plugin forwarded it too. Over net/rpc it isn't forwarded,
+	// but the plugin is served as usual.
+	SyncStdin io.Reader
+
 	// AllowedProtocols is a list of allowed protocols. If this isn't set,
 	// then only netrpc is allowed. This is so that older go-plugin systems
 	// can show friendly errors if they see a plugin with an unknown
@@ -227,6 +369,22 @@ type ClientConfig struct {
 	// If this is 0, then the default of 64KB is used.
 	PluginLogBufferSize int
 
+	// LogRateLimit, if set, limits how many of the plugin's log entries are
+	// forwarded to Logger. See LogRateLimit.
+	LogRateLimit *LogRateLimit
+
+	// Metrics, if non-nil, records the duration and result of every RPC
+	// call the host makes to the plugin. See MetricsConfig.
+	Metrics *MetricsConfig
+
+	// Tracing, if non-nil, creates spans around starting the plugin,
+	// dispensing plugins and broker negotiation. See TracingConfig.
+	Tracing *TracingConfig
+
+	// Broker configures how long the plugin's broker waits for the plugin
+	// to accept or dial connections. See BrokerConfig.
+	Broker *BrokerConfig
+
 	// AutoMTLS has the client and server automatically negotiate mTLS for
 	// transport authentication. This ensures that only the original client will
 	// be allowed to connect to the server, and all other connections will be
@@ -257,15 +415,19 @@ type ClientConfig struct {
 
 	// GRPCBrokerMultiplex turns on multiplexing for the gRPC broker. The gRPC
 	// broker will multiplex all brokered gRPC servers over the plugin's original
-	// listener socket instead of making a new listener for each server. The
-	// go-plugin library currently only includes a Go implementation for the
-	// server (i.e. plugin) side of gRPC broker multiplexing.
+	// listener socket instead of making a new listener for each server. This
+	// applies to the servers the host serves with AcceptAndServe as well as
+	// those the plugin serves, so no extra listeners are opened at all.
 	//
-	// Does not support reattaching.
+	// When reattaching, whether the broker is multiplexed is determined by
+	// ReattachConfig.GRPCBrokerMultiplex instead, and setting this to true
+	// with a plugin that isn't multiplexing is an error.
 	//
-	// Multiplexed gRPC streams MUST be established sequentially, i.e. after
-	// calling AcceptAndServe from one side, wait for the other side to Dial
-	// before calling AcceptAndServe again.
+	// Multiplexed gRPC streams can be established concurrently, in any order.
+	// With plugins built against older versions of go-plugin, they MUST be
+	// established sequentially instead, i.e. after calling AcceptAndServe from
+	// one side, wait for the other side to Dial before calling AcceptAndServe
+	// again.
 	GRPCBrokerMultiplex bool
 
 	// SkipHostEnv allows plugins to run without inheriting the parent process'
@@ -313,6 +475,22 @@ type ReattachConfig struct {
 	// process and instead will rely on the plugin to terminate itself. This
 	// should not be used in non-test environments.
 	Test bool
+
+	// StdioSequence is the sequence number of the last chunk of stdout or
+	// stderr received from a gRPC plugin. A client reattaching with it
+	// resumes the plugin's stdout and stderr after that chunk, rather than
+	// from the oldest data the plugin still buffers. See
+	// ServeConfig.StdioBuffer.
+	StdioSequence uint64
+
+	// GRPCBrokerMultiplex is true if the plugin multiplexes the gRPC
+	// broker's connections over its listener, in which case clients
+	// reattaching to it do too, whatever ClientConfig.GRPCBrokerMultiplex is
+	// set to. GRPCBrokerMultiplexIDs is true if it prefixes multiplexed
+	// streams with their ID, which plugins built against older versions of
+	// go-plugin don't.
+	GRPCBrokerMultiplex    bool
+	GRPCBrokerMultiplexIDs bool
 }
 
 // SecureConfig is used to configure a client to verify the integrity of an
@@ -324,7 +502,8 @@ type ReattachConfig struct {
 // The host process should ensure the checksum was provided by a trusted and
 // authoritative source. The binary should be installed in such a way that it
 // can not be modified by an unauthorized user between the time of this check
-// and the time of execution.
+// and the time of execution, or ClientConfig.SealedExec should be set so
+// that the verified bytes are the executed bytes.
 type SecureConfig struct {
 	Checksum []byte
 	Hash     hash.Hash
@@ -333,21 +512,41 @@ type SecureConfig struct {
 // Check takes the filepath to an executable and returns true if the checksum of
 // the file matches the checksum provided in the SecureConfig.
 func (s *SecureConfig) Check(filePath string) (bool, error) {
+	if err := s.validate(); err != nil {
+		return false, err
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	return s.check(file)
+}
+
+func (s *SecureConfig) validate() error {
 	if len(s.Checksum) == 0 {
-		return false, ErrSecureConfigNoChecksum
+		return ErrSecureConfigNoChecksum
 	}
 
 	if s.Hash == nil {
-		return false, ErrSecureConfigNoHash
+		return ErrSecureConfigNoHash
 	}
 
-	file, err := os.Open(filePath)
-	if err != nil {
+	return nil
+}
+
+// check returns true if the checksum of the executable read from r matches.
+func (s *SecureConfig) check(r io.Reader) (bool, error) {
+	if err := s.validate(); err != nil {
 		return false, err
 	}
-	defer file.Close()
 
-	_, err = io.Copy(s.Hash, file)
+	// Start from a clean state so that the config can be reused across
+	// clients. This doesn't make it safe for concurrent use.
+	s.Hash.Reset()
+	_, err := io.Copy(s.Hash, r)
 	if err != nil {
 		return false, err
 	}
@@ -400,6 +599,10 @@ func NewClient(config *ClientConfig) (c *Client) {
 		config.StartTimeout = 1 * time.Minute
 	}
 
+	if config.GracefulShutdownTimeout == 0 {
+		config.GracefulShutdownTimeout = defaultGracefulShutdownTimeout
+	}
+
 	if config.Stderr == nil {
 		config.Stderr = ioutil.Discard
 	}
@@ -430,6 +633,11 @@ func NewClient(config *ClientConfig) (c *Client) {
 	c = &Client{
 		config: config,
 		logger: config.Logger,
+		stderr: newStderrCapture(),
+		tracer: newTracer(config.Tracing),
+	}
+	if config.LogRateLimit != nil {
+		c.logLimiter = newLogLimiter(config.LogRateLimit)
 	}
 	if config.Managed {
 		managedClientsLock.Lock()
@@ -444,7 +652,13 @@ func NewClient(config *ClientConfig) (c *Client) {
 //
 // Subsequent calls to this will return the same client.
 func (c *Client) Client() (ClientProtocol, error) {
-	_, err := c.Start()
+	return c.ClientContext(context.Background())
+}
+
+// ClientContext is like Client, but starting the plugin and establishing the
+// connection to it are aborted if ctx is cancelled.
+func (c *Client) ClientContext(ctx context.Context) (ClientProtocol, error) {
+	_, err := c.StartContext(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -456,17 +670,22 @@ func (c *Client) Client() (ClientProtocol, error) {
 		return c.client, nil
 	}
 
-	switch c.protocol {
-	case ProtocolNetRPC:
-		c.client, err = newRPCClient(c)
-
-	case ProtocolGRPC:
-		c.client, err = newGRPCClient(c.doneCtx, c)
-
-	default:
+	factories, ok := registeredProtocol(c.protocol)
+	if !ok {
 		return nil, fmt.Errorf("unknown server protocol: %s", c.protocol)
 	}
 
+	c.client, err = factories.client(ctx, &ClientProtocolConfig{
+		Addr:       c.address,
+		TLS:        c.config.TLSConfig,
+		Plugins:    c.config.Plugins,
+		Logger:     c.logger,
+		DoneCtx:    c.doneCtx,
+		SyncStdout: c.config.SyncStdout,
+		SyncStderr: c.config.SyncStderr,
+		client:     c,
+	})
+
 	if err != nil {
 		c.client = nil
 		return nil, err
@@ -475,6 +694,23 @@ func (c *Client) Client() (ClientProtocol, error) {
 	return c.client, nil
 }
 
+// Metadata returns the metadata the plugin reports about itself, starting
+// the plugin if necessary. ErrMetadataNotSupported is returned if the plugin
+// was built against a version of go-plugin without metadata support.
+func (c *Client) Metadata() (*PluginMetadata, error) {
+	client, err := c.Client()
+	if err != nil {
+		return nil, err
+	}
+
+	mc, ok := client.(metadataClient)
+	if !ok {
+		return nil, ErrMetadataNotSupported
+	}
+
+	return mc.metadata(context.Background())
+}
+
 // Tells whether or not the underlying process has exited.
 func (c *Client) Exited() bool {
 	c.l.Lock()
@@ -524,6 +760,11 @@ func (c *Client) Kill() {
 		c.l.Unlock()
 	}()
 
+	// The plugin is given GracefulShutdownTimeout in all to exit, whether it
+	// exits on its own or once the runner terminates it.
+	killCtx, cancel := context.WithTimeout(context.Background(), c.config.GracefulShutdownTimeout)
+	defer cancel()
+
 	// We need to check for address here. It is possible that the plugin
 	// started (process != nil) but has no address (addr == nil) if the
 	// plugin failed at startup. If we do have an address, we need to close
@@ -557,13 +798,15 @@ func (c *Client) Kill() {
 		case <-c.doneCtx.Done():
 			c.logger.Debug("plugin exited")
 			return
-		case <-time.After(2 * time.Second):
+		case <-killCtx.Done():
 		}
 	}
 
-	// If graceful exiting failed, just kill it
+	// If graceful exiting failed, just kill it. The runner terminates the
+	// process with whatever is left of the timeout before it resorts to
+	// force.
 	c.logger.Warn("plugin failed to exit gracefully")
-	if err := runner.Kill(context.Background()); err != nil {
+	if err := runner.Kill(killCtx); err != nil {
 		c.logger.Debug("error killing plugin", "error", err)
 	}
 
@@ -572,6 +815,47 @@ func (c *Client) Kill() {
 	c.l.Unlock()
 }
 
+// createSocketDir creates the temporary directory the plugin creates its unix
+// sockets in, for runners that need to know where they'll be.
+func (c *Client) createSocketDir() error {
+	var err error
+	c.unixSocketCfg.socketDir, err = os.MkdirTemp(c.unixSocketCfg.TempDir, "plugin-dir")
+	if err != nil {
+		return err
+	}
+	// os.MkdirTemp creates folders with 0o700, so if we have a group
+	// configured we need to make it group-writable.
+	if c.unixSocketCfg.Group != "" {
+		err = setGroupWritable(c.unixSocketCfg.socketDir, c.unixSocketCfg.Group, 0o770)
+		if err != nil {
+			return err
+		}
+	}
+	c.logger.Trace("created temporary directory for unix sockets", "dir", c.unixSocketCfg.socketDir)
+
+	return nil
+}
+
+// verifyImage checks an executable image read from image against
+// SecureConfig and SignatureConfig. path is where the image was read from.
+func (c *Client) verifyImage(path string, image io.ReaderAt, size int64) error {
+	if c.config.SecureConfig != nil {
+		if ok, err := c.config.SecureConfig.check(io.NewSectionReader(image, 0, size)); err != nil {
+			return fmt.Errorf("error verifying checksum: %s", err)
+		} else if !ok {
+			return ErrChecksumsDoNotMatch
+		}
+	}
+
+	if c.config.SignatureConfig != nil {
+		if err := c.config.SignatureConfig.check(path, io.NewSectionReader(image, 0, size)); err != nil {
+			return fmt.Errorf("error verifying plugin signature: %w", err)
+		}
+	}
+
+	return nil
+}
+
 // Start the underlying subprocess, communicating with it to negotiate
 // a port for RPC connections, and returning the address to connect via RPC.
 //
@@ -579,6 +863,14 @@ func (c *Client) Kill() {
 // Once a client has been started once, it cannot be started again, even if
 // it was killed.
 func (c *Client) Start() (addr net.Addr, err error) {
+	return c.StartContext(context.Background())
+}
+
+// StartContext is like Start, but the plugin launch is aborted if ctx is
+// cancelled before the plugin has finished starting. ClientConfig.StartTimeout
+// still applies. Cancelling ctx after StartContext returns has no effect on
+// the running plugin.
+func (c *Client) StartContext(ctx context.Context) (addr net.Addr, err error) {
 	c.l.Lock()
 	defer c.l.Unlock()
 
@@ -608,8 +900,20 @@ func (c *Client) Start() (addr net.Addr, err error) {
 			return nil, ErrSecureConfigAndReattach
 		}
 
-		if c.config.GRPCBrokerMultiplex && c.config.Reattach != nil {
-			return nil, fmt.Errorf("gRPC broker multiplexing is not supported with Reattach config")
+		if c.config.SignatureConfig != nil && c.config.Reattach != nil {
+			return nil, ErrSignatureConfigAndReattach
+		}
+
+		if c.config.SealedExec && c.config.Cmd == nil {
+			return nil, fmt.Errorf("SealedExec can only be used with Cmd")
+		}
+
+		if c.config.Sandbox != nil && (c.config.Cmd == nil || c.config.SealedExec) {
+			return nil, fmt.Errorf("Sandbox can only be used with Cmd, and not with SealedExec")
+		}
+
+		if c.config.Cgroup != nil && c.config.Reattach != nil {
+			return nil, fmt.Errorf("Cgroup is not supported with Reattach config")
 		}
 	}
 
@@ -617,6 +921,15 @@ func (c *Client) Start() (addr net.Addr, err error) {
 		return c.reattach()
 	}
 
+	_, span := c.tracer.start(ctx, "plugin.handshake")
+	defer func() {
+		if err == nil {
+			span.setAttribute("plugin.protocol", string(c.protocol))
+			span.setAttribute("plugin.version", strconv.Itoa(c.negotiatedVersion))
+		}
+		span.end(err)
+	}()
+
 	if c.config.VersionedPlugins == nil {
 		c.config.VersionedPlugins = make(map[int]PluginSet)
 	}
@@ -641,10 +954,23 @@ func (c *Client) Start() (addr net.Addr, err error) {
 		fmt.Sprintf("PLUGIN_MIN_PORT=%d", c.config.MinPort),
 		fmt.Sprintf("PLUGIN_MAX_PORT=%d", c.config.MaxPort),
 		fmt.Sprintf("PLUGIN_PROTOCOL_VERSIONS=%s", strings.Join(versionStrings, ",")),
+		fmt.Sprintf("%s=%d,%d", envCoreProtocolVersions, CoreProtocolVersion, CoreProtocolVersionCapabilities),
+	}
+
+	clientCaps := capabilities{
+		capabilityGRPCLogSink: "true",
+	}
+	if c.config.SyncStdin != nil {
+		clientCaps[capabilitySyncStdin] = "true"
 	}
 	if c.config.GRPCBrokerMultiplex {
+		clientCaps[capabilityGRPCBrokerMultiplex] = "true"
+		clientCaps[capabilityGRPCBrokerMultiplexIDs] = "true"
+
+		// Plugins that predate capabilities only look at this.
 		env = append(env, fmt.Sprintf("%s=true", envMultiplexGRPC))
 	}
+	env = append(env, fmt.Sprintf("%s=%s", envClientCapabilities, clientCaps))
 
 	cmd := c.config.Cmd
 	if cmd == nil {
@@ -657,13 +983,24 @@ func (c *Client) Start() (addr net.Addr, err error) {
 		cmd.Env = append(cmd.Env, os.Environ()...)
 	}
 	cmd.Env = append(cmd.Env, env...)
-	cmd.Stdin = os.Stdin
+	if c.config.SyncStdin == nil {
+		cmd.Stdin = os.Stdin
+	}
 
-	if c.config.SecureConfig != nil {
-		if ok, err := c.config.SecureConfig.Check(cmd.Path); err != nil {
-			return nil, fmt.Errorf("error verifying checksum: %s", err)
-		} else if !ok {
-			return nil, ErrChecksumsDoNotMatch
+	// With SealedExec the executable is verified when the runner reads it.
+	if !c.config.SealedExec {
+		if c.config.SecureConfig != nil {
+			if ok, err := c.config.SecureConfig.Check(cmd.Path); err != nil {
+				return nil, fmt.Errorf("error verifying checksum: %s", err)
+			} else if !ok {
+				return nil, ErrChecksumsDoNotMatch
+			}
+		}
+
+		if c.config.SignatureConfig != nil {
+			if err := c.config.SignatureConfig.Check(cmd.Path); err != nil {
+				return nil, fmt.Errorf("error verifying plugin signature: %w", err)
+			}
 		}
 	}
 
@@ -703,25 +1040,38 @@ func (c *Client) Start() (addr net.Addr, err error) {
 	var runner runner.Runner
 	switch {
 	case c.config.RunnerFunc != nil:
-		c.unixSocketCfg.socketDir, err = os.MkdirTemp(c.unixSocketCfg.TempDir, "plugin-dir")
-		if err != nil {
+		if err = c.createSocketDir(); err != nil {
 			return nil, err
 		}
-		// os.MkdirTemp creates folders with 0o700, so if we have a group
-		// configured we need to make it group-writable.
-		if c.unixSocketCfg.Group != "" {
-			err = setGroupWritable(c.unixSocketCfg.socketDir, c.unixSocketCfg.Group, 0o770)
-			if err != nil {
-				return nil, err
-			}
-		}
 		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", EnvUnixSocketDir, c.unixSocketCfg.socketDir))
-		c.logger.Trace("created temporary directory for unix sockets", "dir", c.unixSocketCfg.socketDir)
 
 		runner, err = c.config.RunnerFunc(c.logger, cmd, c.unixSocketCfg.socketDir)
 		if err != nil {
 			return nil, err
 		}
+	case c.config.Sandbox != nil:
+		if err = c.createSocketDir(); err != nil {
+			return nil, err
+		}
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", EnvUnixSocketDir, cmdrunner.SandboxSocketDir))
+
+		runner, err = cmdrunner.NewSandboxRunner(c.logger, cmd, c.unixSocketCfg.socketDir, c.config.Sandbox.runnerConfig())
+		if err != nil {
+			return nil, err
+		}
+	case c.config.SealedExec:
+		path := cmd.Path
+		var sealed *cmdrunner.CmdRunner
+		sealed, err = cmdrunner.NewSealedCmdRunner(c.logger, cmd, func(image io.ReaderAt, size int64) error {
+			return c.verifyImage(path, image, size)
+		})
+		if err != nil {
+			return nil, err
+		}
+		// Start closes the sealed image, but it isn't reached if setting up
+		// the runner fails below.
+		defer sealed.Close()
+		runner = sealed
 	default:
 		runner, err = cmdrunner.NewCmdRunner(c.logger, cmd)
 		if err != nil {
@@ -730,20 +1080,33 @@ func (c *Client) Start() (addr net.Addr, err error) {
 
 	}
 
+	if c.config.Cgroup != nil {
+		cgroup, err := cmdrunner.NewCgroup(c.config.Cgroup.Parent, c.config.Cgroup.limits())
+		if err != nil {
+			return nil, err
+		}
+		runner = cmdrunner.NewCgroupRunner(c.logger, runner, cgroup)
+	}
+
 	c.runner = runner
-	startCtx, startCtxCancel := context.WithTimeout(context.Background(), c.config.StartTimeout)
+	startCtx, startCtxCancel := context.WithTimeout(ctx, c.config.StartTimeout)
 	defer startCtxCancel()
 	err = runner.Start(startCtx)
 	if err != nil {
 		return nil, err
 	}
+	startTime := time.Now()
 
 	// Make sure the command is properly cleaned up if there is an error
 	defer func() {
 		rErr := recover()
 
 		if err != nil || rErr != nil {
-			runner.Kill(context.Background())
+			// Kill the half-started plugin right away, rather than
+			// giving it time to terminate.
+			killCtx, cancel := context.WithCancel(context.Background())
+			cancel()
+			runner.Kill(killCtx)
 		}
 
 		if rErr != nil {
@@ -755,6 +1118,9 @@ func (c *Client) Start() (addr net.Addr, err error) {
 	c.doneCtx, c.ctxCancel = context.WithCancel(context.Background())
 
 	// Start goroutine that logs the stderr
+	c.stderr = newStderrCapture()
+	c.exitErr = nil
+	c.panic = nil
 	c.clientWaitGroup.Add(1)
 	c.stderrWaitGroup.Add(1)
 	// logStderr calls Done()
@@ -773,7 +1139,9 @@ func (c *Client) Start() (addr net.Addr, err error) {
 
 		// Wait for the command to end.
 		err := runner.Wait(context.Background())
-		if err != nil {
+		if errors.Is(err, ErrOOMKilled) {
+			c.logger.Error("plugin process was OOM killed", "plugin", runner.Name(), "id", runner.ID(), "error", err.Error())
+		} else if err != nil {
 			c.logger.Error("plugin process exited", "plugin", runner.Name(), "id", runner.ID(), "error", err.Error())
 		} else {
 			// Log and make sure to flush the logs right away
@@ -784,8 +1152,14 @@ func (c *Client) Start() (addr net.Addr, err error) {
 
 		// Set that we exited, which takes a lock
 		c.l.Lock()
-		defer c.l.Unlock()
+		exitErr := newPluginExitError(err, time.Since(startTime), c.stderr.lines(), c.panic)
 		c.exited = true
+		c.exitErr = exitErr
+		c.l.Unlock()
+
+		if c.config.OnExit != nil {
+			go c.config.OnExit(exitErr)
+		}
 	}()
 
 	// Start a goroutine that is going to be reading the lines
@@ -818,14 +1192,15 @@ func (c *Client) Start() (addr net.Addr, err error) {
 		}()
 	}()
 
-	// Some channels for the next step
-	timeout := time.After(c.config.StartTimeout)
-
 	// Start looking for the address
 	c.logger.Debug("waiting for RPC address", "plugin", runner.Name())
 	select {
-	case <-timeout:
-		err = errors.New("timeout while waiting for plugin to start")
+	case <-startCtx.Done():
+		if ctx.Err() != nil {
+			err = fmt.Errorf("plugin start cancelled: %w", ctx.Err())
+		} else {
+			err = errors.New("timeout while waiting for plugin to start")
+		}
 	case <-c.doneCtx.Done():
 		err = errors.New("plugin exited before we could connect")
 	case line, ok := <-linesCh:
@@ -846,22 +1221,36 @@ func (c *Client) Start() (addr net.Addr, err error) {
 			return
 		}
 
-		// Check the core protocol. Wrapped in a {} for scoping.
-		{
-			var coreProtocol int
-			coreProtocol, err = strconv.Atoi(parts[0])
-			if err != nil {
-				err = fmt.Errorf("Error parsing core protocol version: %s", err)
+		// Check the core protocol.
+		var coreProtocol int
+		coreProtocol, err = strconv.Atoi(parts[0])
+		if err != nil {
+			err = fmt.Errorf("Error parsing core protocol version: %s", err)
+			return
+		}
+
+		switch coreProtocol {
+		case CoreProtocolVersion:
+		case CoreProtocolVersionCapabilities:
+			if len(parts) < 7 {
+				err = fmt.Errorf("Unrecognized remote plugin message: %s\n"+
+					"Core protocol version %d requires a capabilities segment", line, coreProtocol)
 				return
 			}
 
-			if coreProtocol != CoreProtocolVersion {
-				err = fmt.Errorf("Incompatible core API version with plugin. "+
-					"Plugin version: %s, Core version: %d\n\n"+
-					"To fix this, the plugin usually only needs to be recompiled.\n"+
-					"Please report this to the plugin author.", parts[0], CoreProtocolVersion)
+			var caps capabilities
+			caps, err = parseCapabilities(parts[6])
+			if err != nil {
+				err = fmt.Errorf("Error parsing plugin capabilities: %s", err)
 				return
 			}
+			c.serverCapabilities = caps
+		default:
+			err = fmt.Errorf("Incompatible core API version with plugin. "+
+				"Plugin version: %s, Core version: %d\n\n"+
+				"To fix this, the plugin usually only needs to be recompiled.\n"+
+				"Please report this to the plugin author.", parts[0], CoreProtocolVersion)
+			return
 		}
 
 		// Test the API version
@@ -921,7 +1310,11 @@ func (c *Client) Start() (addr net.Addr, err error) {
 			}
 		}
 
-		if c.config.GRPCBrokerMultiplex && c.protocol == ProtocolGRPC {
+		if c.config.GRPCBrokerMultiplex && c.protocol == ProtocolGRPC && coreProtocol == CoreProtocolVersionCapabilities {
+			if !c.serverCapabilities.Bool(capabilityGRPCBrokerMultiplex) {
+				return nil, ErrGRPCBrokerMuxNotSupported
+			}
+		} else if c.config.GRPCBrokerMultiplex && c.protocol == ProtocolGRPC {
 			if len(parts) <= 6 {
 				return nil, fmt.Errorf("%w; for Go plugins, you will need to update the "+
 					"github.com/hashicorp/go-plugin dependency and recompile", ErrGRPCBrokerMuxNotSupported)
@@ -1003,6 +1396,16 @@ func (c *Client) reattach() (net.Addr, error) {
 		c.protocol = ProtocolNetRPC
 	}
 
+	// Multiplex over the plugin's listener if the plugin expects it.
+	if c.protocol == ProtocolGRPC {
+		if c.config.GRPCBrokerMultiplex && !c.config.Reattach.GRPCBrokerMultiplex {
+			return nil, ErrGRPCBrokerMuxNotSupported
+		}
+		if _, err := c.getGRPCMuxer(c.address); err != nil {
+			return nil, err
+		}
+	}
+
 	if c.config.Reattach.Test {
 		c.negotiatedVersion = c.config.Reattach.ProtocolVersion
 	} else {
@@ -1064,18 +1467,30 @@ func (c *Client) ReattachConfig() *ReattachConfig {
 		return nil
 	}
 
-	// If we connected via reattach, just return the information as-is
+	// If we connected via reattach, just return the information as-is, other
+	// than where our stdio is up to
+	var reattach *ReattachConfig
 	if c.config.Reattach != nil {
-		return c.config.Reattach
-	}
+		r := *c.config.Reattach
+		reattach = &r
+	} else {
+		reattach = &ReattachConfig{
+			Protocol: c.protocol,
+			Addr:     c.address,
+		}
+
+		if c.config.Cmd != nil && c.config.Cmd.Process != nil {
+			reattach.Pid = c.config.Cmd.Process.Pid
+		}
 
-	reattach := &ReattachConfig{
-		Protocol: c.protocol,
-		Addr:     c.address,
+		if c.protocol == ProtocolGRPC && c.config.GRPCBrokerMultiplex {
+			reattach.GRPCBrokerMultiplex = true
+			reattach.GRPCBrokerMultiplexIDs = c.serverCapabilities.Bool(capabilityGRPCBrokerMultiplexIDs)
+		}
 	}
 
-	if c.config.Cmd != nil && c.config.Cmd.Process != nil {
-		reattach.Pid = c.config.Cmd.Process.Pid
+	if client, ok := c.client.(*GRPCClient); ok && client.stdio != nil {
+		reattach.StdioSequence = client.stdio.lastSequence()
 	}
 
 	return reattach
@@ -1121,7 +1536,7 @@ func (c *Client) dialer(_ string, timeout time.Duration) (net.Conn, error) {
 
 	var conn net.Conn
 	if muxer.Enabled() {
-		conn, err = muxer.Dial()
+		conn, err = muxer.Dial(0)
 		if err != nil {
 			return nil, err
 		}
@@ -1141,14 +1556,29 @@ func (c *Client) dialer(_ string, timeout time.Duration) (net.Conn, error) {
 	return conn, nil
 }
 
+// grpcBrokerMultiplex returns true if the gRPC broker is multiplexed over the
+// plugin's listener, as requested with ClientConfig.GRPCBrokerMultiplex or
+// recorded in the ReattachConfig.
+func (c *Client) grpcBrokerMultiplex() bool {
+	if c.config.Reattach != nil {
+		return c.config.Reattach.GRPCBrokerMultiplex
+	}
+	return c.config.GRPCBrokerMultiplex
+}
+
 func (c *Client) getGRPCMuxer(addr net.Addr) (*grpcmux.GRPCClientMuxer, error) {
-	if c.protocol != ProtocolGRPC || !c.config.GRPCBrokerMultiplex {
+	if c.protocol != ProtocolGRPC || !c.grpcBrokerMultiplex() {
 		return nil, nil
 	}
 
+	prefixIDs := c.serverCapabilities.Bool(capabilityGRPCBrokerMultiplexIDs)
+	if c.config.Reattach != nil {
+		prefixIDs = c.config.Reattach.GRPCBrokerMultiplexIDs
+	}
+
 	var err error
 	c.grpcMuxerOnce.Do(func() {
-		c.grpcMuxer, err = grpcmux.NewGRPCClientMuxer(c.logger, addr)
+		c.grpcMuxer, err = grpcmux.NewGRPCClientMuxer(c.logger, addr, prefixIDs)
 	})
 	if err != nil {
 		return nil, err
@@ -1157,15 +1587,62 @@ func (c *Client) getGRPCMuxer(addr net.Addr) (*grpcmux.GRPCClientMuxer, error) {
 	return c.grpcMuxer, nil
 }
 
+// logPanic logs a panic read from the plugin's stderr as a single entry and
+// records it for Panic.
+func (c *Client) logPanic(l hclog.Logger, p *PluginPanic) {
+	c.l.Lock()
+	c.panic = p
+	c.l.Unlock()
+
+	msg := "plugin panicked"
+	if p.Fatal {
+		msg = "plugin hit a fatal error"
+	}
+	l.Error(msg, "message", p.Message, "top_frame", p.TopFrame, "goroutines", p.Goroutines, "trace", p.Trace)
+}
+
+// pluginLogger returns the logger that the plugin's own log entries are
+// re-emitted with, named after the plugin.
+func (c *Client) pluginLogger() hclog.Logger {
+	l := c.logger
+	if r, ok := c.runner.(runner.Runner); ok {
+		l = c.logger.Named(filepath.Base(r.Name()))
+	}
+	return c.limitLogs(l)
+}
+
+// limitLogs wraps a logger that the plugin's entries are forwarded to with
+// ClientConfig.LogRateLimit, if set.
+func (c *Client) limitLogs(l hclog.Logger) hclog.Logger {
+	if c.logLimiter == nil {
+		return l
+	}
+	return c.logLimiter.wrap(l)
+}
+
 func (c *Client) logStderr(name string, r io.Reader) {
 	defer c.clientWaitGroup.Done()
 	defer c.stderrWaitGroup.Done()
-	l := c.logger.Named(filepath.Base(name))
+	unlimited := c.logger.Named(filepath.Base(name))
+	l := c.limitLogs(unlimited)
+	if c.logLimiter != nil {
+		defer c.logLimiter.flush(unlimited)
+	}
 
 	reader := bufio.NewReaderSize(r, c.config.PluginLogBufferSize)
 	// continuation indicates the previous line was a prefix
 	continuation := false
 
+	// panicking is set while reading a panic, which is logged as a single
+	// entry once it ends rather than line by line, regardless of the rate
+	// limit.
+	var panicking *panicParser
+	defer func() {
+		if panicking != nil {
+			c.logPanic(unlimited, panicking.result())
+		}
+	}()
+
 	for {
 		line, isPrefix, err := reader.ReadLine()
 		switch {
@@ -1177,11 +1654,18 @@ func (c *Client) logStderr(name string, r io.Reader) {
 		}
 
 		c.config.Stderr.Write(line)
+		c.stderr.add(string(line))
 
 		// The line was longer than our max token size, so it's likely
 		// incomplete and won't unmarshal.
 		if isPrefix || continuation {
-			l.Debug(string(line))
+			if panicking != nil && !panicking.add(string(line)) {
+				c.logPanic(unlimited, panicking.result())
+				panicking = nil
+			}
+			if panicking == nil {
+				l.Debug(string(line))
+			}
 
 			// if we're finishing a continued line, add the newline back in
 			if !isPrefix {
@@ -1195,6 +1679,23 @@ func (c *Client) logStderr(name string, r io.Reader) {
 		c.config.Stderr.Write([]byte{'\n'})
 
 		entry, err := parseJSON(line)
+
+		// A panic usually runs until stderr is closed as the plugin exits. A
+		// JSON log line means the plugin is still running, so whatever looked
+		// like a panic has ended, as it has once a line doesn't fit in a
+		// goroutine dump. The line is then logged as usual.
+		if panicking != nil {
+			if err != nil && panicking.add(string(line)) {
+				continue
+			}
+			c.logPanic(unlimited, panicking.result())
+			panicking = nil
+		}
+		if err != nil && isPanicStart(string(line)) {
+			panicking = newPanicParser(string(line))
+			continue
+		}
+
 		// If output is not JSON format, print directly to Debug
 		if err != nil {
 			// Attempt to infer the desired log level from the commonly used
@@ -16,6 +16,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"sync"
 	"testing"
@@ -24,6 +25,9 @@ import (
 	"github.com/hashicorp/go-hclog"
 	"github.com/hashicorp/go-plugin/internal/cmdrunner"
 	"github.com/hashicorp/go-plugin/runner"
+	grpctest "github.com/hashicorp/go-plugin/test/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 func TestClient(t *testing.T) {
@@ -389,6 +393,251 @@ func testClient_grpcSyncStdio(t *testing.T, useRunnerFunc bool) {
 	}
 }
 
+func TestClient_SyncStdin(t *testing.T) {
+	for name, plugins := range map[string]map[string]Plugin{
+		"netrpc": testPluginMap,
+		"grpc":   testGRPCPluginMap,
+	} {
+		t.Run(name, func(t *testing.T) {
+			var syncOut safeBuffer
+			c := NewClient(&ClientConfig{
+				Cmd:              helperProcess("stdin-echo", name),
+				HandshakeConfig:  testHandshake,
+				Plugins:          plugins,
+				AllowedProtocols: []Protocol{ProtocolNetRPC, ProtocolGRPC},
+				SyncStdin:        strings.NewReader("hello\nworld\n"),
+				SyncStdout:       &syncOut,
+			})
+			defer c.Kill()
+
+			client, err := c.Client()
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			if !c.serverCapabilities.Bool(capabilitySyncStdin) {
+				t.Fatal("expected the plugin to accept stdin")
+			}
+			raw, err := client.Dispense("test")
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
+
+			// The plugin reads stdin until EOF, so this only returns once
+			// all of it was forwarded and the plugin's stdin was closed.
+			raw.(testInterface).PrintStdio(nil, nil)
+
+			waitForOutput(t, &syncOut, "stdin: hello\nworld\n")
+		})
+	}
+}
+
+// A net/rpc client reattaching to a plugin that accepts stdin doesn't forward
+// it, and must be served all the same.
+func TestClient_SyncStdinReattachNetRPC(t *testing.T) {
+	c := NewClient(&ClientConfig{
+		Cmd:             helperProcess("stdin-echo"),
+		HandshakeConfig: testHandshake,
+		Plugins:         testPluginMap,
+		SyncStdin:       strings.NewReader("hello\n"),
+	})
+	defer c.Kill()
+
+	if _, err := c.Client(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !c.serverCapabilities.Bool(capabilitySyncStdin) {
+		t.Fatal("expected the plugin to accept stdin")
+	}
+
+	c = NewClient(&ClientConfig{
+		Reattach:        c.ReattachConfig(),
+		HandshakeConfig: testHandshake,
+		Plugins:         testPluginMap,
+		SyncStdin:       strings.NewReader("ignored\n"),
+	})
+	defer c.Kill()
+
+	client, err := c.Client()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := PingContext(ctx, client); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	raw, err := DispenseContext(ctx, client, "test")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if v := raw.(testInterface).Double(21); v != 42 {
+		t.Fatalf("bad: %d", v)
+	}
+}
+
+func TestClient_grpcStdioResume(t *testing.T) {
+	var syncOut safeBuffer
+	c := NewClient(&ClientConfig{
+		Cmd:              helperProcess("test-grpc"),
+		HandshakeConfig:  testHandshake,
+		Plugins:          testGRPCPluginMap,
+		AllowedProtocols: []Protocol{ProtocolGRPC},
+		SyncStdout:       &syncOut,
+	})
+	defer c.Kill()
+
+	client, err := c.Client()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	raw, err := client.Dispense("test")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	raw.(testInterface).PrintStdio([]byte("first"), nil)
+	waitForOutput(t, &syncOut, "first")
+
+	if sequence := c.ReattachConfig().StdioSequence; sequence != 1 {
+		t.Fatalf("bad: %d", sequence)
+	}
+
+	// A client reattaching from the start gets what was already sent
+	// replayed, and one resuming from the sequence number doesn't. The
+	// original client keeps receiving everything.
+	sent := "first"
+	for _, name := range []string{"replay", "resume"} {
+		t.Run(name, func(t *testing.T) {
+			reattach := c.ReattachConfig()
+			expected := name
+			if name == "replay" {
+				reattach.StdioSequence = 0
+				expected = sent + name
+			}
+
+			var syncOut safeBuffer
+			c := NewClient(&ClientConfig{
+				Reattach:         reattach,
+				HandshakeConfig:  testHandshake,
+				Plugins:          testGRPCPluginMap,
+				AllowedProtocols: []Protocol{ProtocolGRPC},
+				SyncStdout:       &syncOut,
+			})
+
+			client, err := c.Client()
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			raw, err := client.Dispense("test")
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			raw.(testInterface).PrintStdio([]byte(name), nil)
+			waitForOutput(t, &syncOut, expected)
+		})
+
+		sent += name
+		waitForOutput(t, &syncOut, sent)
+	}
+}
+
+// waitForOutput waits for buf to contain exactly expected.
+func waitForOutput(t *testing.T, buf *safeBuffer, expected string) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for buf.String() != expected && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if buf.String() != expected {
+		t.Fatalf("expected %q, got %q", expected, buf.String())
+	}
+}
+
+func TestClient_metrics(t *testing.T) {
+	for name, tc := range map[string]struct {
+		plugins map[string]Plugin
+		method  string
+	}{
+		"netrpc": {testPluginMap, "Plugin.Double"},
+		"grpc":   {testGRPCPluginMap, "/grpctest.Test/Double"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			sink := &InmemMetricsSink{}
+			process := helperProcess("test-log-level", name)
+			c := NewClient(&ClientConfig{
+				Cmd:              process,
+				HandshakeConfig:  testHandshake,
+				Plugins:          tc.plugins,
+				AllowedProtocols: []Protocol{ProtocolNetRPC, ProtocolGRPC},
+				Metrics:          &MetricsConfig{Sink: sink},
+			})
+			defer c.Kill()
+
+			client, err := c.Client()
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			raw, err := client.Dispense("test")
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			raw.(testInterface).Double(21)
+
+			calls := findCalls(sink, MetricsSideClient, tc.method)
+			if len(calls) != 1 {
+				t.Fatalf("bad: %#v", sink.Calls())
+			}
+			if calls[0].Plugin != filepath.Base(process.Path) || calls[0].Protocol != c.Protocol() || calls[0].Code != "OK" {
+				t.Fatalf("bad: %#v", calls[0])
+			}
+		})
+	}
+}
+
+func TestClient_tracing(t *testing.T) {
+	for name, plugins := range map[string]map[string]Plugin{
+		"netrpc": testPluginMap,
+		"grpc":   testGRPCPluginMap,
+	} {
+		t.Run(name, func(t *testing.T) {
+			spans := &InmemSpanExporter{}
+			c := NewClient(&ClientConfig{
+				Cmd:              helperProcess("test-log-level", name),
+				HandshakeConfig:  testHandshake,
+				Plugins:          plugins,
+				AllowedProtocols: []Protocol{ProtocolNetRPC, ProtocolGRPC},
+				Tracing:          &TracingConfig{Exporter: spans},
+			})
+			defer c.Kill()
+
+			ctx := ContextWithTraceContext(context.Background(), testTraceContext)
+			if _, err := c.StartContext(ctx); err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			client, err := c.Client()
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			if _, err := DispenseContext(ctx, client, "test"); err != nil {
+				t.Fatalf("err: %s", err)
+			}
+
+			for _, name := range []string{"plugin.handshake", "plugin.dispense"} {
+				found := findSpans(spans, name)
+				if len(found) != 1 {
+					t.Fatalf("bad: %#v", spans.Spans())
+				}
+				if s := found[0]; s.TraceContext.TraceID != testTraceContext.TraceID || s.ParentSpanID != testTraceContext.SpanID || s.Err != nil {
+					t.Fatalf("bad: %#v", s)
+				}
+			}
+			if v := findSpans(spans, "plugin.handshake")[0].Attributes["plugin.protocol"]; v != string(c.Protocol()) {
+				t.Fatalf("bad: %s", v)
+			}
+		})
+	}
+}
+
 func TestClient_cmdAndReattach(t *testing.T) {
 	config := &ClientConfig{
 		Cmd:      helperProcess("start-timeout"),
@@ -670,59 +919,587 @@ func TestClientStart_badNegotiatedVersion(t *testing.T) {
 	c := NewClient(config)
 	defer c.Kill()
 
-	_, err := c.Start()
-	if err == nil {
-		t.Fatal("err should not be nil")
+	_, err := c.Start()
+	if err == nil {
+		t.Fatal("err should not be nil")
+	}
+	fmt.Println(err)
+}
+
+func TestClient_Start_Timeout(t *testing.T) {
+	config := &ClientConfig{
+		Cmd:             helperProcess("start-timeout"),
+		StartTimeout:    50 * time.Millisecond,
+		HandshakeConfig: testHandshake,
+		Plugins:         testPluginMap,
+	}
+
+	c := NewClient(config)
+	defer c.Kill()
+
+	_, err := c.Start()
+	if err == nil {
+		t.Fatal("err should not be nil")
+	}
+}
+
+func TestClient_StartContext_cancel(t *testing.T) {
+	config := &ClientConfig{
+		Cmd:             helperProcess("start-timeout"),
+		StartTimeout:    time.Minute,
+		HandshakeConfig: testHandshake,
+		Plugins:         testPluginMap,
+	}
+
+	c := NewClient(config)
+	defer c.Kill()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := c.StartContext(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("bad: %v", err)
+	}
+	if time.Since(start) > 10*time.Second {
+		t.Fatal("start should have been cancelled")
+	}
+}
+
+func TestClient_Stderr(t *testing.T) {
+	stderr := new(bytes.Buffer)
+	process := helperProcess("stderr")
+	c := NewClient(&ClientConfig{
+		Cmd:             process,
+		Stderr:          stderr,
+		HandshakeConfig: testHandshake,
+		Plugins:         testPluginMap,
+	})
+	defer c.Kill()
+
+	if _, err := c.Start(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	for !c.Exited() {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if c.killed() {
+		t.Fatal("process failed to exit gracefully")
+	}
+
+	if !strings.Contains(stderr.String(), "HELLO\n") {
+		t.Fatalf("bad log data: '%s'", stderr.String())
+	}
+
+	if !strings.Contains(stderr.String(), "WORLD\n") {
+		t.Fatalf("bad log data: '%s'", stderr.String())
+	}
+}
+
+// testLogSink records the entries logged to an hclog.InterceptLogger.
+type testLogSink struct {
+	l       sync.Mutex
+	entries []testLogSinkEntry
+}
+
+type testLogSinkEntry struct {
+	name  string
+	level hclog.Level
+	msg   string
+	args  map[string]interface{}
+}
+
+func (s *testLogSink) Accept(name string, level hclog.Level, msg string, args ...interface{}) {
+	entry := testLogSinkEntry{name: name, level: level, msg: msg, args: map[string]interface{}{}}
+	for i := 0; i+1 < len(args); i += 2 {
+		entry.args[args[i].(string)] = args[i+1]
+	}
+
+	s.l.Lock()
+	defer s.l.Unlock()
+	s.entries = append(s.entries, entry)
+}
+
+// find returns the entries with the given message.
+func (s *testLogSink) find(msg string) []testLogSinkEntry {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	var result []testLogSinkEntry
+	for _, e := range s.entries {
+		if e.msg == msg {
+			result = append(result, e)
+		}
+	}
+	return result
+}
+
+func TestClient_grpcLogSink(t *testing.T) {
+	sink := &testLogSink{}
+	logger := hclog.NewInterceptLogger(&hclog.LoggerOptions{
+		Level:  hclog.Trace,
+		Output: io.Discard,
+	})
+	logger.RegisterSink(sink)
+
+	c := NewClient(&ClientConfig{
+		Cmd:              helperProcess("test-grpc-log"),
+		HandshakeConfig:  testHandshake,
+		Plugins:          testGRPCPluginMap,
+		AllowedProtocols: []Protocol{ProtocolGRPC},
+		Logger:           logger,
+	})
+	defer c.Kill()
+
+	client, err := c.Client()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if c.ServerCapabilities()[capabilityGRPCLogSink] != "true" {
+		t.Fatalf("bad: %#v", c.ServerCapabilities())
+	}
+
+	raw, err := client.Dispense("test")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	impl := raw.(testInterface)
+
+	// Entries longer than PluginLogBufferSize, which would be split up on
+	// stderr, come through whole.
+	long := strings.Repeat("x", 2*defaultPluginLogBufferSize)
+	impl.PrintKV("count", 42)
+	impl.PrintKV("long", long)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(sink.find("PrintKV called")) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("entries were not streamed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Wait for the plugin to exit, so anything it wrote to stderr has been
+	// logged too.
+	c.Kill()
+
+	entries := sink.find("PrintKV called")
+	if len(entries) != 2 {
+		t.Fatalf("expected each entry once, got %d", len(entries))
+	}
+	if entries[0].level != hclog.Info || !strings.HasSuffix(entries[0].name, "go-plugin.test") {
+		t.Fatalf("bad: %#v", entries[0])
+	}
+
+	// Numbers keep their type, rather than becoming float64 as they would
+	// when parsed from JSON.
+	if v := entries[0].args["count"]; v != int64(42) {
+		t.Fatalf("bad: %#v", v)
+	}
+	if v := entries[1].args["long"]; v != long {
+		t.Fatalf("bad: %d bytes", len(v.(string)))
+	}
+}
+
+func TestClient_grpcLogSinkDefaultLogger(t *testing.T) {
+	sink := &testLogSink{}
+	logger := hclog.NewInterceptLogger(&hclog.LoggerOptions{
+		Level:  hclog.Trace,
+		Output: io.Discard,
+	})
+	logger.RegisterSink(sink)
+
+	c := NewClient(&ClientConfig{
+		Cmd:              helperProcess("test-grpc-default-log"),
+		HandshakeConfig:  testHandshake,
+		Plugins:          testGRPCPluginMap,
+		AllowedProtocols: []Protocol{ProtocolGRPC},
+		Logger:           logger,
+	})
+	defer c.Kill()
+
+	if _, err := c.Client(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if c.ServerCapabilities()[capabilityGRPCLogSink] != "true" {
+		t.Fatalf("bad: %#v", c.ServerCapabilities())
+	}
+
+	// The plugin logs its address before it is connected to, so the entry is
+	// buffered and streamed.
+	deadline := time.Now().Add(5 * time.Second)
+	for len(sink.find("plugin address")) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("entries were not streamed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	c.Kill()
+
+	entries := sink.find("plugin address")
+	if len(entries) != 1 {
+		t.Fatalf("expected the entry once, got %d", len(entries))
+	}
+	if _, ok := entries[0].args["network"].(string); !ok {
+		t.Fatalf("bad: %#v", entries[0])
+	}
+	if c.DroppedLogLines() != 0 {
+		t.Fatalf("bad: %d", c.DroppedLogLines())
+	}
+}
+
+func TestClient_SetLogLevel(t *testing.T) {
+	for name, plugins := range map[string]map[string]Plugin{
+		"netrpc": testPluginMap,
+		"grpc":   testGRPCPluginMap,
+	} {
+		t.Run(name, func(t *testing.T) {
+			sink := &testLogSink{}
+			logger := hclog.NewInterceptLogger(&hclog.LoggerOptions{
+				Level:  hclog.Trace,
+				Output: io.Discard,
+			})
+			logger.RegisterSink(sink)
+
+			c := NewClient(&ClientConfig{
+				Cmd:              helperProcess("test-log-level", name),
+				HandshakeConfig:  testHandshake,
+				Plugins:          plugins,
+				AllowedProtocols: []Protocol{ProtocolNetRPC, ProtocolGRPC},
+				Logger:           logger,
+			})
+			defer c.Kill()
+
+			client, err := c.Client()
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			raw, err := client.Dispense("test")
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			impl := raw.(testInterface)
+
+			// PrintKV logs at info, which the plugin filters out until its
+			// level is lowered.
+			impl.PrintKV("before", "hidden")
+			if err := c.SetLogLevel(hclog.Info); err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			impl.PrintKV("after", "shown")
+
+			if err := c.SetLogLevel(hclog.NoLevel); err == nil {
+				t.Fatal("expected an error for an invalid level")
+			}
+
+			// Wait for the plugin to exit, so everything it wrote to stderr
+			// has been logged.
+			c.Kill()
+
+			entries := sink.find("PrintKV called")
+			if len(entries) != 1 || entries[0].args["after"] != "shown" {
+				t.Fatalf("bad: %#v", entries)
+			}
+			if len(sink.find("plugin log level changed")) != 1 {
+				t.Fatal("expected the plugin to log the change")
+			}
+		})
+	}
+}
+
+func TestClient_LogRateLimit(t *testing.T) {
+	sink := &testLogSink{}
+	logger := hclog.NewInterceptLogger(&hclog.LoggerOptions{
+		Level:  hclog.Trace,
+		Output: io.Discard,
+	})
+	logger.RegisterSink(sink)
+
+	c := NewClient(&ClientConfig{
+		Cmd:             helperProcess("stderr-flood"),
+		HandshakeConfig: testHandshake,
+		Plugins:         testPluginMap,
+		Logger:          logger,
+		LogRateLimit: &LogRateLimit{
+			Rate:               1,
+			Burst:              5,
+			CollapseDuplicates: true,
+		},
+	})
+	defer c.Kill()
+
+	if _, err := c.Start(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	for !c.Exited() {
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.Kill()
+
+	// The repeated errors are collapsed, and don't use up the error bucket.
+	if len(sink.find("[ERROR] same")) != 1 || len(sink.find("message repeated 49 times")) != 1 {
+		t.Fatalf("bad: %#v", sink.entries)
+	}
+
+	// Only the burst of info lines is let through, give or take one that
+	// the bucket refilled with while they were read.
+	dropped := c.DroppedLogLines()
+	if dropped < 44 || dropped > 45 {
+		t.Fatalf("bad: %d", dropped)
+	}
+	summary := sink.find("plugin log entries were dropped by the rate limit")
+	if len(summary) != 1 || summary[0].args["dropped"] != dropped {
+		t.Fatalf("bad: %#v", summary)
+	}
+}
+
+func TestClient_ExitStatus(t *testing.T) {
+	cases := map[string]struct {
+		helper   string
+		exitCode int
+		stderr   string
+		panic    string
+		message  string
+	}{
+		"exit code": {"exit-code", 3, "exiting", "", "plugin exited with code 3"},
+		"panic":     {"panic", 2, "about to panic", "panic: oh no", "plugin exited with code 2: panic: oh no"},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			exitCh := make(chan *PluginExitError, 1)
+			c := NewClient(&ClientConfig{
+				Cmd:             helperProcess(tc.helper),
+				HandshakeConfig: testHandshake,
+				Plugins:         testPluginMap,
+				OnExit: func(exitErr *PluginExitError) {
+					exitCh <- exitErr
+				},
+			})
+			defer c.Kill()
+
+			if c.ExitStatus() != nil {
+				t.Fatal("should have no exit status before starting")
+			}
+			if _, err := c.Start(); err != nil {
+				t.Fatalf("err: %s", err)
+			}
+
+			var exitErr *PluginExitError
+			select {
+			case exitErr = <-exitCh:
+			case <-time.After(5 * time.Second):
+				t.Fatal("OnExit was not called")
+			}
+			if exitErr == nil || exitErr != c.ExitStatus() {
+				t.Fatalf("bad: %#v", exitErr)
+			}
+
+			if exitErr.ExitCode != tc.exitCode {
+				t.Fatalf("bad exit code: %d", exitErr.ExitCode)
+			}
+			if len(exitErr.Stderr) == 0 || exitErr.Stderr[0] != tc.stderr {
+				t.Fatalf("bad stderr: %#v", exitErr.Stderr)
+			}
+			if exitErr.Panic != c.Panic() || (tc.panic == "") != (exitErr.Panic == nil) {
+				t.Fatalf("bad panic: %#v", exitErr.Panic)
+			}
+			if exitErr.Panic != nil && exitErr.Panic.String() != tc.panic {
+				t.Fatalf("bad panic: %s", exitErr.Panic)
+			}
+			if exitErr.Panic != nil && !strings.Contains(exitErr.Panic.TopFrame, "TestHelperProcess") {
+				t.Fatalf("bad top frame: %s", exitErr.Panic.TopFrame)
+			}
+			if exitErr.Error() != tc.message {
+				t.Fatalf("bad message: %s", exitErr.Error())
+			}
+			if exitErr.Runtime <= 0 {
+				t.Fatalf("bad runtime: %s", exitErr.Runtime)
+			}
+
+			var cmdErr *exec.ExitError
+			if !errors.As(exitErr, &cmdErr) {
+				t.Fatalf("should unwrap to the runner error: %#v", exitErr.Err)
+			}
+		})
+	}
+}
+
+func TestClient_ExitStatus_success(t *testing.T) {
+	exitCh := make(chan *PluginExitError, 1)
+	c := NewClient(&ClientConfig{
+		Cmd:             helperProcess("stderr"),
+		HandshakeConfig: testHandshake,
+		Plugins:         testPluginMap,
+		OnExit: func(exitErr *PluginExitError) {
+			exitCh <- exitErr
+		},
+	})
+	defer c.Kill()
+
+	if _, err := c.Start(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	select {
+	case exitErr := <-exitCh:
+		if exitErr != nil {
+			t.Fatalf("bad: %#v", exitErr)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("OnExit was not called")
+	}
+	if c.ExitStatus() != nil {
+		t.Fatalf("bad: %#v", c.ExitStatus())
 	}
-	fmt.Println(err)
 }
 
-func TestClient_Start_Timeout(t *testing.T) {
-	config := &ClientConfig{
-		Cmd:             helperProcess("start-timeout"),
-		StartTimeout:    50 * time.Millisecond,
-		HandshakeConfig: testHandshake,
-		Plugins:         testPluginMap,
-	}
+func TestClient_gracefulShutdown(t *testing.T) {
+	for _, protocol := range []Protocol{ProtocolNetRPC, ProtocolGRPC} {
+		t.Run(string(protocol), func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "output")
 
-	c := NewClient(config)
-	defer c.Kill()
+			plugins := testPluginMap
+			if protocol == ProtocolGRPC {
+				plugins = testGRPCPluginMap
+			}
 
-	_, err := c.Start()
-	if err == nil {
-		t.Fatal("err should not be nil")
+			c := NewClient(&ClientConfig{
+				Cmd:                     helperProcess("shutdown-hook", path, string(protocol)),
+				HandshakeConfig:         testHandshake,
+				Plugins:                 plugins,
+				AllowedProtocols:        []Protocol{protocol},
+				GracefulShutdownTimeout: 5 * time.Second,
+			})
+
+			if _, err := c.Client(); err != nil {
+				t.Fatalf("err: %s", err)
+			}
+
+			c.Kill()
+			if c.killed() {
+				t.Fatal("process failed to exit gracefully")
+			}
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("shutdown hook did not run: %s", err)
+			}
+			if string(data) != "foo" {
+				t.Fatalf("bad: %s", data)
+			}
+		})
 	}
 }
 
-func TestClient_Stderr(t *testing.T) {
-	stderr := new(bytes.Buffer)
-	process := helperProcess("stderr")
+func TestClient_gracefulShutdownInFlight(t *testing.T) {
 	c := NewClient(&ClientConfig{
-		Cmd:             process,
-		Stderr:          stderr,
-		HandshakeConfig: testHandshake,
-		Plugins:         testPluginMap,
+		Cmd:                     helperProcess("test-grpc-slow"),
+		HandshakeConfig:         testHandshake,
+		Plugins:                 testGRPCPluginMap,
+		AllowedProtocols:        []Protocol{ProtocolGRPC},
+		GracefulShutdownTimeout: 5 * time.Second,
 	})
-	defer c.Kill()
 
-	if _, err := c.Start(); err != nil {
+	client, err := c.Client()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	raw, err := client.Dispense("test")
+	if err != nil {
 		t.Fatalf("err: %s", err)
 	}
 
-	for !c.Exited() {
-		time.Sleep(10 * time.Millisecond)
+	type result struct {
+		resp *grpctest.TestResponse
+		err  error
 	}
+	resultCh := make(chan result, 1)
+	go func() {
+		resp, err := raw.(*testGRPCClient).Client.Double(context.Background(), &grpctest.TestRequest{Input: 21})
+		resultCh <- result{resp, err}
+	}()
 
+	// Let the call reach the plugin before it's asked to exit.
+	time.Sleep(200 * time.Millisecond)
+	c.Kill()
 	if c.killed() {
 		t.Fatal("process failed to exit gracefully")
 	}
 
-	if !strings.Contains(stderr.String(), "HELLO\n") {
-		t.Fatalf("bad log data: '%s'", stderr.String())
+	r := <-resultCh
+	if r.err != nil {
+		t.Fatalf("in-flight call failed: %s", r.err)
 	}
+	if r.resp.Output != 42 {
+		t.Fatalf("bad: %d", r.resp.Output)
+	}
+}
 
-	if !strings.Contains(stderr.String(), "WORLD\n") {
-		t.Fatalf("bad log data: '%s'", stderr.String())
+// Kill gives a plugin that doesn't exit GracefulShutdownTimeout in all, not
+// once to exit on its own and again once terminated.
+func TestClient_killTimeout(t *testing.T) {
+	const timeout = time.Second
+	c := NewClient(&ClientConfig{
+		Cmd:                     helperProcess("test-grpc-stubborn"),
+		HandshakeConfig:         testHandshake,
+		Plugins:                 testGRPCPluginMap,
+		AllowedProtocols:        []Protocol{ProtocolGRPC},
+		GracefulShutdownTimeout: timeout,
+	})
+
+	if _, err := c.Client(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	start := time.Now()
+	c.Kill()
+	if d := time.Since(start); d > timeout+timeout/2 {
+		t.Fatalf("kill took %s", d)
+	}
+	if !c.killed() {
+		t.Fatal("expected the process to be killed")
+	}
+}
+
+func TestClient_metadata(t *testing.T) {
+	for _, protocol := range []Protocol{ProtocolNetRPC, ProtocolGRPC} {
+		t.Run(string(protocol), func(t *testing.T) {
+			plugins := testPluginMap
+			if protocol == ProtocolGRPC {
+				plugins = testGRPCPluginMap
+			}
+
+			c := NewClient(&ClientConfig{
+				Cmd:              helperProcess("metadata", string(protocol)),
+				HandshakeConfig:  testHandshake,
+				Plugins:          plugins,
+				AllowedProtocols: []Protocol{protocol},
+			})
+			defer c.Kill()
+
+			m, err := c.Metadata()
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
+
+			if m.Name != "test" || m.Version != "1.2.3" || m.Author != "HashiCorp" {
+				t.Fatalf("bad: %#v", m)
+			}
+			if !m.HasCapability("double") || m.HasCapability("triple") {
+				t.Fatalf("bad capabilities: %#v", m.Capabilities)
+			}
+			if m.Extra["foo"] != "bar" {
+				t.Fatalf("bad extra: %#v", m.Extra)
+			}
+			if m.BuildInfo["go.version"] == "" {
+				t.Fatalf("build info should be filled in: %#v", m.BuildInfo)
+			}
+		})
 	}
 }
 
@@ -913,6 +1690,7 @@ func TestClient_RequestGRPCMultiplexing_UnsupportedByPlugin(t *testing.T) {
 	for _, name := range []string{
 		"mux-grpc-with-old-plugin",
 		"mux-grpc-with-unsupported-plugin",
+		"mux-grpc-with-unsupported-plugin-capabilities",
 	} {
 		t.Run(name, func(t *testing.T) {
 			process := helperProcess(name)
@@ -937,6 +1715,26 @@ func TestClient_RequestGRPCMultiplexing_UnsupportedByPlugin(t *testing.T) {
 	}
 }
 
+func TestClient_ServerCapabilities(t *testing.T) {
+	process := helperProcess("test-grpc")
+	c := NewClient(&ClientConfig{
+		Cmd:              process,
+		HandshakeConfig:  testHandshake,
+		Plugins:          testGRPCPluginMap,
+		AllowedProtocols: []Protocol{ProtocolGRPC},
+	})
+	defer c.Kill()
+
+	if _, err := c.Start(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	caps := c.ServerCapabilities()
+	if caps[capabilityGRPCBrokerMultiplex] != "true" {
+		t.Fatalf("bad: %#v", caps)
+	}
+}
+
 func TestClient_SecureConfig(t *testing.T) {
 	// Test failure case
 	secureConfig := &SecureConfig{
@@ -993,6 +1791,208 @@ func TestClient_SecureConfig(t *testing.T) {
 	if err != nil {
 		t.Fatalf("err should be nil, got %s", err)
 	}
+
+	// The config can be reused for another client
+	c2 := NewClient(&ClientConfig{
+		Cmd:             helperProcess("test-interface"),
+		HandshakeConfig: testHandshake,
+		Plugins:         testPluginMap,
+		SecureConfig:    secureConfig,
+	})
+	defer c2.Kill()
+
+	_, err = c2.Client()
+	if err != nil {
+		t.Fatalf("err should be nil, got %s", err)
+	}
+}
+
+func TestClient_SealedExec(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		c := NewClient(&ClientConfig{
+			Cmd:             helperProcess("test-interface"),
+			HandshakeConfig: testHandshake,
+			Plugins:         testPluginMap,
+			SealedExec:      true,
+		})
+		defer c.Kill()
+
+		if _, err := c.Client(); !errors.Is(err, ErrSealedExecNotSupported) {
+			t.Fatalf("err should be %s, got %s", ErrSealedExecNotSupported, err)
+		}
+		return
+	}
+
+	// Test failure case
+	c := NewClient(&ClientConfig{
+		Cmd:             helperProcess("test-interface"),
+		HandshakeConfig: testHandshake,
+		Plugins:         testPluginMap,
+		SecureConfig: &SecureConfig{
+			Checksum: []byte{'1'},
+			Hash:     sha256.New(),
+		},
+		SealedExec: true,
+	})
+	_, err := c.Client()
+	c.Kill()
+	if err != ErrChecksumsDoNotMatch {
+		t.Fatalf("err should be %s, got %s", ErrChecksumsDoNotMatch, err)
+	}
+
+	data, err := os.ReadFile(os.Args[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(data)
+
+	process := helperProcess("test-interface")
+	c = NewClient(&ClientConfig{
+		Cmd:             process,
+		HandshakeConfig: testHandshake,
+		Plugins:         testPluginMap,
+		SecureConfig: &SecureConfig{
+			Checksum: sum[:],
+			Hash:     sha256.New(),
+		},
+		SealedExec: true,
+	})
+	defer c.Kill()
+
+	client, err := c.Client()
+	if err != nil {
+		t.Fatalf("err should be nil, got %s", err)
+	}
+
+	raw, err := client.Dispense("test")
+	if err != nil {
+		t.Fatalf("err should be nil, got %s", err)
+	}
+	if v := raw.(testInterface).Double(21); v != 42 {
+		t.Fatalf("bad: %#v", v)
+	}
+
+	// The runner still reports the original executable.
+	if name := c.runner.(runner.Runner).Name(); name != os.Args[0] {
+		t.Fatalf("bad: %s", name)
+	}
+}
+
+func TestClient_Sandbox(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		c := NewClient(&ClientConfig{
+			Cmd:             helperProcess("test-interface"),
+			HandshakeConfig: testHandshake,
+			Plugins:         testPluginMap,
+			Sandbox:         &SandboxConfig{},
+		})
+		defer c.Kill()
+
+		if _, err := c.Client(); !errors.Is(err, ErrSandboxNotSupported) {
+			t.Fatalf("err should be %s, got %s", ErrSandboxNotSupported, err)
+		}
+		return
+	}
+
+	for name, tc := range map[string]struct {
+		helper    string
+		plugins   map[string]Plugin
+		protocols []Protocol
+	}{
+		"netrpc": {"test-interface", testPluginMap, []Protocol{ProtocolNetRPC}},
+		"grpc":   {"test-grpc", testGRPCPluginMap, []Protocol{ProtocolGRPC}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			process := helperProcess(tc.helper)
+			c := NewClient(&ClientConfig{
+				Cmd:              process,
+				HandshakeConfig:  testHandshake,
+				Plugins:          tc.plugins,
+				AllowedProtocols: tc.protocols,
+				Sandbox: &SandboxConfig{
+					OpenFiles: 256,
+					Seccomp:   true,
+				},
+			})
+			defer c.Kill()
+
+			client, err := c.Client()
+			if err != nil {
+				if strings.Contains(err.Error(), "operation not permitted") {
+					t.Skipf("namespaces are not available: %s", err)
+				}
+				t.Fatalf("err should be nil, got %s", err)
+			}
+
+			raw, err := client.Dispense("test")
+			if err != nil {
+				t.Fatalf("err should be nil, got %s", err)
+			}
+			if v := raw.(testInterface).Double(21); v != 42 {
+				t.Fatalf("bad: %#v", v)
+			}
+
+			// The plugin's socket is in the host's socket directory.
+			addr := c.ReattachConfig().Addr
+			if addr.Network() != "unix" || filepath.Dir(addr.String()) != c.unixSocketCfg.socketDir {
+				t.Fatalf("bad: %s", addr)
+			}
+		})
+	}
+}
+
+func TestClient_ResourceUsage(t *testing.T) {
+	c := NewClient(&ClientConfig{
+		Cmd:             helperProcess("test-interface"),
+		HandshakeConfig: testHandshake,
+		Plugins:         testPluginMap,
+	})
+	defer c.Kill()
+
+	if _, err := c.Client(); err != nil {
+		t.Fatalf("err should be nil, got %s", err)
+	}
+	if _, err := c.ResourceUsage(); err != ErrResourceUsageNotAvailable {
+		t.Fatalf("err should be %s, got %s", ErrResourceUsageNotAvailable, err)
+	}
+
+	// Use a fake cgroupfs, which the plugin is "moved" into but which
+	// reports whatever the test writes to it.
+	parent := t.TempDir()
+	c2 := NewClient(&ClientConfig{
+		Cmd:             helperProcess("test-interface"),
+		HandshakeConfig: testHandshake,
+		Plugins:         testPluginMap,
+		Cgroup:          &CgroupConfig{Parent: parent},
+	})
+	defer c2.Kill()
+
+	if _, err := c2.Client(); err != nil {
+		t.Fatalf("err should be nil, got %s", err)
+	}
+
+	dirs, err := filepath.Glob(filepath.Join(parent, "plugin-*"))
+	if err != nil || len(dirs) != 1 {
+		t.Fatalf("bad: %v %v", dirs, err)
+	}
+	procs, err := os.ReadFile(filepath.Join(dirs[0], "cgroup.procs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(procs) != c2.runner.ID() {
+		t.Fatalf("bad: %q", procs)
+	}
+
+	if err := os.WriteFile(filepath.Join(dirs[0], "memory.current"), []byte("4096\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	usage, err := c2.ResourceUsage()
+	if err != nil {
+		t.Fatalf("err should be nil, got %s", err)
+	}
+	if usage.MemoryCurrent != 4096 {
+		t.Fatalf("bad: %#v", usage)
+	}
 }
 
 func TestClient_TLS(t *testing.T) {
@@ -1162,6 +2162,82 @@ func TestClient_ping(t *testing.T) {
 	}
 }
 
+func TestClient_grpcDialCancelled(t *testing.T) {
+	c := NewClient(&ClientConfig{
+		Cmd:              helperProcess("test-grpc"),
+		HandshakeConfig:  testHandshake,
+		Plugins:          testGRPCPluginMap,
+		AllowedProtocols: []Protocol{ProtocolGRPC},
+	})
+	defer c.Kill()
+
+	if _, err := c.Start(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The plugin is running, so only dialing it is left to cancel.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := c.ClientContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("bad: %v", err)
+	}
+
+	client, err := c.Client()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := client.Ping(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestClient_contextCancelled(t *testing.T) {
+	for name, tc := range map[string]struct {
+		cmd       *exec.Cmd
+		protocols []Protocol
+		plugins   map[string]Plugin
+	}{
+		"netrpc": {helperProcess("test-interface"), nil, testPluginMap},
+		"grpc":   {helperProcess("test-grpc"), []Protocol{ProtocolGRPC}, testGRPCPluginMap},
+	} {
+		t.Run(name, func(t *testing.T) {
+			c := NewClient(&ClientConfig{
+				Cmd:              tc.cmd,
+				HandshakeConfig:  testHandshake,
+				Plugins:          tc.plugins,
+				AllowedProtocols: tc.protocols,
+			})
+			defer c.Kill()
+
+			client, err := c.ClientContext(context.Background())
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
+
+			if err := PingContext(context.Background(), client); err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			raw, err := DispenseContext(context.Background(), client, "test")
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			if result := raw.(testInterface).Double(21); result != 42 {
+				t.Fatalf("bad: %#v", result)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			if err := PingContext(ctx, client); !errors.Is(err, context.Canceled) && status.Code(err) != codes.Canceled {
+				t.Fatalf("bad: %v", err)
+			}
+			if _, err := DispenseContext(ctx, client, "test"); !errors.Is(err, context.Canceled) {
+				t.Fatalf("bad: %v", err)
+			}
+		})
+	}
+}
+
 func TestClient_wrongVersion(t *testing.T) {
 	process := helperProcess("test-proto-upgraded-plugin")
 	c := NewClient(&ClientConfig{
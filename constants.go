@@ -13,4 +13,10 @@ const (
 	EnvUnixSocketGroup = "PLUGIN_UNIX_SOCKET_GROUP"
 
 	envMultiplexGRPC = "PLUGIN_MULTIPLEX_GRPC"
+
+	// envCoreProtocolVersions lists the core protocol versions the client can
+	// parse, and envClientCapabilities the capabilities it supports. See
+	// handshake.go.
+	envCoreProtocolVersions = "PLUGIN_CORE_PROTOCOL_VERSIONS"
+	envClientCapabilities   = "PLUGIN_CLIENT_CAPABILITIES"
 )
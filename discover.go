@@ -4,18 +4,28 @@
 package plugin
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 )
 
+// manifestSuffix is appended to a plugin's file name to get the path of its
+// sidecar manifest.
+const manifestSuffix = ".manifest.json"
+
 // Discover discovers plugins that are in a given directory.
 //
 // The directory doesn't need to be absolute. For example, "." will work fine.
 //
-// This currently assumes any file matching the glob is a plugin.
-// In the future this may be smarter about checking that a file is
-// executable and so on.
-//
-// TODO: test
+// This assumes any file matching the glob is a plugin. DiscoverPlugins
+// checks that files are executable and parses their names and versions.
 func Discover(glob, dir string) ([]string, error) {
 	var err error
 
@@ -29,3 +39,305 @@ func Discover(glob, dir string) ([]string, error) {
 
 	return filepath.Glob(filepath.Join(dir, glob))
 }
+
+// DiscoverConfig configures DiscoverPlugins.
+type DiscoverConfig struct {
+	// Paths are the directories to search for plugins. When the same version
+	// of a plugin is found in more than one directory, the one in the
+	// earliest directory wins. Directories that don't exist are skipped.
+	Paths []string
+
+	// Prefix is the prefix all plugin file names start with, for example
+	// "myapp-plugin-". Plugins are named "<prefix><name>_v<version>", where
+	// version is a semantic version, or "<prefix><name>" if they aren't
+	// versioned. On Windows, the executable extension is ignored.
+	Prefix string
+
+	// VersionedPlugins, if set, limits the results to plugins that speak at
+	// least one of the protocol versions in the map. This can be the same map
+	// as ClientConfig.VersionedPlugins. Only plugins with a manifest declare
+	// their protocol versions; others are assumed to be compatible.
+	VersionedPlugins map[int]PluginSet
+}
+
+// DiscoveredPlugin describes a plugin found by DiscoverPlugins.
+type DiscoveredPlugin struct {
+	// Name is the name of the plugin, without the prefix and version.
+	Name string
+
+	// Version is the semantic version of the plugin, or empty if it isn't
+	// versioned.
+	Version string
+
+	// Path is the absolute path to the plugin executable.
+	Path string
+
+	// ProtocolVersions are the application protocol versions the plugin
+	// speaks, if its manifest declares them.
+	ProtocolVersions []int
+
+	// Checksum is the SHA256 checksum of the executable, if its manifest
+	// declares it.
+	Checksum []byte
+}
+
+// pluginManifest is the format of the sidecar manifest, a JSON file next to
+// the plugin executable with the same name plus manifestSuffix. All fields
+// are optional and take precedence over what's parsed from the file name.
+type pluginManifest struct {
+	Name             string `json:"name"`
+	Version          string `json:"version"`
+	ProtocolVersions []int  `json:"protocol_versions"`
+	SHA256           string `json:"sha256"`
+}
+
+// ClientConfig returns a copy of the given configuration set up to launch
+// this plugin. If the plugin's manifest declares a checksum, the config also
+// verifies it before launching.
+func (p *DiscoveredPlugin) ClientConfig(base *ClientConfig) *ClientConfig {
+	config := *base
+	config.Cmd = exec.Command(p.Path)
+	if len(p.Checksum) > 0 {
+		config.SecureConfig = &SecureConfig{
+			Checksum: p.Checksum,
+			Hash:     sha256.New(),
+		}
+	}
+
+	return &config
+}
+
+// compatible returns true if the plugin speaks one of the given protocol
+// versions, or if either side didn't specify any.
+func (p *DiscoveredPlugin) compatible(versions map[int]PluginSet) bool {
+	if len(versions) == 0 || len(p.ProtocolVersions) == 0 {
+		return true
+	}
+
+	for _, v := range p.ProtocolVersions {
+		if _, ok := versions[v]; ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// DiscoverPlugins finds plugins in the configured search paths. Files that
+// don't start with the prefix, aren't executable or have an invalid name or
+// manifest are skipped. If several versions of a plugin are found, only the
+// newest compatible one is returned. The result is sorted by name.
+func DiscoverPlugins(config *DiscoverConfig) ([]*DiscoveredPlugin, error) {
+	if config.Prefix == "" {
+		return nil, fmt.Errorf("plugin prefix must be set")
+	}
+
+	found := make(map[string]*DiscoveredPlugin)
+	for _, dir := range config.Paths {
+		dir, err := filepath.Abs(dir)
+		if err != nil {
+			return nil, err
+		}
+
+		entries, err := os.ReadDir(dir)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for _, entry := range entries {
+			if !strings.HasPrefix(entry.Name(), config.Prefix) || strings.HasSuffix(entry.Name(), manifestSuffix) {
+				continue
+			}
+
+			p, err := discoverPlugin(filepath.Join(dir, entry.Name()), config.Prefix)
+			if err != nil || p == nil || !p.compatible(config.VersionedPlugins) {
+				continue
+			}
+
+			// Keep the newest version. Ties go to the earlier search path.
+			if existing, ok := found[p.Name]; ok && compareVersions(p.Version, existing.Version) <= 0 {
+				continue
+			}
+			found[p.Name] = p
+		}
+	}
+
+	result := make([]*DiscoveredPlugin, 0, len(found))
+	for _, p := range found {
+		result = append(result, p)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+
+	return result, nil
+}
+
+// discoverPlugin inspects a single file. It returns nil if the file isn't an
+// executable plugin.
+func discoverPlugin(path, prefix string) (*DiscoveredPlugin, error) {
+	// Stat rather than use the directory entry so that symlinks to plugins
+	// are followed.
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.Mode().IsRegular() || !isExecutable(path, fi) {
+		return nil, nil
+	}
+
+	name := strings.TrimPrefix(trimExecutableExt(filepath.Base(path)), prefix)
+	p := &DiscoveredPlugin{
+		Name: name,
+		Path: path,
+	}
+	if idx := strings.LastIndex(name, "_v"); idx >= 0 {
+		if _, ok := parseVersion(name[idx+2:]); ok {
+			p.Name = name[:idx]
+			p.Version = name[idx+2:]
+		}
+	}
+
+	data, err := os.ReadFile(path + manifestSuffix)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		var m pluginManifest
+		if err := json.Unmarshal(data, &m); err != nil {
+			return nil, fmt.Errorf("error parsing manifest for %s: %w", path, err)
+		}
+
+		if m.Name != "" {
+			p.Name = m.Name
+		}
+		if m.Version != "" {
+			p.Version = m.Version
+		}
+		p.ProtocolVersions = m.ProtocolVersions
+		if m.SHA256 != "" {
+			p.Checksum, err = hex.DecodeString(m.SHA256)
+			if err != nil {
+				return nil, fmt.Errorf("invalid checksum in manifest for %s: %w", path, err)
+			}
+		}
+	}
+
+	if p.Name == "" {
+		return nil, nil
+	}
+	if p.Version != "" {
+		if _, ok := parseVersion(p.Version); !ok {
+			return nil, fmt.Errorf("invalid version %q for %s", p.Version, path)
+		}
+	}
+
+	return p, nil
+}
+
+// semver is a parsed semantic version. Build metadata is dropped since it
+// doesn't affect precedence.
+type semver struct {
+	major, minor, patch int
+	pre                 []string
+}
+
+// parseVersion parses a semantic version such as "1.2.3" or "1.2.3-beta.1".
+// A leading "v" is allowed.
+func parseVersion(s string) (semver, bool) {
+	var v semver
+
+	s = strings.TrimPrefix(s, "v")
+	if idx := strings.IndexByte(s, '+'); idx >= 0 {
+		s = s[:idx]
+	}
+	if idx := strings.IndexByte(s, '-'); idx >= 0 {
+		v.pre = strings.Split(s[idx+1:], ".")
+		s = s[:idx]
+	}
+
+	parts := strings.Split(s, ".")
+	if len(parts) != 3 {
+		return v, false
+	}
+	nums := []*int{&v.major, &v.minor, &v.patch}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return v, false
+		}
+		*nums[i] = n
+	}
+
+	return v, true
+}
+
+// compareVersions compares two semantic versions, returning -1, 0 or 1. An
+// empty or invalid version is lower than any valid one.
+func compareVersions(a, b string) int {
+	va, okA := parseVersion(a)
+	vb, okB := parseVersion(b)
+	switch {
+	case !okA && !okB:
+		return 0
+	case !okA:
+		return -1
+	case !okB:
+		return 1
+	}
+
+	for _, c := range [][2]int{{va.major, vb.major}, {va.minor, vb.minor}, {va.patch, vb.patch}} {
+		if c[0] != c[1] {
+			return compareInts(c[0], c[1])
+		}
+	}
+
+	// A version without a pre-release is newer than one with.
+	switch {
+	case len(va.pre) == 0 && len(vb.pre) == 0:
+		return 0
+	case len(va.pre) == 0:
+		return 1
+	case len(vb.pre) == 0:
+		return -1
+	}
+
+	for i := 0; i < len(va.pre) && i < len(vb.pre); i++ {
+		if c := comparePrerelease(va.pre[i], vb.pre[i]); c != 0 {
+			return c
+		}
+	}
+
+	return compareInts(len(va.pre), len(vb.pre))
+}
+
+// comparePrerelease compares pre-release identifiers. Numeric identifiers
+// compare numerically and are lower than alphanumeric ones.
+func comparePrerelease(a, b string) int {
+	na, errA := strconv.Atoi(a)
+	nb, errB := strconv.Atoi(b)
+	switch {
+	case errA == nil && errB == nil:
+		return compareInts(na, nb)
+	case errA == nil:
+		return -1
+	case errB == nil:
+		return 1
+	}
+
+	return strings.Compare(a, b)
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,20 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+//go:build !windows
+// +build !windows
+
+package plugin
+
+import "os"
+
+// isExecutable returns true if any of the execute permission bits are set.
+func isExecutable(_ string, fi os.FileInfo) bool {
+	return fi.Mode().Perm()&0o111 != 0
+}
+
+// trimExecutableExt returns the name unchanged, since executables don't have
+// an extension outside of Windows.
+func trimExecutableExt(name string) string {
+	return name
+}
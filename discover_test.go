@@ -0,0 +1,142 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestDiscover(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"foo-a", "foo-b", "bar"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o755); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	actual, err := Discover("foo-*", dir)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := []string{filepath.Join(dir, "foo-a"), filepath.Join(dir, "foo-b")}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
+
+func TestDiscoverPlugins(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test relies on execute permission bits")
+	}
+
+	dir1, dir2 := t.TempDir(), t.TempDir()
+	files := []struct {
+		dir, name string
+		mode      os.FileMode
+		manifest  string
+	}{
+		{dir2, "app-plugin-foo_v1.0.0", 0o755, ""},
+		{dir2, "app-plugin-foo_v1.2.0", 0o755, ""},
+		{dir1, "app-plugin-foo_v1.2.0", 0o755, ""},
+		{dir1, "app-plugin-foo_v1.2.0-beta.1", 0o755, ""},
+		{dir1, "app-plugin-bar", 0o755, ""},
+		{dir1, "app-plugin-baz_v2.0.0", 0o644, ""},
+		{dir1, "other-tool", 0o755, ""},
+		{dir1, "app-plugin-qux_v3.0.0", 0o755, `{"protocol_versions": [9]}`},
+		{dir2, "app-plugin-qux-renamed", 0o755, `{"name": "qux", "version": "1.0.0", "protocol_versions": [1, 2], "sha256": "abcd"}`},
+	}
+	for _, f := range files {
+		path := filepath.Join(f.dir, f.name)
+		if err := os.WriteFile(path, nil, f.mode); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if f.manifest != "" {
+			if err := os.WriteFile(path+manifestSuffix, []byte(f.manifest), 0o644); err != nil {
+				t.Fatalf("err: %s", err)
+			}
+		}
+	}
+
+	actual, err := DiscoverPlugins(&DiscoverConfig{
+		Paths:  []string{dir1, dir2, filepath.Join(dir1, "missing")},
+		Prefix: "app-plugin-",
+		VersionedPlugins: map[int]PluginSet{
+			1: testPluginMap,
+		},
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := []*DiscoveredPlugin{
+		{
+			Name: "bar",
+			Path: filepath.Join(dir1, "app-plugin-bar"),
+		},
+		{
+			Name:    "foo",
+			Version: "1.2.0",
+			Path:    filepath.Join(dir1, "app-plugin-foo_v1.2.0"),
+		},
+		{
+			Name:             "qux",
+			Version:          "1.0.0",
+			Path:             filepath.Join(dir2, "app-plugin-qux-renamed"),
+			ProtocolVersions: []int{1, 2},
+			Checksum:         []byte{0xab, 0xcd},
+		},
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		for _, p := range actual {
+			t.Logf("%#v", p)
+		}
+		t.Fatal("bad plugins")
+	}
+
+	config := actual[2].ClientConfig(&ClientConfig{
+		HandshakeConfig: testHandshake,
+	})
+	if config.Cmd.Path != actual[2].Path {
+		t.Fatalf("bad cmd: %#v", config.Cmd)
+	}
+	if config.SecureConfig == nil || !reflect.DeepEqual(config.SecureConfig.Checksum, actual[2].Checksum) {
+		t.Fatalf("bad secure config: %#v", config.SecureConfig)
+	}
+	if config.MagicCookieKey != testHandshake.MagicCookieKey {
+		t.Fatal("config should be copied from the base")
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	cases := []struct {
+		a, b     string
+		expected int
+	}{
+		{"1.0.0", "1.0.0", 0},
+		{"1.0.0", "2.0.0", -1},
+		{"1.10.0", "1.9.0", 1},
+		{"v1.0.1", "1.0.0", 1},
+		{"1.0.0-beta", "1.0.0", -1},
+		{"1.0.0-alpha.1", "1.0.0-alpha.beta", -1},
+		{"1.0.0-alpha.2", "1.0.0-alpha.10", -1},
+		{"1.0.0-alpha", "1.0.0-alpha.1", -1},
+		{"1.0.0+build.5", "1.0.0", 0},
+		{"", "0.0.1", -1},
+		{"1.0", "", 0},
+	}
+
+	for _, tc := range cases {
+		if actual := compareVersions(tc.a, tc.b); actual != tc.expected {
+			t.Fatalf("compare %q and %q: expected %d, got %d", tc.a, tc.b, tc.expected, actual)
+		}
+		if actual := compareVersions(tc.b, tc.a); actual != -tc.expected {
+			t.Fatalf("compare %q and %q: expected %d, got %d", tc.b, tc.a, -tc.expected, actual)
+		}
+	}
+}
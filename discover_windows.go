@@ -0,0 +1,55 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// isExecutable returns true if the file has one of the extensions listed in
+// PATHEXT, since Windows has no execute permission bit.
+func isExecutable(path string, _ os.FileInfo) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext == "" {
+		return false
+	}
+
+	for _, e := range executableExts() {
+		if ext == e {
+			return true
+		}
+	}
+
+	return false
+}
+
+// trimExecutableExt removes the executable extension from a file name.
+func trimExecutableExt(name string) string {
+	ext := filepath.Ext(name)
+	for _, e := range executableExts() {
+		if strings.ToLower(ext) == e {
+			return strings.TrimSuffix(name, ext)
+		}
+	}
+
+	return name
+}
+
+func executableExts() []string {
+	pathExt := os.Getenv("PATHEXT")
+	if pathExt == "" {
+		return []string{".exe", ".com", ".bat", ".cmd"}
+	}
+
+	var exts []string
+	for _, e := range strings.Split(strings.ToLower(pathExt), ";") {
+		if e != "" {
+			exts = append(exts, e)
+		}
+	}
+
+	return exts
+}
@@ -32,6 +32,9 @@ func main() {
 		Cmd:             exec.Command("sh", "-c", os.Getenv("COUNTER_PLUGIN")),
 		AllowedProtocols: []plugin.Protocol{
 			plugin.ProtocolNetRPC, plugin.ProtocolGRPC},
+		// Serve the callbacks to the plugin over the plugin's own socket,
+		// rather than a listener of our own.
+		GRPCBrokerMultiplex: true,
 	})
 	defer client.Kill()
 
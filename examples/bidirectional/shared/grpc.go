@@ -21,24 +21,19 @@ type GRPCClient struct {
 func (m *GRPCClient) Put(key string, value int64, a AddHelper) error {
 	addHelperServer := &GRPCAddHelperServer{Impl: a}
 
-	var s *grpc.Server
-	serverFunc := func(opts []grpc.ServerOption) *grpc.Server {
-		s = grpc.NewServer(opts...)
+	s, err := m.broker.Serve(func(s grpc.ServiceRegistrar) {
 		proto.RegisterAddHelperServer(s, addHelperServer)
-
-		return s
+	})
+	if err != nil {
+		return err
 	}
+	defer s.Close()
 
-	brokerID := m.broker.NextId()
-	go m.broker.AcceptAndServe(brokerID, serverFunc)
-
-	_, err := m.client.Put(context.Background(), &proto.PutRequest{
-		AddServer: brokerID,
+	_, err = m.client.Put(context.Background(), &proto.PutRequest{
+		AddServer: uint32(s.Handle()),
 		Key:       key,
 		Value:     value,
 	})
-
-	s.Stop()
 	return err
 }
 
@@ -62,7 +57,7 @@ type GRPCServer struct {
 }
 
 func (m *GRPCServer) Put(ctx context.Context, req *proto.PutRequest) (*proto.Empty, error) {
-	conn, err := m.broker.Dial(req.AddServer)
+	conn, err := m.broker.DialHandle(ctx, plugin.BrokerHandle(req.AddServer))
 	if err != nil {
 		return nil, err
 	}
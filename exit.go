@@ -0,0 +1,148 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// stderrTailLines is how many of the last lines of the plugin's stderr are
+// kept for PluginExitError.
+const stderrTailLines = 100
+
+// PluginExitError describes a plugin process that exited unsuccessfully. It
+// is returned by Client.ExitStatus and passed to ClientConfig.OnExit.
+type PluginExitError struct {
+	// ExitCode is the exit code of the process, or -1 if it was killed by a
+	// signal or the runner doesn't report exit codes.
+	ExitCode int
+
+	// Signal is the signal that killed the process, if any.
+	Signal syscall.Signal
+
+	// CoreDumped is true if the process dumped core.
+	CoreDumped bool
+
+	// OOMKilled is true if the process was killed for exceeding the memory
+	// limit of its cgroup. See ClientConfig.Cgroup.
+	OOMKilled bool
+
+	// Runtime is how long the process ran for.
+	Runtime time.Duration
+
+	// Stderr holds the last lines the plugin wrote to stderr.
+	Stderr []string
+
+	// Panic is the Go panic or fatal error the plugin wrote to stderr, if
+	// there was one.
+	Panic *PluginPanic
+
+	// Err is the error returned by the runner's Wait.
+	Err error
+}
+
+func (e *PluginExitError) Error() string {
+	var msg string
+	switch {
+	case e.OOMKilled:
+		msg = "plugin was killed for exceeding its memory limit"
+	case e.Signal != 0:
+		msg = fmt.Sprintf("plugin was killed by signal: %s", e.Signal)
+		if e.CoreDumped {
+			msg += " (core dumped)"
+		}
+	case e.ExitCode >= 0:
+		msg = fmt.Sprintf("plugin exited with code %d", e.ExitCode)
+	default:
+		msg = fmt.Sprintf("plugin exited: %s", e.Err)
+	}
+
+	if e.Panic != nil {
+		msg += ": " + e.Panic.String()
+	}
+
+	return msg
+}
+
+func (e *PluginExitError) Unwrap() error {
+	return e.Err
+}
+
+// newPluginExitError builds a PluginExitError from the error returned by a
+// runner's Wait. It returns nil if the plugin exited successfully.
+func newPluginExitError(err error, runtime time.Duration, stderr []string, panic *PluginPanic) *PluginExitError {
+	if err == nil {
+		return nil
+	}
+
+	exitErr := &PluginExitError{
+		ExitCode:  -1,
+		OOMKilled: errors.Is(err, ErrOOMKilled),
+		Runtime:   runtime,
+		Stderr:    stderr,
+		Panic:     panic,
+		Err:       err,
+	}
+
+	var cmdErr *exec.ExitError
+	if errors.As(err, &cmdErr) {
+		exitErr.ExitCode = cmdErr.ExitCode()
+		if status, ok := cmdErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			exitErr.Signal = status.Signal()
+			exitErr.CoreDumped = status.CoreDump()
+		}
+	}
+
+	return exitErr
+}
+
+// stderrCapture keeps the tail of a plugin's stderr for reporting once the
+// plugin exits.
+type stderrCapture struct {
+	l sync.Mutex
+
+	// tail is a ring buffer of the last lines, next is where the next line
+	// goes.
+	tail []string
+	next int
+}
+
+func newStderrCapture() *stderrCapture {
+	return &stderrCapture{
+		tail: make([]string, 0, stderrTailLines),
+	}
+}
+
+func (s *stderrCapture) add(line string) {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	if len(s.tail) < cap(s.tail) {
+		s.tail = append(s.tail, line)
+	} else {
+		s.tail[s.next] = line
+	}
+	s.next = (s.next + 1) % cap(s.tail)
+}
+
+// lines returns the captured lines in order.
+func (s *stderrCapture) lines() []string {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	var tail []string
+	if len(s.tail) < cap(s.tail) {
+		tail = append(tail, s.tail...)
+	} else {
+		tail = append(tail, s.tail[s.next:]...)
+		tail = append(tail, s.tail[:s.next]...)
+	}
+
+	return tail
+}
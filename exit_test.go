@@ -0,0 +1,45 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"fmt"
+	"syscall"
+	"testing"
+)
+
+func TestStderrCapture(t *testing.T) {
+	s := newStderrCapture()
+	for i := 0; i < stderrTailLines+5; i++ {
+		s.add(fmt.Sprintf("line %d", i))
+	}
+
+	tail := s.lines()
+	if len(tail) != stderrTailLines {
+		t.Fatalf("bad: %d", len(tail))
+	}
+	if tail[0] != "line 5" || tail[len(tail)-1] != "line 104" {
+		t.Fatalf("bad: %#v", tail)
+	}
+}
+
+func TestPluginExitError_Error(t *testing.T) {
+	cases := map[string]struct {
+		err      *PluginExitError
+		expected string
+	}{
+		"exit code": {&PluginExitError{ExitCode: 1}, "plugin exited with code 1"},
+		"signal":    {&PluginExitError{ExitCode: -1, Signal: syscall.SIGSEGV, CoreDumped: true}, "plugin was killed by signal: segmentation fault (core dumped)"},
+		"oom":       {&PluginExitError{ExitCode: -1, Signal: syscall.SIGKILL, OOMKilled: true}, "plugin was killed for exceeding its memory limit"},
+		"panic":     {&PluginExitError{ExitCode: 2, Panic: &PluginPanic{Message: "boom"}}, "plugin exited with code 2: panic: boom"},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if actual := tc.err.Error(); actual != tc.expected {
+				t.Fatalf("bad: %s", actual)
+			}
+		})
+	}
+}
@@ -9,6 +9,7 @@ require (
 	github.com/jhump/protoreflect v1.15.1
 	github.com/mitchellh/go-testing-interface v0.0.0-20171004221916-a61a99592b77
 	github.com/oklog/run v1.0.0
+	golang.org/x/sys v0.13.0
 	google.golang.org/grpc v1.38.0
 	google.golang.org/protobuf v1.28.2-0.20230222093303-bc1253ad3743
 )
@@ -20,7 +21,6 @@ require (
 	github.com/mattn/go-isatty v0.0.10 // indirect
 	golang.org/x/net v0.17.0 // indirect
 	golang.org/x/sync v0.0.0-20220722155255-886fb9371eb4 // indirect
-	golang.org/x/sys v0.13.0 // indirect
 	golang.org/x/text v0.13.0 // indirect
 	google.golang.org/genproto v0.0.0-20200526211855-cb27e3aa2013 // indirect
 )
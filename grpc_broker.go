@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"log"
 	"net"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -86,22 +87,35 @@ func (s *gRPCBrokerServer) StartStream(stream plugin.GRPCBroker_StartStreamServe
 		}
 	}()
 
-	// Process receive stream
-	for {
-		i, err := stream.Recv()
-		if err != nil {
-			return err
-		}
-		select {
-		case <-doneCh:
-			return nil
-		case <-s.quit:
-			return nil
-		case s.recv <- i:
+	// Process receive stream. Recv can't be interrupted from this side, so it
+	// runs in its own goroutine to let the stream end as soon as we're closed.
+	// Returning from this handler cancels the stream, which unblocks Recv.
+	errCh := make(chan error, 1)
+	go func() {
+		for {
+			i, err := stream.Recv()
+			if err != nil {
+				errCh <- err
+				return
+			}
+			select {
+			case <-doneCh:
+				return
+			case <-s.quit:
+				return
+			case s.recv <- i:
+			}
 		}
-	}
+	}()
 
-	return nil
+	select {
+	case err := <-errCh:
+		return err
+	case <-doneCh:
+		return nil
+	case <-s.quit:
+		return nil
+	}
 }
 
 // Send is used by the GRPCBroker to pass connection information into the stream
@@ -183,6 +197,16 @@ func (s *gRPCBrokerClientImpl) StartStream() error {
 	}
 	doneCh := stream.Context().Done()
 
+	// Cancel the stream when we're closed so the plugin's end of it returns
+	// and doesn't hold up a graceful stop.
+	go func() {
+		select {
+		case <-doneCh:
+		case <-s.quit:
+			cancelFunc()
+		}
+	}()
+
 	go func() {
 		for {
 			select {
@@ -280,6 +304,30 @@ type GRPCBroker struct {
 
 	muxer grpcmux.GRPCMuxer
 
+	// tracer creates spans around negotiating connections, if non-nil. The
+	// trace context is propagated over the connections either way.
+	tracer *tracer
+
+	// acceptTimeout and dialTimeout are set from the BrokerConfig.
+	acceptTimeout time.Duration
+	dialTimeout   time.Duration
+
+	// tracked has the pending and active IDs, for Streams.
+	tracked *brokerStreams
+
+	// handleNamespace is the range of IDs this side allocates handles from,
+	// brokerHandleHost or brokerHandlePlugin, and is zero if the broker
+	// doesn't support handles.
+	handleNamespace uint32
+	nextHandle      uint32
+	dialHandleLock  sync.Mutex
+	dialedHandles   map[BrokerHandle]*brokeredConnRef
+
+	// servedHandles has a channel for each handle served with Serve, which
+	// is closed once the other side releases it. It is guarded by the
+	// broker's lock.
+	servedHandles map[uint32]chan struct{}
+
 	sync.Mutex
 }
 
@@ -289,7 +337,8 @@ type gRPCBrokerPending struct {
 	once   sync.Once
 }
 
-func newGRPCBroker(s streamer, tls *tls.Config, unixSocketCfg UnixSocketConfig, addrTranslator runner.AddrTranslator, muxer grpcmux.GRPCMuxer) *GRPCBroker {
+func newGRPCBroker(s streamer, tls *tls.Config, unixSocketCfg UnixSocketConfig, addrTranslator runner.AddrTranslator, muxer grpcmux.GRPCMuxer, config *BrokerConfig) *GRPCBroker {
+	acceptTimeout, dialTimeout := config.timeouts()
 	return &GRPCBroker{
 		streamer: s,
 		tls:      tls,
@@ -301,15 +350,52 @@ func newGRPCBroker(s streamer, tls *tls.Config, unixSocketCfg UnixSocketConfig,
 
 		unixSocketCfg:  unixSocketCfg,
 		addrTranslator: addrTranslator,
+
+		acceptTimeout: acceptTimeout,
+		dialTimeout:   dialTimeout,
+		tracked:       newBrokerStreams(),
+		dialedHandles: make(map[BrokerHandle]*brokeredConnRef),
+		servedHandles: make(map[uint32]chan struct{}),
 	}
 }
 
 // Accept accepts a connection by ID.
 //
-// This should not be called multiple times with the same ID at one time.
+// This should not be called multiple times with the same ID at one time. If
+// the other side doesn't dial the ID within BrokerConfig.AcceptTimeout, the
+// listener is closed, and its Accept returns a *BrokerTimeoutError.
 func (b *GRPCBroker) Accept(id uint32) (net.Listener, error) {
+	ln, err := b.acceptNoTimeout(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return newAcceptTimeoutListener(ln, id, b.acceptTimeout), nil
+}
+
+// acceptNoTimeout is Accept, without closing the listener if the other side
+// doesn't dial the ID in time.
+func (b *GRPCBroker) acceptNoTimeout(id uint32) (net.Listener, error) {
+	t := b.tracked.pending(id, BrokerDirectionAccept)
+	ln, err := b.accept(id)
+	if err != nil {
+		t.remove()
+		return nil, err
+	}
+
+	return t.listener(ln), nil
+}
+
+func (b *GRPCBroker) accept(id uint32) (net.Listener, error) {
 	if b.muxer.Enabled() {
 		p := b.getServerStream(id)
+		ln, err := b.muxer.Listener(id, p.doneCh)
+		if err != nil {
+			return nil, err
+		}
+
+		// Only answer knocks once the listener exists, so that a knock
+		// never finds the ID without one.
 		go func() {
 			err := b.listenForKnocks(id)
 			if err != nil {
@@ -317,11 +403,6 @@ func (b *GRPCBroker) Accept(id uint32) (net.Listener, error) {
 			}
 		}()
 
-		ln, err := b.muxer.Listener(id, p.doneCh)
-		if err != nil {
-			return nil, err
-		}
-
 		ln = &rmListener{
 			Listener: ln,
 			close: func() error {
@@ -344,29 +425,41 @@ func (b *GRPCBroker) Accept(id uint32) (net.Listener, error) {
 		return ln, nil
 	}
 
-	listener, err := serverListener(b.unixSocketCfg)
+	listener, info, err := b.listen(id)
 	if err != nil {
 		return nil, err
 	}
+	if err := b.streamer.Send(info); err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	return listener, nil
+}
+
+// listen opens a listener for id without multiplexing, and returns the
+// connection info the other side dials it with.
+func (b *GRPCBroker) listen(id uint32) (net.Listener, *plugin.ConnInfo, error) {
+	listener, err := serverListener(b.unixSocketCfg)
+	if err != nil {
+		return nil, nil, err
+	}
 
 	advertiseNet := listener.Addr().Network()
 	advertiseAddr := listener.Addr().String()
 	if b.addrTranslator != nil {
 		advertiseNet, advertiseAddr, err = b.addrTranslator.HostToPlugin(advertiseNet, advertiseAddr)
 		if err != nil {
-			return nil, err
+			listener.Close()
+			return nil, nil, err
 		}
 	}
-	err = b.streamer.Send(&plugin.ConnInfo{
+
+	return listener, &plugin.ConnInfo{
 		ServiceId: id,
 		Network:   advertiseNet,
 		Address:   advertiseAddr,
-	})
-	if err != nil {
-		return nil, err
-	}
-
-	return listener, nil
+	}, nil
 }
 
 // AcceptAndServe is used to accept a specific stream ID and immediately
@@ -376,20 +469,21 @@ func (b *GRPCBroker) Accept(id uint32) (net.Listener, error) {
 // connection is opened every call, these calls should be used sparingly.
 // Multiple gRPC server implementations can be registered to a single
 // AcceptAndServe call.
+//
+// If the other side doesn't dial the ID within BrokerConfig.AcceptTimeout,
+// the timeout is logged and AcceptAndServe returns.
 func (b *GRPCBroker) AcceptAndServe(id uint32, newGRPCServer func([]grpc.ServerOption) *grpc.Server) {
+	_, span := b.tracer.start(context.Background(), "plugin.broker.accept",
+		"broker.id", strconv.FormatUint(uint64(id), 10))
 	ln, err := b.Accept(id)
+	span.end(err)
 	if err != nil {
 		log.Printf("[ERR] plugin: plugin acceptAndServe error: %s", err)
 		return
 	}
 	defer ln.Close()
 
-	var opts []grpc.ServerOption
-	if b.tls != nil {
-		opts = []grpc.ServerOption{grpc.Creds(credentials.NewTLS(b.tls))}
-	}
-
-	server := newGRPCServer(opts)
+	server := newGRPCServer(b.serverOptions())
 
 	// Here we use a run group to close this goroutine if the server is shutdown
 	// or the broker is shutdown.
@@ -397,7 +491,12 @@ func (b *GRPCBroker) AcceptAndServe(id uint32, newGRPCServer func([]grpc.ServerO
 	{
 		// Serve on the listener, if shutting down call GracefulStop.
 		g.Add(func() error {
-			return server.Serve(ln)
+			err := server.Serve(ln)
+			var timeoutErr *BrokerTimeoutError
+			if errors.As(err, &timeoutErr) {
+				log.Printf("[ERR] plugin: plugin acceptAndServe error: %s", err)
+			}
+			return err
 		}, func(err error) {
 			server.GracefulStop()
 		})
@@ -421,6 +520,84 @@ func (b *GRPCBroker) AcceptAndServe(id uint32, newGRPCServer func([]grpc.ServerO
 	g.Run()
 }
 
+// serverOptions returns the options for the gRPC servers served on brokered
+// connections.
+func (b *GRPCBroker) serverOptions() []grpc.ServerOption {
+	var opts []grpc.ServerOption
+	if b.tls != nil {
+		opts = []grpc.ServerOption{grpc.Creds(credentials.NewTLS(b.tls))}
+	}
+	return append(opts, b.tracer.serverOptions()...)
+}
+
+// acceptTimeoutListener closes the listener it wraps if it doesn't accept a
+// connection within the accept timeout, after which Accept returns a
+// *BrokerTimeoutError.
+type acceptTimeoutListener struct {
+	net.Listener
+	id      uint32
+	timeout time.Duration
+	timer   *time.Timer
+
+	mu       sync.Mutex
+	accepted bool
+	timedOut bool
+}
+
+func newAcceptTimeoutListener(ln net.Listener, id uint32, timeout time.Duration) *acceptTimeoutListener {
+	l := &acceptTimeoutListener{
+		Listener: ln,
+		id:       id,
+		timeout:  timeout,
+	}
+	l.timer = time.AfterFunc(timeout, l.expire)
+	return l
+}
+
+func (l *acceptTimeoutListener) expire() {
+	l.mu.Lock()
+	if l.accepted {
+		l.mu.Unlock()
+		return
+	}
+	l.timedOut = true
+	l.mu.Unlock()
+
+	log.Printf("[WARN] plugin: broker ID %d was accepted, but not dialed within %s; closing the listener",
+		l.id, l.timeout)
+	l.Listener.Close()
+}
+
+func (l *acceptTimeoutListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.timedOut {
+		if err == nil {
+			conn.Close()
+		}
+		return nil, &BrokerTimeoutError{
+			ID:        l.id,
+			Direction: BrokerDirectionAccept,
+			Timeout:   l.timeout,
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	l.accepted = true
+	l.timer.Stop()
+	return conn, nil
+}
+
+func (l *acceptTimeoutListener) Close() error {
+	l.timer.Stop()
+	return l.Listener.Close()
+}
+
 // Close closes the stream and all servers.
 func (b *GRPCBroker) Close() error {
 	b.streamer.Close()
@@ -495,8 +672,12 @@ func (b *GRPCBroker) knock(id uint32) error {
 		if msg.Knock.Error != "" {
 			return fmt.Errorf("failed to knock for id %d: %s", id, msg.Knock.Error)
 		}
-	case <-time.After(5 * time.Second):
-		return fmt.Errorf("timeout waiting for multiplexing knock handshake on id %d", id)
+	case <-time.After(b.dialTimeout):
+		return &BrokerTimeoutError{
+			ID:        id,
+			Direction: BrokerDirectionDial,
+			Timeout:   b.dialTimeout,
+		}
 	}
 
 	return nil
@@ -504,8 +685,12 @@ func (b *GRPCBroker) knock(id uint32) error {
 
 func (b *GRPCBroker) muxDial(id uint32) func(string, time.Duration) (net.Conn, error) {
 	return func(string, time.Duration) (net.Conn, error) {
-		b.dialMutex.Lock()
-		defer b.dialMutex.Unlock()
+		// Streams routed by the most recent knock must be dialled one at a
+		// time, so that each knock is followed by its own stream.
+		if b.muxer.Sequential() {
+			b.dialMutex.Lock()
+			defer b.dialMutex.Unlock()
+		}
 
 		// Tell the other side the listener ID it should give the next stream to.
 		err := b.knock(id)
@@ -513,7 +698,7 @@ func (b *GRPCBroker) muxDial(id uint32) func(string, time.Duration) (net.Conn, e
 			return nil, fmt.Errorf("failed to knock before dialling client: %w", err)
 		}
 
-		conn, err := b.muxer.Dial()
+		conn, err := b.muxer.Dial(id)
 		if err != nil {
 			return nil, err
 		}
@@ -522,21 +707,42 @@ func (b *GRPCBroker) muxDial(id uint32) func(string, time.Duration) (net.Conn, e
 	}
 }
 
-// Dial opens a connection by ID.
+// Dial opens a connection by ID. If the other side doesn't accept the ID
+// within BrokerConfig.DialTimeout, it returns a *BrokerTimeoutError.
 func (b *GRPCBroker) Dial(id uint32) (conn *grpc.ClientConn, err error) {
+	return b.DialContext(context.Background(), id)
+}
+
+// DialContext is like Dial, but stops waiting for the connection info once
+// ctx is cancelled. The span created for the dial, if any, is a child of the
+// trace context ctx carries.
+func (b *GRPCBroker) DialContext(ctx context.Context, id uint32) (conn *grpc.ClientConn, err error) {
+	ctx, span := b.tracer.start(ctx, "plugin.broker.dial", "broker.id", strconv.FormatUint(uint64(id), 10))
+	defer func() { span.end(err) }()
+
 	if b.muxer.Enabled() {
-		return dialGRPCConn(b.tls, b.muxDial(id))
+		return dialGRPCConn(ctx, b.tls, b.tracked.dialer(id, b.muxDial(id)), b.tracer.dialOptions()...)
 	}
 
 	var c *plugin.ConnInfo
 
 	// Open the stream
+	t := b.tracked.pending(id, BrokerDirectionDial)
 	p := b.getClientStream(id)
 	select {
 	case c = <-p.ch:
 		close(p.doneCh)
-	case <-time.After(5 * time.Second):
-		return nil, fmt.Errorf("timeout waiting for connection info")
+		t.remove()
+	case <-time.After(b.dialTimeout):
+		t.remove()
+		return nil, &BrokerTimeoutError{
+			ID:        id,
+			Direction: BrokerDirectionDial,
+			Timeout:   b.dialTimeout,
+		}
+	case <-ctx.Done():
+		t.remove()
+		return nil, ctx.Err()
 	}
 
 	network, address := c.Network, c.Address
@@ -560,7 +766,16 @@ func (b *GRPCBroker) Dial(id uint32) (conn *grpc.ClientConn, err error) {
 		return nil, err
 	}
 
-	return dialGRPCConn(b.tls, netAddrDialer(addr))
+	return dialGRPCConn(ctx, b.tls, b.tracked.dialer(id, netAddrDialer(addr)), b.tracer.dialOptions()...)
+}
+
+// Streams returns the IDs that are pending or active, sorted by ID. It is
+// meant for diagnosing connections that are never established, such as by
+// logging it when Dial times out. Each connection a dialed *grpc.ClientConn
+// opens is listed while it is open, and each accepted ID is listed until its
+// listener is closed.
+func (b *GRPCBroker) Streams() []BrokerStream {
+	return b.tracked.list()
 }
 
 // NextId returns a unique ID to use next.
@@ -585,6 +800,11 @@ func (m *GRPCBroker) Run() {
 			break
 		}
 
+		if msg.Knock != nil && msg.Knock.Release {
+			m.releaseHandle(msg.ServiceId)
+			continue
+		}
+
 		// Initialize the waiter
 		var p *gRPCBrokerPending
 		if msg.Knock != nil && msg.Knock.Knock && !msg.Knock.Ack {
@@ -593,7 +813,12 @@ func (m *GRPCBroker) Run() {
 			// to continuously listen for knocks.
 		} else {
 			p = m.getClientStream(msg.ServiceId)
-			go m.timeoutWait(msg.ServiceId, p)
+			if msg.Knock == nil {
+				// Connection info is pending until Dial picks it up.
+				go m.timeoutWait(msg.ServiceId, p, m.tracked.pending(msg.ServiceId, BrokerDirectionDial))
+			} else {
+				go m.timeoutWait(msg.ServiceId, p, nil)
+			}
 		}
 		select {
 		case p.ch <- msg:
@@ -638,12 +863,22 @@ func (m *GRPCBroker) getServerStream(id uint32) *gRPCBrokerPending {
 	return m.serverStreams[id]
 }
 
-func (m *GRPCBroker) timeoutWait(id uint32, p *gRPCBrokerPending) {
+// timeoutWait drops the connection info or knock ack received for id once
+// it's picked up or times out. t tracks the connection info, and is nil for
+// knock acks.
+func (m *GRPCBroker) timeoutWait(id uint32, p *gRPCBrokerPending, t *brokerStream) {
 	// Wait for the stream to either be picked up and connected, or
 	// for a timeout.
 	select {
 	case <-p.doneCh:
-	case <-time.After(5 * time.Second):
+	case <-time.After(m.dialTimeout):
+		if t != nil {
+			log.Printf("[WARN] plugin: connection info for broker ID %d was received, but not dialed within %s; dropping it",
+				id, m.dialTimeout)
+		}
+	}
+	if t != nil {
+		t.remove()
 	}
 
 	m.Lock()
@@ -0,0 +1,330 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"github.com/hashicorp/go-plugin/internal/plugin"
+	"google.golang.org/grpc"
+)
+
+// The top two bits of the IDs allocated for handles are reserved for the side
+// that allocated them, so that handles never collide with the other side's,
+// or with the IDs returned by NextId, which would take billions of calls to
+// reach them.
+const (
+	brokerHandleMask   uint32 = 0xC0000000
+	brokerHandleHost   uint32 = 0x80000000
+	brokerHandlePlugin uint32 = 0xC0000000
+)
+
+// BrokerHandle identifies a gRPC server served with GRPCBroker.Serve. It is
+// sent to the other side as a uint32, such as in a uint32 proto field, which
+// dials it with GRPCBroker.DialHandle:
+//
+//	server, err := broker.Serve(func(s grpc.ServiceRegistrar) {
+//		proto.RegisterAddHelperServer(s, helper)
+//	})
+//	...
+//	req := &proto.PutRequest{AddServer: uint32(server.Handle())}
+//
+// and on the other side:
+//
+//	conn, err := broker.DialHandle(ctx, plugin.BrokerHandle(req.AddServer))
+type BrokerHandle uint32
+
+// BrokeredServer is a gRPC server served with GRPCBroker.Serve.
+type BrokeredServer struct {
+	handle BrokerHandle
+
+	// doneCh is closed once the server has stopped.
+	doneCh    chan struct{}
+	closeCh   chan struct{}
+	closeOnce sync.Once
+}
+
+// Handle returns the handle the other side dials the server with.
+func (s *BrokeredServer) Handle() BrokerHandle {
+	return s.handle
+}
+
+// Done returns a channel that is closed once the server has stopped.
+func (s *BrokeredServer) Done() <-chan struct{} {
+	return s.doneCh
+}
+
+// Close stops the server, closing the connections of the other side. It
+// returns once the server has stopped.
+func (s *BrokeredServer) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.closeCh)
+	})
+	<-s.doneCh
+	return nil
+}
+
+// BrokeredConn is a connection to a server served with GRPCBroker.Serve,
+// dialed with GRPCBroker.DialHandle. It can be used like the
+// *grpc.ClientConn it embeds, and must be closed with its own Close.
+type BrokeredConn struct {
+	*grpc.ClientConn
+
+	release   func()
+	closeOnce sync.Once
+}
+
+// Close releases the connection. The underlying *grpc.ClientConn is closed
+// once every BrokeredConn dialed for the same handle is closed, and the
+// other side is told to stop the server.
+func (c *BrokeredConn) Close() error {
+	c.closeOnce.Do(c.release)
+	return nil
+}
+
+// brokeredConnRef is a *grpc.ClientConn shared by the BrokeredConns dialed
+// for a handle.
+type brokeredConnRef struct {
+	// ready is closed once the handle has been dialed, after conn or err is
+	// set. refs is guarded by the broker's dialHandleLock, as are conn and
+	// err until ready is closed.
+	ready chan struct{}
+	conn  *grpc.ClientConn
+	err   error
+	refs  int
+}
+
+// Serve allocates a handle, and serves a gRPC server for it with the services
+// register registers, until the other side has dialed it and closed every
+// BrokeredConn it dialed, Close is called, or the broker is closed. The
+// handle should be sent to the other side, which dials it with DialHandle.
+// The server keeps running while the other side holds a BrokeredConn, even
+// if the connection drops and gRPC reconnects.
+//
+// Unlike IDs from NextId, handles are allocated from a range reserved for
+// each side, and don't need to be paired with AcceptAndServe. The other side
+// asks for the handle's connection info when it dials it, so the handle can
+// be dialed however long after it was sent, as long as the server is still
+// running. A server that is never dialed runs until it is closed.
+func (b *GRPCBroker) Serve(register func(grpc.ServiceRegistrar)) (*BrokeredServer, error) {
+	if b.handleNamespace == 0 {
+		return nil, errors.New("broker doesn't support handles")
+	}
+
+	s := &BrokeredServer{
+		handle:  BrokerHandle(atomic.AddUint32(&b.nextHandle, 1)&^brokerHandleMask | b.handleNamespace),
+		doneCh:  make(chan struct{}),
+		closeCh: make(chan struct{}),
+	}
+
+	var ln net.Listener
+	var err error
+	if b.muxer.Enabled() {
+		// Multiplexed IDs are already resolved when they're dialed, by
+		// knocking.
+		ln, err = b.acceptNoTimeout(uint32(s.handle))
+	} else {
+		ln, err = b.acceptHandle(uint32(s.handle), s.doneCh)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	server := grpc.NewServer(b.serverOptions()...)
+	register(server)
+
+	releaseCh := make(chan struct{})
+	b.Lock()
+	b.servedHandles[uint32(s.handle)] = releaseCh
+	b.Unlock()
+
+	go server.Serve(ln)
+	go func() {
+		defer close(s.doneCh)
+		defer ln.Close()
+		defer func() {
+			b.Lock()
+			defer b.Unlock()
+			delete(b.servedHandles, uint32(s.handle))
+		}()
+
+		select {
+		case <-releaseCh:
+			server.GracefulStop()
+		case <-s.closeCh:
+			server.Stop()
+		case <-b.doneCh:
+			server.Stop()
+		}
+	}()
+
+	return s, nil
+}
+
+// acceptHandle accepts a handle without multiplexing. Rather than sending the
+// connection info right away, which the other side drops if it isn't dialed
+// within BrokerConfig.DialTimeout, it is sent in answer to the knock the
+// other side sends each time it dials the handle, until doneCh is closed.
+func (b *GRPCBroker) acceptHandle(id uint32, doneCh <-chan struct{}) (net.Listener, error) {
+	t := b.tracked.pending(id, BrokerDirectionAccept)
+	ln, info, err := b.listen(id)
+	if err != nil {
+		t.remove()
+		return nil, err
+	}
+
+	p := b.getServerStream(id)
+	go func() {
+		defer func() {
+			b.Lock()
+			defer b.Unlock()
+			delete(b.serverStreams, id)
+		}()
+
+		for {
+			select {
+			case <-p.ch:
+				if err := b.streamer.Send(info); err != nil {
+					log.Printf("[ERR] plugin: error sending connection info for broker handle %d: %s", id, err)
+				}
+			case <-doneCh:
+				return
+			}
+		}
+	}()
+
+	return t.listener(ln), nil
+}
+
+// DialHandle dials the server the other side served with Serve for the given
+// handle. Dialing the same handle again before every BrokeredConn for it is
+// closed shares the same connection, and concurrent dials for the same handle
+// wait for the first one. If the other side doesn't answer within
+// BrokerConfig.DialTimeout, such as because the server was closed, it
+// returns a *BrokerTimeoutError.
+func (b *GRPCBroker) DialHandle(ctx context.Context, h BrokerHandle) (*BrokeredConn, error) {
+	switch uint32(h) & brokerHandleMask {
+	case b.handleNamespace:
+		return nil, fmt.Errorf("broker handle %d was served by this side", h)
+	case brokerHandleHost, brokerHandlePlugin:
+	default:
+		return nil, fmt.Errorf("invalid broker handle %d", h)
+	}
+
+	// dialHandleLock only guards dialedHandles, so that dials for different
+	// handles don't wait for each other.
+	b.dialHandleLock.Lock()
+	ref, ok := b.dialedHandles[h]
+	if !ok {
+		ref = &brokeredConnRef{ready: make(chan struct{})}
+		b.dialedHandles[h] = ref
+	}
+	ref.refs++
+	b.dialHandleLock.Unlock()
+
+	release := func() {
+		b.dialHandleLock.Lock()
+		ref.refs--
+		var conn *grpc.ClientConn
+		if ref.refs == 0 {
+			if b.dialedHandles[h] == ref {
+				delete(b.dialedHandles, h)
+			}
+			conn = ref.conn
+		}
+		b.dialHandleLock.Unlock()
+
+		if conn != nil {
+			conn.Close()
+			b.sendRelease(uint32(h))
+		}
+	}
+
+	if !ok {
+		conn, err := b.dialHandle(ctx, uint32(h))
+
+		b.dialHandleLock.Lock()
+		ref.conn, ref.err = conn, err
+		if err != nil {
+			// Later dials start over, rather than sharing the error.
+			delete(b.dialedHandles, h)
+		}
+		b.dialHandleLock.Unlock()
+		close(ref.ready)
+	} else {
+		select {
+		case <-ref.ready:
+		case <-ctx.Done():
+			release()
+			return nil, ctx.Err()
+		}
+	}
+	if ref.err != nil {
+		release()
+		return nil, ref.err
+	}
+
+	return &BrokeredConn{
+		ClientConn: ref.conn,
+		release:    release,
+	}, nil
+}
+
+// dialHandle dials a handle. Without multiplexing, it first knocks to ask
+// the other side for the handle's connection info.
+func (b *GRPCBroker) dialHandle(ctx context.Context, id uint32) (*grpc.ClientConn, error) {
+	if !b.muxer.Enabled() {
+		err := b.streamer.Send(&plugin.ConnInfo{
+			ServiceId: id,
+			Knock: &plugin.ConnInfo_Knock{
+				Knock: true,
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return b.DialContext(ctx, id)
+}
+
+// sendRelease tells the other side that every connection to a handle it
+// served was closed, so that it stops the server.
+func (b *GRPCBroker) sendRelease(id uint32) {
+	select {
+	case <-b.doneCh:
+		// The server stopped with the broker.
+		return
+	default:
+	}
+
+	err := b.streamer.Send(&plugin.ConnInfo{
+		ServiceId: id,
+		Knock: &plugin.ConnInfo_Knock{
+			Release: true,
+		},
+	})
+	if err != nil {
+		log.Printf("[ERR] plugin: error releasing broker handle %d: %s", id, err)
+	}
+}
+
+// releaseHandle stops the server for a handle served by this side, once the
+// other side released it. Releases of handles whose server already stopped
+// are ignored.
+func (b *GRPCBroker) releaseHandle(id uint32) {
+	b.Lock()
+	defer b.Unlock()
+
+	if releaseCh, ok := b.servedHandles[id]; ok {
+		close(releaseCh)
+		delete(b.servedHandles, id)
+	}
+}
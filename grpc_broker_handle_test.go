@@ -0,0 +1,308 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	grpctest "github.com/hashicorp/go-plugin/test/grpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+)
+
+func registerPingPong(s grpc.ServiceRegistrar) {
+	grpctest.RegisterPingPongServer(s, &pingPongServer{})
+}
+
+func TestGRPCBroker_handles(t *testing.T) {
+	for _, multiplex := range []bool{false, true} {
+		multiplex := multiplex
+		name := "no multiplex"
+		if multiplex {
+			name = "multiplex"
+		}
+
+		t.Run(name, func(t *testing.T) {
+			client, server := TestPluginGRPCConn(t, multiplex, map[string]Plugin{
+				"test": new(testGRPCInterfacePlugin),
+			})
+			defer client.Close()
+			defer server.Stop()
+			ctx := context.Background()
+
+			for name, brokers := range map[string][2]*GRPCBroker{
+				"host serves":   {client.broker, server.broker},
+				"plugin serves": {server.broker, client.broker},
+			} {
+				t.Run(name, func(t *testing.T) {
+					serving, dialing := brokers[0], brokers[1]
+
+					s, err := serving.Serve(registerPingPong)
+					if err != nil {
+						t.Fatalf("err: %s", err)
+					}
+					if uint32(s.Handle())&brokerHandleMask != serving.handleNamespace {
+						t.Fatalf("handle %x isn't in the serving side's namespace", s.Handle())
+					}
+
+					// Dialing the handle twice shares the connection.
+					conn1, err := dialing.DialHandle(ctx, s.Handle())
+					if err != nil {
+						t.Fatalf("err: %s", err)
+					}
+					conn2, err := dialing.DialHandle(ctx, s.Handle())
+					if err != nil {
+						t.Fatalf("err: %s", err)
+					}
+					if conn1.ClientConn != conn2.ClientConn {
+						t.Fatal("expected the dials to share the connection")
+					}
+
+					if _, err := grpctest.NewPingPongClient(conn1).Ping(ctx, &grpctest.PingRequest{}); err != nil {
+						t.Fatalf("err: %s", err)
+					}
+					conn1.Close()
+					if _, err := grpctest.NewPingPongClient(conn2).Ping(ctx, &grpctest.PingRequest{}); err != nil {
+						t.Fatalf("err: %s", err)
+					}
+
+					select {
+					case <-s.Done():
+						t.Fatal("server stopped while a connection was open")
+					default:
+					}
+
+					// Closing the last connection stops the server.
+					conn2.Close()
+					select {
+					case <-s.Done():
+					case <-time.After(5 * time.Second):
+						t.Fatal("server didn't stop once the connections were closed")
+					}
+				})
+			}
+
+			t.Run("close", func(t *testing.T) {
+				s, err := client.broker.Serve(registerPingPong)
+				if err != nil {
+					t.Fatalf("err: %s", err)
+				}
+				s.Close()
+				select {
+				case <-s.Done():
+				default:
+					t.Fatal("server didn't stop")
+				}
+			})
+
+			t.Run("invalid handles", func(t *testing.T) {
+				s, err := client.broker.Serve(registerPingPong)
+				if err != nil {
+					t.Fatalf("err: %s", err)
+				}
+				defer s.Close()
+
+				if _, err := client.broker.DialHandle(ctx, s.Handle()); err == nil {
+					t.Fatal("expected an error dialing a handle served by the same side")
+				}
+				if _, err := server.broker.DialHandle(ctx, BrokerHandle(server.broker.NextId())); err == nil {
+					t.Fatal("expected an error dialing an ID that isn't a handle")
+				}
+			})
+		})
+	}
+}
+
+// Handles are resolved when they're dialed, so they can be dialed after the
+// dial timeout that drops connection info sent up front.
+func TestGRPCBroker_handleDialedLate(t *testing.T) {
+	const dialTimeout = 50 * time.Millisecond
+	a, b := testGRPCBrokers(t, &BrokerConfig{DialTimeout: dialTimeout})
+	a.handleNamespace, b.handleNamespace = brokerHandleHost, brokerHandlePlugin
+	ctx := context.Background()
+
+	s, err := b.Serve(registerPingPong)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	time.Sleep(4 * dialTimeout)
+
+	// Concurrent dials share the connection.
+	conns := make(chan *BrokeredConn, 2)
+	errCh := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			conn, err := a.DialHandle(ctx, s.Handle())
+			errCh <- err
+			conns <- conn
+		}()
+	}
+	for i := 0; i < 2; i++ {
+		if err := <-errCh; err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+	conn1, conn2 := <-conns, <-conns
+	if conn1.ClientConn != conn2.ClientConn {
+		t.Fatal("expected the dials to share the connection")
+	}
+	if _, err := grpctest.NewPingPongClient(conn1).Ping(ctx, &grpctest.PingRequest{}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	conn1.Close()
+	conn2.Close()
+
+	select {
+	case <-s.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("server didn't stop once the connections were closed")
+	}
+	waitForStreams(t, b.Streams)
+
+	// A handle whose server stopped isn't answered.
+	_, err = a.DialHandle(ctx, s.Handle())
+	if !errors.Is(err, ErrBrokerTimeout) {
+		t.Fatalf("expected a timeout, got %v", err)
+	}
+}
+
+// The server for a handle keeps running if the connection to it drops, so
+// that gRPC can reconnect.
+func TestGRPCBroker_handleReconnect(t *testing.T) {
+	a, b := testGRPCBrokers(t, nil)
+	a.handleNamespace, b.handleNamespace = brokerHandleHost, brokerHandlePlugin
+	proxy := newTestDropProxy(t)
+	a.addrTranslator = proxy
+	ctx := context.Background()
+
+	s, err := b.Serve(registerPingPong)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	conn, err := a.DialHandle(ctx, s.Handle())
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	client := grpctest.NewPingPongClient(conn)
+	if _, err := client.Ping(ctx, &grpctest.PingRequest{}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	proxy.drop()
+
+	// Wait for gRPC to notice, so that the ping isn't sent on the dropped
+	// connection.
+	pingCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	if !conn.WaitForStateChange(pingCtx, connectivity.Ready) {
+		t.Fatal("connection wasn't dropped")
+	}
+	if _, err := client.Ping(pingCtx, &grpctest.PingRequest{}, grpc.WaitForReady(true)); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if n := proxy.dials(); n < 2 {
+		t.Fatalf("expected the connection to be dialed again, got %d dials", n)
+	}
+	select {
+	case <-s.Done():
+		t.Fatal("server stopped while a connection was open")
+	default:
+	}
+
+	// Closing the connection still stops the server.
+	conn.Close()
+	select {
+	case <-s.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("server didn't stop once the connection was closed")
+	}
+}
+
+// testDropProxy is a runner.AddrTranslator that points the dialing side at a
+// proxy, whose connections can be dropped.
+type testDropProxy struct {
+	ln net.Listener
+
+	mu     sync.Mutex
+	target string
+	conns  []net.Conn
+	dialed int
+}
+
+func newTestDropProxy(t *testing.T) *testDropProxy {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	p := &testDropProxy{ln: ln}
+	go p.serve()
+	return p
+}
+
+func (p *testDropProxy) serve() {
+	for {
+		conn, err := p.ln.Accept()
+		if err != nil {
+			return
+		}
+
+		p.mu.Lock()
+		target, err := net.Dial("unix", p.target)
+		if err != nil {
+			p.mu.Unlock()
+			conn.Close()
+			continue
+		}
+		p.conns = append(p.conns, conn, target)
+		p.dialed++
+		p.mu.Unlock()
+
+		go func() {
+			io.Copy(target, conn)
+			target.Close()
+		}()
+		go func() {
+			io.Copy(conn, target)
+			conn.Close()
+		}()
+	}
+}
+
+// drop closes the proxied connections.
+func (p *testDropProxy) drop() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, conn := range p.conns {
+		conn.Close()
+	}
+	p.conns = nil
+}
+
+func (p *testDropProxy) dials() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.dialed
+}
+
+func (p *testDropProxy) PluginToHost(pluginNet, pluginAddr string) (string, string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.target = pluginAddr
+	return "tcp", p.ln.Addr().String(), nil
+}
+
+func (p *testDropProxy) HostToPlugin(hostNet, hostAddr string) (string, string, error) {
+	return hostNet, hostAddr, nil
+}
@@ -0,0 +1,372 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-plugin/internal/plugin"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// grpcByteStreamChunkSize is the maximum size of the chunks byte streams are
+// read and written in.
+const grpcByteStreamChunkSize = 32 * 1024
+
+// ServeReader serves r on the given ID to a single DialReader call on the
+// other side. It blocks until the other side closes the reader, r returns an
+// error, or the broker is closed, and returns r's error, if it isn't io.EOF.
+// r is read from only as the other side reads, and isn't closed.
+//
+// If the other side doesn't dial the ID within BrokerConfig.AcceptTimeout, it
+// returns a *BrokerTimeoutError.
+func (b *GRPCBroker) ServeReader(id uint32, r io.Reader) error {
+	return b.serveByteStream(id, newGRPCByteStreamServer(r, nil))
+}
+
+// ServeWriter serves w on the given ID to a single DialWriter call on the
+// other side. It blocks until the other side closes the writer, w returns an
+// error, or the broker is closed, and returns w's error. Each write on the
+// other side returns once w has returned. w isn't closed.
+//
+// If the other side doesn't dial the ID within BrokerConfig.AcceptTimeout, it
+// returns a *BrokerTimeoutError.
+func (b *GRPCBroker) ServeWriter(id uint32, w io.Writer) error {
+	return b.serveByteStream(id, newGRPCByteStreamServer(nil, w))
+}
+
+// DialReader dials the reader served on the given ID with ServeReader. Errors
+// the served reader returns are returned by Read, with the same message.
+// Closing the reader ends ServeReader on the other side.
+func (b *GRPCBroker) DialReader(id uint32) (io.ReadCloser, error) {
+	conn, err := b.Dial(id)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := plugin.NewGRPCByteStreamClient(conn).Read(ctx)
+	if err != nil {
+		cancel()
+		conn.Close()
+		return nil, err
+	}
+
+	return &grpcByteStreamReader{conn: conn, cancel: cancel, stream: stream}, nil
+}
+
+// DialWriter dials the writer served on the given ID with ServeWriter. Write
+// returns once the served writer has written the data, and errors it returns
+// are returned by Write, with the same message. Closing the writer ends
+// ServeWriter on the other side.
+func (b *GRPCBroker) DialWriter(id uint32) (io.WriteCloser, error) {
+	conn, err := b.Dial(id)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := plugin.NewGRPCByteStreamClient(conn).Write(ctx)
+	if err != nil {
+		cancel()
+		conn.Close()
+		return nil, err
+	}
+
+	return &grpcByteStreamWriter{conn: conn, cancel: cancel, stream: stream}, nil
+}
+
+// serveByteStream serves s on the given ID until its stream ends.
+func (b *GRPCBroker) serveByteStream(id uint32, s *grpcByteStreamServer) error {
+	ln, err := b.Accept(id)
+	if err != nil {
+		return err
+	}
+	defer ln.Close()
+
+	server := grpc.NewServer(b.serverOptions()...)
+	plugin.RegisterGRPCByteStreamServer(server, s)
+	go server.Serve(ln)
+
+	timer := time.NewTimer(b.acceptTimeout)
+	defer timer.Stop()
+	select {
+	case <-s.startedCh:
+	case <-timer.C:
+		server.Stop()
+		return &BrokerTimeoutError{
+			ID:        id,
+			Direction: BrokerDirectionAccept,
+			Timeout:   b.acceptTimeout,
+		}
+	case <-b.doneCh:
+		server.Stop()
+		return errors.New("broker closed")
+	}
+
+	select {
+	case <-s.doneCh:
+		// Let the call finish sending its status.
+		server.GracefulStop()
+		return s.err
+	case <-b.doneCh:
+		server.Stop()
+		return errors.New("broker closed")
+	}
+}
+
+// grpcByteStreamServer implements the GRPCByteStream service for a single
+// call, reading from reader or writing to writer.
+type grpcByteStreamServer struct {
+	reader io.Reader
+	writer io.Writer
+
+	// startedCh is closed once the call starts, and doneCh once it ends,
+	// after err is set.
+	startedCh chan struct{}
+	startOnce sync.Once
+	doneCh    chan struct{}
+	err       error
+}
+
+func newGRPCByteStreamServer(r io.Reader, w io.Writer) *grpcByteStreamServer {
+	return &grpcByteStreamServer{
+		reader:    r,
+		writer:    w,
+		startedCh: make(chan struct{}),
+		doneCh:    make(chan struct{}),
+	}
+}
+
+// start returns an error unless it is the first call.
+func (s *grpcByteStreamServer) start() error {
+	started := false
+	s.startOnce.Do(func() {
+		started = true
+		close(s.startedCh)
+	})
+	if !started {
+		return status.Error(codes.FailedPrecondition, "byte stream is already being served")
+	}
+
+	return nil
+}
+
+// finish ends the call with err. Errors from the other side cancelling the
+// stream are ignored.
+func (s *grpcByteStreamServer) finish(err error) {
+	if err == io.EOF || status.Code(err) == codes.Canceled {
+		err = nil
+	}
+	s.err = err
+	close(s.doneCh)
+}
+
+func (s *grpcByteStreamServer) Read(stream plugin.GRPCByteStream_ReadServer) (err error) {
+	if s.reader == nil {
+		return status.Error(codes.Unimplemented, "byte stream doesn't serve a reader")
+	}
+	if err := s.start(); err != nil {
+		return err
+	}
+	defer func() { s.finish(err) }()
+
+	buf := make([]byte, grpcByteStreamChunkSize)
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			// The other side closed the stream.
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		size := int(req.Size)
+		if size <= 0 || size > len(buf) {
+			size = len(buf)
+		}
+		n, readErr := s.reader.Read(buf[:size])
+
+		chunk := &plugin.ByteStreamChunk{Data: buf[:n]}
+		if readErr == io.EOF {
+			chunk.Eof = true
+		} else if readErr != nil {
+			chunk.Error = readErr.Error()
+		}
+		if err := stream.Send(chunk); err != nil {
+			return err
+		}
+		if readErr != nil {
+			return readErr
+		}
+	}
+}
+
+func (s *grpcByteStreamServer) Write(stream plugin.GRPCByteStream_WriteServer) (err error) {
+	if s.writer == nil {
+		return status.Error(codes.Unimplemented, "byte stream doesn't serve a writer")
+	}
+	if err := s.start(); err != nil {
+		return err
+	}
+	defer func() { s.finish(err) }()
+
+	for {
+		chunk, err := stream.Recv()
+		if err == io.EOF {
+			// The other side closed the stream.
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		n, writeErr := s.writer.Write(chunk.Data)
+
+		ack := &plugin.ByteStreamWriteAck{Written: uint32(n)}
+		if writeErr != nil {
+			ack.Error = writeErr.Error()
+		}
+		if err := stream.Send(ack); err != nil {
+			return err
+		}
+		if writeErr != nil {
+			return writeErr
+		}
+	}
+}
+
+// grpcByteStreamReader is the io.ReadCloser returned by DialReader.
+type grpcByteStreamReader struct {
+	conn   *grpc.ClientConn
+	cancel context.CancelFunc
+	stream plugin.GRPCByteStream_ReadClient
+
+	// buf is the rest of the last chunk received, and err is returned once
+	// it is read.
+	buf []byte
+	err error
+}
+
+func (r *grpcByteStreamReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if len(p) == 0 {
+			return 0, nil
+		}
+
+		size := len(p)
+		if size > grpcByteStreamChunkSize {
+			size = grpcByteStreamChunkSize
+		}
+		if err := r.stream.Send(&plugin.ByteStreamReadRequest{Size: uint32(size)}); err != nil {
+			// The stream is broken. Its status is returned by Recv.
+			_, err = r.stream.Recv()
+			r.err = byteStreamErr(err)
+			continue
+		}
+
+		chunk, err := r.stream.Recv()
+		if err != nil {
+			r.err = byteStreamErr(err)
+			continue
+		}
+
+		r.buf = chunk.Data
+		if chunk.Eof {
+			r.err = io.EOF
+		} else if chunk.Error != "" {
+			r.err = errors.New(chunk.Error)
+		}
+	}
+
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+func (r *grpcByteStreamReader) Close() error {
+	r.stream.CloseSend()
+	r.cancel()
+	return r.conn.Close()
+}
+
+// grpcByteStreamWriter is the io.WriteCloser returned by DialWriter.
+type grpcByteStreamWriter struct {
+	conn   *grpc.ClientConn
+	cancel context.CancelFunc
+	stream plugin.GRPCByteStream_WriteClient
+
+	// err is returned by every write once set.
+	err error
+}
+
+func (w *grpcByteStreamWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		if w.err != nil {
+			return written, w.err
+		}
+
+		chunk := p
+		if len(chunk) > grpcByteStreamChunkSize {
+			chunk = chunk[:grpcByteStreamChunkSize]
+		}
+		if err := w.stream.Send(&plugin.ByteStreamChunk{Data: chunk}); err != nil {
+			// The stream is broken. Its status is returned by Recv.
+			_, err = w.stream.Recv()
+			w.err = byteStreamErr(err)
+			continue
+		}
+
+		ack, err := w.stream.Recv()
+		if err != nil {
+			w.err = byteStreamErr(err)
+			continue
+		}
+
+		written += int(ack.Written)
+		if ack.Error != "" {
+			w.err = errors.New(ack.Error)
+		} else if int(ack.Written) < len(chunk) {
+			w.err = io.ErrShortWrite
+		}
+		p = p[len(chunk):]
+	}
+
+	return written, w.err
+}
+
+// Close ends the stream, and waits for the other side to end it too.
+func (w *grpcByteStreamWriter) Close() error {
+	defer w.conn.Close()
+	defer w.cancel()
+
+	if err := w.stream.CloseSend(); err != nil {
+		return err
+	}
+	if _, err := w.stream.Recv(); err != io.EOF && w.err == nil {
+		return byteStreamErr(err)
+	}
+
+	return nil
+}
+
+// byteStreamErr returns the error for a byte stream that ended with err
+// before its reader or writer returned an error.
+func byteStreamErr(err error) error {
+	if err == nil || err == io.EOF {
+		return io.ErrClosedPipe
+	}
+	return err
+}
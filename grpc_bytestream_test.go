@@ -0,0 +1,180 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// testByteStreamData spans several chunks.
+var testByteStreamData = bytes.Repeat([]byte("0123456789abcdef"), 10000)
+
+func TestGRPCBroker_byteStream(t *testing.T) {
+	for _, multiplex := range []bool{false, true} {
+		multiplex := multiplex
+		name := "no multiplex"
+		if multiplex {
+			name = "multiplex"
+		}
+
+		t.Run(name, func(t *testing.T) {
+			client, server := TestPluginGRPCConn(t, multiplex, map[string]Plugin{
+				"test": new(testGRPCInterfacePlugin),
+			})
+			defer client.Close()
+			defer server.Stop()
+
+			t.Run("reader", func(t *testing.T) {
+				id := server.broker.NextId()
+				errCh := make(chan error, 1)
+				go func() {
+					errCh <- server.broker.ServeReader(id, iotest.HalfReader(bytes.NewReader(testByteStreamData)))
+				}()
+
+				r, err := client.broker.DialReader(id)
+				if err != nil {
+					t.Fatalf("err: %s", err)
+				}
+				data, err := io.ReadAll(r)
+				if err != nil {
+					t.Fatalf("err: %s", err)
+				}
+				if !bytes.Equal(data, testByteStreamData) {
+					t.Fatalf("read %d bytes that don't match", len(data))
+				}
+				if err := r.Close(); err != nil {
+					t.Fatalf("err: %s", err)
+				}
+				if err := <-errCh; err != nil {
+					t.Fatalf("err: %s", err)
+				}
+			})
+
+			t.Run("reader error", func(t *testing.T) {
+				id := client.broker.NextId()
+				readErr := errors.New("disk on fire")
+				errCh := make(chan error, 1)
+				go func() {
+					errCh <- client.broker.ServeReader(id, io.MultiReader(
+						strings.NewReader("partial"), iotest.ErrReader(readErr)))
+				}()
+
+				r, err := server.broker.DialReader(id)
+				if err != nil {
+					t.Fatalf("err: %s", err)
+				}
+				defer r.Close()
+				data, err := io.ReadAll(r)
+				if err == nil || err.Error() != readErr.Error() {
+					t.Fatalf("expected %q, got %v", readErr, err)
+				}
+				if string(data) != "partial" {
+					t.Fatalf("bad data: %q", data)
+				}
+				if err := <-errCh; err != readErr {
+					t.Fatalf("expected %q, got %v", readErr, err)
+				}
+			})
+
+			t.Run("reader closed early", func(t *testing.T) {
+				id := server.broker.NextId()
+				errCh := make(chan error, 1)
+				go func() {
+					errCh <- server.broker.ServeReader(id, bytes.NewReader(testByteStreamData))
+				}()
+
+				r, err := client.broker.DialReader(id)
+				if err != nil {
+					t.Fatalf("err: %s", err)
+				}
+				if _, err := io.ReadFull(r, make([]byte, 10)); err != nil {
+					t.Fatalf("err: %s", err)
+				}
+				if err := r.Close(); err != nil {
+					t.Fatalf("err: %s", err)
+				}
+				if err := <-errCh; err != nil {
+					t.Fatalf("err: %s", err)
+				}
+			})
+
+			t.Run("writer", func(t *testing.T) {
+				id := client.broker.NextId()
+				var buf bytes.Buffer
+				errCh := make(chan error, 1)
+				go func() {
+					errCh <- client.broker.ServeWriter(id, &buf)
+				}()
+
+				w, err := server.broker.DialWriter(id)
+				if err != nil {
+					t.Fatalf("err: %s", err)
+				}
+				n, err := w.Write(testByteStreamData)
+				if err != nil {
+					t.Fatalf("err: %s", err)
+				}
+				if n != len(testByteStreamData) {
+					t.Fatalf("wrote %d bytes", n)
+				}
+				if err := w.Close(); err != nil {
+					t.Fatalf("err: %s", err)
+				}
+				if err := <-errCh; err != nil {
+					t.Fatalf("err: %s", err)
+				}
+				if !bytes.Equal(buf.Bytes(), testByteStreamData) {
+					t.Fatalf("wrote %d bytes that don't match", buf.Len())
+				}
+			})
+
+			t.Run("writer error", func(t *testing.T) {
+				id := server.broker.NextId()
+				errCh := make(chan error, 1)
+				go func() {
+					errCh <- server.broker.ServeWriter(id, &limitedWriter{n: 5})
+				}()
+
+				w, err := client.broker.DialWriter(id)
+				if err != nil {
+					t.Fatalf("err: %s", err)
+				}
+				defer w.Close()
+				n, err := w.Write([]byte("hello world"))
+				if err == nil || err.Error() != errLimitedWriter.Error() {
+					t.Fatalf("expected %q, got %v", errLimitedWriter, err)
+				}
+				if n != 5 {
+					t.Fatalf("wrote %d bytes", n)
+				}
+				if err := <-errCh; err != errLimitedWriter {
+					t.Fatalf("expected %q, got %v", errLimitedWriter, err)
+				}
+			})
+		})
+	}
+}
+
+var errLimitedWriter = errors.New("writer is full")
+
+// limitedWriter accepts n bytes, and then returns errLimitedWriter.
+type limitedWriter struct {
+	n int
+}
+
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	if len(p) <= w.n {
+		w.n -= len(p)
+		return len(p), nil
+	}
+
+	n := w.n
+	w.n = 0
+	return n, errLimitedWriter
+}
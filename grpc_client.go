@@ -6,18 +6,24 @@ package plugin
 import (
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"math"
 	"net"
 	"time"
 
+	empty "github.com/golang/protobuf/ptypes/empty"
+	hclog "github.com/hashicorp/go-hclog"
 	"github.com/hashicorp/go-plugin/internal/plugin"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
 )
 
-func dialGRPCConn(tls *tls.Config, dialer func(string, time.Duration) (net.Conn, error), dialOpts ...grpc.DialOption) (*grpc.ClientConn, error) {
+func dialGRPCConn(ctx context.Context, tls *tls.Config, dialer func(string, time.Duration) (net.Conn, error), dialOpts ...grpc.DialOption) (*grpc.ClientConn, error) {
 	// Build dialing options.
 	opts := make([]grpc.DialOption, 0)
 
@@ -45,7 +51,7 @@ func dialGRPCConn(tls *tls.Config, dialer func(string, time.Duration) (net.Conn,
 
 	// Connect. Note the first parameter is unused because we use a custom
 	// dialer that has the state to see the address.
-	conn, err := grpc.Dial("unused", opts...)
+	conn, err := grpc.DialContext(ctx, "unused", opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -53,13 +59,53 @@ func dialGRPCConn(tls *tls.Config, dialer func(string, time.Duration) (net.Conn,
 	return conn, nil
 }
 
+// waitGRPCConn waits for conn to first connect or fail to, so that cancelling
+// ctx aborts connecting to the plugin. Unlike grpc.WithBlock, it doesn't keep
+// retrying a connection that failed, whose error is returned by the first RPC
+// instead. It also stops waiting if doneCtx is done, once the plugin exited.
+func waitGRPCConn(ctx, doneCtx context.Context, conn *grpc.ClientConn) error {
+	waitCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-doneCtx.Done():
+			cancel()
+		case <-waitCtx.Done():
+		}
+	}()
+
+	for {
+		state := conn.GetState()
+		switch state {
+		case connectivity.Ready, connectivity.TransientFailure, connectivity.Shutdown:
+			return nil
+		}
+		if !conn.WaitForStateChange(waitCtx, state) {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			return errors.New("plugin exited before connecting")
+		}
+	}
+}
+
 // newGRPCClient creates a new GRPCClient. The Client argument is expected
 // to be successfully started already with a lock held.
-func newGRPCClient(doneCtx context.Context, c *Client) (*GRPCClient, error) {
-	conn, err := dialGRPCConn(c.config.TLSConfig, c.dialer, c.config.GRPCDialOptions...)
+func newGRPCClient(ctx, doneCtx context.Context, c *Client) (*GRPCClient, error) {
+	dialOpts := c.tracer.dialOptions()
+	if m := c.metrics(ProtocolGRPC); m != nil {
+		dialOpts = append(dialOpts, m.dialOptions()...)
+	}
+	dialOpts = append(dialOpts, c.config.GRPCDialOptions...)
+
+	conn, err := dialGRPCConn(ctx, c.config.TLSConfig, c.dialer, dialOpts...)
 	if err != nil {
 		return nil, err
 	}
+	if err := waitGRPCConn(ctx, doneCtx, conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
 
 	muxer, err := c.getGRPCMuxer(c.address)
 	if err != nil {
@@ -68,28 +114,70 @@ func newGRPCClient(doneCtx context.Context, c *Client) (*GRPCClient, error) {
 
 	// Start the broker.
 	brokerGRPCClient := newGRPCBrokerClient(conn)
-	broker := newGRPCBroker(brokerGRPCClient, c.config.TLSConfig, c.unixSocketCfg, c.runner, muxer)
+	broker := newGRPCBroker(brokerGRPCClient, c.config.TLSConfig, c.unixSocketCfg, c.runner, muxer, c.config.Broker)
+	broker.tracer = c.tracer
+	broker.handleNamespace = brokerHandleHost
 	go broker.Run()
 	go brokerGRPCClient.StartStream()
 
-	// Start the stdio client
-	stdioClient, err := newGRPCStdioClient(doneCtx, c.logger.Named("stdio"), conn)
+	// Start the stdio client, resuming where the client we reattach to left
+	// off
+	var stdioSequence uint64
+	if c.config.Reattach != nil {
+		stdioSequence = c.config.Reattach.StdioSequence
+	}
+	stdioClient, err := newGRPCStdioClient(doneCtx, c.logger.Named("stdio"), conn, stdioSequence)
 	if err != nil {
 		return nil, err
 	}
 	go stdioClient.Run(c.config.SyncStdout, c.config.SyncStderr)
 
+	// Forward stdin if it's set. When reattaching it isn't known whether
+	// the plugin accepts stdin, so it's attempted anyway.
+	if c.config.SyncStdin != nil {
+		if c.serverCapabilities.Bool(capabilitySyncStdin) || c.config.Reattach != nil {
+			go syncGRPCStdin(doneCtx, c.logger.Named("stdio"), conn, c.config.SyncStdin)
+		} else {
+			c.logger.Warn("plugin does not accept stdin, SyncStdin is ignored")
+		}
+	}
+
+	// Start the log client, if the plugin streams its logs rather than
+	// writing them to stderr
+	if c.serverCapabilities.Bool(capabilityGRPCLogSink) {
+		logClient, err := newGRPCLogClient(doneCtx, c.pluginLogger(), conn, &c.droppedLogEntries)
+		if err != nil {
+			return nil, err
+		}
+		go logClient.Run()
+	}
+
 	cl := &GRPCClient{
 		Conn:       conn,
 		Plugins:    c.config.Plugins,
 		doneCtx:    doneCtx,
 		broker:     broker,
 		controller: plugin.NewGRPCControllerClient(conn),
+		stdio:      stdioClient,
+		tracer:     c.tracer,
+
+		shutdownTimeout: c.config.GracefulShutdownTimeout,
+		ownsProcess:     c.config.Reattach == nil || !c.config.Reattach.Test,
 	}
 
 	return cl, nil
 }
 
+// newGRPCClientProtocol is the ClientFactory for ProtocolGRPC.
+func newGRPCClientProtocol(ctx context.Context, config *ClientProtocolConfig) (ClientProtocol, error) {
+	client, err := newGRPCClient(ctx, config.DoneCtx, config.client)
+	if err != nil {
+		return nil, err
+	}
+
+	return client, nil
+}
+
 // GRPCClient connects to a GRPCServer over gRPC to dispense plugin types.
 type GRPCClient struct {
 	Conn    *grpc.ClientConn
@@ -99,17 +187,56 @@ type GRPCClient struct {
 	broker  *GRPCBroker
 
 	controller plugin.GRPCControllerClient
+	stdio      *grpcStdioClient
+
+	// tracer creates spans around dispensing plugins, if non-nil.
+	tracer *tracer
+
+	// shutdownTimeout is the grace period the plugin is given to drain
+	// in-flight RPCs when the client is closed. ownsProcess is true if
+	// doneCtx is done once the plugin exits, which it isn't when reattached
+	// in test mode.
+	shutdownTimeout time.Duration
+	ownsProcess     bool
 }
 
 // ClientProtocol impl.
 func (c *GRPCClient) Close() error {
 	c.broker.Close()
-	c.controller.Shutdown(c.doneCtx, &plugin.Empty{})
+	_, err := c.controller.Shutdown(c.doneCtx, &plugin.ShutdownRequest{
+		GracePeriod: int64(c.shutdownTimeout),
+	})
+
+	// The plugin drains in-flight RPCs before it exits, so the connection is
+	// kept open for them until it has, or its grace period is over. Plugins
+	// this client doesn't own, such as ones in test mode, aren't waited for,
+	// since their exit isn't observed.
+	if err == nil && c.ownsProcess && c.shutdownTimeout > 0 {
+		timer := time.NewTimer(c.shutdownTimeout)
+		defer timer.Stop()
+		select {
+		case <-c.doneCtx.Done():
+		case <-timer.C:
+		}
+	}
+
 	return c.Conn.Close()
 }
 
 // ClientProtocol impl.
 func (c *GRPCClient) Dispense(name string) (interface{}, error) {
+	return c.DispenseContext(context.Background(), name)
+}
+
+// ClientProtocol impl.
+func (c *GRPCClient) DispenseContext(ctx context.Context, name string) (_ interface{}, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	_, span := c.tracer.start(ctx, "plugin.dispense", "plugin.name", name, "rpc.system", "grpc")
+	defer func() { span.end(err) }()
+
 	raw, ok := c.Plugins[name]
 	if !ok {
 		return nil, fmt.Errorf("unknown plugin type: %s", name)
@@ -123,10 +250,41 @@ func (c *GRPCClient) Dispense(name string) (interface{}, error) {
 	return p.GRPCClient(c.doneCtx, c.broker, c.Conn)
 }
 
+// metadata asks the plugin for its metadata.
+func (c *GRPCClient) metadata(ctx context.Context) (*PluginMetadata, error) {
+	client := plugin.NewGRPCMetadataClient(c.Conn)
+	resp, err := client.Metadata(ctx, &empty.Empty{})
+	if status.Code(err) == codes.Unimplemented {
+		return nil, ErrMetadataNotSupported
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return metadataFromProto(resp), nil
+}
+
+// setLogLevel changes the level of the plugin's logger.
+func (c *GRPCClient) setLogLevel(ctx context.Context, level hclog.Level) error {
+	_, err := c.controller.SetLogLevel(ctx, &plugin.SetLogLevelRequest{
+		Level: level.String(),
+	})
+	if status.Code(err) == codes.Unimplemented {
+		return ErrSetLogLevelNotSupported
+	}
+
+	return err
+}
+
 // ClientProtocol impl.
 func (c *GRPCClient) Ping() error {
+	return c.PingContext(context.Background())
+}
+
+// ClientProtocol impl.
+func (c *GRPCClient) PingContext(ctx context.Context) error {
 	client := grpc_health_v1.NewHealthClient(c.Conn)
-	_, err := client.Check(context.Background(), &grpc_health_v1.HealthCheckRequest{
+	_, err := client.Check(ctx, &grpc_health_v1.HealthCheckRequest{
 		Service: GRPCServiceName,
 	})
 
@@ -51,6 +51,55 @@ func testGRPCClientApp(t *testing.T, multiplex bool) {
 	}
 }
 
+// Multiplexed streams for different IDs can be established concurrently and
+// in any order, whichever side serves them.
+func TestGRPC_MuxConcurrent(t *testing.T) {
+	client, server := TestPluginGRPCConn(t, true, map[string]Plugin{
+		"test": new(testGRPCInterfacePlugin),
+	})
+	defer client.Close()
+	defer server.Stop()
+
+	for name, brokers := range map[string][2]*GRPCBroker{
+		"host serves":   {client.broker, server.broker},
+		"plugin serves": {server.broker, client.broker},
+	} {
+		t.Run(name, func(t *testing.T) {
+			acceptor, dialer := brokers[0], brokers[1]
+
+			ids := make([]uint32, 5)
+			for i := range ids {
+				ids[i] = acceptor.NextId()
+				go acceptor.AcceptAndServe(ids[i], func(opts []grpc.ServerOption) *grpc.Server {
+					s := grpc.NewServer(opts...)
+					grpctest.RegisterPingPongServer(s, &pingPongServer{})
+					return s
+				})
+			}
+
+			errCh := make(chan error, len(ids))
+			for i := len(ids) - 1; i >= 0; i-- {
+				go func(id uint32) {
+					conn, err := dialer.Dial(id)
+					if err != nil {
+						errCh <- err
+						return
+					}
+					defer conn.Close()
+
+					_, err = grpctest.NewPingPongClient(conn).Ping(context.Background(), &grpctest.PingRequest{})
+					errCh <- err
+				}(ids[i])
+			}
+			for range ids {
+				if err := <-errCh; err != nil {
+					t.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
 func TestGRPCConn_BidirectionalPing(t *testing.T) {
 	conn, _ := TestGRPCConn(t, func(s *grpc.Server) {
 		grpctest.RegisterPingPongServer(s, &pingPongServer{})
@@ -163,7 +212,7 @@ func testGRPCClientReflection(t *testing.T, multiplex bool) {
 	}
 
 	// TODO: maybe only assert some specific services here to make test more resilient
-	expectedSvcs := []string{"grpc.health.v1.Health", "grpc.reflection.v1alpha.ServerReflection", "grpctest.Test", "plugin.GRPCBroker", "plugin.GRPCController", "plugin.GRPCStdio"}
+	expectedSvcs := []string{"grpc.health.v1.Health", "grpc.reflection.v1alpha.ServerReflection", "grpctest.Test", "plugin.GRPCBroker", "plugin.GRPCController", "plugin.GRPCMetadata", "plugin.GRPCStdio"}
 
 	if !reflect.DeepEqual(svcs, expectedSvcs) {
 		t.Fatalf("expected: %v\ngot: %v", expectedSvcs, svcs)
@@ -5,8 +5,11 @@ package plugin
 
 import (
 	"context"
+	"time"
 
 	"github.com/hashicorp/go-plugin/internal/plugin"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 // GRPCControllerServer handles shutdown calls to terminate the server when the
@@ -15,12 +18,25 @@ type grpcControllerServer struct {
 	server *GRPCServer
 }
 
-// Shutdown stops the grpc server. It first will attempt a graceful stop, then a
-// full stop on the server.
-func (s *grpcControllerServer) Shutdown(ctx context.Context, _ *plugin.Empty) (*plugin.Empty, error) {
-	resp := &plugin.Empty{}
+// Shutdown stops the grpc server gracefully in the background, since
+// GracefulStop would otherwise wait on this very RPC. Older clients don't
+// send a grace period, in which case they are given the default one, like
+// net/rpc clients, whose Control.Quit can't carry it.
+func (s *grpcControllerServer) Shutdown(ctx context.Context, req *plugin.ShutdownRequest) (*plugin.Empty, error) {
+	gracePeriod := time.Duration(req.GracePeriod)
+	if gracePeriod <= 0 {
+		gracePeriod = defaultGracefulShutdownTimeout
+	}
 
-	// TODO: figure out why GracefullStop doesn't work.
-	s.server.Stop()
-	return resp, nil
+	go s.server.shutdown(gracePeriod)
+	return &plugin.Empty{}, nil
+}
+
+// SetLogLevel changes the level of the plugin's logger.
+func (s *grpcControllerServer) SetLogLevel(ctx context.Context, req *plugin.SetLogLevelRequest) (*plugin.Empty, error) {
+	if err := setServerLogLevel(s.server.logger, req.Level); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	return &plugin.Empty{}, nil
 }
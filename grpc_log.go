@@ -0,0 +1,384 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	empty "github.com/golang/protobuf/ptypes/empty"
+	hclog "github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-plugin/internal/plugin"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// grpcLogBuffer is the number of log entries buffered until the client reads
+// them. Entries logged while the buffer is full are dropped, so that a client
+// that isn't reading can't block the plugin, and reported once it catches up.
+const grpcLogBuffer = 1024
+
+// resettableInterceptLogger is the logger grpcLogServer needs: one that
+// accepts sinks and whose output can be discarded.
+type resettableInterceptLogger interface {
+	hclog.InterceptLogger
+	hclog.OutputResettable
+}
+
+// grpcLogServer implements the GRPCLogSink service. It is registered as a
+// sink on the plugin's hclog.InterceptLogger and streams what it logs.
+type grpcLogServer struct {
+	logger resettableInterceptLogger
+
+	// stderr is where the logger's output is restored to once the server
+	// is closed.
+	stderr io.Writer
+
+	entryCh chan *plugin.LogEntry
+
+	// dropped is the number of entries dropped since the last report, and
+	// must be accessed atomically.
+	dropped uint64
+
+	// quitCh is closed to end any active streams.
+	quitCh    chan struct{}
+	closeOnce sync.Once
+}
+
+// newGRPCLogServer creates a grpcLogServer that streams the entries logged by
+// logger. Streaming requires an hclog.InterceptLogger whose output can be
+// reset, so this returns nil for any other logger, which keeps logging to
+// stderr.
+//
+// The logger's own output is discarded while the server is running, so that
+// the client doesn't receive entries both over the stream and on stderr.
+func newGRPCLogServer(logger hclog.Logger) *grpcLogServer {
+	il, ok := logger.(resettableInterceptLogger)
+	if !ok {
+		return nil
+	}
+
+	if err := il.ResetOutput(&hclog.LoggerOptions{Output: io.Discard}); err != nil {
+		return nil
+	}
+
+	s := &grpcLogServer{
+		logger:  il,
+		stderr:  os.Stderr,
+		entryCh: make(chan *plugin.LogEntry, grpcLogBuffer),
+		quitCh:  make(chan struct{}),
+	}
+	il.RegisterSink(s)
+
+	return s
+}
+
+// Close stops streaming, after sending what is buffered to an active stream.
+// The logger writes to stderr again from then on.
+func (s *grpcLogServer) Close() {
+	s.closeOnce.Do(func() {
+		s.logger.DeregisterSink(s)
+		s.logger.ResetOutput(&hclog.LoggerOptions{Output: s.stderr})
+		close(s.quitCh)
+	})
+}
+
+// Accept implements hclog.SinkAdapter.
+func (s *grpcLogServer) Accept(name string, level hclog.Level, msg string, args ...interface{}) {
+	// Sinks see every entry, whatever the level of the logger.
+	if !levelEnabled(s.logger, level) {
+		return
+	}
+
+	entry := &plugin.LogEntry{
+		Timestamp: timestamppb.Now(),
+		Level:     logLevelToProto(level),
+		Name:      name,
+		Message:   msg,
+		Args:      logArgsToProto(args),
+	}
+
+	select {
+	case s.entryCh <- entry:
+	default:
+		atomic.AddUint64(&s.dropped, 1)
+	}
+}
+
+// send sends an entry on the stream. Once the buffer has been drained, any
+// entries dropped meanwhile are reported.
+func (s *grpcLogServer) send(srv plugin.GRPCLogSink_StreamLogsServer, entry *plugin.LogEntry) error {
+	if err := srv.Send(entry); err != nil {
+		return err
+	}
+	if len(s.entryCh) > 0 {
+		return nil
+	}
+
+	return s.sendDropped(srv)
+}
+
+// sendDropped sends an entry reporting the number of entries dropped since
+// the last report, if any were.
+func (s *grpcLogServer) sendDropped(srv plugin.GRPCLogSink_StreamLogsServer) error {
+	n := atomic.SwapUint64(&s.dropped, 0)
+	if n == 0 {
+		return nil
+	}
+
+	return srv.Send(&plugin.LogEntry{
+		Timestamp: timestamppb.Now(),
+		Level:     plugin.LogEntry_WARN,
+		Message:   "plugin log entries were dropped because the log buffer was full",
+		Args:      logArgsToProto([]interface{}{"dropped", n}),
+		Dropped:   n,
+	})
+}
+
+// StreamLogs streams the logged entries as the response.
+func (s *grpcLogServer) StreamLogs(
+	_ *empty.Empty,
+	srv plugin.GRPCLogSink_StreamLogsServer,
+) error {
+	for {
+		select {
+		case entry := <-s.entryCh:
+			if err := s.send(srv, entry); err != nil {
+				return err
+			}
+
+		case <-srv.Context().Done():
+			return nil
+
+		case <-s.quitCh:
+			// Send whatever was logged before the server was closed.
+			for {
+				select {
+				case entry := <-s.entryCh:
+					if err := s.send(srv, entry); err != nil {
+						return err
+					}
+				default:
+					return s.sendDropped(srv)
+				}
+			}
+		}
+	}
+}
+
+// grpcLogClient wraps the log service as a client to re-emit the plugin's
+// log entries into the host's logger.
+type grpcLogClient struct {
+	log       hclog.Logger
+	logClient plugin.GRPCLogSink_StreamLogsClient
+
+	// dropped counts the entries the plugin reported dropping, and must be
+	// accessed atomically.
+	dropped *uint64
+}
+
+// newGRPCLogClient creates a grpcLogClient, connecting to the log service
+// immediately. If the service is unavailable the client does nothing, and the
+// plugin's logs are read from stderr instead. The number of entries the
+// plugin reports dropping is added to dropped.
+func newGRPCLogClient(
+	ctx context.Context,
+	log hclog.Logger,
+	conn *grpc.ClientConn,
+	dropped *uint64,
+) (*grpcLogClient, error) {
+	client := plugin.NewGRPCLogSinkClient(conn)
+
+	logClient, err := client.StreamLogs(ctx, &empty.Empty{})
+	if status.Code(err) == codes.Unavailable || status.Code(err) == codes.Unimplemented {
+		log.Warn("log service not available, plugin logs are read from stderr")
+		logClient = nil
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &grpcLogClient{
+		log:       log,
+		logClient: logClient,
+		dropped:   dropped,
+	}, nil
+}
+
+// Run starts the loop that receives log entries and logs them. This blocks
+// and should be run in a goroutine.
+func (c *grpcLogClient) Run() {
+	if c.logClient == nil {
+		return
+	}
+
+	for {
+		entry, err := c.logClient.Recv()
+		if err != nil {
+			if err == io.EOF ||
+				status.Code(err) == codes.Unavailable ||
+				status.Code(err) == codes.Canceled ||
+				status.Code(err) == codes.Unimplemented ||
+				err == context.Canceled {
+				return
+			}
+
+			c.log.Error("error receiving log entry", "err", err)
+			return
+		}
+
+		c.emit(entry)
+	}
+}
+
+// emit logs an entry received from the plugin, the same way logStderr logs
+// entries parsed from stderr.
+func (c *grpcLogClient) emit(entry *plugin.LogEntry) {
+	if entry.Dropped > 0 {
+		atomic.AddUint64(c.dropped, entry.Dropped)
+	}
+
+	args := logArgsFromProto(entry.Args)
+	if entry.Name != "" {
+		args = append(args, "@module", entry.Name)
+	}
+	args = append(args, "timestamp", entry.Timestamp.AsTime().Local().Format(hclog.TimeFormat))
+
+	switch entry.Level {
+	case plugin.LogEntry_TRACE:
+		c.log.Trace(entry.Message, args...)
+	case plugin.LogEntry_DEBUG:
+		c.log.Debug(entry.Message, args...)
+	case plugin.LogEntry_INFO:
+		c.log.Info(entry.Message, args...)
+	case plugin.LogEntry_WARN:
+		c.log.Warn(entry.Message, args...)
+	case plugin.LogEntry_ERROR:
+		c.log.Error(entry.Message, args...)
+	default:
+		c.log.Debug(entry.Message, args...)
+	}
+}
+
+// levelEnabled returns true if l emits entries at the given level.
+func levelEnabled(l hclog.Logger, level hclog.Level) bool {
+	switch level {
+	case hclog.Trace:
+		return l.IsTrace()
+	case hclog.Debug:
+		return l.IsDebug()
+	case hclog.Info:
+		return l.IsInfo()
+	case hclog.Warn:
+		return l.IsWarn()
+	case hclog.Error:
+		return l.IsError()
+	default:
+		return true
+	}
+}
+
+func logLevelToProto(level hclog.Level) plugin.LogEntry_Level {
+	switch level {
+	case hclog.Trace:
+		return plugin.LogEntry_TRACE
+	case hclog.Debug:
+		return plugin.LogEntry_DEBUG
+	case hclog.Info:
+		return plugin.LogEntry_INFO
+	case hclog.Warn:
+		return plugin.LogEntry_WARN
+	case hclog.Error:
+		return plugin.LogEntry_ERROR
+	default:
+		return plugin.LogEntry_NOT_SET
+	}
+}
+
+// logArgsToProto converts hclog key/value pairs. Like hclog, a value without
+// a key is given the key "EXTRA_VALUE_AT_END".
+func logArgsToProto(args []interface{}) []*plugin.LogArg {
+	if len(args)%2 != 0 {
+		args = append(args[:len(args)-1:len(args)-1], "EXTRA_VALUE_AT_END", args[len(args)-1])
+	}
+
+	result := make([]*plugin.LogArg, 0, len(args)/2)
+	for i := 0; i < len(args); i += 2 {
+		key, ok := args[i].(string)
+		if !ok {
+			key = fmt.Sprintf("%v", args[i])
+		}
+
+		result = append(result, logArgToProto(key, args[i+1]))
+	}
+
+	return result
+}
+
+func logArgToProto(key string, v interface{}) *plugin.LogArg {
+	arg := &plugin.LogArg{Key: key}
+
+	switch v := v.(type) {
+	case nil:
+		arg.Value = &plugin.LogArg_StringValue{StringValue: "<nil>"}
+	case string:
+		arg.Value = &plugin.LogArg_StringValue{StringValue: v}
+	case bool:
+		arg.Value = &plugin.LogArg_BoolValue{BoolValue: v}
+	case time.Duration:
+		arg.Value = &plugin.LogArg_DurationValue{DurationValue: int64(v)}
+	case error:
+		arg.Value = &plugin.LogArg_StringValue{StringValue: v.Error()}
+	case fmt.Stringer:
+		arg.Value = &plugin.LogArg_StringValue{StringValue: v.String()}
+	default:
+		rv := reflect.ValueOf(v)
+		switch rv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			arg.Value = &plugin.LogArg_IntValue{IntValue: rv.Int()}
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			arg.Value = &plugin.LogArg_UintValue{UintValue: rv.Uint()}
+		case reflect.Float32, reflect.Float64:
+			arg.Value = &plugin.LogArg_FloatValue{FloatValue: rv.Float()}
+		default:
+			arg.Value = &plugin.LogArg_StringValue{StringValue: fmt.Sprintf("%v", v)}
+		}
+	}
+
+	return arg
+}
+
+func logArgsFromProto(args []*plugin.LogArg) []interface{} {
+	result := make([]interface{}, 0, len(args)*2)
+	for _, arg := range args {
+		var v interface{}
+		switch value := arg.Value.(type) {
+		case *plugin.LogArg_StringValue:
+			v = value.StringValue
+		case *plugin.LogArg_IntValue:
+			v = value.IntValue
+		case *plugin.LogArg_UintValue:
+			v = value.UintValue
+		case *plugin.LogArg_FloatValue:
+			v = value.FloatValue
+		case *plugin.LogArg_BoolValue:
+			v = value.BoolValue
+		case *plugin.LogArg_DurationValue:
+			v = time.Duration(value.DurationValue)
+		}
+
+		result = append(result, arg.Key, v)
+	}
+
+	return result
+}
@@ -0,0 +1,155 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	empty "github.com/golang/protobuf/ptypes/empty"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-plugin/internal/plugin"
+	"google.golang.org/grpc"
+)
+
+func TestGRPCLogServer(t *testing.T) {
+	var buf bytes.Buffer
+	logger := hclog.NewInterceptLogger(&hclog.LoggerOptions{
+		Level:  hclog.Debug,
+		Output: &buf,
+	})
+
+	s := newGRPCLogServer(logger)
+	if s == nil {
+		t.Fatal("expected a log server")
+	}
+
+	logger.Named("sub").Info("typed entry",
+		"int", 42,
+		"uint", uint8(7),
+		"float", float32(0.5),
+		"bool", true,
+		"duration", 3*time.Second,
+		"error", errors.New("boom"),
+		"nil", nil,
+		"extra")
+	logger.Trace("filtered out by the logger's level")
+
+	var entry *plugin.LogEntry
+	select {
+	case entry = <-s.entryCh:
+	default:
+		t.Fatal("expected an entry")
+	}
+	select {
+	case entry := <-s.entryCh:
+		t.Fatalf("bad: %#v", entry)
+	default:
+	}
+
+	if entry.Name != "sub" || entry.Level != plugin.LogEntry_INFO || entry.Message != "typed entry" {
+		t.Fatalf("bad: %#v", entry)
+	}
+	if time.Since(entry.Timestamp.AsTime()) > time.Minute {
+		t.Fatalf("bad timestamp: %s", entry.Timestamp.AsTime())
+	}
+
+	expected := []interface{}{
+		"int", int64(42),
+		"uint", uint64(7),
+		"float", float64(0.5),
+		"bool", true,
+		"duration", 3 * time.Second,
+		"error", "boom",
+		"nil", "<nil>",
+		"EXTRA_VALUE_AT_END", "extra",
+	}
+	if actual := logArgsFromProto(entry.Args); !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+
+	// Entries aren't written to the logger's output while they're streamed,
+	// and are once the server is closed.
+	if buf.Len() != 0 {
+		t.Fatalf("bad: %s", buf.String())
+	}
+	s.stderr = &buf
+	s.Close()
+	logger.Info("after close")
+	if !strings.Contains(buf.String(), "after close") {
+		t.Fatalf("bad: %s", buf.String())
+	}
+	if len(s.entryCh) != 0 {
+		t.Fatal("entries should not be streamed after close")
+	}
+}
+
+func TestGRPCLogServer_notIntercept(t *testing.T) {
+	if s := newGRPCLogServer(hclog.NewNullLogger()); s != nil {
+		t.Fatalf("bad: %#v", s)
+	}
+}
+
+func TestGRPCLogServer_dropped(t *testing.T) {
+	logger := hclog.NewInterceptLogger(&hclog.LoggerOptions{
+		Level:  hclog.Trace,
+		Output: io.Discard,
+	})
+	s := newGRPCLogServer(logger)
+	defer s.Close()
+
+	for i := 0; i < grpcLogBuffer+10; i++ {
+		logger.Info("entry", "i", i)
+	}
+	if n := atomic.LoadUint64(&s.dropped); n != 10 {
+		t.Fatalf("expected 10 dropped entries, got %d", n)
+	}
+
+	// Once the buffer is drained, the drops are reported, and counted by the
+	// client.
+	srv := &testLogStreamServer{ctx: context.Background()}
+	s.Close()
+	if err := s.StreamLogs(&empty.Empty{}, srv); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(srv.entries) != grpcLogBuffer+1 {
+		t.Fatalf("expected %d entries, got %d", grpcLogBuffer+1, len(srv.entries))
+	}
+	report := srv.entries[grpcLogBuffer]
+	if report.Dropped != 10 || report.Level != plugin.LogEntry_WARN {
+		t.Fatalf("bad: %#v", report)
+	}
+
+	var dropped uint64
+	c := &grpcLogClient{log: hclog.NewNullLogger(), dropped: &dropped}
+	for _, entry := range srv.entries {
+		c.emit(entry)
+	}
+	if dropped != 10 {
+		t.Fatalf("expected 10 dropped entries, got %d", dropped)
+	}
+}
+
+// testLogStreamServer records the entries sent by StreamLogs.
+type testLogStreamServer struct {
+	grpc.ServerStream
+	ctx     context.Context
+	entries []*plugin.LogEntry
+}
+
+func (s *testLogStreamServer) Context() context.Context {
+	return s.ctx
+}
+
+func (s *testLogStreamServer) Send(entry *plugin.LogEntry) error {
+	s.entries = append(s.entries, entry)
+	return nil
+}
@@ -5,11 +5,13 @@ package plugin
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net"
+	"time"
 
 	hclog "github.com/hashicorp/go-hclog"
 	"github.com/hashicorp/go-plugin/internal/grpcmux"
@@ -56,14 +58,63 @@ type GRPCServer struct {
 	Stdout io.Reader
 	Stderr io.Reader
 
+	// Stdin, if non-nil, is where the stdin forwarded by the client is
+	// written. It is closed when the client reaches the end of its stdin.
+	Stdin io.WriteCloser
+
 	config      GRPCServerConfig
 	server      *grpc.Server
 	broker      *GRPCBroker
 	stdioServer *grpcStdioServer
+	logServer   *grpcLogServer
 
 	logger hclog.Logger
 
 	muxer *grpcmux.GRPCServerMuxer
+
+	onShutdown  func(context.Context) error
+	metadata    *PluginMetadata
+	stdioBuffer *StdioBufferConfig
+	metrics     *metricsRecorder
+	tracer      *tracer
+
+	brokerConfig *BrokerConfig
+}
+
+// newGRPCServerProtocol is the ServerFactory for ProtocolGRPC.
+func newGRPCServerProtocol(config *ServerProtocolConfig) (ServerProtocol, net.Listener, error) {
+	listener := config.Listener
+	var muxer *grpcmux.GRPCServerMuxer
+	if config.clientCaps.Bool(capabilityGRPCBrokerMultiplex) {
+		muxer = grpcmux.NewGRPCServerMuxer(config.Logger, listener,
+			config.clientCaps.Bool(capabilityGRPCBrokerMultiplexIDs))
+		listener = muxer
+	}
+
+	// Create the gRPC server
+	server := &GRPCServer{
+		Plugins: config.Plugins,
+		Server:  config.ServeConfig.GRPCServer,
+		TLS:     config.TLS,
+		Stdout:  config.Stdout,
+		Stderr:  config.Stderr,
+		Stdin:   config.Stdin,
+		DoneCh:  config.DoneCh,
+		logger:  config.Logger,
+		muxer:   muxer,
+
+		logServer: config.logSink,
+
+		onShutdown:  config.ServeConfig.OnShutdown,
+		metadata:    config.ServeConfig.Metadata,
+		stdioBuffer: config.ServeConfig.StdioBuffer,
+		metrics:     serverMetrics(config.ServeConfig.Metrics, ProtocolGRPC),
+		tracer:      newTracer(config.ServeConfig.Tracing),
+
+		brokerConfig: config.ServeConfig.Broker,
+	}
+
+	return server, listener, nil
 }
 
 // ServerProtocol impl.
@@ -73,6 +124,10 @@ func (s *GRPCServer) Init() error {
 	if s.TLS != nil {
 		opts = append(opts, grpc.Creds(credentials.NewTLS(s.TLS)))
 	}
+	opts = append(opts, s.tracer.serverOptions()...)
+	if s.metrics != nil {
+		opts = append(opts, s.metrics.serverOptions()...)
+	}
 	s.server = s.Server(opts)
 
 	// Register the health service
@@ -87,17 +142,29 @@ func (s *GRPCServer) Init() error {
 	// Register the broker service
 	brokerServer := newGRPCBrokerServer()
 	plugin.RegisterGRPCBrokerServer(s.server, brokerServer)
-	s.broker = newGRPCBroker(brokerServer, s.TLS, unixSocketConfigFromEnv(), nil, s.muxer)
+	s.broker = newGRPCBroker(brokerServer, s.TLS, unixSocketConfigFromEnv(), nil, s.muxer, s.brokerConfig)
+	s.broker.tracer = s.tracer
+	s.broker.handleNamespace = brokerHandlePlugin
 	go s.broker.Run()
 
 	// Register the controller
 	controllerServer := &grpcControllerServer{server: s}
 	plugin.RegisterGRPCControllerServer(s.server, controllerServer)
 
+	// Register the metadata service
+	plugin.RegisterGRPCMetadataServer(s.server, &grpcMetadataServer{
+		metadata: metadataToProto(serverMetadata(s.metadata)),
+	})
+
 	// Register the stdio service
-	s.stdioServer = newGRPCStdioServer(s.logger, s.Stdout, s.Stderr)
+	s.stdioServer = newGRPCStdioServer(s.logger, s.Stdout, s.Stderr, s.Stdin, s.stdioBuffer)
 	plugin.RegisterGRPCStdioServer(s.server, s.stdioServer)
 
+	// Register the log service, if the plugin's logs are streamed
+	if s.logServer != nil {
+		plugin.RegisterGRPCLogSinkServer(s.server, s.logServer)
+	}
+
 	// Register all our plugins onto the gRPC server.
 	for k, raw := range s.Plugins {
 		p, ok := raw.(GRPCPlugin)
@@ -135,6 +202,42 @@ func (s *GRPCServer) GracefulStop() {
 	}
 }
 
+// shutdown gracefully stops the server on behalf of a client. The shutdown
+// hook runs first, then long-lived streams are closed so that they don't hold
+// up GracefulStop, and in-flight RPCs are drained. Whatever is still running
+// once the grace period is over is stopped forcefully.
+func (s *GRPCServer) shutdown(gracePeriod time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), gracePeriod)
+	defer cancel()
+
+	if s.onShutdown != nil {
+		if err := s.onShutdown(ctx); err != nil {
+			s.logger.Error("plugin shutdown hook", "error", err)
+		}
+	}
+
+	s.stdioServer.Close()
+	if s.logServer != nil {
+		s.logServer.Close()
+	}
+	if s.broker != nil {
+		s.broker.Close()
+	}
+
+	stoppedCh := make(chan struct{})
+	go func() {
+		defer close(stoppedCh)
+		s.server.GracefulStop()
+	}()
+
+	select {
+	case <-stoppedCh:
+	case <-ctx.Done():
+		s.logger.Warn("plugin did not stop within the grace period, forcing stop")
+		s.server.Stop()
+	}
+}
+
 // Config is the GRPCServerConfig encoded as JSON then base64.
 func (s *GRPCServer) Config() string {
 	// Create a buffer that will contain our final contents
@@ -8,6 +8,9 @@ import (
 	"bytes"
 	"context"
 	"io"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	empty "github.com/golang/protobuf/ptypes/empty"
 	hclog "github.com/hashicorp/go-hclog"
@@ -24,84 +27,135 @@ const grpcStdioBuffer = 1 * 1024
 
 // grpcStdioServer implements the Stdio service and streams stdiout/stderr.
 type grpcStdioServer struct {
-	stdoutCh <-chan []byte
-	stderrCh <-chan []byte
+	buf *stdioBuffer
+
+	// stdin is the plugin's stdin, or nil if the host doesn't forward it.
+	stdin io.WriteCloser
+
+	// quitCh is closed to end any active streams.
+	quitCh    chan struct{}
+	closeOnce sync.Once
 }
 
-// newGRPCStdioServer creates a new grpcStdioServer and starts the stream
-// copying for the given out and err readers.
+// newGRPCStdioServer creates a new grpcStdioServer and starts copying the
+// given out and err readers into a buffer configured by bufConfig, which may
+// be nil. The stdin forwarded by the host is written to dstIn, which may be
+// nil if it isn't forwarded.
 //
 // This must only be called ONCE per srcOut, srcErr.
-func newGRPCStdioServer(log hclog.Logger, srcOut, srcErr io.Reader) *grpcStdioServer {
-	stdoutCh := make(chan []byte)
-	stderrCh := make(chan []byte)
+func newGRPCStdioServer(log hclog.Logger, srcOut, srcErr io.Reader, dstIn io.WriteCloser, bufConfig *StdioBufferConfig) *grpcStdioServer {
+	buf := newStdioBuffer(bufConfig)
 
 	// Begin copying the streams
-	go copyChan(log, stdoutCh, srcOut)
-	go copyChan(log, stderrCh, srcErr)
+	go copyStdio(log, buf, plugin.StdioData_STDOUT, srcOut)
+	go copyStdio(log, buf, plugin.StdioData_STDERR, srcErr)
 
 	// Construct our server
 	return &grpcStdioServer{
-		stdoutCh: stdoutCh,
-		stderrCh: stderrCh,
+		buf:    buf,
+		stdin:  dstIn,
+		quitCh: make(chan struct{}),
 	}
 }
 
-// StreamStdio streams our stdout/err as the response.
+// Close ends any active streams so that the server can stop gracefully.
+func (s *grpcStdioServer) Close() {
+	s.closeOnce.Do(func() {
+		close(s.quitCh)
+		s.buf.Close()
+	})
+}
+
+// StreamStdio streams our stdout/err as the response, starting from the
+// requested sequence number.
 func (s *grpcStdioServer) StreamStdio(
-	_ *empty.Empty,
+	req *plugin.StreamStdioRequest,
 	srv plugin.GRPCStdio_StreamStdioServer,
 ) error {
-	// Share the same data value between runs. Sending this over the wire
-	// marshals it so we can reuse this.
-	var data plugin.StdioData
-
+	next := req.FromSequence
 	for {
-		// Read our data
-		select {
-		case data.Data = <-s.stdoutCh:
-			data.Channel = plugin.StdioData_STDOUT
-
-		case data.Data = <-s.stderrCh:
-			data.Channel = plugin.StdioData_STDERR
+		chunks, changedCh := s.buf.since(next)
+		for _, data := range chunks {
+			if err := srv.Send(data); err != nil {
+				return err
+			}
+			s.buf.markSent(data.Sequence)
+			next = data.Sequence + 1
+		}
+		if len(chunks) > 0 {
+			continue
+		}
 
+		select {
+		case <-changedCh:
 		case <-srv.Context().Done():
 			return nil
+		case <-s.quitCh:
+			return nil
+		}
+	}
+}
+
+// StreamStdin writes the data streamed by the client to our stdin, which is
+// closed once the client closes the stream. If the stream ends for any other
+// reason, such as the client going away, stdin is left open so that a client
+// that reattaches can continue writing to it.
+func (s *grpcStdioServer) StreamStdin(srv plugin.GRPCStdio_StreamStdinServer) error {
+	if s.stdin == nil {
+		return status.Error(codes.FailedPrecondition, "stdin is not forwarded to this plugin")
+	}
+
+	for {
+		data, err := srv.Recv()
+		if err == io.EOF {
+			s.stdin.Close()
+			return srv.SendAndClose(&empty.Empty{})
+		}
+		if err != nil {
+			return err
 		}
 
-		// Not sure if this is possible, but if we somehow got here and
-		// we didn't populate any data at all, then just continue.
-		if len(data.Data) == 0 {
+		if data.Channel != plugin.StdioData_STDIN {
 			continue
 		}
-
-		// Send our data to the client.
-		if err := srv.Send(&data); err != nil {
-			return err
+		if _, err := s.stdin.Write(data.Data); err != nil {
+			return status.Errorf(codes.Aborted, "error writing to stdin: %s", err)
 		}
 	}
 }
 
+// grpcStdioReconnects is the number of times grpcStdioClient tries to
+// resume a stream that was dropped.
+const grpcStdioReconnects = 3
+
 // grpcStdioClient wraps the stdio service as a client to copy
 // the stdio data to output writers.
 type grpcStdioClient struct {
 	log         hclog.Logger
+	ctx         context.Context
+	client      plugin.GRPCStdioClient
 	stdioClient plugin.GRPCStdio_StreamStdioClient
+
+	// last is the sequence number of the last chunk received. It is read
+	// atomically.
+	last uint64
 }
 
 // newGRPCStdioClient creates a grpcStdioClient. This will perform the
-// initial connection to the stdio service. If the stdio service is unavailable
-// then this will be a no-op. This allows this to work without error for
-// plugins that don't support this.
+// initial connection to the stdio service, resuming from the chunk after the
+// given sequence number. If the stdio service is unavailable then this will
+// be a no-op. This allows this to work without error for plugins that don't
+// support this.
 func newGRPCStdioClient(
 	ctx context.Context,
 	log hclog.Logger,
 	conn *grpc.ClientConn,
+	last uint64,
 ) (*grpcStdioClient, error) {
 	client := plugin.NewGRPCStdioClient(conn)
 
 	// Connect immediately to the endpoint
-	stdioClient, err := client.StreamStdio(ctx, &empty.Empty{})
+	stdioClient, err := client.StreamStdio(ctx, &plugin.StreamStdioRequest{FromSequence: last + 1})
 
 	// If we get an Unavailable or Unimplemented error, this means that the plugin isn't
 	// updated and linking to the latest version of go-plugin that supports
@@ -117,10 +171,18 @@ func newGRPCStdioClient(
 
 	return &grpcStdioClient{
 		log:         log,
+		ctx:         ctx,
+		client:      client,
 		stdioClient: stdioClient,
+		last:        last,
 	}, nil
 }
 
+// lastSequence returns the sequence number of the last chunk received.
+func (c *grpcStdioClient) lastSequence() uint64 {
+	return atomic.LoadUint64(&c.last)
+}
+
 // Run starts the loop that receives stdio data and writes it to the given
 // writers. This blocks and should be run in a goroutine.
 func (c *grpcStdioClient) Run(stdout, stderr io.Writer) {
@@ -130,12 +192,12 @@ func (c *grpcStdioClient) Run(stdout, stderr io.Writer) {
 		return
 	}
 
+	reconnects := 0
 	for {
 		c.log.Trace("waiting for stdio data")
 		data, err := c.stdioClient.Recv()
 		if err != nil {
 			if err == io.EOF ||
-				status.Code(err) == codes.Unavailable ||
 				status.Code(err) == codes.Canceled ||
 				status.Code(err) == codes.Unimplemented ||
 				err == context.Canceled {
@@ -143,9 +205,41 @@ func (c *grpcStdioClient) Run(stdout, stderr io.Writer) {
 				return
 			}
 
+			// The stream was dropped, so resume it from where it left off
+			// unless the plugin went away.
+			if reconnects < grpcStdioReconnects && c.ctx.Err() == nil {
+				reconnects++
+				c.log.Debug("stdio stream dropped, resuming", "err", err, "attempt", reconnects)
+				time.Sleep(time.Duration(reconnects) * 100 * time.Millisecond)
+
+				stdioClient, rerr := c.client.StreamStdio(c.ctx, &plugin.StreamStdioRequest{
+					FromSequence: c.lastSequence() + 1,
+				})
+				if rerr == nil {
+					c.stdioClient = stdioClient
+					continue
+				}
+				err = rerr
+			}
+
+			if status.Code(err) == codes.Unavailable {
+				c.log.Debug("received EOF, stopping recv loop", "err", err)
+				return
+			}
+
 			c.log.Error("error receiving data", "err", err)
 			return
 		}
+		reconnects = 0
+
+		// Chunks the plugin dropped show up as gaps in the sequence numbers.
+		// Plugins that predate sequence numbers don't set them at all.
+		if data.Sequence != 0 {
+			if last := c.lastSequence(); data.Sequence > last+1 {
+				c.log.Warn("plugin dropped stdio data", "chunks", data.Sequence-last-1)
+			}
+			atomic.StoreUint64(&c.last, data.Sequence)
+		}
 
 		// Determine our output writer based on channel
 		var w io.Writer
@@ -171,13 +265,54 @@ func (c *grpcStdioClient) Run(stdout, stderr io.Writer) {
 	}
 }
 
-// copyChan copies an io.Reader into a channel.
-func copyChan(log hclog.Logger, dst chan<- []byte, src io.Reader) {
+// syncGRPCStdin streams src to the plugin's stdin until it reaches EOF, at
+// which point the plugin's stdin is closed. This blocks and should be run in
+// a goroutine.
+func syncGRPCStdin(ctx context.Context, log hclog.Logger, conn *grpc.ClientConn, src io.Reader) {
+	stream, err := plugin.NewGRPCStdioClient(conn).StreamStdin(ctx)
+	if err != nil {
+		log.Error("error forwarding stdin", "err", err)
+		return
+	}
+
+	data := plugin.StdioData{Channel: plugin.StdioData_STDIN}
+	buf := make([]byte, grpcStdioBuffer)
+	for {
+		n, err := src.Read(buf)
+		if n > 0 {
+			data.Data = buf[:n]
+			if err := stream.Send(&data); err != nil {
+				// The actual error is returned by CloseAndRecv.
+				break
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.Error("error reading stdin", "err", err)
+			break
+		}
+	}
+
+	_, err = stream.CloseAndRecv()
+	switch {
+	case err == nil:
+	case status.Code(err) == codes.Unimplemented || status.Code(err) == codes.FailedPrecondition:
+		log.Warn("plugin does not accept stdin, SyncStdin is ignored")
+	case status.Code(err) == codes.Unavailable || status.Code(err) == codes.Canceled || err == context.Canceled:
+	default:
+		log.Error("error forwarding stdin", "err", err)
+	}
+}
+
+// copyStdio copies an io.Reader into the stdio buffer as the given channel.
+func copyStdio(log hclog.Logger, dst *stdioBuffer, channel plugin.StdioData_Channel, src io.Reader) {
 	bufsrc := bufio.NewReader(src)
 
 	for {
 		// Make our data buffer. We allocate a new one per loop iteration
-		// so that we can send it over the channel.
+		// so that we can keep it in the stdio buffer.
 		var data [1024]byte
 
 		// Read the data, this will block until data is available
@@ -186,11 +321,9 @@ func copyChan(log hclog.Logger, dst chan<- []byte, src io.Reader) {
 		// We have to check if we have data BEFORE err != nil. The bufio
 		// docs guarantee n == 0 on EOF but its better to be safe here.
 		if n > 0 {
-			// We have data! Send it on the channel. This will block if there
-			// is no reader on the other side. We expect that go-plugin will
-			// connect immediately to the stdio server to drain this so we want
-			// this block to happen for backpressure.
-			dst <- data[:n]
+			// We have data! Buffer it. Depending on the overflow policy this
+			// may block until a client reads it, which provides backpressure.
+			dst.write(channel, data[:n])
 		}
 
 		// If we hit EOF we're done copying
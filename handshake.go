@@ -0,0 +1,136 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Capabilities that may be advertised in the handshake. Clients advertise
+// them to the plugin through the PLUGIN_CLIENT_CAPABILITIES environment
+// variable, and plugins advertise them back in the last segment of a version 2
+// handshake line.
+const (
+	// capabilityGRPCBrokerMultiplex is set to "true" when the gRPC broker
+	// multiplexes brokered servers over the plugin's listener.
+	capabilityGRPCBrokerMultiplex = "grpc_broker_multiplex"
+
+	// capabilityGRPCBrokerMultiplexIDs is set to "true" when multiplexed
+	// gRPC broker streams are prefixed with their ID, so that they can be
+	// established concurrently. Both sides must advertise it.
+	capabilityGRPCBrokerMultiplexIDs = "grpc_broker_multiplex_ids"
+
+	// capabilityGRPCLogSink is set to "true" when the plugin's log entries
+	// are streamed over the GRPCLogSink service rather than written to
+	// stderr.
+	capabilityGRPCLogSink = "grpc_log_sink"
+
+	// capabilitySyncStdin is set to "true" when the host's stdin is forwarded
+	// to the plugin over the RPC connection. Clients only advertise it if
+	// ClientConfig.SyncStdin is set, since the plugin's own stdin is
+	// replaced.
+	capabilitySyncStdin = "sync_stdin"
+)
+
+// capabilities is a set of key/value pairs exchanged during the handshake.
+type capabilities map[string]string
+
+// Bool returns true if the given capability is set to a true boolean value.
+func (c capabilities) Bool(key string) bool {
+	v, _ := strconv.ParseBool(c[key])
+	return v
+}
+
+// String encodes the capabilities as "k=v,k=v", sorted by key. Keys and
+// values are query escaped so that they can't contain the separators or the
+// "|" used to separate handshake segments.
+func (c capabilities) String() string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = url.QueryEscape(k) + "=" + url.QueryEscape(c[k])
+	}
+
+	return strings.Join(pairs, ",")
+}
+
+// parseCapabilities parses capabilities encoded by capabilities.String.
+func parseCapabilities(s string) (capabilities, error) {
+	result := make(capabilities)
+	if s == "" {
+		return result, nil
+	}
+
+	for _, pair := range strings.Split(s, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid capability %q, expected key=value", pair)
+		}
+		k, v := kv[0], kv[1]
+
+		key, err := url.QueryUnescape(k)
+		if err != nil {
+			return nil, fmt.Errorf("invalid capability key %q: %w", k, err)
+		}
+		value, err := url.QueryUnescape(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid capability value %q: %w", v, err)
+		}
+
+		result[key] = value
+	}
+
+	return result, nil
+}
+
+// clientCoreProtocolVersions returns the core protocol versions the client
+// said it understands. Clients that predate the environment variable only
+// understand version 1.
+func clientCoreProtocolVersions() []int {
+	vs := os.Getenv(envCoreProtocolVersions)
+	if vs == "" {
+		return []int{CoreProtocolVersion}
+	}
+
+	var result []int
+	for _, s := range strings.Split(vs, ",") {
+		v, err := strconv.Atoi(s)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "client sent invalid core protocol version %q\n", s)
+			continue
+		}
+		result = append(result, v)
+	}
+
+	return result
+}
+
+// clientCapabilities returns the capabilities the client advertised. For
+// clients that predate capabilities, the legacy environment variables are
+// translated into their capability equivalents.
+func clientCapabilities() capabilities {
+	result, err := parseCapabilities(os.Getenv(envClientCapabilities))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "client sent invalid capabilities: %s\n", err)
+		result = make(capabilities)
+	}
+
+	if _, ok := result[capabilityGRPCBrokerMultiplex]; !ok {
+		if multiplex, _ := strconv.ParseBool(os.Getenv(envMultiplexGRPC)); multiplex {
+			result[capabilityGRPCBrokerMultiplex] = "true"
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,37 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCapabilities_roundTrip(t *testing.T) {
+	cases := map[string]capabilities{
+		"empty":   {},
+		"single":  {"foo": "true"},
+		"escaped": {"a,b": "c=d|e", "b": ""},
+	}
+
+	for name, caps := range cases {
+		t.Run(name, func(t *testing.T) {
+			actual, err := parseCapabilities(caps.String())
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			if !reflect.DeepEqual(actual, caps) {
+				t.Fatalf("bad: %#v", actual)
+			}
+		})
+	}
+}
+
+func TestParseCapabilities_invalid(t *testing.T) {
+	for _, s := range []string{"foo", "foo=bar,baz", "%zz=true"} {
+		if _, err := parseCapabilities(s); err == nil {
+			t.Fatalf("expected error parsing %q", s)
+		}
+	}
+}
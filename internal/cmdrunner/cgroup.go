@@ -0,0 +1,503 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package cmdrunner
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-plugin/runner"
+)
+
+var _ runner.Runner = (*CgroupRunner)(nil)
+
+// ErrOOMKilled is returned by CgroupRunner.Wait when the plugin was killed
+// for exceeding the memory limit of its cgroup.
+var ErrOOMKilled = errors.New("plugin was killed for exceeding its memory limit")
+
+// oomKilledError wraps the error of a process that was OOM killed. It
+// matches ErrOOMKilled and unwraps to the original error.
+type oomKilledError struct {
+	err error
+}
+
+func (e *oomKilledError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrOOMKilled, e.err)
+}
+
+func (e *oomKilledError) Is(target error) bool {
+	return target == ErrOOMKilled
+}
+
+func (e *oomKilledError) Unwrap() error {
+	return e.err
+}
+
+// cgroupCPUPeriod is the period used for cpu.max, in microseconds. It is the
+// kernel's default. cgroupCPUQuotaMin is the smallest quota the kernel
+// accepts per period, in microseconds.
+const (
+	cgroupCPUPeriod   = 100000
+	cgroupCPUQuotaMin = 1000
+)
+
+// cgroupOOMPollInterval is how often CgroupRunner reads the number of OOM
+// kills in the cgroup while the plugin runs.
+const cgroupOOMPollInterval = 100 * time.Millisecond
+
+// cgroupRemoveTimeout is how long Cgroup.Remove waits for a cgroup to empty.
+const cgroupRemoveTimeout = time.Second
+
+// CgroupLimits are the resource limits of a plugin's cgroup. Zero values mean
+// no limit.
+type CgroupLimits struct {
+	// MemoryMax is the memory limit in bytes. The plugin is OOM killed if it
+	// exceeds it.
+	MemoryMax uint64
+
+	// CPUQuota is the number of CPUs the plugin can use, e.g. 0.5 for half of
+	// one CPU. The kernel doesn't accept quotas below 0.01.
+	CPUQuota float64
+
+	// PIDsMax is the maximum number of processes and threads.
+	PIDsMax uint64
+}
+
+// CgroupUsage is a snapshot of the resource usage of a cgroup. Values the
+// kernel doesn't report, for example because a controller isn't enabled,
+// are zero.
+type CgroupUsage struct {
+	MemoryCurrent uint64
+	MemoryPeak    uint64
+	CPUUsage      time.Duration
+	CPUUser       time.Duration
+	CPUSystem     time.Duration
+	PIDs          uint64
+	OOMKills      uint64
+}
+
+// Cgroup is a cgroup v2 directory. It only uses plain file operations, so it
+// also works against a fake cgroupfs directory in tests.
+type Cgroup struct {
+	path string
+}
+
+// NewCgroup creates a new cgroup under parent, which must be a cgroup v2
+// directory the process can write to, such as a delegated subtree. The
+// controllers needed for the limits are enabled in parent if they aren't
+// already.
+func NewCgroup(parent string, limits CgroupLimits) (*Cgroup, error) {
+	files := map[string]string{}
+	var controllers []string
+	if limits.MemoryMax > 0 {
+		files["memory.max"] = strconv.FormatUint(limits.MemoryMax, 10)
+		controllers = append(controllers, "memory")
+	}
+	if limits.CPUQuota > 0 {
+		quota := int64(limits.CPUQuota * cgroupCPUPeriod)
+		if quota < cgroupCPUQuotaMin {
+			return nil, fmt.Errorf("CPU quota %g is below the minimum of %g CPUs",
+				limits.CPUQuota, float64(cgroupCPUQuotaMin)/cgroupCPUPeriod)
+		}
+		files["cpu.max"] = fmt.Sprintf("%d %d", quota, cgroupCPUPeriod)
+		controllers = append(controllers, "cpu")
+	}
+	if limits.PIDsMax > 0 {
+		files["pids.max"] = strconv.FormatUint(limits.PIDsMax, 10)
+		controllers = append(controllers, "pids")
+	}
+
+	if err := enableControllers(parent, controllers); err != nil {
+		return nil, err
+	}
+
+	path, err := os.MkdirTemp(parent, "plugin-")
+	if err != nil {
+		return nil, fmt.Errorf("error creating cgroup: %w", err)
+	}
+	c := &Cgroup{path: path}
+
+	for file, value := range files {
+		if err := c.write(file, value); err != nil {
+			c.Remove()
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+// enableControllers enables the given controllers for the children of the
+// cgroup at parent.
+func enableControllers(parent string, controllers []string) error {
+	if len(controllers) == 0 {
+		return nil
+	}
+
+	path := filepath.Join(parent, "cgroup.subtree_control")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("error reading enabled cgroup controllers: %w", err)
+	}
+	enabled := map[string]bool{}
+	for _, c := range strings.Fields(string(data)) {
+		enabled[c] = true
+	}
+
+	var missing []string
+	for _, c := range controllers {
+		if !enabled[c] {
+			missing = append(missing, "+"+c)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	if err := os.WriteFile(path, []byte(strings.Join(missing, " ")), 0o644); err != nil {
+		return fmt.Errorf("error enabling cgroup controllers %v: %w", missing, err)
+	}
+
+	return nil
+}
+
+// Path returns the path of the cgroup directory.
+func (c *Cgroup) Path() string {
+	return c.path
+}
+
+// AddProcess moves a process into the cgroup.
+func (c *Cgroup) AddProcess(pid int) error {
+	return c.write("cgroup.procs", strconv.Itoa(pid))
+}
+
+// Kill kills all processes in the cgroup. It is a no-op on kernels that
+// don't support cgroup.kill.
+func (c *Cgroup) Kill() error {
+	err := c.write("cgroup.kill", "1")
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// Remove removes the cgroup. Processes that were just killed can take a
+// moment to leave it, so removal is retried for up to a second while the
+// cgroup is busy.
+func (c *Cgroup) Remove() error {
+	deadline := time.Now().Add(cgroupRemoveTimeout)
+	for {
+		err := os.Remove(c.path)
+		if !errors.Is(err, syscall.EBUSY) || time.Now().After(deadline) {
+			return err
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Usage returns the current resource usage of the cgroup. It returns an error
+// once the cgroup has been removed.
+func (c *Cgroup) Usage() (*CgroupUsage, error) {
+	// Missing files read as zero, so check that the cgroup itself exists.
+	if _, err := os.Stat(c.path); err != nil {
+		return nil, fmt.Errorf("error reading cgroup usage: %w", err)
+	}
+
+	var u CgroupUsage
+	var err error
+
+	if u.MemoryCurrent, err = c.readUint("memory.current"); err != nil {
+		return nil, err
+	}
+	if u.MemoryPeak, err = c.readUint("memory.peak"); err != nil {
+		return nil, err
+	}
+	if u.PIDs, err = c.readUint("pids.current"); err != nil {
+		return nil, err
+	}
+
+	cpu, err := c.readKeyed("cpu.stat")
+	if err != nil {
+		return nil, err
+	}
+	u.CPUUsage = time.Duration(cpu["usage_usec"]) * time.Microsecond
+	u.CPUUser = time.Duration(cpu["user_usec"]) * time.Microsecond
+	u.CPUSystem = time.Duration(cpu["system_usec"]) * time.Microsecond
+
+	if u.OOMKills, err = c.oomKills(); err != nil {
+		return nil, err
+	}
+
+	return &u, nil
+}
+
+// oomKills returns the number of processes in the cgroup that were OOM
+// killed.
+func (c *Cgroup) oomKills() (uint64, error) {
+	events, err := c.readKeyed("memory.events")
+	if err != nil {
+		return 0, err
+	}
+	return events["oom_kill"], nil
+}
+
+func (c *Cgroup) write(file, value string) error {
+	if err := os.WriteFile(filepath.Join(c.path, file), []byte(value), 0o644); err != nil {
+		return fmt.Errorf("error writing cgroup %s: %w", file, err)
+	}
+	return nil
+}
+
+// readUint reads a file holding a single number. Missing files read as 0.
+func (c *Cgroup) readUint(file string) (uint64, error) {
+	data, err := os.ReadFile(filepath.Join(c.path, file))
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	v, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("error parsing cgroup %s: %w", file, err)
+	}
+	return v, nil
+}
+
+// readKeyed reads a file of "key value" lines. Missing files read as empty.
+func (c *Cgroup) readKeyed(file string) (map[string]uint64, error) {
+	result := map[string]uint64{}
+
+	f, err := os.Open(filepath.Join(c.path, file))
+	if errors.Is(err, os.ErrNotExist) {
+		return result, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		v, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing cgroup %s: %w", file, err)
+		}
+		result[fields[0]] = v
+	}
+
+	return result, scanner.Err()
+}
+
+// CgroupRunner wraps a runner whose ID is a process ID, running the process
+// in its own cgroup, as do the processes it starts. CmdRunners and
+// SandboxRunners are started directly in the cgroup on Linux 5.7 and later.
+// Other runners, or on older kernels, are moved into it once they started.
+type CgroupRunner struct {
+	runner.Runner
+
+	logger hclog.Logger
+	cgroup *Cgroup
+
+	// stopWatchCh is closed to stop watching the OOM kills in the cgroup
+	// once the process exited.
+	stopWatchCh   chan struct{}
+	stopWatchOnce sync.Once
+
+	l sync.Mutex
+	// final is the usage of the cgroup when the process exited, after
+	// which the cgroup is removed.
+	final *CgroupUsage
+
+	// oomKillsBefore is the number of OOM kills in the cgroup at least one
+	// poll before the latest, oomKillsLast. An OOM kill of the plugin is
+	// only reported if the count rose since oomKillsBefore, so that other
+	// processes in the cgroup killed earlier aren't taken for the plugin.
+	oomKillsBefore uint64
+	oomKillsLast   uint64
+
+	// killed is set once Kill is called, after which a SIGKILL is the
+	// host's rather than the OOM killer's.
+	killed bool
+}
+
+// NewCgroupRunner returns a runner that runs r in cgroup. The cgroup is
+// removed once the process has exited.
+func NewCgroupRunner(logger hclog.Logger, r runner.Runner, cgroup *Cgroup) *CgroupRunner {
+	return &CgroupRunner{
+		Runner:      r,
+		logger:      logger,
+		cgroup:      cgroup,
+		stopWatchCh: make(chan struct{}),
+	}
+}
+
+func (r *CgroupRunner) Start(ctx context.Context) error {
+	// Count the OOM kills before the process starts, so that it's OOM
+	// killed even if that happens before the first poll.
+	count, err := r.cgroup.oomKills()
+	if err != nil {
+		r.logger.Debug("error reading cgroup OOM kills", "cgroup", r.cgroup.Path(), "error", err)
+	}
+	r.l.Lock()
+	r.oomKillsBefore, r.oomKillsLast = count, count
+	r.l.Unlock()
+
+	// Start the process directly in the cgroup if possible, so that it can't
+	// escape it or use resources outside of it before it's moved there.
+	if cmd, ok := r.Runner.(interface{ command() *exec.Cmd }); ok {
+		if release, ok := r.cgroup.startIn(cmd.command()); ok {
+			defer release()
+			if err := r.Runner.Start(ctx); err != nil {
+				r.cgroup.Remove()
+				return err
+			}
+
+			r.logger.Debug("started plugin in cgroup", "cgroup", r.cgroup.Path(), "id", r.ID())
+			go r.watchOOMKills()
+			return nil
+		}
+	}
+
+	if err := r.Runner.Start(ctx); err != nil {
+		r.cgroup.Remove()
+		return err
+	}
+
+	pid, err := strconv.Atoi(r.ID())
+	if err != nil {
+		err = fmt.Errorf("cgroups require a runner identified by its process ID, got %q", r.ID())
+	} else {
+		err = r.cgroup.AddProcess(pid)
+	}
+	if err != nil {
+		r.Runner.Kill(ctx)
+		r.Runner.Wait(ctx)
+		r.cgroup.Remove()
+		return err
+	}
+
+	r.logger.Debug("added plugin to cgroup", "cgroup", r.cgroup.Path(), "pid", pid)
+	go r.watchOOMKills()
+	return nil
+}
+
+// watchOOMKills reads the number of OOM kills in the cgroup every
+// cgroupOOMPollInterval until the process exits. This blocks and should be
+// run in a goroutine.
+func (r *CgroupRunner) watchOOMKills() {
+	ticker := time.NewTicker(cgroupOOMPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-r.stopWatchCh:
+			return
+		}
+
+		count, err := r.cgroup.oomKills()
+		if err != nil {
+			continue
+		}
+		r.l.Lock()
+		r.oomKillsBefore, r.oomKillsLast = r.oomKillsLast, count
+		r.l.Unlock()
+	}
+}
+
+// Wait waits for the process to exit, kills any processes it left in its
+// cgroup and removes the cgroup. If the process was OOM killed, the returned
+// error wraps ErrOOMKilled. It is only taken to be if it died of SIGKILL
+// while the number of OOM kills in the cgroup rose, and Kill wasn't called.
+func (r *CgroupRunner) Wait(ctx context.Context) error {
+	err := r.Runner.Wait(ctx)
+	r.stopWatchOnce.Do(func() {
+		close(r.stopWatchCh)
+	})
+
+	usage, uErr := r.cgroup.Usage()
+	if uErr != nil {
+		r.logger.Debug("error reading cgroup usage", "cgroup", r.cgroup.Path(), "error", uErr)
+	} else {
+		r.l.Lock()
+		r.final = usage
+		oomKilled := usage.OOMKills > r.oomKillsBefore && !r.killed
+		r.l.Unlock()
+
+		if oomKilled && r.sigkilled(err) {
+			err = &oomKilledError{err: err}
+		}
+	}
+
+	// Don't leave behind anything the plugin started.
+	if kErr := r.cgroup.Kill(); kErr != nil {
+		r.logger.Debug("error killing cgroup", "cgroup", r.cgroup.Path(), "error", kErr)
+	}
+	if rErr := r.cgroup.Remove(); rErr != nil {
+		r.logger.Warn("error removing cgroup", "cgroup", r.cgroup.Path(), "error", rErr)
+	}
+
+	return err
+}
+
+// sigkilled returns true if err is the exit error of a process killed by
+// SIGKILL, as the OOM killer does. Sandboxed plugins run under the sandbox
+// init process, which exits with 128 plus the signal that killed the plugin
+// instead.
+func (r *CgroupRunner) sigkilled(err error) bool {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return false
+	}
+
+	if _, ok := r.Runner.(*SandboxRunner); ok {
+		return exitErr.ExitCode() == 128+int(syscall.SIGKILL)
+	}
+	status, ok := exitErr.Sys().(syscall.WaitStatus)
+	return ok && status.Signaled() && status.Signal() == syscall.SIGKILL
+}
+
+// Kill kills the process, and then any other processes left in its cgroup.
+func (r *CgroupRunner) Kill(ctx context.Context) error {
+	r.l.Lock()
+	r.killed = true
+	r.l.Unlock()
+
+	err := r.Runner.Kill(ctx)
+	if kErr := r.cgroup.Kill(); kErr != nil {
+		r.logger.Debug("error killing cgroup", "cgroup", r.cgroup.Path(), "error", kErr)
+	}
+
+	return err
+}
+
+// Usage returns the resource usage of the plugin's cgroup, or its final usage
+// if the plugin has exited.
+func (r *CgroupRunner) Usage() (*CgroupUsage, error) {
+	r.l.Lock()
+	final := r.final
+	r.l.Unlock()
+	if final != nil {
+		return final, nil
+	}
+
+	return r.cgroup.Usage()
+}
@@ -0,0 +1,71 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+//go:build linux && go1.20
+// +build linux,go1.20
+
+package cmdrunner
+
+import (
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// startIn prepares cmd to be started directly in the cgroup, so that it
+// never runs outside of it, and returns a function that releases what it
+// holds once cmd has started. It returns false if the kernel can't start
+// processes in a cgroup, which requires Linux 5.7, or the cgroup isn't on a
+// cgroup v2 filesystem. The process must then be moved into the cgroup with
+// AddProcess once it has started.
+func (c *Cgroup) startIn(cmd *exec.Cmd) (func(), bool) {
+	var uts unix.Utsname
+	if err := unix.Uname(&uts); err != nil || !kernelAtLeast(unix.ByteSliceToString(uts.Release[:]), 5, 7) {
+		return nil, false
+	}
+
+	var st unix.Statfs_t
+	if err := unix.Statfs(c.path, &st); err != nil || st.Type != unix.CGROUP2_SUPER_MAGIC {
+		return nil, false
+	}
+
+	fd, err := unix.Open(c.path, unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, false
+	}
+
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.UseCgroupFD = true
+	cmd.SysProcAttr.CgroupFD = fd
+
+	return func() { unix.Close(fd) }, true
+}
+
+// kernelAtLeast returns true if the kernel release, as reported by uname, is
+// at least major.minor.
+func kernelAtLeast(release string, major, minor int) bool {
+	parts := strings.SplitN(release, ".", 3)
+	if len(parts) < 2 {
+		return false
+	}
+	actualMajor, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return false
+	}
+	// The minor version may be followed by a suffix, as in "5.7-rc1".
+	minorDigits := parts[1]
+	if i := strings.IndexFunc(minorDigits, func(r rune) bool { return r < '0' || r > '9' }); i >= 0 {
+		minorDigits = minorDigits[:i]
+	}
+	actualMinor, err := strconv.Atoi(minorDigits)
+	if err != nil {
+		return false
+	}
+
+	return actualMajor > major || actualMajor == major && actualMinor >= minor
+}
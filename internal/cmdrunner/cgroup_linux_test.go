@@ -0,0 +1,25 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+//go:build linux && go1.20
+// +build linux,go1.20
+
+package cmdrunner
+
+import "testing"
+
+func TestKernelAtLeast(t *testing.T) {
+	for release, expected := range map[string]bool{
+		"5.7.0":             true,
+		"5.7-rc1":           true,
+		"5.15.0-91-generic": true,
+		"6.1.0":             true,
+		"5.6.19":            false,
+		"4.19.0":            false,
+		"garbage":           false,
+	} {
+		if actual := kernelAtLeast(release, 5, 7); actual != expected {
+			t.Errorf("%s: expected %t, got %t", release, expected, actual)
+		}
+	}
+}
@@ -0,0 +1,15 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+//go:build !linux || !go1.20
+// +build !linux !go1.20
+
+package cmdrunner
+
+import "os/exec"
+
+// startIn always returns false, since processes can only be started directly
+// in a cgroup on Linux, with Go 1.20 or later.
+func (c *Cgroup) startIn(cmd *exec.Cmd) (func(), bool) {
+	return nil, false
+}
@@ -0,0 +1,375 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package cmdrunner
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+// fakeCgroupfs returns a directory standing in for a cgroup v2 parent with
+// the given controllers enabled.
+func fakeCgroupfs(t *testing.T, controllers string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "cgroup.subtree_control"), []byte(controllers), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	return dir
+}
+
+func writeCgroupFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestNewCgroup(t *testing.T) {
+	parent := fakeCgroupfs(t, "memory pids")
+
+	c, err := NewCgroup(parent, CgroupLimits{
+		MemoryMax: 64 << 20,
+		CPUQuota:  0.5,
+		PIDsMax:   10,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if filepath.Dir(c.Path()) != parent {
+		t.Fatalf("bad: %s", c.Path())
+	}
+
+	for file, expected := range map[string]string{
+		"memory.max": "67108864",
+		"cpu.max":    "50000 100000",
+		"pids.max":   "10",
+	} {
+		data, err := os.ReadFile(filepath.Join(c.Path(), file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != expected {
+			t.Fatalf("bad %s: %q", file, data)
+		}
+	}
+
+	// Only the missing controller is enabled.
+	data, err := os.ReadFile(filepath.Join(parent, "cgroup.subtree_control"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "+cpu" {
+		t.Fatalf("bad: %q", data)
+	}
+}
+
+func TestNewCgroup_cpuQuotaTooSmall(t *testing.T) {
+	parent := fakeCgroupfs(t, "")
+
+	_, err := NewCgroup(parent, CgroupLimits{CPUQuota: 0.005})
+	if err == nil || !strings.Contains(err.Error(), "below the minimum") {
+		t.Fatalf("bad: %v", err)
+	}
+
+	// Nothing was created.
+	entries, err := os.ReadDir(parent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("bad: %v", entries)
+	}
+}
+
+func TestCgroup_Usage(t *testing.T) {
+	c, err := NewCgroup(fakeCgroupfs(t, ""), CgroupLimits{})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	writeCgroupFiles(t, c.Path(), map[string]string{
+		"memory.current": "1024\n",
+		"memory.peak":    "2048\n",
+		"pids.current":   "3\n",
+		"cpu.stat":       "usage_usec 3000\nuser_usec 2000\nsystem_usec 1000\nnr_periods 0\n",
+		"memory.events":  "low 0\nhigh 0\nmax 4\noom 1\noom_kill 1\n",
+	})
+
+	usage, err := c.Usage()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := &CgroupUsage{
+		MemoryCurrent: 1024,
+		MemoryPeak:    2048,
+		CPUUsage:      3 * time.Millisecond,
+		CPUUser:       2 * time.Millisecond,
+		CPUSystem:     time.Millisecond,
+		PIDs:          3,
+		OOMKills:      1,
+	}
+	if *usage != *expected {
+		t.Fatalf("bad: %#v", usage)
+	}
+}
+
+func TestCgroup_Usage_removed(t *testing.T) {
+	c, err := NewCgroup(fakeCgroupfs(t, ""), CgroupLimits{})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := c.Remove(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if _, err := c.Usage(); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("bad: %v", err)
+	}
+}
+
+func TestCgroupRunner_oomKilled(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("cgroups are not supported on Windows")
+	}
+
+	c, err := NewCgroup(fakeCgroupfs(t, ""), CgroupLimits{})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	writeCgroupFiles(t, c.Path(), map[string]string{
+		"memory.events": "oom 0\noom_kill 0\n",
+	})
+
+	// The process is SIGKILLed as the OOM kill count rises, like the OOM
+	// killer would.
+	cmd := exec.Command("sh", "-c", `printf 'oom 1\noom_kill 1\n' > "$EVENTS"; kill -9 $$`)
+	cmd.Env = append(os.Environ(), "EVENTS="+filepath.Join(c.Path(), "memory.events"))
+	cmdRunner, err := NewCmdRunner(hclog.NewNullLogger(), cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewCgroupRunner(hclog.NewNullLogger(), cmdRunner, c)
+
+	ctx := context.Background()
+	if err := r.Start(ctx); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(c.Path(), "cgroup.procs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != r.ID() {
+		t.Fatalf("bad: %q", data)
+	}
+
+	err = r.Wait(ctx)
+	if !errors.Is(err, ErrOOMKilled) {
+		t.Fatalf("bad: %v", err)
+	}
+
+	// The final usage is still available.
+	usage, err := r.Usage()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if usage.OOMKills != 1 {
+		t.Fatalf("bad: %#v", usage)
+	}
+}
+
+func TestCgroupRunner_oomKillOfChild(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("cgroups are not supported on Windows")
+	}
+
+	c, err := NewCgroup(fakeCgroupfs(t, ""), CgroupLimits{})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	writeCgroupFiles(t, c.Path(), map[string]string{
+		"memory.events": "oom 1\noom_kill 1\n",
+	})
+
+	// Something else in the cgroup was OOM killed, but the plugin exited on
+	// its own.
+	cmdRunner, err := NewCmdRunner(hclog.NewNullLogger(), exec.Command("sh", "-c", "exit 1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewCgroupRunner(hclog.NewNullLogger(), cmdRunner, c)
+
+	ctx := context.Background()
+	if err := r.Start(ctx); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	err = r.Wait(ctx)
+	if err == nil || errors.Is(err, ErrOOMKilled) {
+		t.Fatalf("bad: %v", err)
+	}
+}
+
+// TestCgroupRunner_delegated runs against a real cgroup v2 subtree, if
+// PLUGIN_TEST_CGROUP_PARENT points to one the test can write to.
+func TestCgroupRunner_earlierOOMKill(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("cgroups are not supported on Windows")
+	}
+
+	c, err := NewCgroup(fakeCgroupfs(t, ""), CgroupLimits{})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	writeCgroupFiles(t, c.Path(), map[string]string{
+		"memory.events": "oom 1\noom_kill 1\n",
+	})
+
+	// Something in the cgroup was OOM killed before the plugin started, and
+	// the plugin is SIGKILLed for another reason.
+	cmdRunner, err := NewCmdRunner(hclog.NewNullLogger(), exec.Command("sh", "-c", "kill -9 $$"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewCgroupRunner(hclog.NewNullLogger(), cmdRunner, c)
+
+	ctx := context.Background()
+	if err := r.Start(ctx); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	err = r.Wait(ctx)
+	if err == nil || errors.Is(err, ErrOOMKilled) {
+		t.Fatalf("bad: %v", err)
+	}
+}
+
+func TestCgroupRunner_killedByHost(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("cgroups are not supported on Windows")
+	}
+
+	c, err := NewCgroup(fakeCgroupfs(t, ""), CgroupLimits{})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	eventsPath := filepath.Join(c.Path(), "memory.events")
+	writeCgroupFiles(t, c.Path(), map[string]string{
+		"memory.events": "oom 0\noom_kill 0\n",
+	})
+
+	// Something else in the cgroup is OOM killed while the plugin runs, and
+	// then the host kills the plugin.
+	cmd := exec.Command("sh", "-c", `printf 'oom 1\noom_kill 1\n' > "$EVENTS"; exec sleep 10`)
+	cmd.Env = append(os.Environ(), "EVENTS="+eventsPath)
+	cmdRunner, err := NewCmdRunner(hclog.NewNullLogger(), cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewCgroupRunner(hclog.NewNullLogger(), cmdRunner, c)
+
+	ctx := context.Background()
+	if err := r.Start(ctx); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		data, err := os.ReadFile(eventsPath)
+		if err == nil && strings.Contains(string(data), "oom_kill 1") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the OOM kill")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := r.Kill(ctx); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	err = r.Wait(ctx)
+	if err == nil || errors.Is(err, ErrOOMKilled) {
+		t.Fatalf("bad: %v", err)
+	}
+}
+
+func TestCgroupRunner_delegated(t *testing.T) {
+	parent := os.Getenv("PLUGIN_TEST_CGROUP_PARENT")
+	if parent == "" {
+		t.Skip("PLUGIN_TEST_CGROUP_PARENT not set")
+	}
+
+	c, err := NewCgroup(parent, CgroupLimits{})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	cmdRunner, err := NewCmdRunner(hclog.NewNullLogger(), exec.Command("sh", "-c", "sleep 0.2; sleep 60 & wait"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewCgroupRunner(hclog.NewNullLogger(), cmdRunner, c)
+
+	ctx := context.Background()
+	if err := r.Start(ctx); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Both the shell and the sleep it starts once it's in the cgroup end up
+	// in the cgroup.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		data, err := os.ReadFile(filepath.Join(c.Path(), "cgroup.procs"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		pids := strings.Fields(string(data))
+		if len(pids) == 2 && (pids[0] == r.ID() || pids[1] == r.ID()) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("bad: %q, expected %s and a child", data, r.ID())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if _, err := r.Usage(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	waitErrCh := make(chan error, 1)
+	go func() {
+		waitErrCh <- r.Wait(ctx)
+	}()
+
+	killCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	if err := r.Kill(killCtx); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	<-waitErrCh
+
+	// The cgroup is removed once everything in it has exited.
+	if _, err := os.Stat(c.Path()); !os.IsNotExist(err) {
+		t.Fatalf("cgroup %s was not removed: %v", c.Path(), err)
+	}
+}
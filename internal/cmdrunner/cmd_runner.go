@@ -10,6 +10,8 @@ import (
 	"io"
 	"os"
 	"os/exec"
+	"sync"
+	"time"
 
 	"github.com/hashicorp/go-hclog"
 	"github.com/hashicorp/go-plugin/runner"
@@ -23,6 +25,10 @@ var (
 	ErrProcessNotFound = errors.New("Reattachment process not found")
 )
 
+// defaultTerminateTimeout is how long Kill waits for the process to exit after
+// asking it to terminate, if the context passed to Kill has no deadline.
+const defaultTerminateTimeout = 2 * time.Second
+
 const unrecognizedRemotePluginMessage = `This usually means
   the plugin was not compiled for this architecture,
   the plugin is missing dynamic-link libraries necessary to run,
@@ -44,6 +50,16 @@ type CmdRunner struct {
 	path string
 	pid  int
 
+	// waitCh is closed once Wait has returned, i.e. the process has exited.
+	// waitOnce guards it, since Wait may be called more than once.
+	waitCh   chan struct{}
+	waitOnce sync.Once
+
+	// image is the sealed copy of the executable that cmd runs, if it was
+	// created with NewSealedCmdRunner. It is closed by Start, since the child
+	// holds its own descriptor, or by Close if Start is never called.
+	image *os.File
+
 	addrTranslator
 }
 
@@ -66,11 +82,14 @@ func NewCmdRunner(logger hclog.Logger, cmd *exec.Cmd) (*CmdRunner, error) {
 		stdout: stdout,
 		stderr: stderr,
 		path:   cmd.Path,
+		waitCh: make(chan struct{}),
 	}, nil
 }
 
 func (c *CmdRunner) Start(_ context.Context) error {
-	c.logger.Debug("starting plugin", "path", c.cmd.Path, "args", c.cmd.Args)
+	defer c.Close()
+
+	c.logger.Debug("starting plugin", "path", c.path, "args", c.cmd.Args)
 	err := c.cmd.Start()
 	if err != nil {
 		return err
@@ -81,20 +100,63 @@ func (c *CmdRunner) Start(_ context.Context) error {
 	return nil
 }
 
+// command returns the command the runner runs, so that other runners in this
+// package can adjust it before it's started.
+func (c *CmdRunner) command() *exec.Cmd {
+	return c.cmd
+}
+
+// Close releases what the runner holds to start the process, i.e. the sealed
+// image of a runner created with NewSealedCmdRunner. Start closes it, so Close
+// only needs to be called if Start never is. It can be called more than once.
+func (c *CmdRunner) Close() error {
+	if c.image == nil {
+		return nil
+	}
+
+	err := c.image.Close()
+	c.image = nil
+	return err
+}
+
 func (c *CmdRunner) Wait(_ context.Context) error {
+	defer c.waitOnce.Do(func() { close(c.waitCh) })
 	return c.cmd.Wait()
 }
 
-func (c *CmdRunner) Kill(_ context.Context) error {
-	if c.cmd.Process != nil {
-		err := c.cmd.Process.Kill()
-		// Swallow ErrProcessDone, we support calling Kill multiple times.
-		if !errors.Is(err, os.ErrProcessDone) {
-			return err
-		}
+// Kill first asks the process to terminate (SIGTERM on Unix) and waits for it
+// to exit, either until ctx is done or, if ctx has no deadline, for a short
+// default period. If the process is still running by then, it is killed
+// forcefully. On Windows the process is always killed forcefully.
+func (c *CmdRunner) Kill(ctx context.Context) error {
+	if c.cmd.Process == nil {
+		return nil
+	}
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, defaultTerminateTimeout)
+		defer cancel()
+	}
+
+	err := terminate(c.cmd.Process)
+	if errors.Is(err, os.ErrProcessDone) {
 		return nil
 	}
+	if err == nil {
+		select {
+		case <-c.waitCh:
+			return nil
+		case <-ctx.Done():
+			c.logger.Warn("plugin did not terminate in time, killing it", "path", c.path, "pid", c.pid)
+		}
+	}
 
+	err = c.cmd.Process.Kill()
+	// Swallow ErrProcessDone, we support calling Kill multiple times.
+	if !errors.Is(err, os.ErrProcessDone) {
+		return err
+	}
 	return nil
 }
 
@@ -125,5 +187,5 @@ var peTypes = map[uint16]string{
 }
 
 func (c *CmdRunner) Diagnose(_ context.Context) string {
-	return fmt.Sprintf(unrecognizedRemotePluginMessage, additionalNotesAboutCommand(c.cmd.Path))
+	return fmt.Sprintf(unrecognizedRemotePluginMessage, additionalNotesAboutCommand(c.path))
 }
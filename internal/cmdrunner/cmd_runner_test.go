@@ -4,10 +4,17 @@
 package cmdrunner
 
 import (
+	"context"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"runtime"
 	"strings"
+	"syscall"
 	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
 )
 
 func TestAdditionalNotesAboutCommand(t *testing.T) {
@@ -48,3 +55,65 @@ func TestAdditionalNotesAboutCommand(t *testing.T) {
 
 	}
 }
+
+func TestCmdRunner_Kill(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("signals are not supported on windows")
+	}
+
+	for name, tc := range map[string]struct {
+		script   string
+		signaled syscall.Signal
+	}{
+		"terminates": {"sleep 30", syscall.SIGTERM},
+		"escalates":  {"trap '' TERM; sleep 30", syscall.SIGKILL},
+	} {
+		t.Run(name, func(t *testing.T) {
+			r, err := NewCmdRunner(hclog.NewNullLogger(), exec.Command("sh", "-c", tc.script))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := r.Start(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			waitErr := make(chan error, 1)
+			go func() {
+				waitErr <- r.Wait(context.Background())
+			}()
+
+			// Give the shell a moment to install its trap.
+			time.Sleep(100 * time.Millisecond)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			if err := r.Kill(ctx); err != nil {
+				t.Fatal(err)
+			}
+
+			<-waitErr
+			status := r.cmd.ProcessState.Sys().(syscall.WaitStatus)
+			if !status.Signaled() || status.Signal() != tc.signaled {
+				t.Fatalf("expected process to be stopped by %s, got %s", tc.signaled, r.cmd.ProcessState)
+			}
+		})
+	}
+}
+
+func TestCmdRunner_waitTwice(t *testing.T) {
+	r, err := NewCmdRunner(hclog.NewNullLogger(), exec.Command("go", "version"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// exec.Cmd.Wait fails the second time, but closing waitCh mustn't panic.
+	if err := r.Wait(context.Background()); err == nil {
+		t.Fatal("expected an error waiting twice")
+	}
+}
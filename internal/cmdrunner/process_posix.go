@@ -21,3 +21,8 @@ func _pidAlive(pid int) bool {
 
 	return err == nil
 }
+
+// terminate asks the process to exit with SIGTERM.
+func terminate(proc *os.Process) error {
+	return proc.Signal(syscall.SIGTERM)
+}
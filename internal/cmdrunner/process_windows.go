@@ -4,6 +4,7 @@
 package cmdrunner
 
 import (
+	"os"
 	"syscall"
 )
 
@@ -31,3 +32,9 @@ func _pidAlive(pid int) bool {
 
 	return ec == exit_STILL_ACTIVE
 }
+
+// terminate kills the process, since Windows has no equivalent of SIGTERM
+// that can be sent to an arbitrary process.
+func terminate(proc *os.Process) error {
+	return proc.Kill()
+}
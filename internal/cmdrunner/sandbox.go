@@ -0,0 +1,89 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package cmdrunner
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-plugin/runner"
+)
+
+var (
+	_ runner.Runner = (*SandboxRunner)(nil)
+
+	// ErrSandboxNotSupported is returned by NewSandboxRunner on platforms
+	// that can't sandbox plugins.
+	ErrSandboxNotSupported = errors.New("plugin sandboxing is only supported on Linux")
+
+	// ErrSandboxInitNotCalled is returned by NewSandboxRunner if SandboxInit
+	// hasn't been called.
+	ErrSandboxInitNotCalled = errors.New("plugin sandboxing requires SandboxInit to be called at the start of main")
+)
+
+// SandboxSocketDir is where the host's unix socket directory is mounted
+// inside the sandbox.
+const SandboxSocketDir = "/tmp/plugin"
+
+// SandboxConfig is plugin.SandboxConfig, which documents its fields, as
+// passed to the sandbox init process.
+type SandboxConfig struct {
+	CPUTime       time.Duration `json:"cpu_time"`
+	Memory        uint64        `json:"memory"`
+	OpenFiles     uint64        `json:"open_files"`
+	Seccomp       bool          `json:"seccomp"`
+	Landlock      bool          `json:"landlock"`
+	ReadOnlyPaths []string      `json:"read_only_paths"`
+}
+
+// SandboxRunner is a CmdRunner that runs the plugin in a sandbox. It
+// translates unix socket addresses between the host's socket directory and
+// SandboxSocketDir.
+type SandboxRunner struct {
+	*CmdRunner
+
+	socketDir string
+}
+
+func (r *SandboxRunner) PluginToHost(pluginNet, pluginAddr string) (string, string, error) {
+	if pluginNet != "unix" {
+		return pluginNet, pluginAddr, nil
+	}
+
+	rel, err := relativeTo(SandboxSocketDir, pluginAddr)
+	if err != nil {
+		return "", "", err
+	}
+
+	return pluginNet, filepath.Join(r.socketDir, rel), nil
+}
+
+func (r *SandboxRunner) HostToPlugin(hostNet, hostAddr string) (string, string, error) {
+	if hostNet != "unix" {
+		return hostNet, hostAddr, nil
+	}
+
+	rel, err := relativeTo(r.socketDir, hostAddr)
+	if err != nil {
+		return "", "", err
+	}
+
+	return hostNet, filepath.Join(SandboxSocketDir, rel), nil
+}
+
+// relativeTo returns path relative to dir, or an error if it is outside it.
+func relativeTo(dir, path string) (string, error) {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return "", err
+	}
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("socket %s is outside of the sandbox socket directory %s", path, dir)
+	}
+
+	return rel, nil
+}
@@ -0,0 +1,528 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package cmdrunner
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"runtime"
+	"sync/atomic"
+	"syscall"
+	"unsafe"
+
+	"github.com/hashicorp/go-hclog"
+	"golang.org/x/sys/unix"
+)
+
+// envSandboxInit is set when the host binary is re-executed as the init
+// process of a sandbox. It holds the JSON encoded sandboxInitConfig.
+const envSandboxInit = "PLUGIN_SANDBOX_INIT"
+
+// sandboxNamespaces are the namespaces every sandboxed plugin runs in.
+const sandboxNamespaces = unix.CLONE_NEWUSER | unix.CLONE_NEWNS | unix.CLONE_NEWNET | unix.CLONE_NEWPID
+
+// sandboxInitConfig is passed from NewSandboxRunner to the sandbox init
+// process.
+type sandboxInitConfig struct {
+	// Path is the plugin executable.
+	Path string `json:"path"`
+
+	// SocketDir is the host's unix socket directory, which is mounted at
+	// SandboxSocketDir.
+	SocketDir string `json:"socket_dir"`
+
+	// ExtraFiles is the number of extra files passed to the plugin.
+	ExtraFiles int `json:"extra_files"`
+
+	Config SandboxConfig `json:"config"`
+}
+
+// sandboxInitCalled is set once SandboxInit has been called, which
+// NewSandboxRunner requires, since the host binary it re-executes would
+// otherwise run its own main function instead of the sandbox init process.
+var sandboxInitCalled uint32
+
+// SandboxInit runs the sandbox init process if the host binary was
+// re-executed as one by a SandboxRunner, in which case it never returns.
+// Otherwise it returns right away. Hosts must call it before doing anything
+// else in their main function to use NewSandboxRunner.
+func SandboxInit() {
+	if data, ok := os.LookupEnv(envSandboxInit); ok {
+		sandboxInit(data)
+	}
+	atomic.StoreUint32(&sandboxInitCalled, 1)
+}
+
+// NewSandboxRunner returns a runner.Runner that runs cmd in new user, mount,
+// network and PID namespaces, as root within the user namespace but without
+// any capabilities, and with the restrictions in config applied.
+//
+// Since these restrictions must be applied between forking and executing the
+// plugin, the host binary is re-executed as the init process of the sandbox,
+// which SandboxInit runs. It sets up the sandbox, runs the plugin and forwards
+// signals to it. NewSandboxRunner fails unless SandboxInit has been called.
+//
+// The plugin can't reach the network, but socketDir is mounted at
+// SandboxSocketDir, and the runner translates addresses in it accordingly.
+// The plugin should be told to create its unix sockets there.
+func NewSandboxRunner(logger hclog.Logger, cmd *exec.Cmd, socketDir string, config *SandboxConfig) (*SandboxRunner, error) {
+	if atomic.LoadUint32(&sandboxInitCalled) == 0 {
+		return nil, ErrSandboxInitNotCalled
+	}
+
+	initConfig := sandboxInitConfig{
+		Path:       cmd.Path,
+		SocketDir:  socketDir,
+		ExtraFiles: len(cmd.ExtraFiles),
+	}
+	if config != nil {
+		initConfig.Config = *config
+	}
+	data, err := json.Marshal(initConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", envSandboxInit, data))
+
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Cloneflags |= sandboxNamespaces
+	cmd.SysProcAttr.UidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getuid(), Size: 1}}
+	cmd.SysProcAttr.GidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getgid(), Size: 1}}
+	cmd.SysProcAttr.GidMappingsEnableSetgroups = false
+
+	path := cmd.Path
+	cmd.Path = "/proc/self/exe"
+
+	r, err := NewCmdRunner(logger, cmd)
+	if err != nil {
+		return nil, err
+	}
+	r.path = path
+
+	return &SandboxRunner{
+		CmdRunner: r,
+		socketDir: socketDir,
+	}, nil
+}
+
+// sandboxInit is the entrypoint of the sandbox init process. It never
+// returns.
+func sandboxInit(data string) {
+	// Most of the restrictions only apply to the calling thread, so stay on
+	// it until the plugin has been started from it.
+	runtime.LockOSThread()
+
+	var config sandboxInitConfig
+	if err := json.Unmarshal([]byte(data), &config); err != nil {
+		fmt.Fprintf(os.Stderr, "plugin sandbox: invalid configuration: %s\n", err)
+		os.Exit(1)
+	}
+	os.Unsetenv(envSandboxInit)
+
+	exe, err := os.Open(config.Path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "plugin sandbox: %s\n", err)
+		os.Exit(1)
+	}
+
+	if err := setupSandbox(&config, exe); err != nil {
+		fmt.Fprintf(os.Stderr, "plugin sandbox: %s\n", err)
+		os.Exit(1)
+	}
+
+	os.Exit(runSandboxed(&config, exe))
+}
+
+// setupSandbox applies the sandbox restrictions to the current thread and
+// process. exe is the plugin executable, opened before its path may have
+// been hidden by the sandbox mounts.
+func setupSandbox(config *sandboxInitConfig, exe *os.File) error {
+	if err := setupSandboxMounts(config.SocketDir); err != nil {
+		return err
+	}
+
+	var ruleset int = -1
+	if config.Config.Landlock {
+		var err error
+		ruleset, err = landlockRuleset(config, exe)
+		if err != nil {
+			return fmt.Errorf("error creating landlock ruleset: %w", err)
+		}
+		defer unix.Close(ruleset)
+	}
+
+	if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		return fmt.Errorf("error setting no_new_privs: %w", err)
+	}
+
+	if err := dropCapabilities(); err != nil {
+		return fmt.Errorf("error dropping capabilities: %w", err)
+	}
+
+	if ruleset >= 0 {
+		if _, _, errno := unix.Syscall(unix.SYS_LANDLOCK_RESTRICT_SELF, uintptr(ruleset), 0, 0); errno != 0 {
+			return fmt.Errorf("error applying landlock ruleset: %w", errno)
+		}
+	}
+
+	if config.Config.Seccomp {
+		if err := installSeccompFilter(); err != nil {
+			return fmt.Errorf("error installing seccomp filter: %w", err)
+		}
+	}
+
+	return setRlimits(&config.Config)
+}
+
+// setupSandboxMounts makes the sandbox's mounts private, mounts socketDir at
+// SandboxSocketDir on a fresh /tmp, and mounts a /proc for the new PID
+// namespace.
+func setupSandboxMounts(socketDir string) error {
+	if err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("error making mounts private: %w", err)
+	}
+
+	if socketDir != "" {
+		// Hold on to the socket directory, since it's likely to be in /tmp.
+		fd, err := unix.Open(socketDir, unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+		if err != nil {
+			return fmt.Errorf("error opening socket directory: %w", err)
+		}
+		defer unix.Close(fd)
+
+		if err := unix.Mount("tmpfs", "/tmp", "tmpfs", unix.MS_NOSUID|unix.MS_NODEV, "mode=0755"); err != nil {
+			return fmt.Errorf("error mounting /tmp: %w", err)
+		}
+		if err := os.Mkdir(SandboxSocketDir, 0o700); err != nil {
+			return err
+		}
+		if err := unix.Mount(fmt.Sprintf("/proc/self/fd/%d", fd), SandboxSocketDir, "", unix.MS_BIND, ""); err != nil {
+			return fmt.Errorf("error mounting socket directory: %w", err)
+		}
+	}
+
+	if err := unix.Mount("proc", "/proc", "proc", unix.MS_NOSUID|unix.MS_NODEV|unix.MS_NOEXEC, ""); err != nil {
+		return fmt.Errorf("error mounting /proc: %w", err)
+	}
+
+	return nil
+}
+
+// Landlock filesystem access rights, by the ABI version that introduced
+// them.
+const (
+	landlockAccessFSv1 = unix.LANDLOCK_ACCESS_FS_EXECUTE |
+		unix.LANDLOCK_ACCESS_FS_WRITE_FILE |
+		unix.LANDLOCK_ACCESS_FS_READ_FILE |
+		unix.LANDLOCK_ACCESS_FS_READ_DIR |
+		unix.LANDLOCK_ACCESS_FS_REMOVE_DIR |
+		unix.LANDLOCK_ACCESS_FS_REMOVE_FILE |
+		unix.LANDLOCK_ACCESS_FS_MAKE_CHAR |
+		unix.LANDLOCK_ACCESS_FS_MAKE_DIR |
+		unix.LANDLOCK_ACCESS_FS_MAKE_REG |
+		unix.LANDLOCK_ACCESS_FS_MAKE_SOCK |
+		unix.LANDLOCK_ACCESS_FS_MAKE_FIFO |
+		unix.LANDLOCK_ACCESS_FS_MAKE_BLOCK |
+		unix.LANDLOCK_ACCESS_FS_MAKE_SYM
+	landlockAccessFSv2 = unix.LANDLOCK_ACCESS_FS_REFER
+	landlockAccessFSv3 = unix.LANDLOCK_ACCESS_FS_TRUNCATE
+
+	// landlockAccessFile are the rights that apply to files rather than
+	// directories.
+	landlockAccessFile = unix.LANDLOCK_ACCESS_FS_EXECUTE |
+		unix.LANDLOCK_ACCESS_FS_WRITE_FILE |
+		unix.LANDLOCK_ACCESS_FS_READ_FILE |
+		unix.LANDLOCK_ACCESS_FS_TRUNCATE
+
+	landlockAccessRead = unix.LANDLOCK_ACCESS_FS_EXECUTE |
+		unix.LANDLOCK_ACCESS_FS_READ_FILE |
+		unix.LANDLOCK_ACCESS_FS_READ_DIR
+)
+
+// landlockRuleset creates a landlock ruleset that allows full access to the
+// socket directory and read access to the plugin executable and the
+// configured read-only paths. Everything else is denied once the ruleset is
+// applied.
+func landlockRuleset(config *sandboxInitConfig, exe *os.File) (int, error) {
+	abi, _, errno := unix.Syscall(unix.SYS_LANDLOCK_CREATE_RULESET, 0, 0, unix.LANDLOCK_CREATE_RULESET_VERSION)
+	if errno != 0 {
+		return -1, fmt.Errorf("landlock is not available: %w", errno)
+	}
+
+	handled := uint64(landlockAccessFSv1)
+	if abi >= 2 {
+		handled |= landlockAccessFSv2
+	}
+	if abi >= 3 {
+		handled |= landlockAccessFSv3
+	}
+
+	attr := unix.LandlockRulesetAttr{Access_fs: handled}
+	fd, _, errno := unix.Syscall(unix.SYS_LANDLOCK_CREATE_RULESET, uintptr(unsafe.Pointer(&attr)), unsafe.Sizeof(attr), 0)
+	if errno != 0 {
+		return -1, errno
+	}
+	ruleset := int(fd)
+
+	addRule := func(fd int, access uint64) error {
+		rule := unix.LandlockPathBeneathAttr{
+			Allowed_access: access & handled,
+			Parent_fd:      int32(fd),
+		}
+		_, _, errno := unix.Syscall6(unix.SYS_LANDLOCK_ADD_RULE, uintptr(ruleset), unix.LANDLOCK_RULE_PATH_BENEATH, uintptr(unsafe.Pointer(&rule)), 0, 0, 0)
+		if errno != 0 {
+			return errno
+		}
+		return nil
+	}
+
+	if err := addRule(int(exe.Fd()), landlockAccessRead&landlockAccessFile); err != nil {
+		unix.Close(ruleset)
+		return -1, fmt.Errorf("error adding rule for %s: %w", config.Path, err)
+	}
+
+	paths := map[string]uint64{}
+	for _, path := range config.Config.ReadOnlyPaths {
+		paths[path] = landlockAccessRead
+	}
+	if config.SocketDir != "" {
+		paths[SandboxSocketDir] = handled
+	}
+	for path, access := range paths {
+		fd, err := unix.Open(path, unix.O_PATH|unix.O_CLOEXEC, 0)
+		if errors.Is(err, unix.ENOENT) {
+			continue
+		}
+		if err != nil {
+			unix.Close(ruleset)
+			return -1, fmt.Errorf("error opening %s: %w", path, err)
+		}
+
+		var st unix.Stat_t
+		err = unix.Fstat(fd, &st)
+		if err == nil {
+			if st.Mode&unix.S_IFMT != unix.S_IFDIR {
+				access &= landlockAccessFile
+			}
+			err = addRule(fd, access)
+		}
+		unix.Close(fd)
+		if err != nil {
+			unix.Close(ruleset)
+			return -1, fmt.Errorf("error adding rule for %s: %w", path, err)
+		}
+	}
+
+	return ruleset, nil
+}
+
+// dropCapabilities drops all capabilities of the current thread, including
+// from its bounding set so that they can't be regained by executing a
+// program.
+func dropCapabilities() error {
+	for c := 0; ; c++ {
+		err := unix.Prctl(unix.PR_CAPBSET_DROP, uintptr(c), 0, 0, 0)
+		if errors.Is(err, unix.EINVAL) {
+			// Past the last capability the kernel knows about.
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := unix.Prctl(unix.PR_CAP_AMBIENT, unix.PR_CAP_AMBIENT_CLEAR_ALL, 0, 0, 0); err != nil && !errors.Is(err, unix.EINVAL) {
+		return err
+	}
+
+	hdr := unix.CapUserHeader{Version: unix.LINUX_CAPABILITY_VERSION_3}
+	var data [2]unix.CapUserData
+	return unix.Capset(&hdr, &data[0])
+}
+
+// Seccomp filter return values, from linux/seccomp.h.
+const (
+	seccompRetKillProcess = 0x80000000
+	seccompRetErrno       = 0x00050000
+	seccompRetAllow       = 0x7fff0000
+)
+
+// seccompDenied are the system calls denied by the seccomp filter.
+var seccompDenied = []uint32{
+	unix.SYS_ACCT,
+	unix.SYS_ADD_KEY,
+	unix.SYS_BPF,
+	unix.SYS_CLOCK_SETTIME,
+	unix.SYS_DELETE_MODULE,
+	unix.SYS_FANOTIFY_INIT,
+	unix.SYS_FINIT_MODULE,
+	unix.SYS_INIT_MODULE,
+	unix.SYS_KCMP,
+	unix.SYS_KEXEC_LOAD,
+	unix.SYS_KEYCTL,
+	unix.SYS_MOUNT,
+	unix.SYS_NAME_TO_HANDLE_AT,
+	unix.SYS_OPEN_BY_HANDLE_AT,
+	unix.SYS_PERF_EVENT_OPEN,
+	unix.SYS_PIVOT_ROOT,
+	unix.SYS_PROCESS_VM_READV,
+	unix.SYS_PROCESS_VM_WRITEV,
+	unix.SYS_PTRACE,
+	unix.SYS_QUOTACTL,
+	unix.SYS_REBOOT,
+	unix.SYS_REQUEST_KEY,
+	unix.SYS_SETDOMAINNAME,
+	unix.SYS_SETHOSTNAME,
+	unix.SYS_SETNS,
+	unix.SYS_SETTIMEOFDAY,
+	unix.SYS_SWAPOFF,
+	unix.SYS_SWAPON,
+	unix.SYS_UMOUNT2,
+	unix.SYS_UNSHARE,
+	unix.SYS_USERFAULTFD,
+}
+
+// seccompArches maps the architectures the seccomp filter supports to their
+// audit architecture. The filter reads the low half of system call
+// arguments, so only little endian architectures are listed.
+var seccompArches = map[string]uint32{
+	"amd64": unix.AUDIT_ARCH_X86_64,
+	"arm64": unix.AUDIT_ARCH_AARCH64,
+}
+
+// installSeccompFilter installs a filter that fails the system calls in
+// seccompDenied with EPERM, and creating namespaces with clone. clone3 fails
+// with ENOSYS, since its flags can't be inspected, so that callers fall back
+// to clone.
+func installSeccompFilter() error {
+	arch, ok := seccompArches[runtime.GOARCH]
+	if !ok {
+		return fmt.Errorf("seccomp filter is not supported on %s", runtime.GOARCH)
+	}
+
+	stmt := func(code uint16, k uint32) unix.SockFilter {
+		return unix.SockFilter{Code: code, K: k}
+	}
+	jump := func(code uint16, k uint32, jt, jf uint8) unix.SockFilter {
+		return unix.SockFilter{Code: code, Jt: jt, Jf: jf, K: k}
+	}
+	const (
+		ld   = unix.BPF_LD | unix.BPF_W | unix.BPF_ABS
+		jeq  = unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K
+		jge  = unix.BPF_JMP | unix.BPF_JGE | unix.BPF_K
+		jset = unix.BPF_JMP | unix.BPF_JSET | unix.BPF_K
+		ret  = unix.BPF_RET | unix.BPF_K
+
+		// Offsets into struct seccomp_data.
+		offsetNr   = 0
+		offsetArch = 4
+		offsetArg0 = 16
+
+		// x32 system calls on amd64 have this bit set.
+		x32SyscallBit = 0x40000000
+
+		namespaceFlags = unix.CLONE_NEWNS | unix.CLONE_NEWCGROUP | unix.CLONE_NEWUTS |
+			unix.CLONE_NEWIPC | unix.CLONE_NEWUSER | unix.CLONE_NEWPID | unix.CLONE_NEWNET
+	)
+	eperm := uint32(seccompRetErrno | uint32(unix.EPERM))
+
+	filter := []unix.SockFilter{
+		stmt(ld, offsetArch),
+		jump(jeq, arch, 1, 0),
+		stmt(ret, seccompRetKillProcess),
+		stmt(ld, offsetNr),
+		jump(jge, x32SyscallBit, 0, 1),
+		stmt(ret, eperm),
+	}
+	for _, nr := range seccompDenied {
+		filter = append(filter,
+			jump(jeq, nr, 0, 1),
+			stmt(ret, eperm),
+		)
+	}
+	filter = append(filter,
+		jump(jeq, unix.SYS_CLONE3, 0, 1),
+		stmt(ret, seccompRetErrno|uint32(unix.ENOSYS)),
+		jump(jeq, unix.SYS_CLONE, 0, 3),
+		stmt(ld, offsetArg0),
+		jump(jset, namespaceFlags, 0, 1),
+		stmt(ret, eperm),
+		stmt(ret, seccompRetAllow),
+	)
+
+	prog := unix.SockFprog{
+		Len:    uint16(len(filter)),
+		Filter: &filter[0],
+	}
+	return unix.Prctl(unix.PR_SET_SECCOMP, unix.SECCOMP_MODE_FILTER, uintptr(unsafe.Pointer(&prog)), 0, 0)
+}
+
+// setRlimits applies the resource limits in config to the process.
+func setRlimits(config *SandboxConfig) error {
+	limits := []struct {
+		resource int
+		value    uint64
+	}{
+		{unix.RLIMIT_CPU, uint64((config.CPUTime + 999999999) / 1000000000)},
+		{unix.RLIMIT_AS, config.Memory},
+		{unix.RLIMIT_NOFILE, config.OpenFiles},
+	}
+	for _, l := range limits {
+		if l.value == 0 {
+			continue
+		}
+		if err := unix.Setrlimit(l.resource, &unix.Rlimit{Cur: l.value, Max: l.value}); err != nil {
+			return fmt.Errorf("error setting resource limit %d: %w", l.resource, err)
+		}
+	}
+
+	return nil
+}
+
+// runSandboxed runs the plugin as a child of the sandbox init process,
+// forwards signals to it and returns the exit code to exit with.
+func runSandboxed(config *sandboxInitConfig, exe *os.File) int {
+	cmd := exec.Command(fmt.Sprintf("/proc/self/fd/%d", 3+config.ExtraFiles))
+	cmd.Args = os.Args
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	for i := 0; i < config.ExtraFiles; i++ {
+		cmd.ExtraFiles = append(cmd.ExtraFiles, os.NewFile(uintptr(3+i), ""))
+	}
+	cmd.ExtraFiles = append(cmd.ExtraFiles, exe)
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, unix.SIGTERM, unix.SIGINT, unix.SIGHUP)
+
+	if err := cmd.Start(); err != nil {
+		fmt.Fprintf(os.Stderr, "plugin sandbox: error starting plugin: %s\n", err)
+		return 1
+	}
+	exe.Close()
+
+	go func() {
+		for sig := range sigCh {
+			cmd.Process.Signal(sig)
+		}
+	}()
+
+	cmd.Wait()
+	status, ok := cmd.ProcessState.Sys().(syscall.WaitStatus)
+	if ok && status.Signaled() {
+		return 128 + int(status.Signal())
+	}
+
+	return cmd.ProcessState.ExitCode()
+}
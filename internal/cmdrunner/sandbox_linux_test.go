@@ -0,0 +1,159 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package cmdrunner
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"golang.org/x/sys/unix"
+)
+
+func TestMain(m *testing.M) {
+	// The sandbox tests re-execute the test binary as the sandbox init
+	// process.
+	SandboxInit()
+	os.Exit(m.Run())
+}
+
+// skipIfNoUserNamespaces skips the test if unprivileged user namespaces
+// can't be created, as is the case in some containers.
+func skipIfNoUserNamespaces(t *testing.T) {
+	t.Helper()
+
+	cmd := exec.Command("/bin/true")
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags:  sandboxNamespaces,
+		UidMappings: []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getuid(), Size: 1}},
+		GidMappings: []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getgid(), Size: 1}},
+	}
+	if err := cmd.Run(); err != nil {
+		t.Skipf("namespaces are not available: %s", err)
+	}
+}
+
+// runInSandbox runs a shell script in a sandbox and returns its output.
+func runInSandbox(t *testing.T, script string, config *SandboxConfig) (string, *SandboxRunner) {
+	t.Helper()
+
+	socketDir := t.TempDir()
+	r, err := NewSandboxRunner(hclog.NewNullLogger(), exec.Command("/bin/sh", "-c", script), socketDir, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if err := r.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	out, err := io.ReadAll(r.Stdout())
+	if err != nil {
+		t.Fatal(err)
+	}
+	stderr, _ := io.ReadAll(r.Stderr())
+	if err := r.Wait(ctx); err != nil {
+		t.Fatalf("err: %s\nstderr: %s", err, stderr)
+	}
+
+	return string(out), r
+}
+
+func TestSandboxRunner(t *testing.T) {
+	skipIfNoUserNamespaces(t)
+
+	script := `echo "ppid=$PPID"; echo "uid=$(id -u)"; echo "nofile=$(ulimit -n)"; echo hello > ` + SandboxSocketDir + `/file`
+	out, r := runInSandbox(t, script, &SandboxConfig{OpenFiles: 64})
+
+	for _, expected := range []string{"ppid=1", "uid=0", "nofile=64"} {
+		if !strings.Contains(out, expected) {
+			t.Fatalf("expected %q in output:\n%s", expected, out)
+		}
+	}
+
+	// The plugin wrote into the host's socket directory.
+	data, err := os.ReadFile(filepath.Join(r.socketDir, "file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "hello\n" {
+		t.Fatalf("bad: %q", data)
+	}
+
+	if r.Name() != "/bin/sh" {
+		t.Fatalf("bad: %s", r.Name())
+	}
+}
+
+func TestSandboxRunner_restrictions(t *testing.T) {
+	skipIfNoUserNamespaces(t)
+
+	config := &SandboxConfig{Seccomp: true}
+	_, _, errno := unix.Syscall(unix.SYS_LANDLOCK_CREATE_RULESET, 0, 0, unix.LANDLOCK_CREATE_RULESET_VERSION)
+	landlock := errno == 0
+	if landlock {
+		config.Landlock = true
+		config.ReadOnlyPaths = []string{"/bin", "/usr", "/lib", "/lib64", "/etc/ld.so.cache", "/proc"}
+	}
+
+	script := `while read k v; do case "$k" in CapEff:|NoNewPrivs:|Seccomp:) echo "$k $v";; esac; done < /proc/self/status
+if cat /etc/hostname >/dev/null 2>&1; then echo "read=allowed"; else echo "read=denied"; fi`
+	out, _ := runInSandbox(t, script, config)
+
+	for _, expected := range []string{"CapEff: 0000000000000000", "NoNewPrivs: 1", "Seccomp: 2"} {
+		if !strings.Contains(out, expected) {
+			t.Fatalf("expected %q in output:\n%s", expected, out)
+		}
+	}
+	if landlock && !strings.Contains(out, "read=denied") {
+		t.Fatalf("expected reading outside the sandbox to be denied:\n%s", out)
+	}
+}
+
+func TestSandboxRunner_addrTranslator(t *testing.T) {
+	r := &SandboxRunner{socketDir: "/host/sockets"}
+
+	for name, tc := range map[string]struct {
+		net, addr, expected string
+		pluginToHost        bool
+		err                 bool
+	}{
+		"plugin to host": {"unix", SandboxSocketDir + "/plugin1", "/host/sockets/plugin1", true, false},
+		"host to plugin": {"unix", "/host/sockets/plugin1", SandboxSocketDir + "/plugin1", false, false},
+		"outside":        {"unix", "/elsewhere/plugin1", "", false, true},
+		"tcp":            {"tcp", "127.0.0.1:1234", "127.0.0.1:1234", true, false},
+	} {
+		t.Run(name, func(t *testing.T) {
+			translate := r.HostToPlugin
+			if tc.pluginToHost {
+				translate = r.PluginToHost
+			}
+
+			_, addr, err := translate(tc.net, tc.addr)
+			if tc.err != (err != nil) {
+				t.Fatalf("err: %v", err)
+			}
+			if addr != tc.expected {
+				t.Fatalf("bad: %s", addr)
+			}
+		})
+	}
+}
+
+func TestNewSandboxRunner_initNotCalled(t *testing.T) {
+	atomic.StoreUint32(&sandboxInitCalled, 0)
+	defer atomic.StoreUint32(&sandboxInitCalled, 1)
+
+	_, err := NewSandboxRunner(hclog.NewNullLogger(), exec.Command("/bin/true"), t.TempDir(), nil)
+	if err != ErrSandboxInitNotCalled {
+		t.Fatalf("bad: %v", err)
+	}
+}
@@ -0,0 +1,22 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+//go:build !linux
+// +build !linux
+
+package cmdrunner
+
+import (
+	"os/exec"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+// SandboxInit does nothing on platforms that can't sandbox plugins.
+func SandboxInit() {}
+
+// NewSandboxRunner is only supported on Linux. See the Linux implementation
+// for details.
+func NewSandboxRunner(logger hclog.Logger, cmd *exec.Cmd, socketDir string, config *SandboxConfig) (*SandboxRunner, error) {
+	return nil, ErrSandboxNotSupported
+}
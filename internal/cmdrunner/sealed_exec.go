@@ -0,0 +1,17 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package cmdrunner
+
+import (
+	"errors"
+	"io"
+)
+
+// ErrSealedExecNotSupported is returned by NewSealedCmdRunner on platforms
+// that can't execute a sealed copy of a plugin.
+var ErrSealedExecNotSupported = errors.New("sealed plugin execution is only supported on Linux")
+
+// VerifyFunc checks the integrity of an executable image of the given size
+// before it is run. Returning an error aborts starting the plugin.
+type VerifyFunc func(image io.ReaderAt, size int64) error
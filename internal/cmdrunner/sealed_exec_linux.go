@@ -0,0 +1,100 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package cmdrunner
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/hashicorp/go-hclog"
+	"golang.org/x/sys/unix"
+)
+
+// sealedImageSeals prevent any further modification of a sealed image,
+// including adding or removing seals.
+const sealedImageSeals = unix.F_SEAL_SEAL | unix.F_SEAL_SHRINK | unix.F_SEAL_GROW | unix.F_SEAL_WRITE
+
+// NewSealedCmdRunner returns a runner.Runner like NewCmdRunner, except that
+// the executable is read exactly once, into a sealed memory file that can no
+// longer be modified. verify, if not nil, is run against that copy, and the
+// process is started from it, so the verified bytes are the executed bytes
+// even if the file at cmd.Path is replaced in the meantime.
+//
+// The plugin process inherits a read-only descriptor to the sealed copy,
+// which is what allows interpreted plugins with a "#!" line to run. Name
+// still reports the original path. If the runner is never started, Close
+// must be called to release the sealed copy.
+func NewSealedCmdRunner(logger hclog.Logger, cmd *exec.Cmd, verify VerifyFunc) (*CmdRunner, error) {
+	path := cmd.Path
+	if !filepath.IsAbs(path) && cmd.Dir != "" {
+		// The path is resolved relative to the working directory of the
+		// child, so do the same here.
+		path = filepath.Join(cmd.Dir, path)
+	}
+
+	image, size, err := sealedImage(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if verify != nil {
+		if err := verify(image, size); err != nil {
+			image.Close()
+			return nil, err
+		}
+	}
+
+	// The image is passed as the next extra file, so it has a known
+	// descriptor number in the child that /proc/self/fd can refer to.
+	cmd.Path = fmt.Sprintf("/proc/self/fd/%d", 3+len(cmd.ExtraFiles))
+	cmd.ExtraFiles = append(cmd.ExtraFiles, image)
+
+	r, err := NewCmdRunner(logger, cmd)
+	if err != nil {
+		image.Close()
+		return nil, err
+	}
+	r.path = path
+	r.image = image
+
+	return r, nil
+}
+
+// sealedImage copies the file at path into a sealed memory file and returns a
+// read-only handle to it, along with its size.
+func sealedImage(path string) (*os.File, int64, error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer src.Close()
+
+	fd, err := unix.MemfdCreate(filepath.Base(path), unix.MFD_CLOEXEC|unix.MFD_ALLOW_SEALING)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error creating memory file: %w", err)
+	}
+	memfd := os.NewFile(uintptr(fd), "memfd:"+filepath.Base(path))
+	defer memfd.Close()
+
+	size, err := io.Copy(memfd, src)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error copying plugin executable: %w", err)
+	}
+
+	if _, err := unix.FcntlInt(memfd.Fd(), unix.F_ADD_SEALS, sealedImageSeals); err != nil {
+		return nil, 0, fmt.Errorf("error sealing memory file: %w", err)
+	}
+
+	// Reopen the memory file read-only and drop the writable descriptor, since
+	// a file can't be executed while it's open for writing.
+	image, err := os.Open(fmt.Sprintf("/proc/self/fd/%d", memfd.Fd()))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return image, size, nil
+}
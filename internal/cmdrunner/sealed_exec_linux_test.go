@@ -0,0 +1,102 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package cmdrunner
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+func TestNewSealedCmdRunner(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "plugin")
+	original := "#!/bin/sh\necho original\n"
+	if err := os.WriteFile(path, []byte(original), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	var verified string
+	r, err := NewSealedCmdRunner(hclog.NewNullLogger(), exec.Command(path), func(image io.ReaderAt, size int64) error {
+		data, err := io.ReadAll(io.NewSectionReader(image, 0, size))
+		if err != nil {
+			return err
+		}
+		verified = string(data)
+
+		// Replace the executable after it has been verified. This must not
+		// change what gets run.
+		return os.WriteFile(path, []byte("#!/bin/sh\necho replaced\n"), 0o755)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if verified != original {
+		t.Fatalf("bad: %q", verified)
+	}
+	if r.Name() != path {
+		t.Fatalf("bad: %s", r.Name())
+	}
+
+	ctx := context.Background()
+	if err := r.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	out, err := io.ReadAll(r.Stdout())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.TrimSpace(string(out)) != "original" {
+		t.Fatalf("bad: %q", out)
+	}
+}
+
+func TestNewSealedCmdRunner_verifyError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "plugin")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := errors.New("not trusted")
+	_, err := NewSealedCmdRunner(hclog.NewNullLogger(), exec.Command(path), func(io.ReaderAt, int64) error {
+		return expected
+	})
+	if err != expected {
+		t.Fatalf("bad: %v", err)
+	}
+}
+
+func TestNewSealedCmdRunner_close(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "plugin")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewSealedCmdRunner(hclog.NewNullLogger(), exec.Command(path), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Closing a runner that is never started releases its image.
+	image := r.image
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := image.Stat(); !errors.Is(err, os.ErrClosed) {
+		t.Fatalf("image should be closed: %v", err)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,19 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+//go:build !linux
+// +build !linux
+
+package cmdrunner
+
+import (
+	"os/exec"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+// NewSealedCmdRunner is only supported on Linux. See the Linux implementation
+// for details.
+func NewSealedCmdRunner(logger hclog.Logger, cmd *exec.Cmd, verify VerifyFunc) (*CmdRunner, error) {
+	return nil, ErrSealedExecNotSupported
+}
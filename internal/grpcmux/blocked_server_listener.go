@@ -11,7 +11,8 @@ import (
 var _ net.Listener = (*blockedServerListener)(nil)
 
 // blockedServerListener accepts connections for a specific gRPC broker stream
-// ID on the server (plugin) side of the connection.
+// ID on the server (plugin) side of the connection, or on either side if
+// streams are prefixed with their ID.
 type blockedServerListener struct {
 	addr     net.Addr
 	acceptCh chan acceptResult
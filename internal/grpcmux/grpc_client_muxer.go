@@ -22,18 +22,25 @@ var _ GRPCMuxer = (*GRPCClientMuxer)(nil)
 // as the implementation for multiplexing any additional connections.
 //
 // Each net.Listener returned from Listener will block until the client receives
-// a knock that matches its gRPC broker stream ID. There is no default listener
-// on the client, as it is a client for the gRPC broker's control services. (See
-// GRPCServerMuxer for more details).
+// a knock that matches its gRPC broker stream ID, or if streams are prefixed
+// with their ID, until it receives a stream with its ID. There is no default
+// listener on the client, as it is a client for the gRPC broker's control
+// services. (See GRPCServerMuxer for more details).
 type GRPCClientMuxer struct {
 	logger  hclog.Logger
 	session *yamux.Session
 
+	// router routes streams by the ID they are prefixed with, and is nil if
+	// streams aren't prefixed.
+	router *streamRouter
+
 	acceptMutex     sync.Mutex
 	acceptListeners map[uint32]*blockedClientListener
 }
 
-func NewGRPCClientMuxer(logger hclog.Logger, addr net.Addr) (*GRPCClientMuxer, error) {
+// NewGRPCClientMuxer connects to the plugin at addr. If prefixIDs is true,
+// streams are prefixed with their ID, which the plugin must support.
+func NewGRPCClientMuxer(logger hclog.Logger, addr net.Addr, prefixIDs bool) (*GRPCClientMuxer, error) {
 	// Eagerly establish the underlying connection as early as possible.
 	logger.Debug("making new client mux initial connection", "addr", addr)
 	conn, err := net.Dial(addr.Network(), addr.String())
@@ -61,6 +68,12 @@ func NewGRPCClientMuxer(logger hclog.Logger, addr net.Addr) (*GRPCClientMuxer, e
 		session:         sess,
 		acceptListeners: make(map[uint32]*blockedClientListener),
 	}
+	if prefixIDs {
+		m.router = newStreamRouter(logger, false)
+		go func() {
+			m.router.close(m.router.serve(sess))
+		}()
+	}
 
 	return m, nil
 }
@@ -70,6 +83,10 @@ func (m *GRPCClientMuxer) Enabled() bool {
 }
 
 func (m *GRPCClientMuxer) Listener(id uint32, doneCh <-chan struct{}) (net.Listener, error) {
+	if m.router != nil {
+		return m.router.listener(m.session.Addr(), id, doneCh), nil
+	}
+
 	ln := newBlockedClientListener(m.session, doneCh)
 
 	m.acceptMutex.Lock()
@@ -80,6 +97,10 @@ func (m *GRPCClientMuxer) Listener(id uint32, doneCh <-chan struct{}) (net.Liste
 }
 
 func (m *GRPCClientMuxer) AcceptKnock(id uint32) error {
+	if m.router != nil {
+		return m.router.knock(id)
+	}
+
 	m.acceptMutex.Lock()
 	defer m.acceptMutex.Unlock()
 
@@ -91,8 +112,8 @@ func (m *GRPCClientMuxer) AcceptKnock(id uint32) error {
 	return nil
 }
 
-func (m *GRPCClientMuxer) Dial() (net.Conn, error) {
-	stream, err := m.session.Open()
+func (m *GRPCClientMuxer) Dial(id uint32) (net.Conn, error) {
+	stream, err := openStream(m.session, m.router != nil, id)
 	if err != nil {
 		return nil, fmt.Errorf("error dialling new client stream: %w", err)
 	}
@@ -100,6 +121,10 @@ func (m *GRPCClientMuxer) Dial() (net.Conn, error) {
 	return stream, nil
 }
 
+func (m *GRPCClientMuxer) Sequential() bool {
+	return m.router == nil
+}
+
 func (m *GRPCClientMuxer) Close() error {
 	return m.session.Close()
 }
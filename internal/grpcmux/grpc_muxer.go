@@ -14,9 +14,14 @@ import (
 // The first multiplexed connection is used to serve the gRPC broker's own
 // control services: plugin.GRPCBroker, plugin.GRPCController, plugin.GRPCStdio.
 //
-// Clients must "knock" before dialling, to tell the server side that the
-// next net.Conn should be accepted onto a specific stream ID. The knock is a
-// bidirectional streaming message on the plugin.GRPCBroker service.
+// Clients must "knock" before dialling, to check the other side is listening
+// on a specific stream ID. The knock is a bidirectional streaming message on
+// the plugin.GRPCBroker service.
+//
+// If both sides prefix streams with their ID, streams are routed to the
+// listener for that ID, and can be established concurrently. Otherwise, the
+// knock tells the other side that the next net.Conn should be accepted onto
+// its ID, so streams must be established sequentially.
 type GRPCMuxer interface {
 	// Enabled determines whether multiplexing should be used. It saves users
 	// of the interface from having to compare an interface with nil, which
@@ -31,9 +36,14 @@ type GRPCMuxer interface {
 	// error if it hasn't been created yet.
 	AcceptKnock(id uint32) error
 
-	// Dial makes a new multiplexed client connection. To dial a specific ID,
-	// a knock must be sent first.
-	Dial() (net.Conn, error)
+	// Dial makes a new multiplexed client connection for the given ID, where
+	// ID 0 is the main connection. To dial a specific ID, a knock must be
+	// sent first.
+	Dial(id uint32) (net.Conn, error)
+
+	// Sequential returns true if streams are routed by the most recent knock,
+	// in which case each knock and dial must complete before the next.
+	Sequential() bool
 
 	// Close closes connections and releases any resources associated with the
 	// muxer.
@@ -31,71 +31,139 @@ var _ net.Listener = (*GRPCServerMuxer)(nil)
 // can't control the order in which gRPC servers will call Accept() on each
 // listener, but we do need to control which gRPC server accepts which connection.
 // As such, each multiplexed listener blocks waiting on a channel. It will be
-// unblocked when a knock is received for the matching stream ID.
+// unblocked when a knock is received for the matching stream ID, or if streams
+// are prefixed with their ID, when a stream with the matching ID is accepted.
+// Streams with ID 0 are then given to the default listener.
 type GRPCServerMuxer struct {
 	addr   net.Addr
 	logger hclog.Logger
+	ln     net.Listener
 
-	sessionErrCh chan error
-	sess         *yamux.Session
+	// readyCh is closed once the first session is established, or
+	// establishing it failed with sessionErr.
+	readyCh    chan struct{}
+	sessionErr error
+
+	// sess is the current session. Once a client disconnects, the next
+	// connection accepted, such as from a client reattaching, replaces it.
+	sessMutex sync.Mutex
+	sess      *yamux.Session
 
 	knockCh chan uint32
 
+	// router routes streams by the ID they are prefixed with, and is nil if
+	// streams aren't prefixed.
+	router *streamRouter
+
 	acceptMutex    sync.Mutex
 	acceptChannels map[uint32]chan acceptResult
 }
 
-func NewGRPCServerMuxer(logger hclog.Logger, ln net.Listener) *GRPCServerMuxer {
+// NewGRPCServerMuxer accepts the connection from the client on ln. If
+// prefixIDs is true, streams are prefixed with their ID, which the client
+// must support.
+func NewGRPCServerMuxer(logger hclog.Logger, ln net.Listener, prefixIDs bool) *GRPCServerMuxer {
 	m := &GRPCServerMuxer{
 		addr:   ln.Addr(),
 		logger: logger,
+		ln:     ln,
 
-		sessionErrCh: make(chan error),
+		readyCh: make(chan struct{}),
 
 		knockCh:        make(chan uint32, 1),
 		acceptChannels: make(map[uint32]chan acceptResult),
 	}
+	if prefixIDs {
+		m.router = newStreamRouter(logger, true)
+	}
 
-	go m.acceptSession(ln)
+	go m.acceptSession()
 
 	return m
 }
 
-// acceptSessionAndMuxAccept is responsible for establishing the yamux session,
-// and then kicking off the acceptLoop function.
-func (m *GRPCServerMuxer) acceptSession(ln net.Listener) {
-	defer close(m.sessionErrCh)
+// acceptSession is responsible for establishing the first yamux session,
+// and then kicking off routing its streams if they're prefixed with their ID.
+func (m *GRPCServerMuxer) acceptSession() {
+	defer close(m.readyCh)
 
 	m.logger.Debug("accepting initial connection", "addr", m.addr)
-	conn, err := ln.Accept()
+	sess, err := m.newSession()
 	if err != nil {
-		m.sessionErrCh <- err
+		m.sessionErr = err
 		return
 	}
 
-	m.logger.Debug("initial server connection accepted", "addr", m.addr)
+	m.sessMutex.Lock()
+	m.sess = sess
+	m.sessMutex.Unlock()
+
+	if m.router != nil {
+		go m.routeSessions(sess)
+	}
+}
+
+// newSession accepts a connection and establishes a yamux session over it.
+func (m *GRPCServerMuxer) newSession() (*yamux.Session, error) {
+	conn, err := m.ln.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	m.logger.Debug("server connection accepted", "addr", m.addr)
 	cfg := yamux.DefaultConfig()
 	cfg.Logger = m.logger.Named("yamux").StandardLogger(&hclog.StandardLoggerOptions{
 		InferLevels: true,
 	})
 	cfg.LogOutput = nil
-	m.sess, err = yamux.Server(conn, cfg)
+	return yamux.Server(conn, cfg)
+}
+
+// nextSession replaces the current session once its client disconnected,
+// with a session for the next connection, such as from a client
+// reattaching. It blocks until there is one or the muxer is closed.
+func (m *GRPCServerMuxer) nextSession() (*yamux.Session, error) {
+	m.logger.Debug("client disconnected, accepting next connection", "addr", m.addr)
+	sess, err := m.newSession()
 	if err != nil {
-		m.sessionErrCh <- err
-		return
+		return nil, err
+	}
+
+	m.sessMutex.Lock()
+	m.sess = sess
+	m.sessMutex.Unlock()
+
+	return sess, nil
+}
+
+// routeSessions routes the streams of sess, and of every session after it,
+// by the ID they are prefixed with.
+func (m *GRPCServerMuxer) routeSessions(sess *yamux.Session) {
+	for {
+		m.router.serve(sess)
+
+		next, err := m.nextSession()
+		if err != nil {
+			m.router.close(err)
+			return
+		}
+		sess = next
 	}
 }
 
 func (m *GRPCServerMuxer) session() (*yamux.Session, error) {
 	select {
-	case err := <-m.sessionErrCh:
-		if err != nil {
-			return nil, err
+	case <-m.readyCh:
+		if m.sessionErr != nil {
+			return nil, m.sessionErr
 		}
 	case <-time.After(5 * time.Second):
 		return nil, errors.New("timed out waiting for connection to be established")
 	}
 
+	m.sessMutex.Lock()
+	defer m.sessMutex.Unlock()
+
 	// Should never happen.
 	if m.sess == nil {
 		return nil, errors.New("no connection established and no error received")
@@ -105,15 +173,29 @@ func (m *GRPCServerMuxer) session() (*yamux.Session, error) {
 }
 
 // Accept accepts all incoming connections and routes them to the correct
-// stream ID based on the most recent knock received.
+// stream ID based on the most recent knock received, or the ID they're
+// prefixed with.
 func (m *GRPCServerMuxer) Accept() (net.Conn, error) {
 	session, err := m.session()
 	if err != nil {
 		return nil, fmt.Errorf("error establishing yamux session: %w", err)
 	}
 
+	if m.router != nil {
+		return m.router.accept()
+	}
+
 	for {
 		conn, acceptErr := session.Accept()
+		if acceptErr != nil && session.IsClosed() {
+			// The client disconnected. Serve the next one instead, which may
+			// be reattaching.
+			session, err = m.nextSession()
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
 
 		select {
 		case id := <-m.knockCh:
@@ -144,6 +226,9 @@ func (m *GRPCServerMuxer) Addr() net.Addr {
 }
 
 func (m *GRPCServerMuxer) Close() error {
+	// Stop accepting connections from new clients.
+	_ = m.ln.Close()
+
 	session, err := m.session()
 	if err != nil {
 		return err
@@ -162,6 +247,10 @@ func (m *GRPCServerMuxer) Listener(id uint32, doneCh <-chan struct{}) (net.Liste
 		return nil, err
 	}
 
+	if m.router != nil {
+		return m.router.listener(sess.Addr(), id, doneCh), nil
+	}
+
 	ln := newBlockedServerListener(sess.Addr(), doneCh)
 	m.acceptMutex.Lock()
 	m.acceptChannels[id] = ln.acceptCh
@@ -170,13 +259,13 @@ func (m *GRPCServerMuxer) Listener(id uint32, doneCh <-chan struct{}) (net.Liste
 	return ln, nil
 }
 
-func (m *GRPCServerMuxer) Dial() (net.Conn, error) {
+func (m *GRPCServerMuxer) Dial(id uint32) (net.Conn, error) {
 	sess, err := m.session()
 	if err != nil {
 		return nil, err
 	}
 
-	stream, err := sess.OpenStream()
+	stream, err := openStream(sess, m.router != nil, id)
 	if err != nil {
 		return nil, fmt.Errorf("error dialling new server stream: %w", err)
 	}
@@ -185,6 +274,14 @@ func (m *GRPCServerMuxer) Dial() (net.Conn, error) {
 }
 
 func (m *GRPCServerMuxer) AcceptKnock(id uint32) error {
+	if m.router != nil {
+		return m.router.knock(id)
+	}
+
 	m.knockCh <- id
 	return nil
 }
+
+func (m *GRPCServerMuxer) Sequential() bool {
+	return m.router == nil
+}
@@ -0,0 +1,179 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package grpcmux
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/yamux"
+)
+
+// streamIDTimeout is how long a dialer has to send the ID of a new stream.
+const streamIDTimeout = 5 * time.Second
+
+// streamRouter routes the streams accepted on a yamux.Session to the
+// listener for the gRPC broker stream ID each stream is prefixed with. Unlike
+// routing by the most recent knock, this lets streams for different IDs be
+// established concurrently, in either direction.
+//
+// ID 0 is the main connection, which serves the gRPC broker's control
+// services. Only the server side accepts it.
+type streamRouter struct {
+	logger hclog.Logger
+
+	// defaultCh receives the streams with ID 0, and is nil if they are
+	// rejected.
+	defaultCh chan net.Conn
+
+	// closedCh is closed once no more sessions will be served, after err is
+	// set.
+	closedCh chan struct{}
+	err      error
+
+	mu        sync.Mutex
+	listeners map[uint32]*blockedServerListener
+}
+
+func newStreamRouter(logger hclog.Logger, acceptDefault bool) *streamRouter {
+	r := &streamRouter{
+		logger:    logger,
+		closedCh:  make(chan struct{}),
+		listeners: make(map[uint32]*blockedServerListener),
+	}
+	if acceptDefault {
+		r.defaultCh = make(chan net.Conn)
+	}
+
+	return r
+}
+
+// serve accepts streams on session until it is closed, and routes them. It
+// blocks and should be run in a goroutine.
+func (r *streamRouter) serve(session *yamux.Session) error {
+	for {
+		conn, err := session.Accept()
+		if err != nil {
+			return err
+		}
+
+		go r.route(conn)
+	}
+}
+
+// close stops routing streams, once no more sessions will be served. Accept
+// returns err from then on.
+func (r *streamRouter) close(err error) {
+	r.err = err
+	close(r.closedCh)
+}
+
+// route reads the ID conn is prefixed with and hands it to the listener for
+// that ID.
+func (r *streamRouter) route(conn net.Conn) {
+	var id uint32
+	_ = conn.SetReadDeadline(time.Now().Add(streamIDTimeout))
+	if err := binary.Read(conn, binary.LittleEndian, &id); err != nil {
+		r.logger.Debug("error reading stream ID", "error", err)
+		_ = conn.Close()
+		return
+	}
+	_ = conn.SetReadDeadline(time.Time{})
+
+	if id == 0 && r.defaultCh != nil {
+		r.logger.Debug("sending conn to default listener")
+		select {
+		case r.defaultCh <- conn:
+		case <-r.closedCh:
+			_ = conn.Close()
+		}
+		return
+	}
+
+	r.mu.Lock()
+	ln, ok := r.listeners[id]
+	r.mu.Unlock()
+	if !ok {
+		r.logger.Warn("received stream for ID that doesn't have a listener", "id", id)
+		_ = conn.Close()
+		return
+	}
+
+	r.logger.Debug("sending conn to brokered listener", "id", id)
+	select {
+	case ln.acceptCh <- acceptResult{conn: conn}:
+	case <-ln.doneCh:
+		_ = conn.Close()
+	case <-r.closedCh:
+		_ = conn.Close()
+	}
+}
+
+// accept returns the next stream with ID 0.
+func (r *streamRouter) accept() (net.Conn, error) {
+	select {
+	case conn := <-r.defaultCh:
+		return conn, nil
+	case <-r.closedCh:
+		return nil, r.err
+	}
+}
+
+// listener returns a listener for the streams with the given ID. It stops
+// receiving them once doneCh is closed.
+func (r *streamRouter) listener(addr net.Addr, id uint32, doneCh <-chan struct{}) net.Listener {
+	ln := newBlockedServerListener(addr, doneCh)
+
+	r.mu.Lock()
+	r.listeners[id] = ln
+	r.mu.Unlock()
+
+	go func() {
+		select {
+		case <-doneCh:
+		case <-r.closedCh:
+		}
+
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if r.listeners[id] == ln {
+			delete(r.listeners, id)
+		}
+	}()
+
+	return ln
+}
+
+// knock returns an error if there is no listener for the given ID.
+func (r *streamRouter) knock(id uint32) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.listeners[id]; !ok {
+		return fmt.Errorf("no listener for id %d", id)
+	}
+	return nil
+}
+
+// openStream opens a stream on session, prefixed with the given ID if
+// prefixID is true.
+func openStream(session *yamux.Session, prefixID bool, id uint32) (net.Conn, error) {
+	stream, err := session.OpenStream()
+	if err != nil {
+		return nil, err
+	}
+
+	if prefixID {
+		if err := binary.Write(stream, binary.LittleEndian, id); err != nil {
+			_ = stream.Close()
+			return nil, err
+		}
+	}
+
+	return stream, nil
+}
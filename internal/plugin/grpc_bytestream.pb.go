@@ -0,0 +1,321 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.31.0
+// 	protoc        (unknown)
+// source: internal/plugin/grpc_bytestream.proto
+
+package plugin
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type ByteStreamReadRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// size is the maximum number of bytes to read.
+	Size uint32 `protobuf:"varint,1,opt,name=size,proto3" json:"size,omitempty"`
+}
+
+func (x *ByteStreamReadRequest) Reset() {
+	*x = ByteStreamReadRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_internal_plugin_grpc_bytestream_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ByteStreamReadRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ByteStreamReadRequest) ProtoMessage() {}
+
+func (x *ByteStreamReadRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_plugin_grpc_bytestream_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ByteStreamReadRequest.ProtoReflect.Descriptor instead.
+func (*ByteStreamReadRequest) Descriptor() ([]byte, []int) {
+	return file_internal_plugin_grpc_bytestream_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *ByteStreamReadRequest) GetSize() uint32 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+// ByteStreamChunk is a chunk of the data read from or written to the
+// stream.
+type ByteStreamChunk struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Data []byte `protobuf:"bytes,1,opt,name=data,proto3" json:"data,omitempty"`
+	// eof is set on the last chunk read, once the io.Reader returned io.EOF.
+	Eof bool `protobuf:"varint,2,opt,name=eof,proto3" json:"eof,omitempty"`
+	// error is set on the last chunk read if the io.Reader returned an error
+	// other than io.EOF.
+	Error string `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"`
+}
+
+func (x *ByteStreamChunk) Reset() {
+	*x = ByteStreamChunk{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_internal_plugin_grpc_bytestream_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ByteStreamChunk) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ByteStreamChunk) ProtoMessage() {}
+
+func (x *ByteStreamChunk) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_plugin_grpc_bytestream_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ByteStreamChunk.ProtoReflect.Descriptor instead.
+func (*ByteStreamChunk) Descriptor() ([]byte, []int) {
+	return file_internal_plugin_grpc_bytestream_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *ByteStreamChunk) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+func (x *ByteStreamChunk) GetEof() bool {
+	if x != nil {
+		return x.Eof
+	}
+	return false
+}
+
+func (x *ByteStreamChunk) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+type ByteStreamWriteAck struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// written is how many bytes of the chunk were written.
+	Written uint32 `protobuf:"varint,1,opt,name=written,proto3" json:"written,omitempty"`
+	// error is set if the io.Writer returned an error.
+	Error string `protobuf:"bytes,2,opt,name=error,proto3" json:"error,omitempty"`
+}
+
+func (x *ByteStreamWriteAck) Reset() {
+	*x = ByteStreamWriteAck{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_internal_plugin_grpc_bytestream_proto_msgTypes[2]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ByteStreamWriteAck) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ByteStreamWriteAck) ProtoMessage() {}
+
+func (x *ByteStreamWriteAck) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_plugin_grpc_bytestream_proto_msgTypes[2]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ByteStreamWriteAck.ProtoReflect.Descriptor instead.
+func (*ByteStreamWriteAck) Descriptor() ([]byte, []int) {
+	return file_internal_plugin_grpc_bytestream_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *ByteStreamWriteAck) GetWritten() uint32 {
+	if x != nil {
+		return x.Written
+	}
+	return 0
+}
+
+func (x *ByteStreamWriteAck) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+var File_internal_plugin_grpc_bytestream_proto protoreflect.FileDescriptor
+
+var file_internal_plugin_grpc_bytestream_proto_rawDesc = []byte{
+	0x0a, 0x25, 0x69, 0x6e, 0x74, 0x65, 0x72, 0x6e, 0x61, 0x6c, 0x2f, 0x70, 0x6c, 0x75, 0x67, 0x69,
+	0x6e, 0x2f, 0x67, 0x72, 0x70, 0x63, 0x5f, 0x62, 0x79, 0x74, 0x65, 0x73, 0x74, 0x72, 0x65, 0x61,
+	0x6d, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x06, 0x70, 0x6c, 0x75, 0x67, 0x69, 0x6e, 0x22,
+	0x2b, 0x0a, 0x15, 0x42, 0x79, 0x74, 0x65, 0x53, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x52, 0x65, 0x61,
+	0x64, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x12, 0x0a, 0x04, 0x73, 0x69, 0x7a, 0x65,
+	0x18, 0x01, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x04, 0x73, 0x69, 0x7a, 0x65, 0x22, 0x4d, 0x0a, 0x0f,
+	0x42, 0x79, 0x74, 0x65, 0x53, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x43, 0x68, 0x75, 0x6e, 0x6b, 0x12,
+	0x12, 0x0a, 0x04, 0x64, 0x61, 0x74, 0x61, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x04, 0x64,
+	0x61, 0x74, 0x61, 0x12, 0x10, 0x0a, 0x03, 0x65, 0x6f, 0x66, 0x18, 0x02, 0x20, 0x01, 0x28, 0x08,
+	0x52, 0x03, 0x65, 0x6f, 0x66, 0x12, 0x14, 0x0a, 0x05, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x18, 0x03,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x22, 0x44, 0x0a, 0x12, 0x42,
+	0x79, 0x74, 0x65, 0x53, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x57, 0x72, 0x69, 0x74, 0x65, 0x41, 0x63,
+	0x6b, 0x12, 0x18, 0x0a, 0x07, 0x77, 0x72, 0x69, 0x74, 0x74, 0x65, 0x6e, 0x18, 0x01, 0x20, 0x01,
+	0x28, 0x0d, 0x52, 0x07, 0x77, 0x72, 0x69, 0x74, 0x74, 0x65, 0x6e, 0x12, 0x14, 0x0a, 0x05, 0x65,
+	0x72, 0x72, 0x6f, 0x72, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x65, 0x72, 0x72, 0x6f,
+	0x72, 0x32, 0x96, 0x01, 0x0a, 0x0e, 0x47, 0x52, 0x50, 0x43, 0x42, 0x79, 0x74, 0x65, 0x53, 0x74,
+	0x72, 0x65, 0x61, 0x6d, 0x12, 0x42, 0x0a, 0x04, 0x52, 0x65, 0x61, 0x64, 0x12, 0x1d, 0x2e, 0x70,
+	0x6c, 0x75, 0x67, 0x69, 0x6e, 0x2e, 0x42, 0x79, 0x74, 0x65, 0x53, 0x74, 0x72, 0x65, 0x61, 0x6d,
+	0x52, 0x65, 0x61, 0x64, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x17, 0x2e, 0x70, 0x6c,
+	0x75, 0x67, 0x69, 0x6e, 0x2e, 0x42, 0x79, 0x74, 0x65, 0x53, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x43,
+	0x68, 0x75, 0x6e, 0x6b, 0x28, 0x01, 0x30, 0x01, 0x12, 0x40, 0x0a, 0x05, 0x57, 0x72, 0x69, 0x74,
+	0x65, 0x12, 0x17, 0x2e, 0x70, 0x6c, 0x75, 0x67, 0x69, 0x6e, 0x2e, 0x42, 0x79, 0x74, 0x65, 0x53,
+	0x74, 0x72, 0x65, 0x61, 0x6d, 0x43, 0x68, 0x75, 0x6e, 0x6b, 0x1a, 0x1a, 0x2e, 0x70, 0x6c, 0x75,
+	0x67, 0x69, 0x6e, 0x2e, 0x42, 0x79, 0x74, 0x65, 0x53, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x57, 0x72,
+	0x69, 0x74, 0x65, 0x41, 0x63, 0x6b, 0x28, 0x01, 0x30, 0x01, 0x42, 0x0a, 0x5a, 0x08, 0x2e, 0x2f,
+	0x70, 0x6c, 0x75, 0x67, 0x69, 0x6e, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+}
+
+var (
+	file_internal_plugin_grpc_bytestream_proto_rawDescOnce sync.Once
+	file_internal_plugin_grpc_bytestream_proto_rawDescData = file_internal_plugin_grpc_bytestream_proto_rawDesc
+)
+
+func file_internal_plugin_grpc_bytestream_proto_rawDescGZIP() []byte {
+	file_internal_plugin_grpc_bytestream_proto_rawDescOnce.Do(func() {
+		file_internal_plugin_grpc_bytestream_proto_rawDescData = protoimpl.X.CompressGZIP(file_internal_plugin_grpc_bytestream_proto_rawDescData)
+	})
+	return file_internal_plugin_grpc_bytestream_proto_rawDescData
+}
+
+var file_internal_plugin_grpc_bytestream_proto_msgTypes = make([]protoimpl.MessageInfo, 3)
+var file_internal_plugin_grpc_bytestream_proto_goTypes = []interface{}{
+	(*ByteStreamReadRequest)(nil), // 0: plugin.ByteStreamReadRequest
+	(*ByteStreamChunk)(nil),       // 1: plugin.ByteStreamChunk
+	(*ByteStreamWriteAck)(nil),    // 2: plugin.ByteStreamWriteAck
+}
+var file_internal_plugin_grpc_bytestream_proto_depIdxs = []int32{
+	0, // 0: plugin.GRPCByteStream.Read:input_type -> plugin.ByteStreamReadRequest
+	1, // 1: plugin.GRPCByteStream.Write:input_type -> plugin.ByteStreamChunk
+	1, // 2: plugin.GRPCByteStream.Read:output_type -> plugin.ByteStreamChunk
+	2, // 3: plugin.GRPCByteStream.Write:output_type -> plugin.ByteStreamWriteAck
+	2, // [2:4] is the sub-list for method output_type
+	0, // [0:2] is the sub-list for method input_type
+	0, // [0:0] is the sub-list for extension type_name
+	0, // [0:0] is the sub-list for extension extendee
+	0, // [0:0] is the sub-list for field type_name
+}
+
+func init() { file_internal_plugin_grpc_bytestream_proto_init() }
+func file_internal_plugin_grpc_bytestream_proto_init() {
+	if File_internal_plugin_grpc_bytestream_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_internal_plugin_grpc_bytestream_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ByteStreamReadRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_internal_plugin_grpc_bytestream_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ByteStreamChunk); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_internal_plugin_grpc_bytestream_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ByteStreamWriteAck); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_internal_plugin_grpc_bytestream_proto_rawDesc,
+			NumEnums:      0,
+			NumMessages:   3,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_internal_plugin_grpc_bytestream_proto_goTypes,
+		DependencyIndexes: file_internal_plugin_grpc_bytestream_proto_depIdxs,
+		MessageInfos:      file_internal_plugin_grpc_bytestream_proto_msgTypes,
+	}.Build()
+	File_internal_plugin_grpc_bytestream_proto = out.File
+	file_internal_plugin_grpc_bytestream_proto_rawDesc = nil
+	file_internal_plugin_grpc_bytestream_proto_goTypes = nil
+	file_internal_plugin_grpc_bytestream_proto_depIdxs = nil
+}
@@ -0,0 +1,221 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: internal/plugin/grpc_bytestream.proto
+
+package plugin
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	GRPCByteStream_Read_FullMethodName  = "/plugin.GRPCByteStream/Read"
+	GRPCByteStream_Write_FullMethodName = "/plugin.GRPCByteStream/Write"
+)
+
+// GRPCByteStreamClient is the client API for GRPCByteStream service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type GRPCByteStreamClient interface {
+	// Read reads from the served io.Reader. The server answers each request
+	// with one chunk of at most the requested size, so that it never reads
+	// ahead of the caller.
+	Read(ctx context.Context, opts ...grpc.CallOption) (GRPCByteStream_ReadClient, error)
+	// Write writes to the served io.Writer. The server acknowledges each
+	// chunk once it is written, so that the caller never writes ahead of it.
+	Write(ctx context.Context, opts ...grpc.CallOption) (GRPCByteStream_WriteClient, error)
+}
+
+type gRPCByteStreamClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewGRPCByteStreamClient(cc grpc.ClientConnInterface) GRPCByteStreamClient {
+	return &gRPCByteStreamClient{cc}
+}
+
+func (c *gRPCByteStreamClient) Read(ctx context.Context, opts ...grpc.CallOption) (GRPCByteStream_ReadClient, error) {
+	stream, err := c.cc.NewStream(ctx, &GRPCByteStream_ServiceDesc.Streams[0], GRPCByteStream_Read_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &gRPCByteStreamReadClient{stream}
+	return x, nil
+}
+
+type GRPCByteStream_ReadClient interface {
+	Send(*ByteStreamReadRequest) error
+	Recv() (*ByteStreamChunk, error)
+	grpc.ClientStream
+}
+
+type gRPCByteStreamReadClient struct {
+	grpc.ClientStream
+}
+
+func (x *gRPCByteStreamReadClient) Send(m *ByteStreamReadRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *gRPCByteStreamReadClient) Recv() (*ByteStreamChunk, error) {
+	m := new(ByteStreamChunk)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *gRPCByteStreamClient) Write(ctx context.Context, opts ...grpc.CallOption) (GRPCByteStream_WriteClient, error) {
+	stream, err := c.cc.NewStream(ctx, &GRPCByteStream_ServiceDesc.Streams[1], GRPCByteStream_Write_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &gRPCByteStreamWriteClient{stream}
+	return x, nil
+}
+
+type GRPCByteStream_WriteClient interface {
+	Send(*ByteStreamChunk) error
+	Recv() (*ByteStreamWriteAck, error)
+	grpc.ClientStream
+}
+
+type gRPCByteStreamWriteClient struct {
+	grpc.ClientStream
+}
+
+func (x *gRPCByteStreamWriteClient) Send(m *ByteStreamChunk) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *gRPCByteStreamWriteClient) Recv() (*ByteStreamWriteAck, error) {
+	m := new(ByteStreamWriteAck)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// GRPCByteStreamServer is the server API for GRPCByteStream service.
+// All implementations should embed UnimplementedGRPCByteStreamServer
+// for forward compatibility
+type GRPCByteStreamServer interface {
+	// Read reads from the served io.Reader. The server answers each request
+	// with one chunk of at most the requested size, so that it never reads
+	// ahead of the caller.
+	Read(GRPCByteStream_ReadServer) error
+	// Write writes to the served io.Writer. The server acknowledges each
+	// chunk once it is written, so that the caller never writes ahead of it.
+	Write(GRPCByteStream_WriteServer) error
+}
+
+// UnimplementedGRPCByteStreamServer should be embedded to have forward compatible implementations.
+type UnimplementedGRPCByteStreamServer struct {
+}
+
+func (UnimplementedGRPCByteStreamServer) Read(GRPCByteStream_ReadServer) error {
+	return status.Errorf(codes.Unimplemented, "method Read not implemented")
+}
+func (UnimplementedGRPCByteStreamServer) Write(GRPCByteStream_WriteServer) error {
+	return status.Errorf(codes.Unimplemented, "method Write not implemented")
+}
+
+// UnsafeGRPCByteStreamServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to GRPCByteStreamServer will
+// result in compilation errors.
+type UnsafeGRPCByteStreamServer interface {
+	mustEmbedUnimplementedGRPCByteStreamServer()
+}
+
+func RegisterGRPCByteStreamServer(s grpc.ServiceRegistrar, srv GRPCByteStreamServer) {
+	s.RegisterService(&GRPCByteStream_ServiceDesc, srv)
+}
+
+func _GRPCByteStream_Read_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(GRPCByteStreamServer).Read(&gRPCByteStreamReadServer{stream})
+}
+
+type GRPCByteStream_ReadServer interface {
+	Send(*ByteStreamChunk) error
+	Recv() (*ByteStreamReadRequest, error)
+	grpc.ServerStream
+}
+
+type gRPCByteStreamReadServer struct {
+	grpc.ServerStream
+}
+
+func (x *gRPCByteStreamReadServer) Send(m *ByteStreamChunk) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *gRPCByteStreamReadServer) Recv() (*ByteStreamReadRequest, error) {
+	m := new(ByteStreamReadRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _GRPCByteStream_Write_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(GRPCByteStreamServer).Write(&gRPCByteStreamWriteServer{stream})
+}
+
+type GRPCByteStream_WriteServer interface {
+	Send(*ByteStreamWriteAck) error
+	Recv() (*ByteStreamChunk, error)
+	grpc.ServerStream
+}
+
+type gRPCByteStreamWriteServer struct {
+	grpc.ServerStream
+}
+
+func (x *gRPCByteStreamWriteServer) Send(m *ByteStreamWriteAck) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *gRPCByteStreamWriteServer) Recv() (*ByteStreamChunk, error) {
+	m := new(ByteStreamChunk)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// GRPCByteStream_ServiceDesc is the grpc.ServiceDesc for GRPCByteStream service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var GRPCByteStream_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "plugin.GRPCByteStream",
+	HandlerType: (*GRPCByteStreamServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Read",
+			Handler:       _GRPCByteStream_Read_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "Write",
+			Handler:       _GRPCByteStream_Write_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "internal/plugin/grpc_bytestream.proto",
+}
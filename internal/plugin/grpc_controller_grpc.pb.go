@@ -22,14 +22,17 @@ import (
 const _ = grpc.SupportPackageIsVersion7
 
 const (
-	GRPCController_Shutdown_FullMethodName = "/plugin.GRPCController/Shutdown"
+	GRPCController_Shutdown_FullMethodName    = "/plugin.GRPCController/Shutdown"
+	GRPCController_SetLogLevel_FullMethodName = "/plugin.GRPCController/SetLogLevel"
 )
 
 // GRPCControllerClient is the client API for GRPCController service.
 //
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type GRPCControllerClient interface {
-	Shutdown(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*Empty, error)
+	Shutdown(ctx context.Context, in *ShutdownRequest, opts ...grpc.CallOption) (*Empty, error)
+	// SetLogLevel changes the level of the plugin's logger while it runs.
+	SetLogLevel(ctx context.Context, in *SetLogLevelRequest, opts ...grpc.CallOption) (*Empty, error)
 }
 
 type gRPCControllerClient struct {
@@ -40,7 +43,7 @@ func NewGRPCControllerClient(cc grpc.ClientConnInterface) GRPCControllerClient {
 	return &gRPCControllerClient{cc}
 }
 
-func (c *gRPCControllerClient) Shutdown(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*Empty, error) {
+func (c *gRPCControllerClient) Shutdown(ctx context.Context, in *ShutdownRequest, opts ...grpc.CallOption) (*Empty, error) {
 	out := new(Empty)
 	err := c.cc.Invoke(ctx, GRPCController_Shutdown_FullMethodName, in, out, opts...)
 	if err != nil {
@@ -49,20 +52,34 @@ func (c *gRPCControllerClient) Shutdown(ctx context.Context, in *Empty, opts ...
 	return out, nil
 }
 
+func (c *gRPCControllerClient) SetLogLevel(ctx context.Context, in *SetLogLevelRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, GRPCController_SetLogLevel_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // GRPCControllerServer is the server API for GRPCController service.
 // All implementations should embed UnimplementedGRPCControllerServer
 // for forward compatibility
 type GRPCControllerServer interface {
-	Shutdown(context.Context, *Empty) (*Empty, error)
+	Shutdown(context.Context, *ShutdownRequest) (*Empty, error)
+	// SetLogLevel changes the level of the plugin's logger while it runs.
+	SetLogLevel(context.Context, *SetLogLevelRequest) (*Empty, error)
 }
 
 // UnimplementedGRPCControllerServer should be embedded to have forward compatible implementations.
 type UnimplementedGRPCControllerServer struct {
 }
 
-func (UnimplementedGRPCControllerServer) Shutdown(context.Context, *Empty) (*Empty, error) {
+func (UnimplementedGRPCControllerServer) Shutdown(context.Context, *ShutdownRequest) (*Empty, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Shutdown not implemented")
 }
+func (UnimplementedGRPCControllerServer) SetLogLevel(context.Context, *SetLogLevelRequest) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetLogLevel not implemented")
+}
 
 // UnsafeGRPCControllerServer may be embedded to opt out of forward compatibility for this service.
 // Use of this interface is not recommended, as added methods to GRPCControllerServer will
@@ -76,7 +93,7 @@ func RegisterGRPCControllerServer(s grpc.ServiceRegistrar, srv GRPCControllerSer
 }
 
 func _GRPCController_Shutdown_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(Empty)
+	in := new(ShutdownRequest)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
@@ -88,7 +105,25 @@ func _GRPCController_Shutdown_Handler(srv interface{}, ctx context.Context, dec
 		FullMethod: GRPCController_Shutdown_FullMethodName,
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(GRPCControllerServer).Shutdown(ctx, req.(*Empty))
+		return srv.(GRPCControllerServer).Shutdown(ctx, req.(*ShutdownRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GRPCController_SetLogLevel_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetLogLevelRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GRPCControllerServer).SetLogLevel(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GRPCController_SetLogLevel_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GRPCControllerServer).SetLogLevel(ctx, req.(*SetLogLevelRequest))
 	}
 	return interceptor(ctx, in, info, handler)
 }
@@ -104,6 +139,10 @@ var GRPCController_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Shutdown",
 			Handler:    _GRPCController_Shutdown_Handler,
 		},
+		{
+			MethodName: "SetLogLevel",
+			Handler:    _GRPCController_SetLogLevel_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "internal/plugin/grpc_controller.proto",
@@ -0,0 +1,468 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.31.0
+// 	protoc        (unknown)
+// source: internal/plugin/grpc_log.proto
+
+package plugin
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	emptypb "google.golang.org/protobuf/types/known/emptypb"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type LogEntry_Level int32
+
+const (
+	LogEntry_NOT_SET LogEntry_Level = 0
+	LogEntry_TRACE   LogEntry_Level = 1
+	LogEntry_DEBUG   LogEntry_Level = 2
+	LogEntry_INFO    LogEntry_Level = 3
+	LogEntry_WARN    LogEntry_Level = 4
+	LogEntry_ERROR   LogEntry_Level = 5
+)
+
+// Enum value maps for LogEntry_Level.
+var (
+	LogEntry_Level_name = map[int32]string{
+		0: "NOT_SET",
+		1: "TRACE",
+		2: "DEBUG",
+		3: "INFO",
+		4: "WARN",
+		5: "ERROR",
+	}
+	LogEntry_Level_value = map[string]int32{
+		"NOT_SET": 0,
+		"TRACE":   1,
+		"DEBUG":   2,
+		"INFO":    3,
+		"WARN":    4,
+		"ERROR":   5,
+	}
+)
+
+func (x LogEntry_Level) Enum() *LogEntry_Level {
+	p := new(LogEntry_Level)
+	*p = x
+	return p
+}
+
+func (x LogEntry_Level) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (LogEntry_Level) Descriptor() protoreflect.EnumDescriptor {
+	return file_internal_plugin_grpc_log_proto_enumTypes[0].Descriptor()
+}
+
+func (LogEntry_Level) Type() protoreflect.EnumType {
+	return &file_internal_plugin_grpc_log_proto_enumTypes[0]
+}
+
+func (x LogEntry_Level) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use LogEntry_Level.Descriptor instead.
+func (LogEntry_Level) EnumDescriptor() ([]byte, []int) {
+	return file_internal_plugin_grpc_log_proto_rawDescGZIP(), []int{0, 0}
+}
+
+// LogEntry is a single entry logged by the plugin.
+type LogEntry struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Timestamp *timestamppb.Timestamp `protobuf:"bytes,1,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	Level     LogEntry_Level         `protobuf:"varint,2,opt,name=level,proto3,enum=plugin.LogEntry_Level" json:"level,omitempty"`
+	// name is the name of the logger the entry was logged with.
+	Name    string    `protobuf:"bytes,3,opt,name=name,proto3" json:"name,omitempty"`
+	Message string    `protobuf:"bytes,4,opt,name=message,proto3" json:"message,omitempty"`
+	Args    []*LogArg `protobuf:"bytes,5,rep,name=args,proto3" json:"args,omitempty"`
+	// dropped is set on entries the plugin sends to report that it dropped
+	// that many entries, because the host didn't read them in time.
+	Dropped uint64 `protobuf:"varint,6,opt,name=dropped,proto3" json:"dropped,omitempty"`
+}
+
+func (x *LogEntry) Reset() {
+	*x = LogEntry{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_internal_plugin_grpc_log_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *LogEntry) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LogEntry) ProtoMessage() {}
+
+func (x *LogEntry) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_plugin_grpc_log_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LogEntry.ProtoReflect.Descriptor instead.
+func (*LogEntry) Descriptor() ([]byte, []int) {
+	return file_internal_plugin_grpc_log_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *LogEntry) GetTimestamp() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Timestamp
+	}
+	return nil
+}
+
+func (x *LogEntry) GetLevel() LogEntry_Level {
+	if x != nil {
+		return x.Level
+	}
+	return LogEntry_NOT_SET
+}
+
+func (x *LogEntry) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *LogEntry) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *LogEntry) GetArgs() []*LogArg {
+	if x != nil {
+		return x.Args
+	}
+	return nil
+}
+
+func (x *LogEntry) GetDropped() uint64 {
+	if x != nil {
+		return x.Dropped
+	}
+	return 0
+}
+
+// LogArg is a key/value argument of a LogEntry. Values of types without an
+// equivalent are sent as their string representation.
+type LogArg struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Key string `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	// Types that are assignable to Value:
+	//	*LogArg_StringValue
+	//	*LogArg_IntValue
+	//	*LogArg_UintValue
+	//	*LogArg_FloatValue
+	//	*LogArg_BoolValue
+	//	*LogArg_DurationValue
+	Value isLogArg_Value `protobuf_oneof:"value"`
+}
+
+func (x *LogArg) Reset() {
+	*x = LogArg{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_internal_plugin_grpc_log_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *LogArg) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LogArg) ProtoMessage() {}
+
+func (x *LogArg) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_plugin_grpc_log_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LogArg.ProtoReflect.Descriptor instead.
+func (*LogArg) Descriptor() ([]byte, []int) {
+	return file_internal_plugin_grpc_log_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *LogArg) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (m *LogArg) GetValue() isLogArg_Value {
+	if m != nil {
+		return m.Value
+	}
+	return nil
+}
+
+func (x *LogArg) GetStringValue() string {
+	if x, ok := x.GetValue().(*LogArg_StringValue); ok {
+		return x.StringValue
+	}
+	return ""
+}
+
+func (x *LogArg) GetIntValue() int64 {
+	if x, ok := x.GetValue().(*LogArg_IntValue); ok {
+		return x.IntValue
+	}
+	return 0
+}
+
+func (x *LogArg) GetUintValue() uint64 {
+	if x, ok := x.GetValue().(*LogArg_UintValue); ok {
+		return x.UintValue
+	}
+	return 0
+}
+
+func (x *LogArg) GetFloatValue() float64 {
+	if x, ok := x.GetValue().(*LogArg_FloatValue); ok {
+		return x.FloatValue
+	}
+	return 0
+}
+
+func (x *LogArg) GetBoolValue() bool {
+	if x, ok := x.GetValue().(*LogArg_BoolValue); ok {
+		return x.BoolValue
+	}
+	return false
+}
+
+func (x *LogArg) GetDurationValue() int64 {
+	if x, ok := x.GetValue().(*LogArg_DurationValue); ok {
+		return x.DurationValue
+	}
+	return 0
+}
+
+type isLogArg_Value interface {
+	isLogArg_Value()
+}
+
+type LogArg_StringValue struct {
+	StringValue string `protobuf:"bytes,2,opt,name=string_value,json=stringValue,proto3,oneof"`
+}
+
+type LogArg_IntValue struct {
+	IntValue int64 `protobuf:"varint,3,opt,name=int_value,json=intValue,proto3,oneof"`
+}
+
+type LogArg_UintValue struct {
+	UintValue uint64 `protobuf:"varint,4,opt,name=uint_value,json=uintValue,proto3,oneof"`
+}
+
+type LogArg_FloatValue struct {
+	FloatValue float64 `protobuf:"fixed64,5,opt,name=float_value,json=floatValue,proto3,oneof"`
+}
+
+type LogArg_BoolValue struct {
+	BoolValue bool `protobuf:"varint,6,opt,name=bool_value,json=boolValue,proto3,oneof"`
+}
+
+type LogArg_DurationValue struct {
+	// duration_value is a time.Duration in nanoseconds.
+	DurationValue int64 `protobuf:"varint,7,opt,name=duration_value,json=durationValue,proto3,oneof"`
+}
+
+func (*LogArg_StringValue) isLogArg_Value() {}
+
+func (*LogArg_IntValue) isLogArg_Value() {}
+
+func (*LogArg_UintValue) isLogArg_Value() {}
+
+func (*LogArg_FloatValue) isLogArg_Value() {}
+
+func (*LogArg_BoolValue) isLogArg_Value() {}
+
+func (*LogArg_DurationValue) isLogArg_Value() {}
+
+var File_internal_plugin_grpc_log_proto protoreflect.FileDescriptor
+
+var file_internal_plugin_grpc_log_proto_rawDesc = []byte{
+	0x0a, 0x1e, 0x69, 0x6e, 0x74, 0x65, 0x72, 0x6e, 0x61, 0x6c, 0x2f, 0x70, 0x6c, 0x75, 0x67, 0x69,
+	0x6e, 0x2f, 0x67, 0x72, 0x70, 0x63, 0x5f, 0x6c, 0x6f, 0x67, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f,
+	0x12, 0x06, 0x70, 0x6c, 0x75, 0x67, 0x69, 0x6e, 0x1a, 0x1b, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65,
+	0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2f, 0x65, 0x6d, 0x70, 0x74, 0x79, 0x2e,
+	0x70, 0x72, 0x6f, 0x74, 0x6f, 0x1a, 0x1f, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2f, 0x70, 0x72,
+	0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2f, 0x74, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70,
+	0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0xa9, 0x02, 0x0a, 0x08, 0x4c, 0x6f, 0x67, 0x45, 0x6e,
+	0x74, 0x72, 0x79, 0x12, 0x38, 0x0a, 0x09, 0x74, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70,
+	0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1a, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e,
+	0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61,
+	0x6d, 0x70, 0x52, 0x09, 0x74, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x12, 0x2c, 0x0a,
+	0x05, 0x6c, 0x65, 0x76, 0x65, 0x6c, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x16, 0x2e, 0x70,
+	0x6c, 0x75, 0x67, 0x69, 0x6e, 0x2e, 0x4c, 0x6f, 0x67, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x2e, 0x4c,
+	0x65, 0x76, 0x65, 0x6c, 0x52, 0x05, 0x6c, 0x65, 0x76, 0x65, 0x6c, 0x12, 0x12, 0x0a, 0x04, 0x6e,
+	0x61, 0x6d, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x12,
+	0x18, 0x0a, 0x07, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x07, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x12, 0x22, 0x0a, 0x04, 0x61, 0x72, 0x67,
+	0x73, 0x18, 0x05, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x0e, 0x2e, 0x70, 0x6c, 0x75, 0x67, 0x69, 0x6e,
+	0x2e, 0x4c, 0x6f, 0x67, 0x41, 0x72, 0x67, 0x52, 0x04, 0x61, 0x72, 0x67, 0x73, 0x12, 0x18, 0x0a,
+	0x07, 0x64, 0x72, 0x6f, 0x70, 0x70, 0x65, 0x64, 0x18, 0x06, 0x20, 0x01, 0x28, 0x04, 0x52, 0x07,
+	0x64, 0x72, 0x6f, 0x70, 0x70, 0x65, 0x64, 0x22, 0x49, 0x0a, 0x05, 0x4c, 0x65, 0x76, 0x65, 0x6c,
+	0x12, 0x0b, 0x0a, 0x07, 0x4e, 0x4f, 0x54, 0x5f, 0x53, 0x45, 0x54, 0x10, 0x00, 0x12, 0x09, 0x0a,
+	0x05, 0x54, 0x52, 0x41, 0x43, 0x45, 0x10, 0x01, 0x12, 0x09, 0x0a, 0x05, 0x44, 0x45, 0x42, 0x55,
+	0x47, 0x10, 0x02, 0x12, 0x08, 0x0a, 0x04, 0x49, 0x4e, 0x46, 0x4f, 0x10, 0x03, 0x12, 0x08, 0x0a,
+	0x04, 0x57, 0x41, 0x52, 0x4e, 0x10, 0x04, 0x12, 0x09, 0x0a, 0x05, 0x45, 0x52, 0x52, 0x4f, 0x52,
+	0x10, 0x05, 0x22, 0xf5, 0x01, 0x0a, 0x06, 0x4c, 0x6f, 0x67, 0x41, 0x72, 0x67, 0x12, 0x10, 0x0a,
+	0x03, 0x6b, 0x65, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x6b, 0x65, 0x79, 0x12,
+	0x23, 0x0a, 0x0c, 0x73, 0x74, 0x72, 0x69, 0x6e, 0x67, 0x5f, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x18,
+	0x02, 0x20, 0x01, 0x28, 0x09, 0x48, 0x00, 0x52, 0x0b, 0x73, 0x74, 0x72, 0x69, 0x6e, 0x67, 0x56,
+	0x61, 0x6c, 0x75, 0x65, 0x12, 0x1d, 0x0a, 0x09, 0x69, 0x6e, 0x74, 0x5f, 0x76, 0x61, 0x6c, 0x75,
+	0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x03, 0x48, 0x00, 0x52, 0x08, 0x69, 0x6e, 0x74, 0x56, 0x61,
+	0x6c, 0x75, 0x65, 0x12, 0x1f, 0x0a, 0x0a, 0x75, 0x69, 0x6e, 0x74, 0x5f, 0x76, 0x61, 0x6c, 0x75,
+	0x65, 0x18, 0x04, 0x20, 0x01, 0x28, 0x04, 0x48, 0x00, 0x52, 0x09, 0x75, 0x69, 0x6e, 0x74, 0x56,
+	0x61, 0x6c, 0x75, 0x65, 0x12, 0x21, 0x0a, 0x0b, 0x66, 0x6c, 0x6f, 0x61, 0x74, 0x5f, 0x76, 0x61,
+	0x6c, 0x75, 0x65, 0x18, 0x05, 0x20, 0x01, 0x28, 0x01, 0x48, 0x00, 0x52, 0x0a, 0x66, 0x6c, 0x6f,
+	0x61, 0x74, 0x56, 0x61, 0x6c, 0x75, 0x65, 0x12, 0x1f, 0x0a, 0x0a, 0x62, 0x6f, 0x6f, 0x6c, 0x5f,
+	0x76, 0x61, 0x6c, 0x75, 0x65, 0x18, 0x06, 0x20, 0x01, 0x28, 0x08, 0x48, 0x00, 0x52, 0x09, 0x62,
+	0x6f, 0x6f, 0x6c, 0x56, 0x61, 0x6c, 0x75, 0x65, 0x12, 0x27, 0x0a, 0x0e, 0x64, 0x75, 0x72, 0x61,
+	0x74, 0x69, 0x6f, 0x6e, 0x5f, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x18, 0x07, 0x20, 0x01, 0x28, 0x03,
+	0x48, 0x00, 0x52, 0x0d, 0x64, 0x75, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x56, 0x61, 0x6c, 0x75,
+	0x65, 0x42, 0x07, 0x0a, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x32, 0x47, 0x0a, 0x0b, 0x47, 0x52,
+	0x50, 0x43, 0x4c, 0x6f, 0x67, 0x53, 0x69, 0x6e, 0x6b, 0x12, 0x38, 0x0a, 0x0a, 0x53, 0x74, 0x72,
+	0x65, 0x61, 0x6d, 0x4c, 0x6f, 0x67, 0x73, 0x12, 0x16, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65,
+	0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x45, 0x6d, 0x70, 0x74, 0x79, 0x1a,
+	0x10, 0x2e, 0x70, 0x6c, 0x75, 0x67, 0x69, 0x6e, 0x2e, 0x4c, 0x6f, 0x67, 0x45, 0x6e, 0x74, 0x72,
+	0x79, 0x30, 0x01, 0x42, 0x0a, 0x5a, 0x08, 0x2e, 0x2f, 0x70, 0x6c, 0x75, 0x67, 0x69, 0x6e, 0x62,
+	0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+}
+
+var (
+	file_internal_plugin_grpc_log_proto_rawDescOnce sync.Once
+	file_internal_plugin_grpc_log_proto_rawDescData = file_internal_plugin_grpc_log_proto_rawDesc
+)
+
+func file_internal_plugin_grpc_log_proto_rawDescGZIP() []byte {
+	file_internal_plugin_grpc_log_proto_rawDescOnce.Do(func() {
+		file_internal_plugin_grpc_log_proto_rawDescData = protoimpl.X.CompressGZIP(file_internal_plugin_grpc_log_proto_rawDescData)
+	})
+	return file_internal_plugin_grpc_log_proto_rawDescData
+}
+
+var file_internal_plugin_grpc_log_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_internal_plugin_grpc_log_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_internal_plugin_grpc_log_proto_goTypes = []interface{}{
+	(LogEntry_Level)(0),           // 0: plugin.LogEntry.Level
+	(*LogEntry)(nil),              // 1: plugin.LogEntry
+	(*LogArg)(nil),                // 2: plugin.LogArg
+	(*timestamppb.Timestamp)(nil), // 3: google.protobuf.Timestamp
+	(*emptypb.Empty)(nil),         // 4: google.protobuf.Empty
+}
+var file_internal_plugin_grpc_log_proto_depIdxs = []int32{
+	3, // 0: plugin.LogEntry.timestamp:type_name -> google.protobuf.Timestamp
+	0, // 1: plugin.LogEntry.level:type_name -> plugin.LogEntry.Level
+	2, // 2: plugin.LogEntry.args:type_name -> plugin.LogArg
+	4, // 3: plugin.GRPCLogSink.StreamLogs:input_type -> google.protobuf.Empty
+	1, // 4: plugin.GRPCLogSink.StreamLogs:output_type -> plugin.LogEntry
+	4, // [4:5] is the sub-list for method output_type
+	3, // [3:4] is the sub-list for method input_type
+	3, // [3:3] is the sub-list for extension type_name
+	3, // [3:3] is the sub-list for extension extendee
+	0, // [0:3] is the sub-list for field type_name
+}
+
+func init() { file_internal_plugin_grpc_log_proto_init() }
+func file_internal_plugin_grpc_log_proto_init() {
+	if File_internal_plugin_grpc_log_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_internal_plugin_grpc_log_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*LogEntry); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_internal_plugin_grpc_log_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*LogArg); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	file_internal_plugin_grpc_log_proto_msgTypes[1].OneofWrappers = []interface{}{
+		(*LogArg_StringValue)(nil),
+		(*LogArg_IntValue)(nil),
+		(*LogArg_UintValue)(nil),
+		(*LogArg_FloatValue)(nil),
+		(*LogArg_BoolValue)(nil),
+		(*LogArg_DurationValue)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_internal_plugin_grpc_log_proto_rawDesc,
+			NumEnums:      1,
+			NumMessages:   2,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_internal_plugin_grpc_log_proto_goTypes,
+		DependencyIndexes: file_internal_plugin_grpc_log_proto_depIdxs,
+		EnumInfos:         file_internal_plugin_grpc_log_proto_enumTypes,
+		MessageInfos:      file_internal_plugin_grpc_log_proto_msgTypes,
+	}.Build()
+	File_internal_plugin_grpc_log_proto = out.File
+	file_internal_plugin_grpc_log_proto_rawDesc = nil
+	file_internal_plugin_grpc_log_proto_goTypes = nil
+	file_internal_plugin_grpc_log_proto_depIdxs = nil
+}
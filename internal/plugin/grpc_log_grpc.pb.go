@@ -0,0 +1,150 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: internal/plugin/grpc_log.proto
+
+package plugin
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+	emptypb "google.golang.org/protobuf/types/known/emptypb"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	GRPCLogSink_StreamLogs_FullMethodName = "/plugin.GRPCLogSink/StreamLogs"
+)
+
+// GRPCLogSinkClient is the client API for GRPCLogSink service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type GRPCLogSinkClient interface {
+	// StreamLogs returns a stream of the plugin's log entries. This RPC
+	// endpoint must only be called ONCE. Once an entry is consumed it is not
+	// sent again.
+	//
+	// Callers should connect early, since entries logged before the stream
+	// is read are only buffered up to a limit.
+	StreamLogs(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (GRPCLogSink_StreamLogsClient, error)
+}
+
+type gRPCLogSinkClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewGRPCLogSinkClient(cc grpc.ClientConnInterface) GRPCLogSinkClient {
+	return &gRPCLogSinkClient{cc}
+}
+
+func (c *gRPCLogSinkClient) StreamLogs(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (GRPCLogSink_StreamLogsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &GRPCLogSink_ServiceDesc.Streams[0], GRPCLogSink_StreamLogs_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &gRPCLogSinkStreamLogsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type GRPCLogSink_StreamLogsClient interface {
+	Recv() (*LogEntry, error)
+	grpc.ClientStream
+}
+
+type gRPCLogSinkStreamLogsClient struct {
+	grpc.ClientStream
+}
+
+func (x *gRPCLogSinkStreamLogsClient) Recv() (*LogEntry, error) {
+	m := new(LogEntry)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// GRPCLogSinkServer is the server API for GRPCLogSink service.
+// All implementations should embed UnimplementedGRPCLogSinkServer
+// for forward compatibility
+type GRPCLogSinkServer interface {
+	// StreamLogs returns a stream of the plugin's log entries. This RPC
+	// endpoint must only be called ONCE. Once an entry is consumed it is not
+	// sent again.
+	//
+	// Callers should connect early, since entries logged before the stream
+	// is read are only buffered up to a limit.
+	StreamLogs(*emptypb.Empty, GRPCLogSink_StreamLogsServer) error
+}
+
+// UnimplementedGRPCLogSinkServer should be embedded to have forward compatible implementations.
+type UnimplementedGRPCLogSinkServer struct {
+}
+
+func (UnimplementedGRPCLogSinkServer) StreamLogs(*emptypb.Empty, GRPCLogSink_StreamLogsServer) error {
+	return status.Errorf(codes.Unimplemented, "method StreamLogs not implemented")
+}
+
+// UnsafeGRPCLogSinkServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to GRPCLogSinkServer will
+// result in compilation errors.
+type UnsafeGRPCLogSinkServer interface {
+	mustEmbedUnimplementedGRPCLogSinkServer()
+}
+
+func RegisterGRPCLogSinkServer(s grpc.ServiceRegistrar, srv GRPCLogSinkServer) {
+	s.RegisterService(&GRPCLogSink_ServiceDesc, srv)
+}
+
+func _GRPCLogSink_StreamLogs_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(emptypb.Empty)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(GRPCLogSinkServer).StreamLogs(m, &gRPCLogSinkStreamLogsServer{stream})
+}
+
+type GRPCLogSink_StreamLogsServer interface {
+	Send(*LogEntry) error
+	grpc.ServerStream
+}
+
+type gRPCLogSinkStreamLogsServer struct {
+	grpc.ServerStream
+}
+
+func (x *gRPCLogSinkStreamLogsServer) Send(m *LogEntry) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// GRPCLogSink_ServiceDesc is the grpc.ServiceDesc for GRPCLogSink service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var GRPCLogSink_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "plugin.GRPCLogSink",
+	HandlerType: (*GRPCLogSinkServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamLogs",
+			Handler:       _GRPCLogSink_StreamLogs_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "internal/plugin/grpc_log.proto",
+}
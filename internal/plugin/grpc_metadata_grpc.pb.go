@@ -0,0 +1,111 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: internal/plugin/grpc_metadata.proto
+
+package plugin
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+	emptypb "google.golang.org/protobuf/types/known/emptypb"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	GRPCMetadata_Metadata_FullMethodName = "/plugin.GRPCMetadata/Metadata"
+)
+
+// GRPCMetadataClient is the client API for GRPCMetadata service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type GRPCMetadataClient interface {
+	Metadata(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*PluginMetadata, error)
+}
+
+type gRPCMetadataClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewGRPCMetadataClient(cc grpc.ClientConnInterface) GRPCMetadataClient {
+	return &gRPCMetadataClient{cc}
+}
+
+func (c *gRPCMetadataClient) Metadata(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*PluginMetadata, error) {
+	out := new(PluginMetadata)
+	err := c.cc.Invoke(ctx, GRPCMetadata_Metadata_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GRPCMetadataServer is the server API for GRPCMetadata service.
+// All implementations should embed UnimplementedGRPCMetadataServer
+// for forward compatibility
+type GRPCMetadataServer interface {
+	Metadata(context.Context, *emptypb.Empty) (*PluginMetadata, error)
+}
+
+// UnimplementedGRPCMetadataServer should be embedded to have forward compatible implementations.
+type UnimplementedGRPCMetadataServer struct {
+}
+
+func (UnimplementedGRPCMetadataServer) Metadata(context.Context, *emptypb.Empty) (*PluginMetadata, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Metadata not implemented")
+}
+
+// UnsafeGRPCMetadataServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to GRPCMetadataServer will
+// result in compilation errors.
+type UnsafeGRPCMetadataServer interface {
+	mustEmbedUnimplementedGRPCMetadataServer()
+}
+
+func RegisterGRPCMetadataServer(s grpc.ServiceRegistrar, srv GRPCMetadataServer) {
+	s.RegisterService(&GRPCMetadata_ServiceDesc, srv)
+}
+
+func _GRPCMetadata_Metadata_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GRPCMetadataServer).Metadata(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GRPCMetadata_Metadata_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GRPCMetadataServer).Metadata(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// GRPCMetadata_ServiceDesc is the grpc.ServiceDesc for GRPCMetadata service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var GRPCMetadata_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "plugin.GRPCMetadata",
+	HandlerType: (*GRPCMetadataServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Metadata",
+			Handler:    _GRPCMetadata_Metadata_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "internal/plugin/grpc_metadata.proto",
+}
@@ -30,6 +30,7 @@ const (
 	StdioData_INVALID StdioData_Channel = 0
 	StdioData_STDOUT  StdioData_Channel = 1
 	StdioData_STDERR  StdioData_Channel = 2
+	StdioData_STDIN   StdioData_Channel = 3
 )
 
 // Enum value maps for StdioData_Channel.
@@ -38,11 +39,13 @@ var (
 		0: "INVALID",
 		1: "STDOUT",
 		2: "STDERR",
+		3: "STDIN",
 	}
 	StdioData_Channel_value = map[string]int32{
 		"INVALID": 0,
 		"STDOUT":  1,
 		"STDERR":  2,
+		"STDIN":   3,
 	}
 )
 
@@ -70,11 +73,63 @@ func (x StdioData_Channel) Number() protoreflect.EnumNumber {
 
 // Deprecated: Use StdioData_Channel.Descriptor instead.
 func (StdioData_Channel) EnumDescriptor() ([]byte, []int) {
-	return file_internal_plugin_grpc_stdio_proto_rawDescGZIP(), []int{0, 0}
+	return file_internal_plugin_grpc_stdio_proto_rawDescGZIP(), []int{1, 0}
+}
+
+// StreamStdioRequest is the request for GRPCStdio.StreamStdio. It is wire
+// compatible with the google.protobuf.Empty that older clients send.
+type StreamStdioRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// from_sequence is the sequence number of the first chunk to send. If it
+	// is zero, or older than the oldest chunk still buffered, the stream
+	// starts from the oldest chunk still buffered.
+	FromSequence uint64 `protobuf:"varint,1,opt,name=from_sequence,json=fromSequence,proto3" json:"from_sequence,omitempty"`
+}
+
+func (x *StreamStdioRequest) Reset() {
+	*x = StreamStdioRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_internal_plugin_grpc_stdio_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *StreamStdioRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StreamStdioRequest) ProtoMessage() {}
+
+func (x *StreamStdioRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_plugin_grpc_stdio_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StreamStdioRequest.ProtoReflect.Descriptor instead.
+func (*StreamStdioRequest) Descriptor() ([]byte, []int) {
+	return file_internal_plugin_grpc_stdio_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *StreamStdioRequest) GetFromSequence() uint64 {
+	if x != nil {
+		return x.FromSequence
+	}
+	return 0
 }
 
 // StdioData is a single chunk of stdout or stderr data that is streamed
-// from GRPCStdio.
+// from GRPCStdio, or of stdin data that is streamed to it.
 type StdioData struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -82,12 +137,15 @@ type StdioData struct {
 
 	Channel StdioData_Channel `protobuf:"varint,1,opt,name=channel,proto3,enum=plugin.StdioData_Channel" json:"channel,omitempty"`
 	Data    []byte            `protobuf:"bytes,2,opt,name=data,proto3" json:"data,omitempty"`
+	// sequence numbers the stdout and stderr chunks sent by the plugin, in the
+	// order they were written, starting at 1. It is unset for stdin.
+	Sequence uint64 `protobuf:"varint,3,opt,name=sequence,proto3" json:"sequence,omitempty"`
 }
 
 func (x *StdioData) Reset() {
 	*x = StdioData{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_internal_plugin_grpc_stdio_proto_msgTypes[0]
+		mi := &file_internal_plugin_grpc_stdio_proto_msgTypes[1]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -100,7 +158,7 @@ func (x *StdioData) String() string {
 func (*StdioData) ProtoMessage() {}
 
 func (x *StdioData) ProtoReflect() protoreflect.Message {
-	mi := &file_internal_plugin_grpc_stdio_proto_msgTypes[0]
+	mi := &file_internal_plugin_grpc_stdio_proto_msgTypes[1]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -113,7 +171,7 @@ func (x *StdioData) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use StdioData.ProtoReflect.Descriptor instead.
 func (*StdioData) Descriptor() ([]byte, []int) {
-	return file_internal_plugin_grpc_stdio_proto_rawDescGZIP(), []int{0}
+	return file_internal_plugin_grpc_stdio_proto_rawDescGZIP(), []int{1}
 }
 
 func (x *StdioData) GetChannel() StdioData_Channel {
@@ -130,6 +188,13 @@ func (x *StdioData) GetData() []byte {
 	return nil
 }
 
+func (x *StdioData) GetSequence() uint64 {
+	if x != nil {
+		return x.Sequence
+	}
+	return 0
+}
+
 var File_internal_plugin_grpc_stdio_proto protoreflect.FileDescriptor
 
 var file_internal_plugin_grpc_stdio_proto_rawDesc = []byte{
@@ -137,21 +202,31 @@ var file_internal_plugin_grpc_stdio_proto_rawDesc = []byte{
 	0x6e, 0x2f, 0x67, 0x72, 0x70, 0x63, 0x5f, 0x73, 0x74, 0x64, 0x69, 0x6f, 0x2e, 0x70, 0x72, 0x6f,
 	0x74, 0x6f, 0x12, 0x06, 0x70, 0x6c, 0x75, 0x67, 0x69, 0x6e, 0x1a, 0x1b, 0x67, 0x6f, 0x6f, 0x67,
 	0x6c, 0x65, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2f, 0x65, 0x6d, 0x70, 0x74,
-	0x79, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0x84, 0x01, 0x0a, 0x09, 0x53, 0x74, 0x64, 0x69,
-	0x6f, 0x44, 0x61, 0x74, 0x61, 0x12, 0x33, 0x0a, 0x07, 0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c,
-	0x18, 0x01, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x19, 0x2e, 0x70, 0x6c, 0x75, 0x67, 0x69, 0x6e, 0x2e,
-	0x53, 0x74, 0x64, 0x69, 0x6f, 0x44, 0x61, 0x74, 0x61, 0x2e, 0x43, 0x68, 0x61, 0x6e, 0x6e, 0x65,
-	0x6c, 0x52, 0x07, 0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x12, 0x12, 0x0a, 0x04, 0x64, 0x61,
-	0x74, 0x61, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x04, 0x64, 0x61, 0x74, 0x61, 0x22, 0x2e,
-	0x0a, 0x07, 0x43, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x12, 0x0b, 0x0a, 0x07, 0x49, 0x4e, 0x56,
-	0x41, 0x4c, 0x49, 0x44, 0x10, 0x00, 0x12, 0x0a, 0x0a, 0x06, 0x53, 0x54, 0x44, 0x4f, 0x55, 0x54,
-	0x10, 0x01, 0x12, 0x0a, 0x0a, 0x06, 0x53, 0x54, 0x44, 0x45, 0x52, 0x52, 0x10, 0x02, 0x32, 0x47,
-	0x0a, 0x09, 0x47, 0x52, 0x50, 0x43, 0x53, 0x74, 0x64, 0x69, 0x6f, 0x12, 0x3a, 0x0a, 0x0b, 0x53,
-	0x74, 0x72, 0x65, 0x61, 0x6d, 0x53, 0x74, 0x64, 0x69, 0x6f, 0x12, 0x16, 0x2e, 0x67, 0x6f, 0x6f,
-	0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x45, 0x6d, 0x70,
-	0x74, 0x79, 0x1a, 0x11, 0x2e, 0x70, 0x6c, 0x75, 0x67, 0x69, 0x6e, 0x2e, 0x53, 0x74, 0x64, 0x69,
-	0x6f, 0x44, 0x61, 0x74, 0x61, 0x30, 0x01, 0x42, 0x0a, 0x5a, 0x08, 0x2e, 0x2f, 0x70, 0x6c, 0x75,
-	0x67, 0x69, 0x6e, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+	0x79, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0x39, 0x0a, 0x12, 0x53, 0x74, 0x72, 0x65, 0x61,
+	0x6d, 0x53, 0x74, 0x64, 0x69, 0x6f, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x23, 0x0a,
+	0x0d, 0x66, 0x72, 0x6f, 0x6d, 0x5f, 0x73, 0x65, 0x71, 0x75, 0x65, 0x6e, 0x63, 0x65, 0x18, 0x01,
+	0x20, 0x01, 0x28, 0x04, 0x52, 0x0c, 0x66, 0x72, 0x6f, 0x6d, 0x53, 0x65, 0x71, 0x75, 0x65, 0x6e,
+	0x63, 0x65, 0x22, 0xab, 0x01, 0x0a, 0x09, 0x53, 0x74, 0x64, 0x69, 0x6f, 0x44, 0x61, 0x74, 0x61,
+	0x12, 0x33, 0x0a, 0x07, 0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x0e, 0x32, 0x19, 0x2e, 0x70, 0x6c, 0x75, 0x67, 0x69, 0x6e, 0x2e, 0x53, 0x74, 0x64, 0x69, 0x6f,
+	0x44, 0x61, 0x74, 0x61, 0x2e, 0x43, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x52, 0x07, 0x63, 0x68,
+	0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x12, 0x12, 0x0a, 0x04, 0x64, 0x61, 0x74, 0x61, 0x18, 0x02, 0x20,
+	0x01, 0x28, 0x0c, 0x52, 0x04, 0x64, 0x61, 0x74, 0x61, 0x12, 0x1a, 0x0a, 0x08, 0x73, 0x65, 0x71,
+	0x75, 0x65, 0x6e, 0x63, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x04, 0x52, 0x08, 0x73, 0x65, 0x71,
+	0x75, 0x65, 0x6e, 0x63, 0x65, 0x22, 0x39, 0x0a, 0x07, 0x43, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c,
+	0x12, 0x0b, 0x0a, 0x07, 0x49, 0x4e, 0x56, 0x41, 0x4c, 0x49, 0x44, 0x10, 0x00, 0x12, 0x0a, 0x0a,
+	0x06, 0x53, 0x54, 0x44, 0x4f, 0x55, 0x54, 0x10, 0x01, 0x12, 0x0a, 0x0a, 0x06, 0x53, 0x54, 0x44,
+	0x45, 0x52, 0x52, 0x10, 0x02, 0x12, 0x09, 0x0a, 0x05, 0x53, 0x54, 0x44, 0x49, 0x4e, 0x10, 0x03,
+	0x32, 0x87, 0x01, 0x0a, 0x09, 0x47, 0x52, 0x50, 0x43, 0x53, 0x74, 0x64, 0x69, 0x6f, 0x12, 0x3e,
+	0x0a, 0x0b, 0x53, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x53, 0x74, 0x64, 0x69, 0x6f, 0x12, 0x1a, 0x2e,
+	0x70, 0x6c, 0x75, 0x67, 0x69, 0x6e, 0x2e, 0x53, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x53, 0x74, 0x64,
+	0x69, 0x6f, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x11, 0x2e, 0x70, 0x6c, 0x75, 0x67,
+	0x69, 0x6e, 0x2e, 0x53, 0x74, 0x64, 0x69, 0x6f, 0x44, 0x61, 0x74, 0x61, 0x30, 0x01, 0x12, 0x3a,
+	0x0a, 0x0b, 0x53, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x53, 0x74, 0x64, 0x69, 0x6e, 0x12, 0x11, 0x2e,
+	0x70, 0x6c, 0x75, 0x67, 0x69, 0x6e, 0x2e, 0x53, 0x74, 0x64, 0x69, 0x6f, 0x44, 0x61, 0x74, 0x61,
+	0x1a, 0x16, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62,
+	0x75, 0x66, 0x2e, 0x45, 0x6d, 0x70, 0x74, 0x79, 0x28, 0x01, 0x42, 0x0a, 0x5a, 0x08, 0x2e, 0x2f,
+	0x70, 0x6c, 0x75, 0x67, 0x69, 0x6e, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
 }
 
 var (
@@ -167,18 +242,21 @@ func file_internal_plugin_grpc_stdio_proto_rawDescGZIP() []byte {
 }
 
 var file_internal_plugin_grpc_stdio_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
-var file_internal_plugin_grpc_stdio_proto_msgTypes = make([]protoimpl.MessageInfo, 1)
+var file_internal_plugin_grpc_stdio_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
 var file_internal_plugin_grpc_stdio_proto_goTypes = []interface{}{
-	(StdioData_Channel)(0), // 0: plugin.StdioData.Channel
-	(*StdioData)(nil),      // 1: plugin.StdioData
-	(*emptypb.Empty)(nil),  // 2: google.protobuf.Empty
+	(StdioData_Channel)(0),     // 0: plugin.StdioData.Channel
+	(*StreamStdioRequest)(nil), // 1: plugin.StreamStdioRequest
+	(*StdioData)(nil),          // 2: plugin.StdioData
+	(*emptypb.Empty)(nil),      // 3: google.protobuf.Empty
 }
 var file_internal_plugin_grpc_stdio_proto_depIdxs = []int32{
 	0, // 0: plugin.StdioData.channel:type_name -> plugin.StdioData.Channel
-	2, // 1: plugin.GRPCStdio.StreamStdio:input_type -> google.protobuf.Empty
-	1, // 2: plugin.GRPCStdio.StreamStdio:output_type -> plugin.StdioData
-	2, // [2:3] is the sub-list for method output_type
-	1, // [1:2] is the sub-list for method input_type
+	1, // 1: plugin.GRPCStdio.StreamStdio:input_type -> plugin.StreamStdioRequest
+	2, // 2: plugin.GRPCStdio.StreamStdin:input_type -> plugin.StdioData
+	2, // 3: plugin.GRPCStdio.StreamStdio:output_type -> plugin.StdioData
+	3, // 4: plugin.GRPCStdio.StreamStdin:output_type -> google.protobuf.Empty
+	3, // [3:5] is the sub-list for method output_type
+	1, // [1:3] is the sub-list for method input_type
 	1, // [1:1] is the sub-list for extension type_name
 	1, // [1:1] is the sub-list for extension extendee
 	0, // [0:1] is the sub-list for field type_name
@@ -191,6 +269,18 @@ func file_internal_plugin_grpc_stdio_proto_init() {
 	}
 	if !protoimpl.UnsafeEnabled {
 		file_internal_plugin_grpc_stdio_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*StreamStdioRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_internal_plugin_grpc_stdio_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
 			switch v := v.(*StdioData); i {
 			case 0:
 				return &v.state
@@ -209,7 +299,7 @@ func file_internal_plugin_grpc_stdio_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_internal_plugin_grpc_stdio_proto_rawDesc,
 			NumEnums:      1,
-			NumMessages:   1,
+			NumMessages:   2,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
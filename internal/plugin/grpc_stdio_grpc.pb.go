@@ -24,18 +24,27 @@ const _ = grpc.SupportPackageIsVersion7
 
 const (
 	GRPCStdio_StreamStdio_FullMethodName = "/plugin.GRPCStdio/StreamStdio"
+	GRPCStdio_StreamStdin_FullMethodName = "/plugin.GRPCStdio/StreamStdin"
 )
 
 // GRPCStdioClient is the client API for GRPCStdio service.
 //
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type GRPCStdioClient interface {
-	// StreamStdio returns a stream that contains all the stdout/stderr.
-	// This RPC endpoint must only be called ONCE. Once stdio data is consumed
-	// it is not sent again.
+	// StreamStdio returns a stream that contains all the stdout/stderr,
+	// starting from the given sequence number. The plugin buffers a bounded
+	// amount of data, so a client that reconnects or reattaches can resume
+	// where it left off, as long as that data wasn't dropped from the buffer
+	// in the meantime. Data is sent in order, and gaps in the sequence numbers
+	// are data that was dropped.
 	//
 	// Callers should connect early to prevent blocking on the plugin process.
-	StreamStdio(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (GRPCStdio_StreamStdioClient, error)
+	StreamStdio(ctx context.Context, in *StreamStdioRequest, opts ...grpc.CallOption) (GRPCStdio_StreamStdioClient, error)
+	// StreamStdin writes the STDIN data streamed by the host to the plugin's
+	// stdin. The plugin's stdin is closed when the host closes the stream.
+	// It fails with FAILED_PRECONDITION unless the host that started the
+	// plugin asked for stdin to be forwarded.
+	StreamStdin(ctx context.Context, opts ...grpc.CallOption) (GRPCStdio_StreamStdinClient, error)
 }
 
 type gRPCStdioClient struct {
@@ -46,7 +55,7 @@ func NewGRPCStdioClient(cc grpc.ClientConnInterface) GRPCStdioClient {
 	return &gRPCStdioClient{cc}
 }
 
-func (c *gRPCStdioClient) StreamStdio(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (GRPCStdio_StreamStdioClient, error) {
+func (c *gRPCStdioClient) StreamStdio(ctx context.Context, in *StreamStdioRequest, opts ...grpc.CallOption) (GRPCStdio_StreamStdioClient, error) {
 	stream, err := c.cc.NewStream(ctx, &GRPCStdio_ServiceDesc.Streams[0], GRPCStdio_StreamStdio_FullMethodName, opts...)
 	if err != nil {
 		return nil, err
@@ -78,25 +87,70 @@ func (x *gRPCStdioStreamStdioClient) Recv() (*StdioData, error) {
 	return m, nil
 }
 
+func (c *gRPCStdioClient) StreamStdin(ctx context.Context, opts ...grpc.CallOption) (GRPCStdio_StreamStdinClient, error) {
+	stream, err := c.cc.NewStream(ctx, &GRPCStdio_ServiceDesc.Streams[1], GRPCStdio_StreamStdin_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &gRPCStdioStreamStdinClient{stream}
+	return x, nil
+}
+
+type GRPCStdio_StreamStdinClient interface {
+	Send(*StdioData) error
+	CloseAndRecv() (*emptypb.Empty, error)
+	grpc.ClientStream
+}
+
+type gRPCStdioStreamStdinClient struct {
+	grpc.ClientStream
+}
+
+func (x *gRPCStdioStreamStdinClient) Send(m *StdioData) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *gRPCStdioStreamStdinClient) CloseAndRecv() (*emptypb.Empty, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(emptypb.Empty)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // GRPCStdioServer is the server API for GRPCStdio service.
 // All implementations should embed UnimplementedGRPCStdioServer
 // for forward compatibility
 type GRPCStdioServer interface {
-	// StreamStdio returns a stream that contains all the stdout/stderr.
-	// This RPC endpoint must only be called ONCE. Once stdio data is consumed
-	// it is not sent again.
+	// StreamStdio returns a stream that contains all the stdout/stderr,
+	// starting from the given sequence number. The plugin buffers a bounded
+	// amount of data, so a client that reconnects or reattaches can resume
+	// where it left off, as long as that data wasn't dropped from the buffer
+	// in the meantime. Data is sent in order, and gaps in the sequence numbers
+	// are data that was dropped.
 	//
 	// Callers should connect early to prevent blocking on the plugin process.
-	StreamStdio(*emptypb.Empty, GRPCStdio_StreamStdioServer) error
+	StreamStdio(*StreamStdioRequest, GRPCStdio_StreamStdioServer) error
+	// StreamStdin writes the STDIN data streamed by the host to the plugin's
+	// stdin. The plugin's stdin is closed when the host closes the stream.
+	// It fails with FAILED_PRECONDITION unless the host that started the
+	// plugin asked for stdin to be forwarded.
+	StreamStdin(GRPCStdio_StreamStdinServer) error
 }
 
 // UnimplementedGRPCStdioServer should be embedded to have forward compatible implementations.
 type UnimplementedGRPCStdioServer struct {
 }
 
-func (UnimplementedGRPCStdioServer) StreamStdio(*emptypb.Empty, GRPCStdio_StreamStdioServer) error {
+func (UnimplementedGRPCStdioServer) StreamStdio(*StreamStdioRequest, GRPCStdio_StreamStdioServer) error {
 	return status.Errorf(codes.Unimplemented, "method StreamStdio not implemented")
 }
+func (UnimplementedGRPCStdioServer) StreamStdin(GRPCStdio_StreamStdinServer) error {
+	return status.Errorf(codes.Unimplemented, "method StreamStdin not implemented")
+}
 
 // UnsafeGRPCStdioServer may be embedded to opt out of forward compatibility for this service.
 // Use of this interface is not recommended, as added methods to GRPCStdioServer will
@@ -110,7 +164,7 @@ func RegisterGRPCStdioServer(s grpc.ServiceRegistrar, srv GRPCStdioServer) {
 }
 
 func _GRPCStdio_StreamStdio_Handler(srv interface{}, stream grpc.ServerStream) error {
-	m := new(emptypb.Empty)
+	m := new(StreamStdioRequest)
 	if err := stream.RecvMsg(m); err != nil {
 		return err
 	}
@@ -130,6 +184,32 @@ func (x *gRPCStdioStreamStdioServer) Send(m *StdioData) error {
 	return x.ServerStream.SendMsg(m)
 }
 
+func _GRPCStdio_StreamStdin_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(GRPCStdioServer).StreamStdin(&gRPCStdioStreamStdinServer{stream})
+}
+
+type GRPCStdio_StreamStdinServer interface {
+	SendAndClose(*emptypb.Empty) error
+	Recv() (*StdioData, error)
+	grpc.ServerStream
+}
+
+type gRPCStdioStreamStdinServer struct {
+	grpc.ServerStream
+}
+
+func (x *gRPCStdioStreamStdinServer) SendAndClose(m *emptypb.Empty) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *gRPCStdioStreamStdinServer) Recv() (*StdioData, error) {
+	m := new(StdioData)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // GRPCStdio_ServiceDesc is the grpc.ServiceDesc for GRPCStdio service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -143,6 +223,11 @@ var GRPCStdio_ServiceDesc = grpc.ServiceDesc{
 			Handler:       _GRPCStdio_StreamStdio_Handler,
 			ServerStreams: true,
 		},
+		{
+			StreamName:    "StreamStdin",
+			Handler:       _GRPCStdio_StreamStdin_Handler,
+			ClientStreams: true,
+		},
 	},
 	Metadata: "internal/plugin/grpc_stdio.proto",
 }
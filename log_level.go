@@ -0,0 +1,59 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	hclog "github.com/hashicorp/go-hclog"
+)
+
+// ErrSetLogLevelNotSupported is returned by Client.SetLogLevel when the plugin
+// was built against a version of go-plugin that can't change its log level.
+var ErrSetLogLevelNotSupported = errors.New("plugin does not support changing its log level")
+
+// SetLogLevel changes the level of the plugin's logger, ServeConfig.Logger,
+// while it is running, starting the plugin if necessary. This lets operators
+// turn on trace logging for a single plugin without restarting it.
+//
+// Entries the plugin logs are still filtered by the level of
+// ClientConfig.Logger on the host.
+func (c *Client) SetLogLevel(level hclog.Level) error {
+	if level < hclog.Trace || level > hclog.Error {
+		return fmt.Errorf("invalid log level: %d", level)
+	}
+
+	client, err := c.Client()
+	if err != nil {
+		return err
+	}
+
+	lc, ok := client.(logLevelClient)
+	if !ok {
+		return ErrSetLogLevelNotSupported
+	}
+
+	return lc.setLogLevel(context.Background(), level)
+}
+
+// logLevelClient is implemented by protocol clients that can change the
+// plugin's log level.
+type logLevelClient interface {
+	setLogLevel(ctx context.Context, level hclog.Level) error
+}
+
+// setServerLogLevel sets the level of the plugin's logger to the level named
+// by a client.
+func setServerLogLevel(logger hclog.Logger, name string) error {
+	level := hclog.LevelFromString(name)
+	if level == hclog.NoLevel {
+		return fmt.Errorf("invalid log level: %q", name)
+	}
+
+	logger.SetLevel(level)
+	logger.Info("plugin log level changed", "level", level.String())
+	return nil
+}
@@ -0,0 +1,247 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	hclog "github.com/hashicorp/go-hclog"
+)
+
+// LogRateLimit limits how many of a plugin's log entries are forwarded to
+// ClientConfig.Logger, so that a chatty or buggy plugin can't degrade the
+// host or fill its disks. Each level has its own token bucket. Entries over
+// the limit are dropped and counted, see Client.DroppedLogLines, and the
+// number dropped is logged once entries at that level are let through again.
+//
+// The limit applies to entries read from the plugin's stderr and to those
+// streamed over gRPC. ClientConfig.Stderr still receives all of stderr.
+type LogRateLimit struct {
+	// Rate is the number of entries per second forwarded at each level, with
+	// bursts of up to Burst entries. A Rate of zero doesn't limit entries. If
+	// Burst is less than one, it is Rate rounded up.
+	Rate  float64
+	Burst int
+
+	// Levels overrides Rate and Burst for individual levels, for example to
+	// let more errors through than debug entries.
+	Levels map[hclog.Level]LogRate
+
+	// CollapseDuplicates collapses consecutive entries with the same level and
+	// message, whatever their arguments, into the first of them followed by
+	// "message repeated N times". Collapsed entries don't count against the
+	// rate limit.
+	CollapseDuplicates bool
+}
+
+// LogRate is the rate limit for a single level. See LogRateLimit.
+type LogRate struct {
+	Rate  float64
+	Burst int
+}
+
+// logLimiter enforces a LogRateLimit across all of a plugin's loggers.
+type logLimiter struct {
+	config *LogRateLimit
+	now    func() time.Time
+
+	l       sync.Mutex
+	buckets map[hclog.Level]*tokenBucket
+
+	// dropped is the number of entries dropped at each level since one was
+	// last let through, and total the number dropped overall.
+	dropped map[hclog.Level]uint64
+	total   uint64
+
+	// last is the last entry that was logged, and repeats the number of
+	// times it was repeated since, if duplicates are collapsed.
+	last    *limitedEntry
+	repeats int
+}
+
+type limitedEntry struct {
+	logger hclog.Logger
+	level  hclog.Level
+	msg    string
+}
+
+func newLogLimiter(config *LogRateLimit) *logLimiter {
+	return &logLimiter{
+		config:  config,
+		now:     time.Now,
+		buckets: make(map[hclog.Level]*tokenBucket),
+		dropped: make(map[hclog.Level]uint64),
+	}
+}
+
+// wrap returns a logger that logs through the limiter.
+func (l *logLimiter) wrap(logger hclog.Logger) hclog.Logger {
+	return &rateLimitedLogger{Logger: logger, limiter: l}
+}
+
+// droppedLines returns the number of entries dropped so far.
+func (l *logLimiter) droppedLines() uint64 {
+	l.l.Lock()
+	defer l.l.Unlock()
+
+	return l.total
+}
+
+func (l *logLimiter) log(logger hclog.Logger, level hclog.Level, msg string, args ...interface{}) {
+	l.l.Lock()
+	defer l.l.Unlock()
+
+	if l.config.CollapseDuplicates {
+		if l.last != nil && l.last.logger.Name() == logger.Name() && l.last.level == level && l.last.msg == msg {
+			l.repeats++
+			return
+		}
+		l.flushRepeats()
+	}
+
+	if b := l.bucket(level); b != nil && !b.take(l.now()) {
+		l.dropped[level]++
+		l.total++
+		return
+	}
+
+	if n := l.dropped[level]; n > 0 {
+		logger.Warn("plugin log entries were dropped by the rate limit", "level", level.String(), "dropped", n)
+		l.dropped[level] = 0
+	}
+
+	logger.Log(level, msg, args...)
+	if l.config.CollapseDuplicates {
+		l.last = &limitedEntry{logger: logger, level: level, msg: msg}
+	}
+}
+
+// flush logs the number of times the last entry was repeated and how many
+// entries were dropped, which is otherwise only logged once the plugin logs
+// something else. It is called once the plugin's output ends.
+func (l *logLimiter) flush(logger hclog.Logger) {
+	l.l.Lock()
+	defer l.l.Unlock()
+
+	l.flushRepeats()
+	for level, n := range l.dropped {
+		if n > 0 {
+			logger.Warn("plugin log entries were dropped by the rate limit", "level", level.String(), "dropped", n)
+			l.dropped[level] = 0
+		}
+	}
+}
+
+// flushRepeats logs the number of times the last entry was repeated, if it
+// was, and forgets it. The lock must be held.
+func (l *logLimiter) flushRepeats() {
+	if l.last != nil && l.repeats > 0 {
+		l.last.logger.Log(l.last.level, fmt.Sprintf("message repeated %d times", l.repeats), "message", l.last.msg)
+	}
+	l.last = nil
+	l.repeats = 0
+}
+
+// bucket returns the token bucket for the given level, or nil if the level
+// isn't limited. The lock must be held.
+func (l *logLimiter) bucket(level hclog.Level) *tokenBucket {
+	if b, ok := l.buckets[level]; ok {
+		return b
+	}
+
+	rate := LogRate{Rate: l.config.Rate, Burst: l.config.Burst}
+	if r, ok := l.config.Levels[level]; ok {
+		rate = r
+	}
+
+	var b *tokenBucket
+	if rate.Rate > 0 {
+		b = newTokenBucket(rate.Rate, rate.Burst, l.now())
+	}
+	l.buckets[level] = b
+
+	return b
+}
+
+// tokenBucket lets through rate events per second on average, and up to
+// burst at once.
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int, now time.Time) *tokenBucket {
+	if burst < 1 {
+		burst = int(math.Ceil(rate))
+	}
+
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   now,
+	}
+}
+
+// take takes a token if one is available.
+func (b *tokenBucket) take(now time.Time) bool {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = math.Min(b.burst, b.tokens+elapsed.Seconds()*b.rate)
+		b.last = now
+	}
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// rateLimitedLogger is an hclog.Logger whose entries go through a
+// logLimiter.
+type rateLimitedLogger struct {
+	hclog.Logger
+	limiter *logLimiter
+}
+
+func (r *rateLimitedLogger) Log(level hclog.Level, msg string, args ...interface{}) {
+	r.limiter.log(r.Logger, level, msg, args...)
+}
+
+func (r *rateLimitedLogger) Trace(msg string, args ...interface{}) {
+	r.limiter.log(r.Logger, hclog.Trace, msg, args...)
+}
+
+func (r *rateLimitedLogger) Debug(msg string, args ...interface{}) {
+	r.limiter.log(r.Logger, hclog.Debug, msg, args...)
+}
+
+func (r *rateLimitedLogger) Info(msg string, args ...interface{}) {
+	r.limiter.log(r.Logger, hclog.Info, msg, args...)
+}
+
+func (r *rateLimitedLogger) Warn(msg string, args ...interface{}) {
+	r.limiter.log(r.Logger, hclog.Warn, msg, args...)
+}
+
+func (r *rateLimitedLogger) Error(msg string, args ...interface{}) {
+	r.limiter.log(r.Logger, hclog.Error, msg, args...)
+}
+
+func (r *rateLimitedLogger) With(args ...interface{}) hclog.Logger {
+	return r.limiter.wrap(r.Logger.With(args...))
+}
+
+func (r *rateLimitedLogger) Named(name string) hclog.Logger {
+	return r.limiter.wrap(r.Logger.Named(name))
+}
+
+func (r *rateLimitedLogger) ResetNamed(name string) hclog.Logger {
+	return r.limiter.wrap(r.Logger.ResetNamed(name))
+}
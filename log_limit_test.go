@@ -0,0 +1,136 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+// newTestLogLimiter returns a limiter with a fake clock, and a logger wrapped
+// by it whose entries are recorded.
+func newTestLogLimiter(config *LogRateLimit) (*logLimiter, *time.Time, hclog.Logger, *testLogSink) {
+	sink := &testLogSink{}
+	logger := hclog.NewInterceptLogger(&hclog.LoggerOptions{
+		Level:  hclog.Trace,
+		Output: io.Discard,
+	})
+	logger.RegisterSink(sink)
+
+	now := time.Now()
+	limiter := newLogLimiter(config)
+	limiter.now = func() time.Time { return now }
+
+	return limiter, &now, limiter.wrap(logger), sink
+}
+
+func TestLogLimiter_rate(t *testing.T) {
+	limiter, now, l, sink := newTestLogLimiter(&LogRateLimit{
+		Rate:  1,
+		Burst: 2,
+		Levels: map[hclog.Level]LogRate{
+			hclog.Error: {},
+		},
+	})
+
+	for i := 0; i < 5; i++ {
+		l.Info("info")
+		l.Error("error")
+	}
+	l.Warn("warn")
+
+	// Each level has its own bucket, and errors aren't limited.
+	if n := len(sink.find("info")); n != 2 {
+		t.Fatalf("bad: %d", n)
+	}
+	if n := len(sink.find("error")); n != 5 {
+		t.Fatalf("bad: %d", n)
+	}
+	if n := len(sink.find("warn")); n != 1 {
+		t.Fatalf("bad: %d", n)
+	}
+	if n := limiter.droppedLines(); n != 3 {
+		t.Fatalf("bad: %d", n)
+	}
+
+	// Once the bucket refills, the number dropped is logged first.
+	*now = now.Add(time.Second)
+	l.Info("info")
+	summary := sink.find("plugin log entries were dropped by the rate limit")
+	if len(summary) != 1 || summary[0].args["dropped"] != uint64(3) || summary[0].args["level"] != "info" {
+		t.Fatalf("bad: %#v", summary)
+	}
+	if n := len(sink.find("info")); n != 3 {
+		t.Fatalf("bad: %d", n)
+	}
+}
+
+func TestLogLimiter_collapseDuplicates(t *testing.T) {
+	limiter, _, l, sink := newTestLogLimiter(&LogRateLimit{
+		CollapseDuplicates: true,
+	})
+
+	for i := 0; i < 4; i++ {
+		l.Info("same", "i", i)
+	}
+	l.Info("different")
+	l.Info("different")
+
+	var msgs []string
+	for _, e := range sink.entries {
+		msgs = append(msgs, e.msg)
+	}
+	expected := []string{"same", "message repeated 3 times", "different"}
+	if len(msgs) != len(expected) {
+		t.Fatalf("bad: %#v", msgs)
+	}
+	for i := range expected {
+		if msgs[i] != expected[i] {
+			t.Fatalf("bad: %#v", msgs)
+		}
+	}
+	if sink.entries[1].args["message"] != "same" {
+		t.Fatalf("bad: %#v", sink.entries[1])
+	}
+
+	// The last repeats are logged once the output ends.
+	limiter.flush(hclog.NewNullLogger())
+	if len(sink.find("message repeated 1 times")) != 1 {
+		t.Fatalf("bad: %#v", sink.entries)
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Now()
+	b := newTokenBucket(2, 0, now)
+
+	// Burst defaults to the rate.
+	for i := 0; i < 2; i++ {
+		if !b.take(now) {
+			t.Fatalf("expected token %d", i)
+		}
+	}
+	if b.take(now) {
+		t.Fatal("bucket should be empty")
+	}
+
+	// It refills at the rate, up to the burst.
+	if !b.take(now.Add(500 * time.Millisecond)) {
+		t.Fatal("expected a token after refilling")
+	}
+	if b.take(now.Add(500 * time.Millisecond)) {
+		t.Fatal("bucket should be empty")
+	}
+	for i := 0; i < 2; i++ {
+		if !b.take(now.Add(time.Hour)) {
+			t.Fatalf("expected token %d", i)
+		}
+	}
+	if b.take(now.Add(time.Hour)) {
+		t.Fatal("bucket should only refill up to the burst")
+	}
+}
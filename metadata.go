@@ -0,0 +1,122 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"context"
+	"errors"
+	"runtime/debug"
+
+	empty "github.com/golang/protobuf/ptypes/empty"
+	"github.com/hashicorp/go-plugin/internal/plugin"
+)
+
+// ErrMetadataNotSupported is returned by Client.Metadata when the plugin was
+// built against a version of go-plugin that can't report its metadata.
+var ErrMetadataNotSupported = errors.New("plugin does not support reporting metadata")
+
+// PluginMetadata describes a plugin binary. Plugins set it with
+// ServeConfig.Metadata and hosts retrieve it with Client.Metadata, for
+// example to list installed plugins or to reject plugins that are too old.
+type PluginMetadata struct {
+	// Name, Version and Author describe the plugin. Version should be a
+	// semantic version.
+	Name    string
+	Version string
+	Author  string
+
+	// BuildInfo describes how the plugin binary was built. If this is nil,
+	// it is filled in from runtime/debug.ReadBuildInfo: "go.version",
+	// "module.path" and "module.version", along with the build settings
+	// such as "vcs.revision".
+	BuildInfo map[string]string
+
+	// Capabilities lists optional features the plugin supports. Their
+	// meaning is up to the host and plugin.
+	Capabilities []string
+
+	// Extra holds any other information the plugin wants to publish.
+	Extra map[string]string
+}
+
+// HasCapability returns true if the plugin listed the given capability.
+func (m *PluginMetadata) HasCapability(name string) bool {
+	for _, c := range m.Capabilities {
+		if c == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// serverMetadata returns the metadata the server should report, filling in
+// the build information if the plugin didn't set it.
+func serverMetadata(m *PluginMetadata) *PluginMetadata {
+	var result PluginMetadata
+	if m != nil {
+		result = *m
+	}
+
+	if result.BuildInfo == nil {
+		result.BuildInfo = readBuildInfo()
+	}
+
+	return &result
+}
+
+func readBuildInfo() map[string]string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return nil
+	}
+
+	result := map[string]string{
+		"go.version":     info.GoVersion,
+		"module.path":    info.Main.Path,
+		"module.version": info.Main.Version,
+	}
+	for _, s := range info.Settings {
+		result[s.Key] = s.Value
+	}
+
+	return result
+}
+
+func metadataToProto(m *PluginMetadata) *plugin.PluginMetadata {
+	return &plugin.PluginMetadata{
+		Name:         m.Name,
+		Version:      m.Version,
+		Author:       m.Author,
+		BuildInfo:    m.BuildInfo,
+		Capabilities: m.Capabilities,
+		Extra:        m.Extra,
+	}
+}
+
+func metadataFromProto(m *plugin.PluginMetadata) *PluginMetadata {
+	return &PluginMetadata{
+		Name:         m.Name,
+		Version:      m.Version,
+		Author:       m.Author,
+		BuildInfo:    m.BuildInfo,
+		Capabilities: m.Capabilities,
+		Extra:        m.Extra,
+	}
+}
+
+// metadataClient is implemented by protocol clients that can ask the plugin
+// for its metadata.
+type metadataClient interface {
+	metadata(ctx context.Context) (*PluginMetadata, error)
+}
+
+// grpcMetadataServer implements the GRPCMetadata service.
+type grpcMetadataServer struct {
+	metadata *plugin.PluginMetadata
+}
+
+func (s *grpcMetadataServer) Metadata(context.Context, *empty.Empty) (*plugin.PluginMetadata, error) {
+	return s.metadata, nil
+}
@@ -0,0 +1,363 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/rpc"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// Sides of an RPC call, see RPCCall.Side.
+const (
+	MetricsSideClient = "client"
+	MetricsSideServer = "server"
+)
+
+// MetricsConfig configures the metrics recorded for the RPC calls between a
+// host and a plugin, set with ClientConfig.Metrics on the host and
+// ServeConfig.Metrics in the plugin.
+//
+// Every call is recorded, including the ones go-plugin makes itself, such
+// as health checks and the stdio and log streams. Calls over connections
+// established with the broker aren't recorded.
+type MetricsConfig struct {
+	// Sink receives the recorded calls.
+	Sink MetricsSink
+
+	// Plugin identifies the plugin in RPCCall.Plugin. If it is empty, it is
+	// the base name of the plugin's executable, or "plugin" on the host if
+	// that isn't known, such as when reattaching.
+	Plugin string
+}
+
+// MetricsSink receives the RPC calls recorded according to a MetricsConfig.
+// Implementations must be safe for concurrent use.
+//
+// PrometheusSink exports histograms of the calls in the Prometheus text
+// format, and InmemMetricsSink keeps the calls in memory for tests.
+type MetricsSink interface {
+	ObserveRPC(call RPCCall)
+}
+
+// RPCCall is a single RPC call between a host and a plugin.
+type RPCCall struct {
+	// Plugin is MetricsConfig.Plugin.
+	Plugin string
+
+	// Side is MetricsSideClient for calls the host made and
+	// MetricsSideServer for calls the plugin served.
+	Side string
+
+	// Protocol is the protocol the call was made over.
+	Protocol Protocol
+
+	// Method is the full gRPC method, such as "/plugin.GRPCController/Shutdown",
+	// or the net/rpc service method, such as "Plugin.Double".
+	Method string
+
+	// Duration is how long the call took. For gRPC streams, it is how long
+	// the stream was open.
+	Duration time.Duration
+
+	// Code is the gRPC status code of the call, such as "OK". net/rpc calls
+	// are either "OK" or "Unknown". Err is the error the call failed with,
+	// if any.
+	Code string
+	Err  error
+}
+
+// InmemMetricsSink is a MetricsSink that keeps every call in memory. It is
+// meant for tests. The zero value is ready to use.
+type InmemMetricsSink struct {
+	l     sync.Mutex
+	calls []RPCCall
+}
+
+// ObserveRPC implements MetricsSink.
+func (s *InmemMetricsSink) ObserveRPC(call RPCCall) {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	s.calls = append(s.calls, call)
+}
+
+// Calls returns the calls recorded so far, in the order they completed.
+func (s *InmemMetricsSink) Calls() []RPCCall {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	return append([]RPCCall(nil), s.calls...)
+}
+
+// metricsRecorder records the calls made on one side of one plugin's
+// connection.
+type metricsRecorder struct {
+	sink     MetricsSink
+	plugin   string
+	side     string
+	protocol Protocol
+}
+
+// newMetricsRecorder returns a metricsRecorder, or nil if config is nil. The
+// plugin defaults to name.
+func newMetricsRecorder(config *MetricsConfig, name, side string, protocol Protocol) *metricsRecorder {
+	if config == nil || config.Sink == nil {
+		return nil
+	}
+
+	m := &metricsRecorder{
+		sink:     config.Sink,
+		plugin:   config.Plugin,
+		side:     side,
+		protocol: protocol,
+	}
+	if m.plugin == "" {
+		m.plugin = name
+	}
+
+	return m
+}
+
+// metrics returns the recorder for the calls the client makes to the plugin
+// over the given protocol, or nil if they aren't recorded.
+func (c *Client) metrics(protocol Protocol) *metricsRecorder {
+	name := "plugin"
+	if c.config.Cmd != nil {
+		name = filepath.Base(c.config.Cmd.Path)
+	}
+
+	return newMetricsRecorder(c.config.Metrics, name, MetricsSideClient, protocol)
+}
+
+// serverMetrics returns the recorder for the calls the plugin serves over the
+// given protocol, or nil if they aren't recorded.
+func serverMetrics(config *MetricsConfig, protocol Protocol) *metricsRecorder {
+	return newMetricsRecorder(config, filepath.Base(os.Args[0]), MetricsSideServer, protocol)
+}
+
+func (m *metricsRecorder) observe(method string, start time.Time, err error) {
+	code := status.Code(err).String()
+	if m.protocol != ProtocolGRPC && err != nil {
+		code = "Unknown"
+	}
+
+	m.sink.ObserveRPC(RPCCall{
+		Plugin:   m.plugin,
+		Side:     m.side,
+		Protocol: m.protocol,
+		Method:   method,
+		Duration: time.Since(start),
+		Code:     code,
+		Err:      err,
+	})
+}
+
+// dialOptions returns the gRPC dial options that record the client's calls.
+func (m *metricsRecorder) dialOptions() []grpc.DialOption {
+	return []grpc.DialOption{
+		grpc.WithChainUnaryInterceptor(m.unaryClientInterceptor),
+		grpc.WithChainStreamInterceptor(m.streamClientInterceptor),
+	}
+}
+
+// serverOptions returns the gRPC server options that record the server's
+// calls.
+func (m *metricsRecorder) serverOptions() []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(m.unaryServerInterceptor),
+		grpc.ChainStreamInterceptor(m.streamServerInterceptor),
+	}
+}
+
+func (m *metricsRecorder) unaryClientInterceptor(
+	ctx context.Context,
+	method string,
+	req, reply interface{},
+	cc *grpc.ClientConn,
+	invoker grpc.UnaryInvoker,
+	opts ...grpc.CallOption,
+) error {
+	start := time.Now()
+	err := invoker(ctx, method, req, reply, cc, opts...)
+	m.observe(method, start, err)
+	return err
+}
+
+func (m *metricsRecorder) streamClientInterceptor(
+	ctx context.Context,
+	desc *grpc.StreamDesc,
+	cc *grpc.ClientConn,
+	method string,
+	streamer grpc.Streamer,
+	opts ...grpc.CallOption,
+) (grpc.ClientStream, error) {
+	start := time.Now()
+	stream, err := streamer(ctx, desc, cc, method, opts...)
+	if err != nil {
+		m.observe(method, start, err)
+		return nil, err
+	}
+
+	return &metricsClientStream{
+		ClientStream:  stream,
+		metrics:       m,
+		method:        method,
+		start:         start,
+		serverStreams: desc.ServerStreams,
+	}, nil
+}
+
+func (m *metricsRecorder) unaryServerInterceptor(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	m.observe(info.FullMethod, start, err)
+	return resp, err
+}
+
+func (m *metricsRecorder) streamServerInterceptor(
+	srv interface{},
+	ss grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	start := time.Now()
+	err := handler(srv, ss)
+	m.observe(info.FullMethod, start, err)
+	return err
+}
+
+// metricsClientStream records a client stream once it ends, which is when
+// receiving from it fails, or for streams with a single response, once that
+// response was received.
+type metricsClientStream struct {
+	grpc.ClientStream
+
+	metrics       *metricsRecorder
+	method        string
+	start         time.Time
+	serverStreams bool
+	once          sync.Once
+}
+
+func (s *metricsClientStream) RecvMsg(msg interface{}) error {
+	err := s.ClientStream.RecvMsg(msg)
+	switch {
+	case err == io.EOF:
+		s.done(nil)
+	case err != nil:
+		s.done(err)
+	case !s.serverStreams:
+		s.done(nil)
+	}
+
+	return err
+}
+
+func (s *metricsClientStream) done(err error) {
+	s.once.Do(func() {
+		s.metrics.observe(s.method, s.start, err)
+	})
+}
+
+type pendingRPCCall struct {
+	method string
+	start  time.Time
+}
+
+// metricsClientCodec is a net/rpc client codec that records calls, from
+// writing the request to reading the response.
+type metricsClientCodec struct {
+	rpc.ClientCodec
+
+	metrics *metricsRecorder
+	l       sync.Mutex
+	calls   map[uint64]pendingRPCCall
+}
+
+func (c *metricsClientCodec) WriteRequest(r *rpc.Request, body interface{}) error {
+	call := pendingRPCCall{method: r.ServiceMethod, start: time.Now()}
+	if err := c.ClientCodec.WriteRequest(r, body); err != nil {
+		c.metrics.observe(call.method, call.start, err)
+		return err
+	}
+
+	c.l.Lock()
+	c.calls[r.Seq] = call
+	c.l.Unlock()
+
+	return nil
+}
+
+func (c *metricsClientCodec) ReadResponseHeader(r *rpc.Response) error {
+	if err := c.ClientCodec.ReadResponseHeader(r); err != nil {
+		return err
+	}
+
+	c.l.Lock()
+	call, ok := c.calls[r.Seq]
+	delete(c.calls, r.Seq)
+	c.l.Unlock()
+
+	if ok {
+		c.metrics.observe(call.method, call.start, rpcResponseError(r.Error))
+	}
+
+	return nil
+}
+
+// metricsServerCodec is a net/rpc server codec that records calls, from
+// reading the request to writing the response.
+type metricsServerCodec struct {
+	rpc.ServerCodec
+
+	metrics *metricsRecorder
+	l       sync.Mutex
+	calls   map[uint64]pendingRPCCall
+}
+
+func (c *metricsServerCodec) ReadRequestHeader(r *rpc.Request) error {
+	if err := c.ServerCodec.ReadRequestHeader(r); err != nil {
+		return err
+	}
+
+	c.l.Lock()
+	c.calls[r.Seq] = pendingRPCCall{method: r.ServiceMethod, start: time.Now()}
+	c.l.Unlock()
+
+	return nil
+}
+
+func (c *metricsServerCodec) WriteResponse(r *rpc.Response, body interface{}) error {
+	c.l.Lock()
+	call, ok := c.calls[r.Seq]
+	delete(c.calls, r.Seq)
+	c.l.Unlock()
+
+	if ok {
+		c.metrics.observe(call.method, call.start, rpcResponseError(r.Error))
+	}
+
+	return c.ServerCodec.WriteResponse(r, body)
+}
+
+func rpcResponseError(msg string) error {
+	if msg == "" {
+		return nil
+	}
+	return errors.New(msg)
+}
@@ -0,0 +1,200 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultPrometheusBuckets are the histogram buckets used by
+// NewPrometheusSink if none are given, in seconds. They are the Prometheus
+// client's defaults.
+var DefaultPrometheusBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// PrometheusSink is a MetricsSink that aggregates calls into histograms and
+// exports them in the Prometheus text exposition format, as:
+//
+//   - plugin_rpc_duration_seconds, a histogram of call durations labeled
+//     with plugin, side, protocol and method.
+//   - plugin_rpc_calls_total, a counter of calls with the same labels plus
+//     code, from which error rates can be derived.
+//
+// It is an http.Handler, so it can be served on a metrics endpoint, or
+// written to another exporter with WriteTo.
+type PrometheusSink struct {
+	buckets []float64
+
+	l         sync.Mutex
+	durations map[prometheusLabels]*prometheusHistogram
+	calls     map[prometheusLabels]uint64
+}
+
+// NewPrometheusSink returns a PrometheusSink with the given histogram
+// buckets, in seconds, or DefaultPrometheusBuckets if there are none.
+func NewPrometheusSink(buckets ...float64) *PrometheusSink {
+	if len(buckets) == 0 {
+		buckets = DefaultPrometheusBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+
+	return &PrometheusSink{
+		buckets:   buckets,
+		durations: make(map[prometheusLabels]*prometheusHistogram),
+		calls:     make(map[prometheusLabels]uint64),
+	}
+}
+
+type prometheusLabels struct {
+	plugin, side, protocol, method, code string
+}
+
+type prometheusHistogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// ObserveRPC implements MetricsSink.
+func (s *PrometheusSink) ObserveRPC(call RPCCall) {
+	labels := prometheusLabels{
+		plugin:   call.Plugin,
+		side:     call.Side,
+		protocol: string(call.Protocol),
+		method:   call.Method,
+	}
+	seconds := call.Duration.Seconds()
+
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	h, ok := s.durations[labels]
+	if !ok {
+		h = &prometheusHistogram{counts: make([]uint64, len(s.buckets))}
+		s.durations[labels] = h
+	}
+	for i, le := range s.buckets {
+		if seconds <= le {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += seconds
+
+	labels.code = call.Code
+	s.calls[labels]++
+}
+
+// WriteTo writes the metrics in the Prometheus text exposition format.
+func (s *PrometheusSink) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: bufio.NewWriter(w)}
+
+	s.l.Lock()
+	durations := make([]prometheusLabels, 0, len(s.durations))
+	for labels := range s.durations {
+		durations = append(durations, labels)
+	}
+	sortPrometheusLabels(durations)
+
+	fmt.Fprintln(cw, "# HELP plugin_rpc_duration_seconds Duration of RPC calls between plugin hosts and plugins.")
+	fmt.Fprintln(cw, "# TYPE plugin_rpc_duration_seconds histogram")
+	for _, labels := range durations {
+		h := s.durations[labels]
+		for i, le := range s.buckets {
+			fmt.Fprintf(cw, "plugin_rpc_duration_seconds_bucket{%s,le=%q} %d\n",
+				labels, formatPrometheusFloat(le), h.counts[i])
+		}
+		fmt.Fprintf(cw, "plugin_rpc_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, h.count)
+		fmt.Fprintf(cw, "plugin_rpc_duration_seconds_sum{%s} %s\n", labels, formatPrometheusFloat(h.sum))
+		fmt.Fprintf(cw, "plugin_rpc_duration_seconds_count{%s} %d\n", labels, h.count)
+	}
+
+	calls := make([]prometheusLabels, 0, len(s.calls))
+	for labels := range s.calls {
+		calls = append(calls, labels)
+	}
+	sortPrometheusLabels(calls)
+
+	fmt.Fprintln(cw, "# HELP plugin_rpc_calls_total Number of RPC calls between plugin hosts and plugins, by status code.")
+	fmt.Fprintln(cw, "# TYPE plugin_rpc_calls_total counter")
+	for _, labels := range calls {
+		fmt.Fprintf(cw, "plugin_rpc_calls_total{%s,code=\"%s\"} %d\n",
+			labels, escapePrometheusLabel(labels.code), s.calls[labels])
+	}
+	s.l.Unlock()
+
+	if cw.err != nil {
+		return cw.n, cw.err
+	}
+	return cw.n, cw.w.(*bufio.Writer).Flush()
+}
+
+// ServeHTTP serves the metrics in the Prometheus text exposition format.
+func (s *PrometheusSink) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	s.WriteTo(w)
+}
+
+// String formats the labels other than code.
+func (l prometheusLabels) String() string {
+	return fmt.Sprintf(`plugin="%s",side="%s",protocol="%s",method="%s"`,
+		escapePrometheusLabel(l.plugin),
+		escapePrometheusLabel(l.side),
+		escapePrometheusLabel(l.protocol),
+		escapePrometheusLabel(l.method))
+}
+
+func sortPrometheusLabels(labels []prometheusLabels) {
+	sort.Slice(labels, func(i, j int) bool {
+		a, b := labels[i], labels[j]
+		if a.plugin != b.plugin {
+			return a.plugin < b.plugin
+		}
+		if a.side != b.side {
+			return a.side < b.side
+		}
+		if a.protocol != b.protocol {
+			return a.protocol < b.protocol
+		}
+		if a.method != b.method {
+			return a.method < b.method
+		}
+		return a.code < b.code
+	})
+}
+
+var prometheusLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapePrometheusLabel(v string) string {
+	return prometheusLabelEscaper.Replace(v)
+}
+
+func formatPrometheusFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// countingWriter counts the bytes written to w, and keeps the first error.
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	c.err = err
+	return n, err
+}
@@ -0,0 +1,198 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// findCalls returns the recorded calls to the given method.
+func findCalls(s *InmemMetricsSink, side, method string) []RPCCall {
+	var result []RPCCall
+	for _, call := range s.Calls() {
+		if call.Side == side && call.Method == method {
+			result = append(result, call)
+		}
+	}
+	return result
+}
+
+func TestMetrics_netRPC(t *testing.T) {
+	sink := &InmemMetricsSink{}
+	config := &MetricsConfig{Sink: sink, Plugin: "test"}
+
+	clientConn, serverConn := TestConn(t)
+	server := &RPCServer{
+		Plugins: testPluginMap,
+		Stdout:  new(bytes.Buffer),
+		Stderr:  new(bytes.Buffer),
+		metrics: serverMetrics(config, ProtocolNetRPC),
+	}
+	go server.ServeConn(serverConn)
+
+	client, err := newRPCClientConn(clientConn, testPluginMap, false,
+		newMetricsRecorder(config, "", MetricsSideClient, ProtocolNetRPC), nil, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer client.Close()
+
+	raw, err := client.Dispense("test")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if v := raw.(testInterface).Double(21); v != 42 {
+		t.Fatalf("bad: %d", v)
+	}
+	var resp struct{}
+	if err := client.control.Call("Control.Missing", true, &resp); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	for _, side := range []string{MetricsSideClient, MetricsSideServer} {
+		calls := findCalls(sink, side, "Plugin.Double")
+		if len(calls) != 1 {
+			t.Fatalf("%s: bad: %#v", side, sink.Calls())
+		}
+		call := calls[0]
+		if call.Plugin != "test" || call.Protocol != ProtocolNetRPC || call.Code != "OK" || call.Err != nil || call.Duration <= 0 {
+			t.Fatalf("%s: bad: %#v", side, call)
+		}
+
+		calls = findCalls(sink, side, "Control.Missing")
+		if len(calls) != 1 || calls[0].Code != "Unknown" || calls[0].Err == nil {
+			t.Fatalf("%s: bad: %#v", side, calls)
+		}
+	}
+}
+
+func TestMetrics_gRPC(t *testing.T) {
+	sink := &InmemMetricsSink{}
+	config := &MetricsConfig{Sink: sink, Plugin: "test"}
+
+	server := grpc.NewServer(serverMetrics(config, ProtocolGRPC).serverOptions()...)
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus("test", grpc_health_v1.HealthCheckResponse_SERVING)
+	grpc_health_v1.RegisterHealthServer(server, healthServer)
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	go server.Serve(lis)
+	defer server.Stop()
+
+	client := newMetricsRecorder(config, "", MetricsSideClient, ProtocolGRPC)
+	conn, err := grpc.Dial(lis.Addr().String(),
+		append(client.dialOptions(), grpc.WithInsecure(), grpc.WithBlock())...)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer conn.Close()
+	healthClient := grpc_health_v1.NewHealthClient(conn)
+
+	ctx := context.Background()
+	if _, err := healthClient.Check(ctx, &grpc_health_v1.HealthCheckRequest{Service: "test"}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if _, err := healthClient.Check(ctx, &grpc_health_v1.HealthCheckRequest{Service: "missing"}); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	// A stream is recorded once it ends.
+	ctx, cancel := context.WithCancel(ctx)
+	stream, err := healthClient.Watch(ctx, &grpc_health_v1.HealthCheckRequest{Service: "test"})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if _, err := stream.Recv(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	cancel()
+	if _, err := stream.Recv(); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	for _, side := range []string{MetricsSideClient, MetricsSideServer} {
+		calls := findCalls(sink, side, "/grpc.health.v1.Health/Check")
+		if len(calls) != 2 {
+			t.Fatalf("%s: bad: %#v", side, sink.Calls())
+		}
+		if calls[0].Code != "OK" || calls[0].Err != nil || calls[0].Protocol != ProtocolGRPC || calls[0].Plugin != "test" {
+			t.Fatalf("%s: bad: %#v", side, calls[0])
+		}
+		if calls[1].Code != "NotFound" || calls[1].Err == nil {
+			t.Fatalf("%s: bad: %#v", side, calls[1])
+		}
+	}
+
+	// The server only notices the stream was cancelled asynchronously.
+	deadline := time.Now().Add(5 * time.Second)
+	for len(findCalls(sink, MetricsSideServer, "/grpc.health.v1.Health/Watch")) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	for _, side := range []string{MetricsSideClient, MetricsSideServer} {
+		calls := findCalls(sink, side, "/grpc.health.v1.Health/Watch")
+		if len(calls) != 1 || calls[0].Code != "Canceled" {
+			t.Fatalf("%s: bad: %#v", side, calls)
+		}
+	}
+}
+
+func TestPrometheusSink(t *testing.T) {
+	s := NewPrometheusSink(0.1, 1)
+	call := RPCCall{
+		Plugin:   `my "plugin"`,
+		Side:     MetricsSideClient,
+		Protocol: ProtocolGRPC,
+		Method:   "/test.Test/Call",
+		Duration: 50 * time.Millisecond,
+		Code:     "OK",
+	}
+	s.ObserveRPC(call)
+	call.Duration = 500 * time.Millisecond
+	s.ObserveRPC(call)
+	call.Duration = 2 * time.Second
+	call.Code = "Unavailable"
+	call.Err = errors.New("unavailable")
+	s.ObserveRPC(call)
+
+	var buf bytes.Buffer
+	n, err := s.WriteTo(&buf)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if n != int64(buf.Len()) {
+		t.Fatalf("bad: %d", n)
+	}
+
+	labels := `plugin="my \"plugin\"",side="client",protocol="grpc",method="/test.Test/Call"`
+	expected := strings.Join([]string{
+		"# HELP plugin_rpc_duration_seconds Duration of RPC calls between plugin hosts and plugins.",
+		"# TYPE plugin_rpc_duration_seconds histogram",
+		`plugin_rpc_duration_seconds_bucket{` + labels + `,le="0.1"} 1`,
+		`plugin_rpc_duration_seconds_bucket{` + labels + `,le="1"} 2`,
+		`plugin_rpc_duration_seconds_bucket{` + labels + `,le="+Inf"} 3`,
+		`plugin_rpc_duration_seconds_sum{` + labels + `} 2.55`,
+		`plugin_rpc_duration_seconds_count{` + labels + `} 3`,
+		"# HELP plugin_rpc_calls_total Number of RPC calls between plugin hosts and plugins, by status code.",
+		"# TYPE plugin_rpc_calls_total counter",
+		`plugin_rpc_calls_total{` + labels + `,code="OK"} 2`,
+		`plugin_rpc_calls_total{` + labels + `,code="Unavailable"} 1`,
+		"",
+	}, "\n")
+	if buf.String() != expected {
+		t.Fatalf("bad:\n%s", buf.String())
+	}
+}
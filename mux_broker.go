@@ -4,10 +4,14 @@
 package plugin
 
 import (
+	"context"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"log"
 	"net"
+	"net/rpc"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -34,36 +38,81 @@ type MuxBroker struct {
 	session *yamux.Session
 	streams map[uint32]*muxBrokerPending
 
+	// tracer creates spans around negotiating connections, if non-nil.
+	tracer *tracer
+
+	// acceptTimeout and dialTimeout are set from the BrokerConfig.
+	acceptTimeout time.Duration
+	dialTimeout   time.Duration
+
+	// tracked has the pending and active IDs, for Streams.
+	tracked *brokerStreams
+
 	sync.Mutex
 }
 
+// muxBrokerStdinID is the ID the client dials the stream it forwards stdin
+// over with, so that the server can accept it whenever it is dialed, and
+// serve clients that don't forward stdin, such as ones that reattached.
+// NextId doesn't return it until it wraps.
+const muxBrokerStdinID uint32 = 0
+
 type muxBrokerPending struct {
 	ch     chan net.Conn
 	doneCh chan struct{}
 }
 
-func newMuxBroker(s *yamux.Session) *MuxBroker {
+func newMuxBroker(s *yamux.Session, config *BrokerConfig) *MuxBroker {
+	acceptTimeout, dialTimeout := config.timeouts()
 	return &MuxBroker{
-		session: s,
-		streams: make(map[uint32]*muxBrokerPending),
+		session:       s,
+		streams:       make(map[uint32]*muxBrokerPending),
+		acceptTimeout: acceptTimeout,
+		dialTimeout:   dialTimeout,
+		tracked:       newBrokerStreams(),
 	}
 }
 
 // Accept accepts a connection by ID.
 //
-// This should not be called multiple times with the same ID at one time.
+// This should not be called multiple times with the same ID at one time. If
+// the other side doesn't dial the ID within BrokerConfig.AcceptTimeout, it
+// returns a *BrokerTimeoutError.
 func (m *MuxBroker) Accept(id uint32) (net.Conn, error) {
+	t := m.tracked.pending(id, BrokerDirectionAccept)
+	c, err := m.accept(id, time.After(m.acceptTimeout))
+	if err != nil {
+		t.remove()
+		return nil, err
+	}
+
+	return t.conn(c), nil
+}
+
+// accept is Accept without tracking the ID for Streams. It gives up once
+// timeoutCh fires, or, if it is nil, only once the session is closed.
+func (m *MuxBroker) accept(id uint32, timeoutCh <-chan time.Time) (net.Conn, error) {
 	var c net.Conn
 	p := m.getStream(id)
 	select {
 	case c = <-p.ch:
 		close(p.doneCh)
-	case <-time.After(5 * time.Second):
+	case <-timeoutCh:
 		m.Lock()
 		defer m.Unlock()
 		delete(m.streams, id)
 
-		return nil, fmt.Errorf("timeout waiting for accept")
+		return nil, &BrokerTimeoutError{
+			ID:        id,
+			Direction: BrokerDirectionAccept,
+			Timeout:   m.acceptTimeout,
+		}
+	case <-m.session.CloseChan():
+		m.Lock()
+		defer m.Unlock()
+		delete(m.streams, id)
+
+		return nil, errors.New("broker closed")
 	}
 
 	// Ack our connection
@@ -79,15 +128,19 @@ func (m *MuxBroker) Accept(id uint32) (net.Conn, error) {
 // serve an RPC server on that stream ID. This is used to easily serve
 // complex arguments.
 //
-// The served interface is always registered to the "Plugin" name.
+// The served interface is always registered to the "Plugin" name. Calls
+// dialed with DialClient carry the caller's trace context.
 func (m *MuxBroker) AcceptAndServe(id uint32, v interface{}) {
+	_, span := m.tracer.start(context.Background(), "plugin.broker.accept",
+		"broker.id", strconv.FormatUint(uint64(id), 10))
 	conn, err := m.Accept(id)
+	span.end(err)
 	if err != nil {
 		log.Printf("[ERR] plugin: plugin acceptAndServe error: %s", err)
 		return
 	}
 
-	serve(conn, "Plugin", v)
+	serve(conn, "Plugin", v, nil, m.tracer)
 }
 
 // Close closes the connection and all sub-connections.
@@ -95,8 +148,53 @@ func (m *MuxBroker) Close() error {
 	return m.session.Close()
 }
 
-// Dial opens a connection by ID.
+// Dial opens a connection by ID. If the other side doesn't accept the ID
+// within BrokerConfig.DialTimeout, it returns a *BrokerTimeoutError.
 func (m *MuxBroker) Dial(id uint32) (net.Conn, error) {
+	return m.DialContext(context.Background(), id)
+}
+
+// Streams returns the IDs that are pending or active, sorted by ID. It is
+// meant for diagnosing connections that are never established, such as by
+// logging it when Accept or Dial time out.
+func (m *MuxBroker) Streams() []BrokerStream {
+	return m.tracked.list()
+}
+
+// DialContext is like Dial, but the span created for the dial, if any, is a
+// child of the trace context ctx carries.
+func (m *MuxBroker) DialContext(ctx context.Context, id uint32) (conn net.Conn, err error) {
+	_, span := m.tracer.start(ctx, "plugin.broker.dial", "broker.id", strconv.FormatUint(uint64(id), 10))
+	defer func() { span.end(err) }()
+
+	return m.dial(id)
+}
+
+// DialClient dials the connection with the given ID and returns a net/rpc
+// client for it, such as for an interface served with AcceptAndServe. Every
+// call made with the client carries the trace context ctx carries, if any.
+func (m *MuxBroker) DialClient(ctx context.Context, id uint32) (*rpc.Client, error) {
+	conn, err := m.DialContext(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	trace, _ := TraceContextFromContext(ctx)
+	return newNetRPCClient(conn, nil, trace), nil
+}
+
+func (m *MuxBroker) dial(id uint32) (net.Conn, error) {
+	t := m.tracked.pending(id, BrokerDirectionDial)
+	stream, err := m.dialStream(id)
+	if err != nil {
+		t.remove()
+		return nil, err
+	}
+
+	return t.conn(stream), nil
+}
+
+func (m *MuxBroker) dialStream(id uint32) (net.Conn, error) {
 	// Open the stream
 	stream, err := m.session.OpenStream()
 	if err != nil {
@@ -111,10 +209,19 @@ func (m *MuxBroker) Dial(id uint32) (net.Conn, error) {
 
 	// Read the ack that we connected. Then we're off!
 	var ack uint32
+	_ = stream.SetReadDeadline(time.Now().Add(m.dialTimeout))
 	if err := binary.Read(stream, binary.LittleEndian, &ack); err != nil {
 		stream.Close()
+		if err == yamux.ErrTimeout {
+			return nil, &BrokerTimeoutError{
+				ID:        id,
+				Direction: BrokerDirectionDial,
+				Timeout:   m.dialTimeout,
+			}
+		}
 		return nil, err
 	}
+	_ = stream.SetReadDeadline(time.Time{})
 	if ack != id {
 		stream.Close()
 		return nil, fmt.Errorf("bad ack: %d (expected %d)", ack, id)
@@ -160,7 +267,7 @@ func (m *MuxBroker) Run() {
 		}
 
 		// Wait for a timeout
-		go m.timeoutWait(id, p)
+		go m.timeoutWait(id, p, m.tracked.pending(id, BrokerDirectionAccept))
 	}
 }
 
@@ -180,14 +287,18 @@ func (m *MuxBroker) getStream(id uint32) *muxBrokerPending {
 	return m.streams[id]
 }
 
-func (m *MuxBroker) timeoutWait(id uint32, p *muxBrokerPending) {
+func (m *MuxBroker) timeoutWait(id uint32, p *muxBrokerPending, t *brokerStream) {
+	defer t.remove()
+
 	// Wait for the stream to either be picked up and connected, or
 	// for a timeout.
 	timeout := false
 	select {
 	case <-p.doneCh:
-	case <-time.After(5 * time.Second):
+	case <-time.After(m.acceptTimeout):
 		timeout = true
+		log.Printf("[WARN] plugin: broker ID %d was dialed, but not accepted within %s; closing the stream",
+			id, m.acceptTimeout)
 	}
 
 	m.Lock()
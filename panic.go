@@ -0,0 +1,152 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"strings"
+)
+
+const (
+	panicPrefix      = "panic: "
+	fatalErrorPrefix = "fatal error: "
+
+	// maxPanicLines caps how much of a panic and the goroutine dump that
+	// follows it is kept in PluginPanic.Trace. Lines past it are no longer
+	// considered part of the panic.
+	maxPanicLines = 1000
+)
+
+// PluginPanic is a Go panic or fatal error that a plugin wrote to stderr,
+// along with the goroutine dump that follows it.
+type PluginPanic struct {
+	// Message is the panic value or fatal error message, for example
+	// "runtime error: index out of range [3] with length 3".
+	Message string
+
+	// Fatal is true for unrecoverable runtime errors such as deadlocks or
+	// concurrent map writes, which are reported as "fatal error:" rather
+	// than "panic:".
+	Fatal bool
+
+	// TopFrame is the innermost non-runtime frame of the goroutine that
+	// panicked, as "function at file:line". It is empty if the trace
+	// doesn't contain one.
+	TopFrame string
+
+	// Goroutines is the number of goroutines in the dump. It depends on the
+	// plugin's GOTRACEBACK setting.
+	Goroutines int
+
+	// Trace is the panic as written to stderr, up to 1000 lines.
+	Trace string
+}
+
+// String returns the first line of the panic, as Go prints it.
+func (p *PluginPanic) String() string {
+	if p.Fatal {
+		return fatalErrorPrefix + p.Message
+	}
+	return panicPrefix + p.Message
+}
+
+// isPanicStart returns true if line starts a Go panic or fatal error.
+func isPanicStart(line string) bool {
+	return strings.HasPrefix(line, panicPrefix) || strings.HasPrefix(line, fatalErrorPrefix)
+}
+
+// panicParser parses a panic line by line from stderr.
+type panicParser struct {
+	panic *PluginPanic
+	trace []string
+
+	// frame is the function of the frame whose location is expected on the
+	// next line, if it's a candidate for TopFrame.
+	frame string
+
+	// blank is set if the last line was empty. Past the first lines, a
+	// panic only continues after one with a goroutine or a stack frame.
+	blank bool
+}
+
+// newPanicParser starts parsing a panic from its first line, for which
+// isPanicStart must be true.
+func newPanicParser(line string) *panicParser {
+	p := &panicParser{
+		panic: &PluginPanic{},
+		trace: []string{line},
+	}
+	if strings.HasPrefix(line, fatalErrorPrefix) {
+		p.panic.Fatal = true
+		p.panic.Message = strings.TrimPrefix(line, fatalErrorPrefix)
+	} else {
+		p.panic.Message = strings.TrimPrefix(line, panicPrefix)
+	}
+
+	return p
+}
+
+// add adds the next line of stderr to the panic. It returns false if the
+// line isn't part of the panic, which has then ended.
+func (p *panicParser) add(line string) bool {
+	if len(p.trace) >= maxPanicLines {
+		return false
+	}
+	if p.blank && line != "" && !isTraceLine(line) {
+		return false
+	}
+	p.blank = line == ""
+	p.trace = append(p.trace, line)
+
+	switch {
+	case strings.HasPrefix(line, "goroutine ") && strings.HasSuffix(line, ":"):
+		p.panic.Goroutines++
+		p.frame = ""
+
+	// Only the first goroutine, which is the one that panicked, is searched
+	// for the top frame.
+	case p.panic.Goroutines != 1 || p.panic.TopFrame != "" || line == "":
+
+	case strings.HasPrefix(line, "\t"):
+		// The location of the previous frame, "\tfile:line +0x1d".
+		if fields := strings.Fields(line); p.frame != "" && len(fields) > 0 {
+			p.panic.TopFrame = p.frame + " at " + fields[0]
+		}
+
+	default:
+		// A function, "pkg.Func(args)". Frames within the runtime, such as
+		// the panic itself, are skipped.
+		p.frame = ""
+		if i := strings.LastIndex(line, "("); i > 0 {
+			function := line[:i]
+			if !strings.HasPrefix(function, "runtime.") && function != "panic" && !strings.HasPrefix(function, "created by ") {
+				p.frame = function
+			}
+		}
+	}
+
+	return true
+}
+
+// isTraceLine returns true if line can start a section of a goroutine dump:
+// a goroutine, the runtime stack of a fatal error, or a stack frame.
+func isTraceLine(line string) bool {
+	switch {
+	case strings.HasPrefix(line, "goroutine "),
+		line == "runtime stack:",
+		strings.HasPrefix(line, "\t"),
+		strings.HasPrefix(line, "created by "),
+		line == "...additional frames elided...":
+		return true
+	}
+
+	// A function, "pkg.Func(args)".
+	return strings.Contains(line, "(") && strings.HasSuffix(line, ")")
+}
+
+// result returns the panic parsed so far.
+func (p *panicParser) result() *PluginPanic {
+	result := *p.panic
+	result.Trace = strings.TrimRight(strings.Join(p.trace, "\n"), "\n")
+	return &result
+}
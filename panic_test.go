@@ -0,0 +1,212 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+func TestPanicParser(t *testing.T) {
+	cases := map[string]struct {
+		stderr   string
+		expected PluginPanic
+	}{
+		"nil pointer": {
+			`panic: runtime error: invalid memory address or nil pointer dereference
+[signal SIGSEGV: segmentation violation code=0x1 addr=0x0 pc=0x47db1c]
+
+goroutine 1 [running]:
+main.(*T).Foo(...)
+	/src/main.go:3
+main.main()
+	/src/main.go:4 +0x1c`,
+			PluginPanic{
+				Message:    "runtime error: invalid memory address or nil pointer dereference",
+				TopFrame:   "main.(*T).Foo at /src/main.go:3",
+				Goroutines: 1,
+			},
+		},
+
+		"repanicked": {
+			`panic: first [recovered]
+	panic: second
+
+goroutine 7 [running]:
+main.handle.func1()
+	/src/main.go:12 +0x25
+panic({0x5181e8?, 0x485f48?})
+	/usr/local/go/src/runtime/panic.go:859 +0x125
+main.handle()
+	/src/main.go:14 +0x3e
+created by main.main in goroutine 1
+	/src/main.go:20 +0x1a
+
+goroutine 1 [chan receive]:
+main.main()
+	/src/main.go:21 +0x4c`,
+			PluginPanic{
+				Message:    "first [recovered]",
+				TopFrame:   "main.handle.func1 at /src/main.go:12",
+				Goroutines: 2,
+			},
+		},
+
+		"fatal error": {
+			`fatal error: concurrent map writes
+
+goroutine 5 [running]:
+runtime.throw({0x4a1c2b?, 0x0?})
+	/usr/local/go/src/runtime/panic.go:1023 +0x5c
+runtime.mapassign_faststr(0x0?, 0x0?, {0x4a0e1e, 0x3})
+	/usr/local/go/src/runtime/map_faststr.go:203 +0x3e
+main.write(0xc000012345)
+	/src/main.go:8 +0x45
+`,
+			PluginPanic{
+				Message:    "concurrent map writes",
+				Fatal:      true,
+				TopFrame:   "main.write at /src/main.go:8",
+				Goroutines: 1,
+			},
+		},
+
+		"no trace": {
+			`panic: boom`,
+			PluginPanic{
+				Message: "boom",
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			lines := strings.Split(tc.stderr, "\n")
+			if !isPanicStart(lines[0]) {
+				t.Fatalf("bad: %q", lines[0])
+			}
+
+			p := newPanicParser(lines[0])
+			for _, line := range lines[1:] {
+				if !p.add(line) {
+					t.Fatalf("line should be part of the panic: %q", line)
+				}
+			}
+			actual := p.result()
+
+			tc.expected.Trace = strings.TrimRight(tc.stderr, "\n")
+			if *actual != tc.expected {
+				t.Fatalf("bad: %#v", actual)
+			}
+		})
+	}
+}
+
+func TestClient_logStderrPanic(t *testing.T) {
+	stderr := `{"@level":"info","@message":"starting","@timestamp":"2006-01-02T15:04:05.000000-07:00"}
+panic: oh no
+
+goroutine 1 [running]:
+main.main()
+	/src/main.go:4 +0x1c
+`
+
+	var buf bytes.Buffer
+	c := NewClient(&ClientConfig{
+		Logger: hclog.New(&hclog.LoggerOptions{
+			Output: &buf,
+			Level:  hclog.Trace,
+		}),
+	})
+	c.clientWaitGroup.Add(1)
+	c.stderrWaitGroup.Add(1)
+	c.logStderr("test", strings.NewReader(stderr))
+
+	if c.Panic() == nil || c.Panic().Message != "oh no" || c.Panic().TopFrame != "main.main at /src/main.go:4" {
+		t.Fatalf("bad: %#v", c.Panic())
+	}
+
+	// The panic is logged as a single error, and nothing else from it leaks
+	// out line by line.
+	logs := buf.String()
+	if strings.Count(logs, "[ERROR]") != 1 || !strings.Contains(logs, "plugin panicked") || strings.Contains(logs, "[DEBUG]") {
+		t.Fatalf("bad logs:\n%s", logs)
+	}
+	if !strings.Contains(logs, "starting") {
+		t.Fatalf("lines before the panic should be logged:\n%s", logs)
+	}
+}
+
+func TestClient_logStderrPanicEnds(t *testing.T) {
+	stderr := `panic: this is only a log message
+{"@level":"info","@message":"still running","@timestamp":"2006-01-02T15:04:05.000000-07:00"}
+`
+
+	var buf bytes.Buffer
+	c := NewClient(&ClientConfig{
+		Logger: hclog.New(&hclog.LoggerOptions{
+			Output: &buf,
+			Level:  hclog.Trace,
+		}),
+	})
+	c.clientWaitGroup.Add(1)
+	c.stderrWaitGroup.Add(1)
+	c.logStderr("test", strings.NewReader(stderr))
+
+	// Logging carries on once the plugin logs again.
+	logs := buf.String()
+	if !strings.Contains(logs, "still running") {
+		t.Fatalf("bad logs:\n%s", logs)
+	}
+	if c.Panic() == nil {
+		t.Fatal("expected a panic")
+	}
+}
+
+func TestClient_logStderrPanicEndsWithoutJSON(t *testing.T) {
+	cases := map[string]struct {
+		stderr string
+		trace  int
+	}{
+		"after the goroutine dump": {
+			stderr: "panic: caught and logged\n\ngoroutine 1 [running]:\nmain.main()\n\t/src/main.go:4 +0x1c\n\nstill running\n",
+			trace:  5,
+		},
+		"past the cap": {
+			stderr: "panic: caught and logged\n" + strings.Repeat("trace\n", maxPanicLines-1) + "still running\n",
+			trace:  maxPanicLines,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			c := NewClient(&ClientConfig{
+				Logger: hclog.New(&hclog.LoggerOptions{
+					Output: &buf,
+					Level:  hclog.Trace,
+				}),
+			})
+			c.clientWaitGroup.Add(1)
+			c.stderrWaitGroup.Add(1)
+			c.logStderr("test", strings.NewReader(tc.stderr))
+
+			if c.Panic() == nil {
+				t.Fatal("expected a panic")
+			}
+			if lines := strings.Count(c.Panic().Trace, "\n") + 1; lines != tc.trace {
+				t.Fatalf("expected %d lines of trace, got %d", tc.trace, lines)
+			}
+
+			// Lines past the end of the panic are logged as usual.
+			logs := buf.String()
+			if !strings.Contains(logs, "[DEBUG] test: still running") {
+				t.Fatalf("bad logs:\n%s", logs)
+			}
+		})
+	}
+}
@@ -15,6 +15,8 @@ import (
 	"net/rpc"
 	"os"
 	"os/exec"
+	"os/signal"
+	"syscall"
 	"testing"
 	"time"
 
@@ -131,6 +133,17 @@ type testInterfaceImpl struct {
 
 func (i *testInterfaceImpl) Double(v int) int { return v * 2 }
 
+// slowTestInterface takes a second to double, so that it can be called while
+// the plugin shuts down.
+type slowTestInterface struct {
+	testInterfaceImpl
+}
+
+func (i *slowTestInterface) Double(v int) int {
+	time.Sleep(time.Second)
+	return v * 2
+}
+
 func (i *testInterfaceImpl) PrintKV(key string, value interface{}) {
 	i.logger.Info("PrintKV called", key, value)
 }
@@ -139,6 +152,21 @@ func (i *testInterfaceImpl) Bidirectional() error {
 	return nil
 }
 
+// testStdinEchoImpl is a testInterfaceImpl whose PrintStdio reads stdin until
+// EOF and prints it to stdout.
+type testStdinEchoImpl struct {
+	testInterfaceImpl
+}
+
+func (i *testStdinEchoImpl) PrintStdio(_, _ []byte) {
+	data, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Fprintf(os.Stdout, "stdin: %s", data)
+	os.Stdout.Sync()
+}
+
 func (i *testInterfaceImpl) PrintStdio(stdout, stderr []byte) {
 	if len(stdout) > 0 {
 		fmt.Fprint(os.Stdout, string(stdout))
@@ -181,11 +209,10 @@ func (impl *testInterfaceClient) Bidirectional() error {
 }
 
 func (impl *testInterfaceClient) PrintStdio(stdout, stderr []byte) {
-	// We don't implement this because we test stream syncing another
-	// way (see rpc_client_test.go). We probably should test this way
-	// but very few people use the net/rpc protocol nowadays so we didn'
-	// put in the effort.
-	return
+	err := impl.Client.Call("Plugin.PrintStdio", [][]byte{stdout, stderr}, &struct{}{})
+	if err != nil {
+		panic(err)
+	}
 }
 
 // testInterfaceServer is the RPC server for testInterfaceClient
@@ -204,6 +231,11 @@ func (s *testInterfaceServer) PrintKV(args map[string]interface{}, _ *struct{})
 	return nil
 }
 
+func (s *testInterfaceServer) PrintStdio(args [][]byte, _ *struct{}) error {
+	s.Impl.PrintStdio(args[0], args[1])
+	return nil
+}
+
 // testPluginMap can be used for tests as a plugin map
 var testPluginMap = map[string]Plugin{
 	"test": new(testInterfacePlugin),
@@ -420,6 +452,13 @@ func (c *testGRPCClient) PrintStdio(stdout, stderr []byte) {
 	}
 }
 
+func TestMain(m *testing.M) {
+	// Sandboxed helper processes are started by re-executing the test binary
+	// as the sandbox init process.
+	SandboxInit()
+	os.Exit(m.Run())
+}
+
 func helperProcess(s ...string) *exec.Cmd {
 	cs := []string{"-test.run=TestHelperProcess", "--"}
 	cs = append(cs, s...)
@@ -502,6 +541,27 @@ func TestHelperProcess(*testing.T) {
 		fmt.Printf("%d|%d|tcp|:1234\n", CoreProtocolVersion, testHandshake.ProtocolVersion)
 		os.Stderr.WriteString("HELLO\n")
 		os.Stderr.WriteString("WORLD\n")
+	case "stderr-flood":
+		fmt.Printf("%d|%d|tcp|:1234\n", CoreProtocolVersion, testHandshake.ProtocolVersion)
+		for i := 0; i < 50; i++ {
+			os.Stderr.WriteString("[ERROR] same\n")
+		}
+		for i := 0; i < 50; i++ {
+			fmt.Fprintf(os.Stderr, "[INFO] line %d\n", i)
+		}
+	case "exit-code":
+		fmt.Printf("%d|%d|tcp|:1234\n", CoreProtocolVersion, testHandshake.ProtocolVersion)
+		os.Stderr.WriteString("exiting\n")
+		os.Exit(3)
+	case "panic":
+		fmt.Printf("%d|%d|tcp|:1234\n", CoreProtocolVersion, testHandshake.ProtocolVersion)
+		os.Stderr.WriteString("about to panic\n")
+
+		// Panic in a new goroutine so the deferred os.Exit can't swallow it.
+		go func() {
+			panic("oh no")
+		}()
+		select {}
 	case "stderr-json":
 		// write values that might be JSON, but aren't KVs
 		fmt.Printf("%d|%d|tcp|:1234\n", CoreProtocolVersion, testHandshake.ProtocolVersion)
@@ -543,6 +603,53 @@ func TestHelperProcess(*testing.T) {
 
 		// Exit
 		return
+	case "shutdown-hook":
+		// The hook writes the file so we can tell from the outside that it
+		// ran before the plugin exited.
+		path, protocol := args[0], args[1]
+		plugins := testPluginMap
+		if Protocol(protocol) == ProtocolGRPC {
+			plugins = testGRPCPluginMap
+		}
+
+		Serve(&ServeConfig{
+			HandshakeConfig: testHandshake,
+			Plugins:         plugins,
+			GRPCServer:      DefaultGRPCServer,
+			OnShutdown: func(ctx context.Context) error {
+				return ioutil.WriteFile(path, []byte("foo"), 0644)
+			},
+		})
+
+		os.Exit(0)
+	case "metadata":
+		plugins := testPluginMap
+		if Protocol(args[0]) == ProtocolGRPC {
+			plugins = testGRPCPluginMap
+		}
+
+		Serve(&ServeConfig{
+			HandshakeConfig: testHandshake,
+			Plugins:         plugins,
+			GRPCServer:      DefaultGRPCServer,
+			Metadata: &PluginMetadata{
+				Name:         "test",
+				Version:      "1.2.3",
+				Author:       "HashiCorp",
+				Capabilities: []string{"double"},
+				Extra:        map[string]string{"foo": "bar"},
+			},
+		})
+
+		os.Exit(0)
+	case "test-custom-protocol":
+		Serve(&ServeConfig{
+			HandshakeConfig: testHandshake,
+			Plugins:         testPluginMap,
+			Protocol:        testProtocol,
+		})
+
+		os.Exit(0)
 	case "test-grpc":
 		Serve(&ServeConfig{
 			HandshakeConfig: testHandshake,
@@ -550,6 +657,60 @@ func TestHelperProcess(*testing.T) {
 			GRPCServer:      DefaultGRPCServer,
 		})
 
+		// Shouldn't reach here but make sure we exit anyways
+		os.Exit(0)
+	case "test-grpc-slow":
+		Serve(&ServeConfig{
+			HandshakeConfig: testHandshake,
+			Plugins: map[string]Plugin{
+				"test": &testGRPCInterfacePlugin{Impl: new(slowTestInterface)},
+			},
+			GRPCServer: DefaultGRPCServer,
+		})
+
+		// Shouldn't reach here but make sure we exit anyways
+		os.Exit(0)
+	case "test-grpc-stubborn":
+		// Never exit unless killed.
+		signal.Ignore(syscall.SIGTERM)
+		Serve(&ServeConfig{
+			HandshakeConfig: testHandshake,
+			Plugins:         testGRPCPluginMap,
+			GRPCServer:      DefaultGRPCServer,
+			OnShutdown: func(context.Context) error {
+				select {}
+			},
+		})
+
+		select {}
+	case "test-grpc-log":
+		logger := hclog.NewInterceptLogger(&hclog.LoggerOptions{
+			Level:      hclog.Trace,
+			Output:     os.Stderr,
+			JSONFormat: true,
+		})
+
+		Serve(&ServeConfig{
+			HandshakeConfig: testHandshake,
+			Plugins: map[string]Plugin{
+				"test": &testGRPCInterfacePlugin{
+					Impl: &testInterfaceImpl{logger: logger},
+				},
+			},
+			GRPCServer: DefaultGRPCServer,
+			Logger:     logger,
+		})
+
+		// Shouldn't reach here but make sure we exit anyways
+		os.Exit(0)
+	case "test-grpc-default-log":
+		// Serve with the default logger, which streams its entries too.
+		Serve(&ServeConfig{
+			HandshakeConfig: testHandshake,
+			Plugins:         testGRPCPluginMap,
+			GRPCServer:      DefaultGRPCServer,
+		})
+
 		// Shouldn't reach here but make sure we exit anyways
 		os.Exit(0)
 	case "test-grpc-tls":
@@ -569,6 +730,42 @@ func TestHelperProcess(*testing.T) {
 			Plugins:         testPluginMap,
 		})
 
+		// Shouldn't reach here but make sure we exit anyways
+		os.Exit(0)
+	case "test-log-level":
+		// The plugin starts out only logging warnings.
+		logger := hclog.New(&hclog.LoggerOptions{
+			Level:      hclog.Warn,
+			Output:     os.Stderr,
+			JSONFormat: true,
+		})
+		impl := &testInterfaceImpl{logger: logger}
+
+		config := &ServeConfig{
+			HandshakeConfig: testHandshake,
+			Plugins:         map[string]Plugin{"test": &testInterfacePlugin{Impl: impl}},
+			Logger:          logger,
+		}
+		if len(args) > 0 && args[0] == "grpc" {
+			config.Plugins = map[string]Plugin{"test": &testGRPCInterfacePlugin{Impl: impl}}
+			config.GRPCServer = DefaultGRPCServer
+		}
+		Serve(config)
+
+		// Shouldn't reach here but make sure we exit anyways
+		os.Exit(0)
+	case "stdin-echo":
+		impl := &testStdinEchoImpl{testInterfaceImpl{logger: hclog.NewNullLogger()}}
+		config := &ServeConfig{
+			HandshakeConfig: testHandshake,
+			Plugins:         map[string]Plugin{"test": &testInterfacePlugin{Impl: impl}},
+		}
+		if len(args) > 0 && args[0] == "grpc" {
+			config.Plugins = map[string]Plugin{"test": &testGRPCInterfacePlugin{Impl: impl}}
+			config.GRPCServer = DefaultGRPCServer
+		}
+		Serve(config)
+
 		// Shouldn't reach here but make sure we exit anyways
 		os.Exit(0)
 	case "test-interface-logger-netrpc":
@@ -707,6 +904,15 @@ func TestHelperProcess(*testing.T) {
 		}
 		fmt.Printf("%d|%d|tcp|:1234|%s||false\n", CoreProtocolVersion, testHandshake.ProtocolVersion, ProtocolGRPC)
 		<-make(chan int)
+	case "mux-grpc-with-unsupported-plugin-capabilities":
+		// Same as above, but the plugin uses the capabilities handshake.
+		caps, err := parseCapabilities(os.Getenv(envClientCapabilities))
+		if err != nil || !caps.Bool(capabilityGRPCBrokerMultiplex) {
+			fmt.Println("failed precondition for mux test")
+			os.Exit(1)
+		}
+		fmt.Printf("%d|%d|tcp|:1234|%s||%s=false\n", CoreProtocolVersionCapabilities, testHandshake.ProtocolVersion, ProtocolGRPC, capabilityGRPCBrokerMultiplex)
+		<-make(chan int)
 	default:
 		fmt.Fprintf(os.Stderr, "Unknown command: %q\n", cmd)
 		os.Exit(2)
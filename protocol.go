@@ -4,8 +4,14 @@
 package plugin
 
 import (
+	"context"
+	"crypto/tls"
+	"fmt"
 	"io"
 	"net"
+	"sync"
+
+	"github.com/hashicorp/go-hclog"
 )
 
 // Protocol is an enum representing the types of protocols.
@@ -46,3 +52,195 @@ type ClientProtocol interface {
 	// Ping checks that the client connection is still healthy.
 	Ping() error
 }
+
+// ClientProtocolContext is optionally implemented by a ClientProtocol whose
+// Dispense and Ping can be cancelled. The built-in protocols implement it.
+// Use DispenseContext and PingContext to call them on any ClientProtocol.
+type ClientProtocolContext interface {
+	ClientProtocol
+
+	// DispenseContext is like Dispense, but gives up waiting on the plugin
+	// if the context is cancelled.
+	DispenseContext(context.Context, string) (interface{}, error)
+
+	// PingContext is like Ping, but gives up waiting on the plugin if the
+	// context is cancelled.
+	PingContext(context.Context) error
+}
+
+// DispenseContext dispenses the named plugin from client, giving up once ctx
+// is cancelled. If client doesn't implement ClientProtocolContext, Dispense
+// keeps running in the background after ctx is cancelled.
+func DispenseContext(ctx context.Context, client ClientProtocol, name string) (interface{}, error) {
+	if c, ok := client.(ClientProtocolContext); ok {
+		return c.DispenseContext(ctx, name)
+	}
+
+	type result struct {
+		raw interface{}
+		err error
+	}
+	resultCh := make(chan result, 1)
+	go func() {
+		raw, err := client.Dispense(name)
+		resultCh <- result{raw, err}
+	}()
+
+	select {
+	case r := <-resultCh:
+		return r.raw, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// PingContext pings client, giving up once ctx is cancelled. If client
+// doesn't implement ClientProtocolContext, Ping keeps running in the
+// background after ctx is cancelled.
+func PingContext(ctx context.Context, client ClientProtocol) error {
+	if c, ok := client.(ClientProtocolContext); ok {
+		return c.PingContext(ctx)
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- client.Ping()
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// ServerProtocolConfig is the configuration a ServerFactory uses to build
+// the server side of a protocol.
+type ServerProtocolConfig struct {
+	// ServeConfig is the configuration Serve was called with, for protocols
+	// that need options from it.
+	ServeConfig *ServeConfig
+
+	// Plugins is the plugin set negotiated with the client.
+	Plugins PluginSet
+
+	// Listener is the listener the client will connect to. TLS is the TLS
+	// configuration if one was provided or negotiated with AutoMTLS. The
+	// protocol is responsible for applying it, for example by wrapping the
+	// listener.
+	Listener net.Listener
+	TLS      *tls.Config
+
+	// Stdout and Stderr are the plugin's redirected stdout and stderr, which
+	// the protocol should forward to the client if it is able to.
+	Stdout io.Reader
+	Stderr io.Reader
+
+	// Stdin, if non-nil, is the write end of the plugin's redirected stdin.
+	// The protocol should write the stdin the client forwards to it, and
+	// close it once the client reaches the end of its stdin. It is only set
+	// for the built-in protocols, so protocols registered with
+	// RegisterProtocol leave the plugin's stdin inherited from the client.
+	Stdin io.WriteCloser
+
+	// DoneCh must be closed by the server once it has stopped serving, at
+	// which point Serve returns.
+	DoneCh chan struct{}
+
+	Logger hclog.Logger
+
+	// clientCaps are the capabilities the client advertised.
+	clientCaps capabilities
+
+	// logSink, if non-nil, streams the plugin's log entries to a gRPC
+	// client.
+	logSink *grpcLogServer
+}
+
+// ClientProtocolConfig is the configuration a ClientFactory uses to connect
+// to a plugin.
+type ClientProtocolConfig struct {
+	// Addr is the address the plugin is listening on, and TLS the TLS
+	// configuration to connect with, if any.
+	Addr net.Addr
+	TLS  *tls.Config
+
+	// Plugins is the plugin set negotiated with the plugin.
+	Plugins PluginSet
+
+	Logger hclog.Logger
+
+	// DoneCtx is cancelled once the plugin process has exited.
+	DoneCtx context.Context
+
+	// SyncStdout and SyncStderr are where the plugin's stdout and stderr
+	// should be copied to.
+	SyncStdout io.Writer
+	SyncStderr io.Writer
+
+	// client is the Client the connection is being made for. This is used by
+	// the built-in protocols, which rely on more of its state.
+	client *Client
+}
+
+// ServerFactory builds the server for a protocol. It returns the listener
+// Serve should pass to ServerProtocol.Serve, which may be the one from the
+// config or a wrapper around it.
+type ServerFactory func(*ServerProtocolConfig) (ServerProtocol, net.Listener, error)
+
+// ClientFactory connects to a plugin serving a protocol.
+type ClientFactory func(context.Context, *ClientProtocolConfig) (ClientProtocol, error)
+
+type protocolFactories struct {
+	server ServerFactory
+	client ClientFactory
+}
+
+var (
+	protocolsLock sync.RWMutex
+	protocols     = make(map[Protocol]protocolFactories)
+)
+
+func init() {
+	RegisterProtocol(ProtocolNetRPC, newRPCServerProtocol, newRPCClientProtocol)
+	RegisterProtocol(ProtocolGRPC, newGRPCServerProtocol, newGRPCClientProtocol)
+}
+
+// RegisterProtocol makes a protocol available to plugins and hosts. Plugins
+// select it with ServeConfig.Protocol, and hosts must still list it in
+// ClientConfig.AllowedProtocols to accept it. The net/rpc and gRPC protocols
+// are registered by default.
+//
+// RegisterProtocol is usually called from an init function, and panics if
+// the protocol is already registered or a factory is nil.
+func RegisterProtocol(p Protocol, server ServerFactory, client ClientFactory) {
+	if p == ProtocolInvalid {
+		panic("plugin: RegisterProtocol with an empty protocol name")
+	}
+	if server == nil || client == nil {
+		panic(fmt.Sprintf("plugin: RegisterProtocol factory for %q is nil", p))
+	}
+
+	protocolsLock.Lock()
+	defer protocolsLock.Unlock()
+
+	if _, ok := protocols[p]; ok {
+		panic(fmt.Sprintf("plugin: RegisterProtocol called twice for %q", p))
+	}
+
+	protocols[p] = protocolFactories{
+		server: server,
+		client: client,
+	}
+}
+
+// registeredProtocol returns the factories for a protocol, if it was
+// registered.
+func registeredProtocol(p Protocol) (protocolFactories, bool) {
+	protocolsLock.RLock()
+	defer protocolsLock.RUnlock()
+
+	f, ok := protocols[p]
+	return f, ok
+}
@@ -0,0 +1,133 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testProtocol is net/rpc registered under another name, built only from the
+// exported parts of the protocol configs like a third-party protocol would.
+const testProtocol Protocol = "test-netrpc"
+
+func init() {
+	RegisterProtocol(testProtocol,
+		func(config *ServerProtocolConfig) (ServerProtocol, net.Listener, error) {
+			return &RPCServer{
+				Plugins: config.Plugins,
+				Stdout:  config.Stdout,
+				Stderr:  config.Stderr,
+				DoneCh:  config.DoneCh,
+			}, config.Listener, nil
+		},
+		func(ctx context.Context, config *ClientProtocolConfig) (ClientProtocol, error) {
+			var d net.Dialer
+			conn, err := d.DialContext(ctx, config.Addr.Network(), config.Addr.String())
+			if err != nil {
+				return nil, err
+			}
+
+			return NewRPCClient(conn, config.Plugins)
+		},
+	)
+}
+
+func TestRegisterProtocol(t *testing.T) {
+	c := NewClient(&ClientConfig{
+		Cmd:              helperProcess("test-custom-protocol"),
+		HandshakeConfig:  testHandshake,
+		Plugins:          testPluginMap,
+		AllowedProtocols: []Protocol{testProtocol},
+		SyncStdin:        strings.NewReader("hello\n"),
+	})
+	defer c.Kill()
+
+	client, err := c.Client()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Only the built-in protocols forward stdin.
+	if c.serverCapabilities.Bool(capabilitySyncStdin) {
+		t.Fatal("expected the plugin not to accept stdin")
+	}
+
+	raw, err := client.Dispense("test")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if result := raw.(testInterface).Double(21); result != 42 {
+		t.Fatalf("bad: %#v", result)
+	}
+}
+
+func TestRegisterProtocol_notAllowed(t *testing.T) {
+	c := NewClient(&ClientConfig{
+		Cmd:             helperProcess("test-custom-protocol"),
+		HandshakeConfig: testHandshake,
+		Plugins:         testPluginMap,
+	})
+	defer c.Kill()
+
+	_, err := c.Start()
+	if err == nil || !strings.Contains(err.Error(), "Unsupported plugin protocol") {
+		t.Fatalf("bad: %v", err)
+	}
+}
+
+func TestRegisterProtocol_duplicate(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("should panic")
+		}
+	}()
+
+	RegisterProtocol(ProtocolGRPC, newGRPCServerProtocol, newGRPCClientProtocol)
+}
+
+// blockingClientProtocol is a ClientProtocol without the context methods,
+// whose calls block until unblockCh is closed.
+type blockingClientProtocol struct {
+	unblockCh chan struct{}
+}
+
+func (p *blockingClientProtocol) Close() error { return nil }
+
+func (p *blockingClientProtocol) Dispense(string) (interface{}, error) {
+	<-p.unblockCh
+	return "raw", nil
+}
+
+func (p *blockingClientProtocol) Ping() error {
+	<-p.unblockCh
+	return nil
+}
+
+func TestDispenseContext_fallback(t *testing.T) {
+	client := &blockingClientProtocol{unblockCh: make(chan struct{})}
+	defer close(client.unblockCh)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := DispenseContext(ctx, client, "test"); err != context.DeadlineExceeded {
+		t.Fatalf("bad: %v", err)
+	}
+	if err := PingContext(ctx, client); err != context.DeadlineExceeded {
+		t.Fatalf("bad: %v", err)
+	}
+
+	unblocked := &blockingClientProtocol{unblockCh: make(chan struct{})}
+	close(unblocked.unblockCh)
+	raw, err := DispenseContext(context.Background(), unblocked, "test")
+	if err != nil || raw != "raw" {
+		t.Fatalf("bad: %v, %v", raw, err)
+	}
+	if err := PingContext(context.Background(), unblocked); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+)
+
+// reattachConfigJSON is the JSON form of a ReattachConfig. ReattachFunc
+// can't be encoded, and is left out.
+type reattachConfigJSON struct {
+	Protocol        Protocol
+	ProtocolVersion int
+	Addr            reattachAddrJSON
+	Pid             int
+	Test            bool
+
+	StdioSequence          uint64 `json:",omitempty"`
+	GRPCBrokerMultiplex    bool   `json:",omitempty"`
+	GRPCBrokerMultiplexIDs bool   `json:",omitempty"`
+}
+
+// reattachAddrJSON is the JSON form of ReattachConfig.Addr.
+type reattachAddrJSON struct {
+	Network string
+	String  string
+}
+
+// MarshalJSON encodes the reattach config as JSON, for example to pass it
+// to another process that reattaches to the plugin. ReattachFunc isn't
+// encoded. Addr is encoded as its network and string form:
+//
+//	{"Protocol":"grpc","ProtocolVersion":1,"Addr":{"Network":"unix","String":"/tmp/plugin123"},"Pid":123,"Test":true}
+func (c ReattachConfig) MarshalJSON() ([]byte, error) {
+	v := reattachConfigJSON{
+		Protocol:               c.Protocol,
+		ProtocolVersion:        c.ProtocolVersion,
+		Pid:                    c.Pid,
+		Test:                   c.Test,
+		StdioSequence:          c.StdioSequence,
+		GRPCBrokerMultiplex:    c.GRPCBrokerMultiplex,
+		GRPCBrokerMultiplexIDs: c.GRPCBrokerMultiplexIDs,
+	}
+	if c.Addr != nil {
+		v.Addr = reattachAddrJSON{
+			Network: c.Addr.Network(),
+			String:  c.Addr.String(),
+		}
+	}
+
+	return json.Marshal(v)
+}
+
+// UnmarshalJSON decodes a reattach config encoded with MarshalJSON.
+func (c *ReattachConfig) UnmarshalJSON(data []byte) error {
+	var v reattachConfigJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	var addr net.Addr
+	switch v.Addr.Network {
+	case "":
+	case "unix":
+		addr = &net.UnixAddr{Net: "unix", Name: v.Addr.String}
+	case "tcp":
+		tcpAddr, err := net.ResolveTCPAddr("tcp", v.Addr.String)
+		if err != nil {
+			return fmt.Errorf("invalid reattach address %q: %w", v.Addr.String, err)
+		}
+		addr = tcpAddr
+	default:
+		return fmt.Errorf("unknown reattach address network %q", v.Addr.Network)
+	}
+
+	*c = ReattachConfig{
+		Protocol:               v.Protocol,
+		ProtocolVersion:        v.ProtocolVersion,
+		Addr:                   addr,
+		Pid:                    v.Pid,
+		Test:                   v.Test,
+		StdioSequence:          v.StdioSequence,
+		GRPCBrokerMultiplex:    v.GRPCBrokerMultiplex,
+		GRPCBrokerMultiplexIDs: v.GRPCBrokerMultiplexIDs,
+	}
+
+	return nil
+}
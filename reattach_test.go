@@ -0,0 +1,72 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"encoding/json"
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestReattachConfig_json(t *testing.T) {
+	tcpAddr, err := net.ResolveTCPAddr("tcp", "127.0.0.1:1234")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	for name, config := range map[string]*ReattachConfig{
+		"unix": {
+			Protocol:               ProtocolGRPC,
+			ProtocolVersion:        5,
+			Addr:                   &net.UnixAddr{Net: "unix", Name: "/tmp/plugin123"},
+			Pid:                    123,
+			StdioSequence:          42,
+			GRPCBrokerMultiplex:    true,
+			GRPCBrokerMultiplexIDs: true,
+		},
+		"tcp": {
+			Protocol: ProtocolNetRPC,
+			Addr:     tcpAddr,
+			Test:     true,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			data, err := json.Marshal(config)
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
+
+			var actual ReattachConfig
+			if err := json.Unmarshal(data, &actual); err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			if !reflect.DeepEqual(&actual, config) {
+				t.Fatalf("bad: %#v\n%s", actual, data)
+			}
+		})
+	}
+
+	// The format is shared with other processes, so it must be stable.
+	const expected = `{"Protocol":"grpc","ProtocolVersion":1,"Addr":{"Network":"unix","String":"/tmp/plugin123"},"Pid":123,"Test":true,"GRPCBrokerMultiplex":true}`
+	data, err := json.Marshal(ReattachConfig{
+		Protocol:            ProtocolGRPC,
+		ProtocolVersion:     1,
+		Addr:                &net.UnixAddr{Net: "unix", Name: "/tmp/plugin123"},
+		Pid:                 123,
+		Test:                true,
+		GRPCBrokerMultiplex: true,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if string(data) != expected {
+		t.Fatalf("bad: %s", data)
+	}
+
+	var config ReattachConfig
+	if err := json.Unmarshal([]byte(`{"Addr":{"Network":"udp","String":"127.0.0.1:1234"}}`), &config); err == nil {
+		t.Fatal("expected an error")
+	}
+}
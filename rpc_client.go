@@ -4,12 +4,15 @@
 package plugin
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
 	"io"
 	"net"
 	"net/rpc"
+	"strings"
 
+	"github.com/hashicorp/go-hclog"
 	"github.com/hashicorp/yamux"
 )
 
@@ -19,15 +22,23 @@ type RPCClient struct {
 	control *rpc.Client
 	plugins map[string]Plugin
 
-	// These are the streams used for the various stdout/err overrides
-	stdout, stderr net.Conn
+	// metrics records the calls to the plugin, if non-nil.
+	metrics *metricsRecorder
+
+	// tracer creates spans around dispensing plugins, if non-nil.
+	tracer *tracer
+
+	// These are the streams used for the various stdin/out/err overrides.
+	// stdin is nil unless the plugin accepts stdin.
+	stdin, stdout, stderr net.Conn
 }
 
 // newRPCClient creates a new RPCClient. The Client argument is expected
 // to be successfully started already with a lock held.
-func newRPCClient(c *Client) (*RPCClient, error) {
+func newRPCClient(ctx context.Context, c *Client) (*RPCClient, error) {
 	// Connect to the client
-	conn, err := net.Dial(c.address.Network(), c.address.String())
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, c.address.Network(), c.address.String())
 	if err != nil {
 		return nil, err
 	}
@@ -40,8 +51,16 @@ func newRPCClient(c *Client) (*RPCClient, error) {
 		conn = tls.Client(conn, c.config.TLSConfig)
 	}
 
+	// Forward stdin over its own stream if it's set and the plugin accepts
+	// it. This isn't known when reattaching, in which case it isn't
+	// forwarded.
+	syncStdin := c.config.SyncStdin != nil && c.serverCapabilities.Bool(capabilitySyncStdin)
+	if c.config.SyncStdin != nil && !syncStdin {
+		c.logger.Warn("plugin does not accept stdin, SyncStdin is ignored")
+	}
+
 	// Create the actual RPC client
-	result, err := NewRPCClient(conn, c.config.Plugins)
+	result, err := newRPCClientConn(conn, c.config.Plugins, syncStdin, c.metrics(ProtocolNetRPC), c.tracer, c.config.Broker)
 	if err != nil {
 		conn.Close()
 		return nil, err
@@ -55,13 +74,34 @@ func newRPCClient(c *Client) (*RPCClient, error) {
 		result.Close()
 		return nil, err
 	}
+	if syncStdin {
+		go result.syncStdin(c.config.SyncStdin)
+	}
 
 	return result, nil
 }
 
+// newRPCClientProtocol is the ClientFactory for ProtocolNetRPC.
+func newRPCClientProtocol(ctx context.Context, config *ClientProtocolConfig) (ClientProtocol, error) {
+	client, err := newRPCClient(ctx, config.client)
+	if err != nil {
+		return nil, err
+	}
+
+	return client, nil
+}
+
 // NewRPCClient creates a client from an already-open connection-like value.
 // Dial is typically used instead.
 func NewRPCClient(conn io.ReadWriteCloser, plugins map[string]Plugin) (*RPCClient, error) {
+	return newRPCClientConn(conn, plugins, false, nil, nil, nil)
+}
+
+// newRPCClientConn is NewRPCClient, also opening a stream to forward stdin
+// over if stdin is true. The server must expect it, see RPCServer.Stdin.
+// Calls are recorded with metrics if it is non-nil, and spans are created
+// with tracer if it is non-nil. The broker is configured with brokerConfig.
+func newRPCClientConn(conn io.ReadWriteCloser, plugins map[string]Plugin, stdin bool, metrics *metricsRecorder, tracer *tracer, brokerConfig *BrokerConfig) (*RPCClient, error) {
 	// Create the yamux client so we can multiplex
 	mux, err := yamux.Client(conn, nil)
 	if err != nil {
@@ -87,14 +127,28 @@ func NewRPCClient(conn io.ReadWriteCloser, plugins map[string]Plugin) (*RPCClien
 	}
 
 	// Create the broker and start it up
-	broker := newMuxBroker(mux)
+	broker := newMuxBroker(mux, brokerConfig)
+	broker.tracer = tracer
 	go broker.Run()
 
+	// Connect the stdin stream
+	var stdinStream net.Conn
+	if stdin {
+		stdinStream, err = broker.dialStream(muxBrokerStdinID)
+		if err != nil {
+			mux.Close()
+			return nil, err
+		}
+	}
+
 	// Build the client using our broker and control channel.
 	return &RPCClient{
 		broker:  broker,
-		control: rpc.NewClient(control),
+		control: newNetRPCClient(control, metrics, TraceContext{}),
+		metrics: metrics,
+		tracer:  tracer,
 		plugins: plugins,
+		stdin:   stdinStream,
 		stdout:  stdstream[0],
 		stderr:  stdstream[1],
 	}, nil
@@ -113,6 +167,13 @@ func (c *RPCClient) SyncStreams(stdout io.Writer, stderr io.Writer) error {
 	return nil
 }
 
+// syncStdin copies src to the plugin's stdin, closing the plugin's stdin
+// once src reaches EOF. This blocks and should be run in a goroutine.
+func (c *RPCClient) syncStdin(src io.Reader) {
+	copyStream("stdin", c.stdin, src)
+	c.stdin.Close()
+}
+
 // Close closes the connection. The client is no longer usable after this
 // is called.
 func (c *RPCClient) Close() error {
@@ -143,23 +204,37 @@ func (c *RPCClient) Close() error {
 }
 
 func (c *RPCClient) Dispense(name string) (interface{}, error) {
+	return c.DispenseContext(context.Background(), name)
+}
+
+// DispenseContext is like Dispense, but stops waiting for the plugin to
+// respond once ctx is cancelled.
+//
+// net/rpc calls don't take a context, so every call made with the dispensed
+// client carries the trace context ctx carries, if any, however long after
+// the dispense it is made. See TracingConfig.
+func (c *RPCClient) DispenseContext(ctx context.Context, name string) (raw interface{}, err error) {
 	p, ok := c.plugins[name]
 	if !ok {
 		return nil, fmt.Errorf("unknown plugin type: %s", name)
 	}
 
+	trace, _ := TraceContextFromContext(ctx)
+	ctx, span := c.tracer.start(ctx, "plugin.dispense", "plugin.name", name, "rpc.system", "netrpc")
+	defer func() { span.end(err) }()
+
 	var id uint32
-	if err := c.control.Call(
+	if err := c.callContext(ctx,
 		"Dispenser.Dispense", name, &id); err != nil {
 		return nil, err
 	}
 
-	conn, err := c.broker.Dial(id)
+	conn, err := c.broker.DialContext(ctx, id)
 	if err != nil {
 		return nil, err
 	}
 
-	return p.Client(c.broker, rpc.NewClient(conn))
+	return p.Client(c.broker, newNetRPCClient(conn, c.metrics, trace))
 }
 
 // Ping pings the connection to ensure it is still alive.
@@ -168,6 +243,56 @@ func (c *RPCClient) Dispense(name string) (interface{}, error) {
 // it for further error analysis. Any error returned from here would indicate
 // that the connection to the plugin is not healthy.
 func (c *RPCClient) Ping() error {
+	return c.PingContext(context.Background())
+}
+
+// PingContext is like Ping, but stops waiting for the plugin to respond once
+// ctx is cancelled.
+func (c *RPCClient) PingContext(ctx context.Context) error {
+	var empty struct{}
+	return c.callContext(ctx, "Control.Ping", true, &empty)
+}
+
+// metadata asks the plugin for its metadata.
+func (c *RPCClient) metadata(ctx context.Context) (*PluginMetadata, error) {
+	var m PluginMetadata
+	err := c.callContext(ctx, "Control.Metadata", true, &m)
+	if err != nil {
+		// Plugins built against older versions of go-plugin don't have the
+		// method at all.
+		if strings.Contains(err.Error(), "can't find method") {
+			return nil, ErrMetadataNotSupported
+		}
+		return nil, err
+	}
+
+	return &m, nil
+}
+
+// setLogLevel changes the level of the plugin's logger.
+func (c *RPCClient) setLogLevel(ctx context.Context, level hclog.Level) error {
 	var empty struct{}
-	return c.control.Call("Control.Ping", true, &empty)
+	err := c.callContext(ctx, "Control.SetLogLevel", level.String(), &empty)
+	if err != nil && strings.Contains(err.Error(), "can't find method") {
+		return ErrSetLogLevelNotSupported
+	}
+
+	return err
+}
+
+// callContext calls the given method on the control channel. net/rpc has no
+// notion of cancellation, so if ctx is done first the call is abandoned and
+// its reply is discarded whenever it arrives.
+func (c *RPCClient) callContext(ctx context.Context, method string, args, reply interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	call := c.control.Go(method, args, reply, make(chan *rpc.Call, 1))
+	select {
+	case <-call.Done:
+		return call.Error
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
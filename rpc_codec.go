@@ -0,0 +1,219 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"bufio"
+	"context"
+	"encoding/gob"
+	"io"
+	"log"
+	"net/rpc"
+	"sync"
+)
+
+// newNetRPCClient returns a net/rpc client for conn. Its calls carry trace, if
+// it is valid, and are recorded with metrics, if it is non-nil.
+func newNetRPCClient(conn io.ReadWriteCloser, metrics *metricsRecorder, trace TraceContext) *rpc.Client {
+	if metrics == nil && !trace.IsValid() {
+		return rpc.NewClient(conn)
+	}
+
+	var codec rpc.ClientCodec = newGobClientCodec(conn, trace)
+	if metrics != nil {
+		codec = &metricsClientCodec{
+			ClientCodec: codec,
+			metrics:     metrics,
+			calls:       make(map[uint64]pendingRPCCall),
+		}
+	}
+
+	return rpc.NewClientWithCodec(codec)
+}
+
+// serveRPC serves conn with a net/rpc server. Calls are recorded with
+// metrics, if it is non-nil, and calls that carry a trace context get a span
+// from tracer, if it is non-nil.
+func serveRPC(server *rpc.Server, conn io.ReadWriteCloser, metrics *metricsRecorder, tracer *tracer) {
+	if metrics == nil && tracer == nil {
+		server.ServeConn(conn)
+		return
+	}
+
+	var codec rpc.ServerCodec = newGobServerCodec(conn, tracer)
+	if metrics != nil {
+		codec = &metricsServerCodec{
+			ServerCodec: codec,
+			metrics:     metrics,
+			calls:       make(map[uint64]pendingRPCCall),
+		}
+	}
+
+	server.ServeCodec(codec)
+}
+
+// rpcRequestHeader is the header of a net/rpc request, which is an
+// rpc.Request with the trace context of the call added. Since gob matches
+// fields by name, a standard net/rpc server decodes it as an rpc.Request and
+// ignores the trace context, and a standard rpc.Request decodes as an
+// rpcRequestHeader without one.
+type rpcRequestHeader struct {
+	ServiceMethod string
+	Seq           uint64
+	Traceparent   string
+	Tracestate    string
+}
+
+// gobClientCodec and gobServerCodec are the gob codecs that net/rpc uses by
+// default, which it doesn't export for wrapping, extended to propagate trace
+// context in the request header.
+type gobClientCodec struct {
+	rwc    io.ReadWriteCloser
+	dec    *gob.Decoder
+	enc    *gob.Encoder
+	encBuf *bufio.Writer
+
+	// header is the request header with the trace context of every call,
+	// or nil if there is none.
+	header *rpcRequestHeader
+}
+
+func newGobClientCodec(conn io.ReadWriteCloser, trace TraceContext) *gobClientCodec {
+	encBuf := bufio.NewWriter(conn)
+	c := &gobClientCodec{
+		rwc:    conn,
+		dec:    gob.NewDecoder(conn),
+		enc:    gob.NewEncoder(encBuf),
+		encBuf: encBuf,
+	}
+	if trace.IsValid() {
+		c.header = &rpcRequestHeader{
+			Traceparent: trace.Traceparent(),
+			Tracestate:  trace.State,
+		}
+	}
+
+	return c
+}
+
+func (c *gobClientCodec) WriteRequest(r *rpc.Request, body interface{}) (err error) {
+	var header interface{} = r
+	if c.header != nil {
+		// WriteRequest isn't called concurrently, so the header is reused.
+		c.header.ServiceMethod = r.ServiceMethod
+		c.header.Seq = r.Seq
+		header = c.header
+	}
+
+	if err = c.enc.Encode(header); err != nil {
+		return
+	}
+	if err = c.enc.Encode(body); err != nil {
+		return
+	}
+	return c.encBuf.Flush()
+}
+
+func (c *gobClientCodec) ReadResponseHeader(r *rpc.Response) error {
+	return c.dec.Decode(r)
+}
+
+func (c *gobClientCodec) ReadResponseBody(body interface{}) error {
+	return c.dec.Decode(body)
+}
+
+func (c *gobClientCodec) Close() error {
+	return c.rwc.Close()
+}
+
+type gobServerCodec struct {
+	rwc    io.ReadWriteCloser
+	dec    *gob.Decoder
+	enc    *gob.Encoder
+	encBuf *bufio.Writer
+	closed bool
+
+	// tracer creates a span for each call that carries a trace context, if
+	// it is non-nil. spans are the calls' spans by sequence number.
+	tracer *tracer
+	l      sync.Mutex
+	spans  map[uint64]*span
+}
+
+func newGobServerCodec(conn io.ReadWriteCloser, tracer *tracer) *gobServerCodec {
+	encBuf := bufio.NewWriter(conn)
+	return &gobServerCodec{
+		rwc:    conn,
+		dec:    gob.NewDecoder(conn),
+		enc:    gob.NewEncoder(encBuf),
+		encBuf: encBuf,
+		tracer: tracer,
+		spans:  make(map[uint64]*span),
+	}
+}
+
+func (c *gobServerCodec) ReadRequestHeader(r *rpc.Request) error {
+	var header rpcRequestHeader
+	if err := c.dec.Decode(&header); err != nil {
+		return err
+	}
+	r.ServiceMethod = header.ServiceMethod
+	r.Seq = header.Seq
+
+	if c.tracer != nil && header.Traceparent != "" {
+		if trace, err := ParseTraceparent(header.Traceparent, header.Tracestate); err == nil {
+			ctx := ContextWithTraceContext(context.Background(), trace)
+			_, s := c.tracer.start(ctx, header.ServiceMethod, "rpc.system", "netrpc")
+
+			c.l.Lock()
+			c.spans[header.Seq] = s
+			c.l.Unlock()
+		}
+	}
+
+	return nil
+}
+
+func (c *gobServerCodec) ReadRequestBody(body interface{}) error {
+	return c.dec.Decode(body)
+}
+
+func (c *gobServerCodec) WriteResponse(r *rpc.Response, body interface{}) (err error) {
+	c.l.Lock()
+	s := c.spans[r.Seq]
+	delete(c.spans, r.Seq)
+	c.l.Unlock()
+	s.end(rpcResponseError(r.Error))
+
+	if err = c.enc.Encode(r); err != nil {
+		if c.encBuf.Flush() == nil {
+			// Gob couldn't encode the header. Should not happen, so if it
+			// does, shut down the connection to signal that the connection
+			// is broken.
+			log.Printf("[ERR] plugin: rpc: gob error encoding response: %s", err)
+			c.Close()
+		}
+		return
+	}
+	if err = c.enc.Encode(body); err != nil {
+		if c.encBuf.Flush() == nil {
+			// Was a gob problem encoding the body but the header has been
+			// written. Shut down the connection to signal that the
+			// connection is broken.
+			log.Printf("[ERR] plugin: rpc: gob error encoding body: %s", err)
+			c.Close()
+		}
+		return
+	}
+	return c.encBuf.Flush()
+}
+
+func (c *gobServerCodec) Close() error {
+	if c.closed {
+		// Only call c.rwc.Close once; otherwise the semantics are undefined.
+		return nil
+	}
+	c.closed = true
+	return c.rwc.Close()
+}
@@ -4,6 +4,8 @@
 package plugin
 
 import (
+	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
@@ -12,6 +14,7 @@ import (
 	"net/rpc"
 	"sync"
 
+	"github.com/hashicorp/go-hclog"
 	"github.com/hashicorp/yamux"
 )
 
@@ -30,11 +33,53 @@ type RPCServer struct {
 	Stdout io.Reader
 	Stderr io.Reader
 
+	// Stdin, if non-nil, is where the stdin forwarded by clients is
+	// written. Clients forward it over an extra stream, which they only open
+	// if the plugin advertised stdin forwarding in its handshake. Stdin is
+	// closed when a client reaches the end of its stdin.
+	Stdin io.WriteCloser
+
 	// DoneCh should be set to a non-nil channel that will be closed
 	// when the control requests the RPC server to end.
 	DoneCh chan<- struct{}
 
 	lock sync.Mutex
+
+	onShutdown func(context.Context) error
+	metadata   *PluginMetadata
+	logger     hclog.Logger
+	metrics    *metricsRecorder
+	tracer     *tracer
+
+	brokerConfig *BrokerConfig
+}
+
+// newRPCServerProtocol is the ServerFactory for ProtocolNetRPC.
+func newRPCServerProtocol(config *ServerProtocolConfig) (ServerProtocol, net.Listener, error) {
+	// If we have a TLS configuration then we wrap the listener
+	// ourselves and do it at that level.
+	listener := config.Listener
+	if config.TLS != nil {
+		listener = tls.NewListener(listener, config.TLS)
+	}
+
+	// Create the RPC server to dispense
+	server := &RPCServer{
+		Plugins:    config.Plugins,
+		Stdout:     config.Stdout,
+		Stderr:     config.Stderr,
+		Stdin:      config.Stdin,
+		DoneCh:     config.DoneCh,
+		onShutdown: config.ServeConfig.OnShutdown,
+		metadata:   config.ServeConfig.Metadata,
+		logger:     config.Logger,
+		metrics:    serverMetrics(config.ServeConfig.Metrics, ProtocolNetRPC),
+		tracer:     newTracer(config.ServeConfig.Tracing),
+
+		brokerConfig: config.ServeConfig.Broker,
+	}
+
+	return server, listener, nil
 }
 
 // ServerProtocol impl.
@@ -101,9 +146,23 @@ func (s *RPCServer) ServeConn(conn io.ReadWriteCloser) {
 	go copyStream("stderr", stdstream[1], s.Stderr)
 
 	// Create the broker and start it up
-	broker := newMuxBroker(mux)
+	broker := newMuxBroker(mux, s.brokerConfig)
+	broker.tracer = s.tracer
 	go broker.Run()
 
+	// Accept the stdin stream, if the client forwards stdin. Clients that
+	// don't, such as ones that reattached, are served all the same.
+	if s.Stdin != nil {
+		go func() {
+			stdin, err := broker.accept(muxBrokerStdinID, nil)
+			if err != nil {
+				return
+			}
+
+			s.copyStdin(mux, stdin)
+		}()
+	}
+
 	// Use the control connection to build the dispenser and serve the
 	// connection.
 	server := rpc.NewServer()
@@ -113,8 +172,24 @@ func (s *RPCServer) ServeConn(conn io.ReadWriteCloser) {
 	server.RegisterName("Dispenser", &dispenseServer{
 		broker:  broker,
 		plugins: s.Plugins,
+		metrics: s.metrics,
+		tracer:  s.tracer,
 	})
-	server.ServeConn(control)
+	serveRPC(server, control, s.metrics, s.tracer)
+}
+
+// copyStdin copies a client's stdin stream to our stdin. Stdin is only
+// closed if the client closed the stream, and not if the connection was lost,
+// so that a client that reattaches can continue writing to it.
+func (s *RPCServer) copyStdin(mux *yamux.Session, stdin net.Conn) {
+	_, err := io.Copy(s.Stdin, stdin)
+	if err != nil {
+		log.Printf("[ERR] plugin: stream copy 'stdin' error: %s", err)
+		return
+	}
+	if !mux.IsClosed() {
+		s.Stdin.Close()
+	}
 }
 
 // done is called internally by the control server to trigger the
@@ -144,9 +219,39 @@ func (c *controlServer) Ping(
 	return nil
 }
 
+// Metadata returns the metadata describing the plugin.
+func (c *controlServer) Metadata(
+	null bool, response *PluginMetadata,
+) error {
+	*response = *serverMetadata(c.server.metadata)
+	return nil
+}
+
+// SetLogLevel changes the level of the plugin's logger.
+func (c *controlServer) SetLogLevel(
+	level string, response *struct{},
+) error {
+	if c.server.logger == nil {
+		return ErrSetLogLevelNotSupported
+	}
+
+	*response = struct{}{}
+	return setServerLogLevel(c.server.logger, level)
+}
+
 func (c *controlServer) Quit(
 	null bool, response *struct{},
 ) error {
+	// net/rpc clients don't send a grace period, so give the shutdown hook
+	// the default one.
+	if c.server.onShutdown != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), defaultGracefulShutdownTimeout)
+		if err := c.server.onShutdown(ctx); err != nil {
+			log.Printf("[ERR] plugin: shutdown hook: %s", err)
+		}
+		cancel()
+	}
+
 	// End the server
 	c.server.done()
 
@@ -160,6 +265,8 @@ func (c *controlServer) Quit(
 type dispenseServer struct {
 	broker  *MuxBroker
 	plugins map[string]Plugin
+	metrics *metricsRecorder
+	tracer  *tracer
 }
 
 func (d *dispenseServer) Dispense(
@@ -192,18 +299,20 @@ func (d *dispenseServer) Dispense(
 			return
 		}
 
-		serve(conn, "Plugin", impl)
+		serve(conn, "Plugin", impl, d.metrics, d.tracer)
 	}()
 
 	return nil
 }
 
-func serve(conn io.ReadWriteCloser, name string, v interface{}) {
+// serve serves v under the given name on conn, recording its calls with
+// metrics and creating spans for them with tracer if they are non-nil.
+func serve(conn io.ReadWriteCloser, name string, v interface{}, metrics *metricsRecorder, tracer *tracer) {
 	server := rpc.NewServer()
 	if err := server.RegisterName(name, v); err != nil {
 		log.Printf("[ERR] go-plugin: plugin dispense error: %s", err)
 		return
 	}
 
-	server.ServeConn(conn)
+	serveRPC(server, conn, metrics, tracer)
 }
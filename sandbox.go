@@ -0,0 +1,76 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"time"
+
+	"github.com/hashicorp/go-plugin/internal/cmdrunner"
+)
+
+// SandboxConfig configures the sandbox a plugin runs in when it is set as
+// ClientConfig.Sandbox. Sandboxing is only supported on Linux.
+//
+// The plugin always runs in its own user, mount, network and PID namespaces,
+// as root within its user namespace but without any capabilities, and with
+// no_new_privs set. The host's unix socket directory is the only part of the
+// host filesystem it gets write access to that it didn't have before, and
+// /tmp is replaced with an empty directory. The host binary is re-executed
+// to set this up, so its main function must call SandboxInit first.
+type SandboxConfig struct {
+	// CPUTime limits the CPU time the plugin can use, rounded up to whole
+	// seconds. Zero means no limit.
+	CPUTime time.Duration
+
+	// Memory limits the address space of the plugin in bytes. Note that the
+	// Go runtime reserves much more address space than it uses. Zero means
+	// no limit.
+	Memory uint64
+
+	// OpenFiles limits the number of open file descriptors. Zero means no
+	// limit.
+	OpenFiles uint64
+
+	// Seccomp installs a filter denying system calls a plugin has no
+	// business making, such as mount, ptrace, bpf, or creating namespaces.
+	// It is supported on amd64 and arm64.
+	Seccomp bool
+
+	// Landlock restricts filesystem access to the unix socket directory, the
+	// plugin executable and ReadOnlyPaths. It requires a kernel with landlock
+	// enabled.
+	Landlock bool
+
+	// ReadOnlyPaths are files or directories the plugin can read and execute
+	// when Landlock is set, for example the shared libraries it needs.
+	// Paths that don't exist are ignored.
+	ReadOnlyPaths []string
+}
+
+// SandboxInit must be called at the start of the main function of hosts that
+// set ClientConfig.Sandbox, before anything else runs:
+//
+//	func main() {
+//		plugin.SandboxInit()
+//		...
+//	}
+//
+// Sandboxed plugins are started by re-executing the host binary, which then
+// sets up the sandbox and runs the plugin from SandboxInit, which never
+// returns in that case. Otherwise SandboxInit returns right away. Starting a
+// sandboxed plugin fails if it hasn't been called.
+func SandboxInit() {
+	cmdrunner.SandboxInit()
+}
+
+func (s *SandboxConfig) runnerConfig() *cmdrunner.SandboxConfig {
+	return &cmdrunner.SandboxConfig{
+		CPUTime:       s.CPUTime,
+		Memory:        s.Memory,
+		OpenFiles:     s.OpenFiles,
+		Seccomp:       s.Seccomp,
+		Landlock:      s.Landlock,
+		ReadOnlyPaths: s.ReadOnlyPaths,
+	}
+}
@@ -21,7 +21,6 @@ import (
 	"strings"
 
 	hclog "github.com/hashicorp/go-hclog"
-	"github.com/hashicorp/go-plugin/internal/grpcmux"
 	"google.golang.org/grpc"
 )
 
@@ -32,6 +31,13 @@ import (
 // infrequently.
 const CoreProtocolVersion = 1
 
+// CoreProtocolVersionCapabilities is the core protocol version whose
+// handshake line ends with a segment of comma-separated key=value
+// capabilities instead of positional segments for each new feature. Plugins
+// only use it if the client lists it in PLUGIN_CORE_PROTOCOL_VERSIONS, and
+// fall back to CoreProtocolVersion otherwise.
+const CoreProtocolVersionCapabilities = 2
+
 // HandshakeConfig is the configuration used by client and servers to
 // handshake before starting a plugin connection. This is embedded by
 // both ServeConfig and ClientConfig.
@@ -85,10 +91,55 @@ type ServeConfig struct {
 	// relies on this to implement Ping().
 	GRPCServer func([]grpc.ServerOption) *grpc.Server
 
+	// Protocol, if set, serves the plugins over a protocol registered with
+	// RegisterProtocol instead of net/rpc or gRPC, which are otherwise picked
+	// based on GRPCServer and the type of the plugins. The client must list
+	// the protocol in ClientConfig.AllowedProtocols.
+	Protocol Protocol
+
 	// Logger is used to pass a logger into the server. If none is provided the
-	// server will create a default logger.
+	// server will create a default logger, which is an hclog.InterceptLogger.
+	//
+	// If Logger is an hclog.InterceptLogger and the plugin is served over
+	// gRPC, its entries are streamed to the client with their types intact
+	// instead of being written to stderr as JSON for the client to parse.
+	// Clients that don't support this keep reading them from stderr.
 	Logger hclog.Logger
 
+	// OnShutdown, if non-nil, is called when the client asks the plugin to
+	// exit, before the server stops. Plugins can use it to flush state. The
+	// context is cancelled once the grace period granted by the client
+	// (ClientConfig.GracefulShutdownTimeout) runs out, after which the server
+	// is stopped regardless. net/rpc clients, and gRPC clients that predate
+	// grace periods, grant a default of 2 seconds.
+	OnShutdown func(context.Context) error
+
+	// Metadata describes the plugin to the host, which can retrieve it with
+	// Client.Metadata. This is optional; build information is reported even
+	// if it isn't set.
+	Metadata *PluginMetadata
+
+	// StdioBuffer configures how much of the plugin's stdout and stderr is
+	// buffered for the client when serving over gRPC, and what happens when
+	// the buffer is full. If it is nil, 64 KiB are buffered and writes block
+	// once they haven't been sent.
+	StdioBuffer *StdioBufferConfig
+
+	// Metrics, if non-nil, records the duration and result of every RPC
+	// call the plugin serves. See MetricsConfig. With gRPC, this relies on
+	// GRPCServer passing on the server options it is given.
+	Metrics *MetricsConfig
+
+	// Tracing, if non-nil, creates spans around broker negotiation and
+	// each call that carries a trace context. See TracingConfig, including
+	// how net/rpc calls are traced. With gRPC, this relies on GRPCServer
+	// passing on the server options it is given.
+	Tracing *TracingConfig
+
+	// Broker configures how long the plugin's broker waits for the client
+	// to accept or dial connections. See BrokerConfig.
+	Broker *BrokerConfig
+
 	// Test, if non-nil, will put plugin serving into "test mode". This is
 	// meant to be used as part of `go test` within a plugin's codebase to
 	// launch the plugin in-process and output a ReattachConfig.
@@ -127,6 +178,12 @@ type ServeTestConfig struct {
 	// server being shut down.
 	CloseCh chan<- struct{}
 
+	// GRPCBrokerMultiplex, if true, multiplexes the gRPC broker's
+	// connections over the plugin's listener, as if a client had requested
+	// it with ClientConfig.GRPCBrokerMultiplex. The ReattachConfig records
+	// it, so that clients reattaching multiplex too.
+	GRPCBrokerMultiplex bool
+
 	// SyncStdio, if true, will enable the client side "SyncStdout/Stderr"
 	// functionality to work. This defaults to false because the implementation
 	// of making this work within test environments is particularly messy
@@ -205,6 +262,10 @@ func protocolVersion(opts *ServeConfig) (int, Protocol, PluginSet) {
 			}
 		}
 
+		if opts.Protocol != ProtocolInvalid {
+			protoType = opts.Protocol
+		}
+
 		for _, clientVersion := range clientVersions {
 			if clientVersion == protoVersion {
 				return protoVersion, protoType, pluginSet
@@ -269,11 +330,18 @@ func Serve(opts *ServeConfig) {
 	// negotiate the version and plugins
 	// start with default version in the handshake config
 	protoVersion, protoType, pluginSet := protocolVersion(opts)
+	clientCaps := clientCapabilities()
+	if opts.Test != nil && opts.Test.GRPCBrokerMultiplex {
+		// There is no client to request it in test mode.
+		clientCaps[capabilityGRPCBrokerMultiplex] = "true"
+		clientCaps[capabilityGRPCBrokerMultiplexIDs] = "true"
+	}
 
 	logger := opts.Logger
 	if logger == nil {
-		// internal logger to os.Stderr
-		logger = hclog.New(&hclog.LoggerOptions{
+		// internal logger to os.Stderr, which is an InterceptLogger so that
+		// its entries can be streamed to the client
+		logger = hclog.NewInterceptLogger(&hclog.LoggerOptions{
 			Level:      hclog.Trace,
 			Output:     os.Stderr,
 			JSONFormat: true,
@@ -356,6 +424,21 @@ func Serve(opts *ServeConfig) {
 		os.Exit(1)
 	}
 
+	// Replace our stdin with one the client writes to over the RPC connection,
+	// if it asked to. Otherwise stdin is inherited from the client. Only the
+	// built-in protocols forward stdin, so it isn't advertised for others.
+	var stdin_w io.WriteCloser
+	var stdin_r *os.File
+	builtinProtocol := protoType == ProtocolNetRPC || protoType == ProtocolGRPC
+	if builtinProtocol && opts.Test == nil && clientCaps.Bool(capabilitySyncStdin) {
+		stdin_r, stdin_w, err = os.Pipe()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error preparing plugin: %s\n", err)
+			os.Exit(1)
+		}
+		os.Stdin = stdin_r
+	}
+
 	// If we're in test mode, we tee off the reader and write the data
 	// as-is to our normal Stdout and Stderr so that they continue working
 	// while stdio works. This is because in test mode, we assume we're running
@@ -369,47 +452,41 @@ func Serve(opts *ServeConfig) {
 		stderr_r = io.TeeReader(stderr_r, os.Stderr)
 	}
 
-	// Build the server type
-	var server ServerProtocol
-	switch protoType {
-	case ProtocolNetRPC:
-		// If we have a TLS configuration then we wrap the listener
-		// ourselves and do it at that level.
-		if tlsConfig != nil {
-			listener = tls.NewListener(listener, tlsConfig)
-		}
-
-		// Create the RPC server to dispense
-		server = &RPCServer{
-			Plugins: pluginSet,
-			Stdout:  stdout_r,
-			Stderr:  stderr_r,
-			DoneCh:  doneCh,
-		}
-
-	case ProtocolGRPC:
-		var muxer *grpcmux.GRPCServerMuxer
-		if multiplex, _ := strconv.ParseBool(os.Getenv(envMultiplexGRPC)); multiplex {
-			muxer = grpcmux.NewGRPCServerMuxer(logger, listener)
-			listener = muxer
-		}
-
-		// Create the gRPC server
-		server = &GRPCServer{
-			Plugins: pluginSet,
-			Server:  opts.GRPCServer,
-			TLS:     tlsConfig,
-			Stdout:  stdout_r,
-			Stderr:  stderr_r,
-			DoneCh:  doneCh,
-			logger:  logger,
-			muxer:   muxer,
-		}
+	// Stream the plugin's logs to the client over gRPC rather than stderr if
+	// both sides support it. This needs to happen before stderr is redirected
+	// below, so that the logger can fall back to the real stderr.
+	var logSink *grpcLogServer
+	if protoType == ProtocolGRPC && opts.Test == nil && clientCaps.Bool(capabilityGRPCLogSink) {
+		logSink = newGRPCLogServer(logger)
+	}
+	if logSink != nil {
+		defer logSink.Close()
+	}
 
-	default:
+	// Build the server type
+	factories, ok := registeredProtocol(protoType)
+	if !ok {
 		panic("unknown server protocol: " + protoType)
 	}
 
+	server, listener, err := factories.server(&ServerProtocolConfig{
+		ServeConfig: opts,
+		Plugins:     pluginSet,
+		Listener:    listener,
+		TLS:         tlsConfig,
+		Stdout:      stdout_r,
+		Stderr:      stderr_r,
+		Stdin:       stdin_w,
+		DoneCh:      doneCh,
+		Logger:      logger,
+		clientCaps:  clientCaps,
+		logSink:     logSink,
+	})
+	if err != nil {
+		logger.Error("protocol init", "error", err)
+		return
+	}
+
 	// Initialize the servers
 	if err := server.Init(); err != nil {
 		logger.Error("protocol init", "error", err)
@@ -423,23 +500,41 @@ func Serve(opts *ServeConfig) {
 	// attach via a reattach config.
 	if opts.Test == nil {
 		const grpcBrokerMultiplexingSupported = true
+		coreVersion := CoreProtocolVersion
+		for _, v := range clientCoreProtocolVersions() {
+			if v == CoreProtocolVersionCapabilities {
+				coreVersion = v
+			}
+		}
+
 		protocolLine := fmt.Sprintf("%d|%d|%s|%s|%s|%s",
-			CoreProtocolVersion,
+			coreVersion,
 			protoVersion,
 			listener.Addr().Network(),
 			listener.Addr().String(),
 			protoType,
 			serverCert)
 
-		// Old clients will error with new plugins if we blindly append the
-		// seventh segment for gRPC broker multiplexing support, because old
-		// client code uses strings.SplitN(line, "|", 6), which means a seventh
-		// segment will get appended to the sixth segment as "sixthpart|true".
-		//
-		// If the environment variable is set, we assume the client is new enough
-		// to handle a seventh segment, as it should now use
-		// strings.Split(line, "|") and always handle each segment individually.
-		if os.Getenv(envMultiplexGRPC) != "" {
+		if coreVersion == CoreProtocolVersionCapabilities {
+			// The client understands capabilities, so every feature is
+			// advertised in a single trailing segment that can grow without
+			// breaking anyone.
+			caps := capabilities{
+				capabilityGRPCBrokerMultiplex:    strconv.FormatBool(grpcBrokerMultiplexingSupported),
+				capabilityGRPCBrokerMultiplexIDs: strconv.FormatBool(grpcBrokerMultiplexingSupported),
+				capabilityGRPCLogSink:            strconv.FormatBool(logSink != nil),
+				capabilitySyncStdin:              strconv.FormatBool(stdin_w != nil),
+			}
+			protocolLine += "|" + caps.String()
+		} else if os.Getenv(envMultiplexGRPC) != "" {
+			// Old clients will error with new plugins if we blindly append the
+			// seventh segment for gRPC broker multiplexing support, because old
+			// client code uses strings.SplitN(line, "|", 6), which means a seventh
+			// segment will get appended to the sixth segment as "sixthpart|true".
+			//
+			// If the environment variable is set, we assume the client is new enough
+			// to handle a seventh segment, as it should now use
+			// strings.Split(line, "|") and always handle each segment individually.
 			protocolLine += fmt.Sprintf("|%v", grpcBrokerMultiplexingSupported)
 		}
 		fmt.Printf("%s\n", protocolLine)
@@ -448,12 +543,15 @@ func Serve(opts *ServeConfig) {
 		// Send back the reattach config that can be used. This isn't
 		// quite ready if they connect immediately but the client should
 		// retry a few times.
+		multiplex := protoType == ProtocolGRPC && clientCaps.Bool(capabilityGRPCBrokerMultiplex)
 		ch <- &ReattachConfig{
-			Protocol:        protoType,
-			ProtocolVersion: protoVersion,
-			Addr:            listener.Addr(),
-			Pid:             os.Getpid(),
-			Test:            true,
+			Protocol:               protoType,
+			ProtocolVersion:        protoVersion,
+			Addr:                   listener.Addr(),
+			Pid:                    os.Getpid(),
+			Test:                   true,
+			GRPCBrokerMultiplex:    multiplex,
+			GRPCBrokerMultiplexIDs: multiplex && clientCaps.Bool(capabilityGRPCBrokerMultiplexIDs),
 		}
 	}
 
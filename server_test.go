@@ -6,6 +6,8 @@ package plugin
 import (
 	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"log"
 	"net"
 	"os"
@@ -86,6 +88,158 @@ func TestServer_testMode(t *testing.T) {
 	t.Logf("HELLO")
 }
 
+// A client reattached in test mode doesn't see the plugin exit, so closing
+// it mustn't wait for that.
+func TestServer_testMode_grpcClose(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ch := make(chan *ReattachConfig, 1)
+	closeCh := make(chan struct{})
+	go Serve(&ServeConfig{
+		HandshakeConfig: testHandshake,
+		Plugins:         testGRPCPluginMap,
+		GRPCServer:      DefaultGRPCServer,
+		Test: &ServeTestConfig{
+			Context:          ctx,
+			ReattachConfigCh: ch,
+			CloseCh:          closeCh,
+		},
+	})
+	defer func() {
+		cancel()
+		<-closeCh
+	}()
+
+	var config *ReattachConfig
+	select {
+	case config = <-ch:
+	case <-time.After(2000 * time.Millisecond):
+		t.Fatal("should've received reattach")
+	}
+
+	c := NewClient(&ClientConfig{
+		HandshakeConfig:         testHandshake,
+		Plugins:                 testGRPCPluginMap,
+		Reattach:                config,
+		AllowedProtocols:        []Protocol{ProtocolGRPC},
+		GracefulShutdownTimeout: 10 * time.Second,
+	})
+	client, err := c.Client()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	start := time.Now()
+	if err := client.Close(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Fatalf("close waited %s", d)
+	}
+}
+
+func TestServer_testMode_grpcBrokerMultiplex(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ch := make(chan *ReattachConfig, 1)
+	closeCh := make(chan struct{})
+	go Serve(&ServeConfig{
+		HandshakeConfig: testHandshake,
+		Plugins:         testGRPCPluginMap,
+		GRPCServer:      DefaultGRPCServer,
+		Test: &ServeTestConfig{
+			Context:             ctx,
+			ReattachConfigCh:    ch,
+			CloseCh:             closeCh,
+			GRPCBrokerMultiplex: true,
+		},
+	})
+	defer func() {
+		cancel()
+		<-closeCh
+	}()
+
+	var config *ReattachConfig
+	select {
+	case config = <-ch:
+	case <-time.After(2000 * time.Millisecond):
+		t.Fatal("should've received reattach")
+	}
+	if !config.GRPCBrokerMultiplex || !config.GRPCBrokerMultiplexIDs {
+		t.Fatalf("bad: %#v", config)
+	}
+
+	// Reattach from the JSON form, as another process would.
+	data, err := json.Marshal(config)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	var decoded ReattachConfig
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// A client that goes away is replaced by the next one that reattaches.
+	for i := 0; i < 2; i++ {
+		reattach := decoded
+		c := NewClient(&ClientConfig{
+			HandshakeConfig:  testHandshake,
+			Plugins:          testGRPCPluginMap,
+			Reattach:         &reattach,
+			AllowedProtocols: []Protocol{ProtocolGRPC},
+		})
+		client, err := c.Client()
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if c.grpcMuxer == nil {
+			t.Fatal("should be multiplexed")
+		}
+
+		raw, err := client.Dispense("test")
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		tester := raw.(testInterface)
+		if n := tester.Double(3); n != 6 {
+			t.Fatalf("bad: %d", n)
+		}
+
+		// Brokered servers on both sides are multiplexed too. The plugin's
+		// broker ends with the first client's broker stream, so this is
+		// only checked once.
+		if i == 0 {
+			if err := tester.Bidirectional(); err != nil {
+				t.Fatalf("err: %s", err)
+			}
+		}
+
+		if rc := c.ReattachConfig(); !rc.GRPCBrokerMultiplex || !rc.GRPCBrokerMultiplexIDs {
+			t.Fatalf("bad: %#v", rc)
+		}
+
+		// Test mode clients don't close their connection on Kill, so go
+		// away like a host process that exited.
+		c.grpcMuxer.Close()
+	}
+
+	// Requiring multiplexing from a plugin that doesn't multiplex fails.
+	reattach := decoded
+	reattach.GRPCBrokerMultiplex = false
+	c := NewClient(&ClientConfig{
+		HandshakeConfig:     testHandshake,
+		Plugins:             testGRPCPluginMap,
+		Reattach:            &reattach,
+		AllowedProtocols:    []Protocol{ProtocolGRPC},
+		GRPCBrokerMultiplex: true,
+	})
+	if _, err := c.Start(); !errors.Is(err, ErrGRPCBrokerMuxNotSupported) {
+		t.Fatalf("expected %s, but got %v", ErrGRPCBrokerMuxNotSupported, err)
+	}
+}
+
 func TestServer_testMode_AutoMTLS(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
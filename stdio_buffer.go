@@ -0,0 +1,195 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"sync"
+
+	"github.com/hashicorp/go-plugin/internal/plugin"
+)
+
+// defaultStdioBufferSize is the default for StdioBufferConfig.Size.
+const defaultStdioBufferSize = 64 * 1024
+
+// StdioOverflow is what a plugin does when its stdio buffer is full of data
+// that hasn't been sent to a client yet. See StdioBufferConfig.
+type StdioOverflow int
+
+const (
+	// StdioOverflowBlock blocks writes to stdout and stderr until the data
+	// has been sent to a client. This is the default.
+	StdioOverflowBlock StdioOverflow = iota
+
+	// StdioOverflowDropOldest drops the oldest buffered data to make room.
+	StdioOverflowDropOldest
+
+	// StdioOverflowDropNewest drops the data being written.
+	StdioOverflowDropNewest
+)
+
+func (o StdioOverflow) String() string {
+	switch o {
+	case StdioOverflowBlock:
+		return "block"
+	case StdioOverflowDropOldest:
+		return "drop-oldest"
+	case StdioOverflowDropNewest:
+		return "drop-newest"
+	default:
+		return "unknown"
+	}
+}
+
+// StdioBufferConfig configures how much of a gRPC plugin's stdout and stderr
+// is buffered for the client.
+//
+// Data is kept in the buffer after it was sent, so that a client that
+// reconnects or reattaches can resume from where it left off, see
+// ReattachConfig.StdioSequence. Data that was sent is dropped first to make
+// room. Overflow only applies once the buffer is full of data that hasn't
+// been sent to a client yet.
+type StdioBufferConfig struct {
+	// Size is the number of bytes buffered. If it is zero, it defaults to
+	// 64 KiB.
+	Size int
+
+	// Overflow is what happens when the buffer is full.
+	Overflow StdioOverflow
+}
+
+// stdioBuffer buffers sequenced chunks of stdout and stderr for
+// grpcStdioServer.
+type stdioBuffer struct {
+	size     int
+	overflow StdioOverflow
+
+	l      sync.Mutex
+	chunks []*plugin.StdioData
+	bytes  int
+
+	// next is the sequence number of the next chunk, and sent the highest
+	// sequence number sent to a client.
+	next uint64
+	sent uint64
+
+	// changedCh is closed and replaced whenever a chunk is added or sent.
+	changedCh chan struct{}
+	closed    bool
+}
+
+func newStdioBuffer(config *StdioBufferConfig) *stdioBuffer {
+	b := &stdioBuffer{
+		size:      defaultStdioBufferSize,
+		next:      1,
+		changedCh: make(chan struct{}),
+	}
+	if config != nil {
+		if config.Size > 0 {
+			b.size = config.Size
+		}
+		b.overflow = config.Overflow
+	}
+
+	return b
+}
+
+// write adds a chunk of data, applying the overflow policy if the buffer is
+// full. With StdioOverflowBlock it blocks until there is room or the buffer
+// is closed. data must not be modified afterwards.
+func (b *stdioBuffer) write(channel plugin.StdioData_Channel, data []byte) {
+	b.l.Lock()
+	defer b.l.Unlock()
+
+	for len(b.chunks) > 0 && b.bytes+len(data) > b.size {
+		if b.closed {
+			return
+		}
+
+		// Chunks that were sent can always be dropped.
+		if b.chunks[0].Sequence <= b.sent {
+			b.dropOldest()
+			continue
+		}
+
+		switch b.overflow {
+		case StdioOverflowDropOldest:
+			b.dropOldest()
+
+		case StdioOverflowDropNewest:
+			// The chunk still takes a sequence number, so that clients see
+			// the gap.
+			b.next++
+			return
+
+		default:
+			changedCh := b.changedCh
+			b.l.Unlock()
+			<-changedCh
+			b.l.Lock()
+		}
+	}
+	if b.closed {
+		return
+	}
+
+	b.chunks = append(b.chunks, &plugin.StdioData{
+		Channel:  channel,
+		Data:     data,
+		Sequence: b.next,
+	})
+	b.bytes += len(data)
+	b.next++
+	b.changed()
+}
+
+// since returns the buffered chunks with a sequence number of at least from,
+// and a channel that is closed once there are more or the buffer is closed.
+// The chunks must not be modified.
+func (b *stdioBuffer) since(from uint64) ([]*plugin.StdioData, <-chan struct{}) {
+	b.l.Lock()
+	defer b.l.Unlock()
+
+	i := len(b.chunks)
+	for i > 0 && b.chunks[i-1].Sequence >= from {
+		i--
+	}
+
+	return b.chunks[i:len(b.chunks):len(b.chunks)], b.changedCh
+}
+
+// markSent records that the chunk with the given sequence number, and those
+// before it, were sent to a client.
+func (b *stdioBuffer) markSent(sequence uint64) {
+	b.l.Lock()
+	defer b.l.Unlock()
+
+	if sequence > b.sent {
+		b.sent = sequence
+		b.changed()
+	}
+}
+
+// Close unblocks any writers. Data written afterwards is dropped.
+func (b *stdioBuffer) Close() {
+	b.l.Lock()
+	defer b.l.Unlock()
+
+	if !b.closed {
+		b.closed = true
+		b.changed()
+	}
+}
+
+// dropOldest drops the oldest chunk. The lock must be held.
+func (b *stdioBuffer) dropOldest() {
+	b.bytes -= len(b.chunks[0].Data)
+	b.chunks[0] = nil
+	b.chunks = b.chunks[1:]
+}
+
+// changed wakes up anyone waiting on changedCh. The lock must be held.
+func (b *stdioBuffer) changed() {
+	close(b.changedCh)
+	b.changedCh = make(chan struct{})
+}
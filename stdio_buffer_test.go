@@ -0,0 +1,142 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-plugin/internal/plugin"
+)
+
+// stdioChunks returns the sequence numbers and data of the buffered chunks
+// from the given sequence number.
+func stdioChunks(b *stdioBuffer, from uint64) ([]uint64, string) {
+	chunks, _ := b.since(from)
+
+	var sequences []uint64
+	var data string
+	for _, c := range chunks {
+		sequences = append(sequences, c.Sequence)
+		data += string(c.Data)
+	}
+
+	return sequences, data
+}
+
+func TestStdioBuffer_since(t *testing.T) {
+	b := newStdioBuffer(nil)
+	b.write(plugin.StdioData_STDOUT, []byte("a"))
+	b.write(plugin.StdioData_STDERR, []byte("b"))
+	b.write(plugin.StdioData_STDOUT, []byte("c"))
+
+	for from, expected := range map[uint64]string{
+		0: "abc",
+		1: "abc",
+		2: "bc",
+		3: "c",
+		4: "",
+	} {
+		if _, data := stdioChunks(b, from); data != expected {
+			t.Fatalf("from %d: bad: %q", from, data)
+		}
+	}
+
+	_, changedCh := b.since(4)
+	b.write(plugin.StdioData_STDOUT, []byte("d"))
+	select {
+	case <-changedCh:
+	default:
+		t.Fatal("expected a change to be signaled")
+	}
+}
+
+func TestStdioBuffer_overflow(t *testing.T) {
+	for _, tc := range []struct {
+		overflow  StdioOverflow
+		sequences []uint64
+		data      string
+	}{
+		{StdioOverflowDropOldest, []uint64{2, 3}, "cdef"},
+		{StdioOverflowDropNewest, []uint64{1, 2}, "abcd"},
+	} {
+		t.Run(tc.overflow.String(), func(t *testing.T) {
+			b := newStdioBuffer(&StdioBufferConfig{Size: 4, Overflow: tc.overflow})
+			b.write(plugin.StdioData_STDOUT, []byte("ab"))
+			b.write(plugin.StdioData_STDOUT, []byte("cd"))
+			b.write(plugin.StdioData_STDOUT, []byte("ef"))
+
+			sequences, data := stdioChunks(b, 0)
+			if !reflect.DeepEqual(sequences, tc.sequences) || data != tc.data {
+				t.Fatalf("bad: %v %q", sequences, data)
+			}
+
+			// Dropped chunks still use up a sequence number.
+			b.markSent(3)
+			b.write(plugin.StdioData_STDOUT, []byte("g"))
+			if sequences, _ := stdioChunks(b, 4); !reflect.DeepEqual(sequences, []uint64{4}) {
+				t.Fatalf("bad: %v", sequences)
+			}
+		})
+	}
+}
+
+func TestStdioBuffer_overflowSent(t *testing.T) {
+	// Chunks that were sent are dropped to make room, whatever the policy.
+	b := newStdioBuffer(&StdioBufferConfig{Size: 4, Overflow: StdioOverflowDropNewest})
+	b.write(plugin.StdioData_STDOUT, []byte("ab"))
+	b.write(plugin.StdioData_STDOUT, []byte("cd"))
+	b.markSent(1)
+	b.write(plugin.StdioData_STDOUT, []byte("ef"))
+
+	if _, data := stdioChunks(b, 0); data != "cdef" {
+		t.Fatalf("bad: %q", data)
+	}
+}
+
+func TestStdioBuffer_overflowBlock(t *testing.T) {
+	b := newStdioBuffer(&StdioBufferConfig{Size: 4})
+	b.write(plugin.StdioData_STDOUT, []byte("ab"))
+	b.write(plugin.StdioData_STDOUT, []byte("cd"))
+
+	doneCh := make(chan struct{})
+	go func() {
+		defer close(doneCh)
+		b.write(plugin.StdioData_STDOUT, []byte("ef"))
+	}()
+
+	select {
+	case <-doneCh:
+		t.Fatal("write should block until data is sent")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	b.markSent(1)
+	select {
+	case <-doneCh:
+	case <-time.After(5 * time.Second):
+		t.Fatal("write should have unblocked")
+	}
+	if _, data := stdioChunks(b, 0); data != "cdef" {
+		t.Fatalf("bad: %q", data)
+	}
+
+	// Closing unblocks writers, and drops what they write.
+	closedCh := make(chan struct{})
+	go func() {
+		defer close(closedCh)
+		b.write(plugin.StdioData_STDOUT, []byte("gh"))
+	}()
+	time.Sleep(50 * time.Millisecond)
+	b.Close()
+	select {
+	case <-closedCh:
+	case <-time.After(5 * time.Second):
+		t.Fatal("write should have unblocked")
+	}
+	if _, data := stdioChunks(b, 0); data != "cdef" {
+		t.Fatalf("bad: %q", data)
+	}
+}
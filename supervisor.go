@@ -0,0 +1,424 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+// ErrRestartBudgetExhausted is returned by Supervisor.Err when the plugin
+// crashed more often than RestartPolicy.MaxRestarts allows and the supervisor
+// stopped restarting it.
+var ErrRestartBudgetExhausted = errors.New("plugin restart budget exhausted")
+
+const (
+	defaultRestartInitialBackoff = 1 * time.Second
+	defaultRestartMaxBackoff     = 30 * time.Second
+	defaultRestartMultiplier     = 2.0
+)
+
+// RestartPolicy configures how a Supervisor relaunches a plugin that exited
+// without being asked to.
+type RestartPolicy struct {
+	// MaxRestarts is the number of restarts allowed before the supervisor
+	// gives up. Crashes separated by more than ResetAfter are not counted
+	// against this budget. If this is 0, the plugin is restarted forever.
+	MaxRestarts int
+
+	// InitialBackoff is the delay before the first restart attempt. Each
+	// further consecutive attempt multiplies the delay by Multiplier, up to
+	// MaxBackoff. These default to 1 second, 30 seconds and 2 respectively.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+
+	// ResetAfter, if non-zero, is how long a plugin must have been running
+	// for a crash to no longer be counted as consecutive with the previous
+	// one. When a plugin that ran at least this long exits, the restart
+	// count and backoff start over.
+	ResetAfter time.Duration
+
+	// RestartOnCleanExit restarts a plugin that exits with code 0 like one
+	// that crashed. By default, a clean exit is taken to mean the plugin is
+	// done: the supervisor stops without an error, and Done is closed.
+	RestartOnCleanExit bool
+}
+
+// backoff returns the delay before the given restart attempt, starting at 1.
+func (p *RestartPolicy) backoff(attempt int) time.Duration {
+	d := float64(p.InitialBackoff) * math.Pow(p.Multiplier, float64(attempt-1))
+	if d > float64(p.MaxBackoff) {
+		return p.MaxBackoff
+	}
+
+	return time.Duration(d)
+}
+
+// RestartEvent describes a plugin crash observed by a Supervisor and what the
+// supervisor is doing about it.
+type RestartEvent struct {
+	// Attempt is the number of consecutive restarts including this one.
+	Attempt int
+
+	// Backoff is how long the supervisor waits before relaunching.
+	Backoff time.Duration
+
+	// Generation is the generation of the client that exited. Every
+	// successful restart increments the generation by one.
+	Generation uint64
+
+	// Err is the reason for the restart. This is the start error if the
+	// previous restart attempt failed, or nil if the plugin simply exited.
+	Err error
+
+	// GaveUp is true if the restart budget is exhausted and the plugin will
+	// not be relaunched again.
+	GaveUp bool
+}
+
+// SupervisorConfig is the configuration used to initialize a new Supervisor.
+type SupervisorConfig struct {
+	// ClientConfig must return a new ClientConfig every time it is called.
+	// A fresh configuration is required for every launch since an exec.Cmd
+	// can only be started once. Reattach configurations are not supported.
+	ClientConfig func() *ClientConfig
+
+	// RestartPolicy controls restart backoff and the restart budget.
+	RestartPolicy RestartPolicy
+
+	// OnRestart, if non-nil, is called every time the supervisor notices the
+	// plugin has exited, before waiting for the backoff. It is called from the
+	// supervisor's own goroutine and should not block.
+	OnRestart func(RestartEvent)
+
+	// Logger is used for the supervisor's own logs. If none is provided, the
+	// logger of the first ClientConfig is used.
+	Logger hclog.Logger
+}
+
+// Supervisor keeps a plugin running. It wraps a Client, and when the plugin
+// process crashes, it launches a new Client with exponential backoff until
+// RestartPolicy.MaxRestarts is reached. A plugin that exits cleanly is only
+// restarted if RestartPolicy.RestartOnCleanExit is set.
+//
+// Interfaces dispensed from a crashed plugin stop working, so callers should
+// fetch implementations through Dispense every time they need one instead of
+// holding on to them. Dispense caches the implementation per generation, so
+// this is cheap.
+type Supervisor struct {
+	config *SupervisorConfig
+	logger hclog.Logger
+
+	l          sync.Mutex
+	started    bool
+	client     *Client
+	generation uint64
+	dispensed  map[string]interface{}
+	err        error
+
+	stopCh   chan struct{}
+	stopOnce sync.Once
+	doneCh   chan struct{}
+}
+
+// NewSupervisor creates a new Supervisor. The plugin is not launched until
+// Start is called.
+func NewSupervisor(config *SupervisorConfig) *Supervisor {
+	// Fill in the defaults on a copy, leaving the caller's config alone.
+	configCopy := *config
+	config = &configCopy
+
+	policy := &config.RestartPolicy
+	if policy.InitialBackoff == 0 {
+		policy.InitialBackoff = defaultRestartInitialBackoff
+	}
+	if policy.MaxBackoff == 0 {
+		policy.MaxBackoff = defaultRestartMaxBackoff
+	}
+	if policy.Multiplier == 0 {
+		policy.Multiplier = defaultRestartMultiplier
+	}
+
+	return &Supervisor{
+		config:    config,
+		logger:    config.Logger,
+		dispensed: make(map[string]interface{}),
+		stopCh:    make(chan struct{}),
+		doneCh:    make(chan struct{}),
+	}
+}
+
+// Start launches the plugin and begins supervising it. Errors launching the
+// plugin the first time are returned directly and are not retried.
+//
+// Start must only be called once.
+func (s *Supervisor) Start() error {
+	s.l.Lock()
+	s.started = true
+	s.l.Unlock()
+
+	client, err := s.launch()
+	if err != nil {
+		close(s.doneCh)
+		return err
+	}
+
+	s.l.Lock()
+	s.client = client
+	if s.logger == nil {
+		s.logger = client.logger.Named("supervisor")
+	}
+	s.l.Unlock()
+
+	go s.run(client)
+	return nil
+}
+
+// Client returns the client for the currently running plugin. This returns
+// nil before Start is called, and may return a client that has exited while a
+// restart is pending.
+func (s *Supervisor) Client() *Client {
+	s.l.Lock()
+	defer s.l.Unlock()
+	return s.client
+}
+
+// Generation returns the number of times the plugin has been successfully
+// restarted.
+func (s *Supervisor) Generation() uint64 {
+	s.l.Lock()
+	defer s.l.Unlock()
+	return s.generation
+}
+
+// Dispense returns an implementation of the named plugin from the currently
+// running plugin process. The implementation is cached until the plugin is
+// restarted, after which a fresh one is dispensed.
+func (s *Supervisor) Dispense(name string) (interface{}, error) {
+	s.l.Lock()
+	client, generation := s.client, s.generation
+	raw, ok := s.dispensed[name]
+	s.l.Unlock()
+
+	if client == nil {
+		return nil, errors.New("supervisor has not been started")
+	}
+	if ok {
+		return raw, nil
+	}
+
+	return s.dispense(client, generation, name)
+}
+
+// dispense dispenses the named plugin from client, which is the given
+// generation. The lock isn't held during the RPC, so that a slow dispense
+// doesn't block Kill or restarts. The implementation is only cached if the
+// plugin wasn't restarted in the meantime.
+func (s *Supervisor) dispense(client *Client, generation uint64, name string) (interface{}, error) {
+	rpcClient, err := client.Client()
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := rpcClient.Dispense(name)
+	if err != nil {
+		return nil, err
+	}
+
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	if s.generation == generation {
+		if cached, ok := s.dispensed[name]; ok {
+			// Another caller dispensed it first.
+			return cached, nil
+		}
+		s.dispensed[name] = raw
+	}
+
+	return raw, nil
+}
+
+// Done returns a channel that is closed once the supervisor has stopped,
+// either because Kill was called, the restart budget is exhausted, or the
+// plugin exited cleanly without RestartPolicy.RestartOnCleanExit.
+func (s *Supervisor) Done() <-chan struct{} {
+	return s.doneCh
+}
+
+// Err returns the reason the supervisor stopped restarting the plugin, if it
+// gave up on its own.
+func (s *Supervisor) Err() error {
+	s.l.Lock()
+	defer s.l.Unlock()
+	return s.err
+}
+
+// Kill stops supervising and kills the current plugin process. It blocks
+// until the supervisor has stopped, including while Start is still
+// launching the plugin.
+//
+// This method can safely be called multiple times.
+func (s *Supervisor) Kill() {
+	s.stopOnce.Do(func() {
+		close(s.stopCh)
+	})
+
+	s.l.Lock()
+	started := s.started
+	s.l.Unlock()
+	if !started {
+		return
+	}
+
+	// The supervisor kills the current plugin process once it stops.
+	<-s.doneCh
+}
+
+func (s *Supervisor) launch() (*Client, error) {
+	config := s.config.ClientConfig()
+	if config.Reattach != nil {
+		return nil, errors.New("supervised clients cannot use Reattach")
+	}
+
+	client := NewClient(config)
+	if _, err := client.Start(); err != nil {
+		client.Kill()
+		return nil, err
+	}
+
+	return client, nil
+}
+
+// run waits for the plugin to exit and restarts it. It returns once the
+// supervisor is killed or gives up.
+func (s *Supervisor) run(client *Client) {
+	defer close(s.doneCh)
+
+	attempt := 0
+	for {
+		startedAt := time.Now()
+		select {
+		case <-s.stopCh:
+			client.Kill()
+			return
+		case <-client.doneCtx.Done():
+		}
+
+		// Clean up whatever is left of the old process before relaunching.
+		client.Kill()
+
+		policy := s.config.RestartPolicy
+		if !policy.RestartOnCleanExit && client.ExitStatus() == nil {
+			s.logger.Info("plugin exited cleanly, not restarting")
+			return
+		}
+		if policy.ResetAfter > 0 && time.Since(startedAt) >= policy.ResetAfter {
+			attempt = 0
+		}
+
+		var err error
+		client, err = s.restart(&attempt)
+		if err != nil {
+			s.l.Lock()
+			s.err = err
+			s.l.Unlock()
+			return
+		}
+		if client == nil {
+			return
+		}
+	}
+}
+
+// restart relaunches the plugin with backoff until it succeeds, the budget
+// is exhausted, or the supervisor is killed. A nil client and nil error mean
+// the supervisor was killed.
+func (s *Supervisor) restart(attempt *int) (*Client, error) {
+	policy := s.config.RestartPolicy
+	var lastErr error
+	for {
+		*attempt++
+		generation := s.Generation()
+
+		if policy.MaxRestarts > 0 && *attempt > policy.MaxRestarts {
+			s.logger.Error("plugin restart budget exhausted, giving up", "restarts", policy.MaxRestarts)
+			s.publish(RestartEvent{
+				Attempt:    *attempt,
+				Generation: generation,
+				Err:        lastErr,
+				GaveUp:     true,
+			})
+			return nil, fmt.Errorf("%w after %d restarts", ErrRestartBudgetExhausted, policy.MaxRestarts)
+		}
+
+		backoff := policy.backoff(*attempt)
+		s.logger.Warn("plugin exited unexpectedly, restarting", "attempt", *attempt, "backoff", backoff)
+		s.publish(RestartEvent{
+			Attempt:    *attempt,
+			Backoff:    backoff,
+			Generation: generation,
+			Err:        lastErr,
+		})
+
+		select {
+		case <-s.stopCh:
+			return nil, nil
+		case <-time.After(backoff):
+		}
+
+		client, err := s.launch()
+		if err != nil {
+			s.logger.Error("failed to restart plugin", "attempt", *attempt, "error", err)
+			lastErr = err
+			continue
+		}
+
+		s.l.Lock()
+		// Kill may have been called while we were launching, in which case
+		// the new client must not outlive the supervisor.
+		select {
+		case <-s.stopCh:
+			s.l.Unlock()
+			client.Kill()
+			return nil, nil
+		default:
+		}
+
+		names := make([]string, 0, len(s.dispensed))
+		for name := range s.dispensed {
+			names = append(names, name)
+		}
+
+		s.client = client
+		s.generation++
+		s.dispensed = make(map[string]interface{})
+		generation = s.generation
+		s.l.Unlock()
+
+		s.logger.Info("plugin restarted", "generation", generation)
+
+		// Re-dispense everything that was in use so callers get working
+		// implementations immediately.
+		for _, name := range names {
+			if _, err := s.dispense(client, generation, name); err != nil {
+				s.logger.Warn("failed to re-dispense plugin after restart", "name", name, "error", err)
+			}
+		}
+
+		return client, nil
+	}
+}
+
+func (s *Supervisor) publish(event RestartEvent) {
+	if s.config.OnRestart != nil {
+		s.config.OnRestart(event)
+	}
+}
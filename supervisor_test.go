@@ -0,0 +1,242 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func testSupervisorConfig(policy RestartPolicy, events chan<- RestartEvent) *SupervisorConfig {
+	return &SupervisorConfig{
+		ClientConfig: func() *ClientConfig {
+			return &ClientConfig{
+				Cmd:              helperProcess("test-grpc"),
+				HandshakeConfig:  testHandshake,
+				Plugins:          testGRPCPluginMap,
+				AllowedProtocols: []Protocol{ProtocolGRPC},
+			}
+		},
+		RestartPolicy: policy,
+		OnRestart: func(e RestartEvent) {
+			events <- e
+		},
+	}
+}
+
+func TestSupervisor_restart(t *testing.T) {
+	events := make(chan RestartEvent, 10)
+	s := NewSupervisor(testSupervisorConfig(RestartPolicy{
+		InitialBackoff: 10 * time.Millisecond,
+	}, events))
+	if err := s.Start(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer s.Kill()
+
+	raw, err := s.Dispense("test")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if result := raw.(testInterface).Double(21); result != 42 {
+		t.Fatalf("bad: %#v", result)
+	}
+
+	// Simulate a crash
+	first := s.Client()
+	first.runner.Kill(context.Background())
+
+	select {
+	case e := <-events:
+		if e.Attempt != 1 || e.Generation != 0 || e.GaveUp {
+			t.Fatalf("bad event: %#v", e)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no restart event")
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for s.Generation() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("plugin was not restarted")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if s.Client() == first {
+		t.Fatal("expected a new client after restart")
+	}
+
+	raw, err = s.Dispense("test")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if result := raw.(testInterface).Double(4); result != 8 {
+		t.Fatalf("bad: %#v", result)
+	}
+
+	// Killing the supervisor must not trigger a restart
+	client := s.Client()
+	s.Kill()
+	if !client.Exited() {
+		t.Fatal("should say client has exited")
+	}
+	select {
+	case e := <-events:
+		t.Fatalf("unexpected event: %#v", e)
+	default:
+	}
+}
+
+// Killing the supervisor while Start is launching the plugin kills the plugin
+// it launched.
+func TestSupervisor_killDuringStart(t *testing.T) {
+	config := testSupervisorConfig(RestartPolicy{}, nil)
+	launching := make(chan struct{})
+	clientConfig := config.ClientConfig
+	config.ClientConfig = func() *ClientConfig {
+		close(launching)
+		return clientConfig()
+	}
+	s := NewSupervisor(config)
+
+	startErr := make(chan error, 1)
+	go func() {
+		startErr <- s.Start()
+	}()
+
+	<-launching
+	s.Kill()
+	if err := <-startErr; err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	client := s.Client()
+	if client == nil {
+		t.Fatal("expected a client")
+	}
+	if !client.Exited() {
+		t.Fatal("should say client has exited")
+	}
+}
+
+func TestSupervisor_budgetExhausted(t *testing.T) {
+	events := make(chan RestartEvent, 10)
+	s := NewSupervisor(testSupervisorConfig(RestartPolicy{
+		MaxRestarts:    1,
+		InitialBackoff: 10 * time.Millisecond,
+	}, events))
+	if err := s.Start(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer s.Kill()
+
+	s.Client().runner.Kill(context.Background())
+	select {
+	case <-events:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no restart event")
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for s.Generation() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("plugin was not restarted")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	s.Client().runner.Kill(context.Background())
+	select {
+	case e := <-events:
+		if !e.GaveUp {
+			t.Fatalf("expected supervisor to give up: %#v", e)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no restart event")
+	}
+
+	select {
+	case <-s.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("supervisor should have stopped")
+	}
+
+	if err := s.Err(); !errors.Is(err, ErrRestartBudgetExhausted) {
+		t.Fatalf("bad: %v", err)
+	}
+}
+
+func TestSupervisor_cleanExit(t *testing.T) {
+	for _, restart := range []bool{false, true} {
+		events := make(chan RestartEvent, 10)
+		s := NewSupervisor(testSupervisorConfig(RestartPolicy{
+			InitialBackoff:     10 * time.Millisecond,
+			RestartOnCleanExit: restart,
+		}, events))
+		if err := s.Start(); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		// Killing the client directly shuts the plugin down gracefully, so
+		// it exits with code 0.
+		s.Client().Kill()
+
+		if restart {
+			deadline := time.Now().Add(10 * time.Second)
+			for s.Generation() != 1 {
+				if time.Now().After(deadline) {
+					t.Fatal("plugin was not restarted")
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+		} else {
+			select {
+			case <-s.Done():
+			case <-time.After(5 * time.Second):
+				t.Fatal("supervisor should have stopped")
+			}
+			if err := s.Err(); err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			select {
+			case e := <-events:
+				t.Fatalf("unexpected event: %#v", e)
+			default:
+			}
+		}
+
+		s.Kill()
+	}
+}
+
+func TestNewSupervisor_configUnchanged(t *testing.T) {
+	config := testSupervisorConfig(RestartPolicy{}, nil)
+	NewSupervisor(config)
+
+	if config.RestartPolicy != (RestartPolicy{}) {
+		t.Fatalf("config was modified: %#v", config.RestartPolicy)
+	}
+}
+
+func TestRestartPolicy_backoff(t *testing.T) {
+	p := RestartPolicy{
+		InitialBackoff: time.Second,
+		MaxBackoff:     5 * time.Second,
+		Multiplier:     2,
+	}
+
+	for attempt, expected := range map[int]time.Duration{
+		1: time.Second,
+		2: 2 * time.Second,
+		3: 4 * time.Second,
+		4: 5 * time.Second,
+	} {
+		if actual := p.backoff(attempt); actual != expected {
+			t.Fatalf("attempt %d: expected %s, got %s", attempt, expected, actual)
+		}
+	}
+}
@@ -149,7 +149,7 @@ func TestPluginGRPCConn(t testing.T, multiplex bool, ps map[string]Plugin) (*GRP
 	// Start up the server
 	var muxer *grpcmux.GRPCServerMuxer
 	if multiplex {
-		muxer = grpcmux.NewGRPCServerMuxer(logger, ln)
+		muxer = grpcmux.NewGRPCServerMuxer(logger, ln, true)
 		ln = muxer
 	}
 	server := &GRPCServer{
@@ -175,8 +175,14 @@ func TestPluginGRPCConn(t testing.T, multiplex bool, ps map[string]Plugin) (*GRP
 		},
 		logger: logger,
 	}
+	if multiplex {
+		client.serverCapabilities = capabilities{
+			capabilityGRPCBrokerMultiplex:    "true",
+			capabilityGRPCBrokerMultiplexIDs: "true",
+		}
+	}
 
-	grpcClient, err := newGRPCClient(context.Background(), client)
+	grpcClient, err := newGRPCClient(context.Background(), context.Background(), client)
 	if err != nil {
 		t.Fatal(err)
 	}
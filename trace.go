@@ -0,0 +1,379 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// The W3C trace context headers, which are also the gRPC metadata keys the
+// trace context is propagated in.
+const (
+	traceparentHeader = "traceparent"
+	tracestateHeader  = "tracestate"
+)
+
+// TraceFlagsSampled is the W3C trace flag that marks a trace as sampled.
+const TraceFlagsSampled byte = 0x01
+
+// TraceContext is a W3C trace context, which go-plugin propagates from the
+// host to the plugin and back.
+//
+// go-plugin doesn't depend on a tracing library. Hosts put the context of
+// their current span into the context.Context they pass to go-plugin with
+// ContextWithTraceContext, and plugins retrieve it in their gRPC handlers
+// with TraceContextFromContext, which bridges to OpenTelemetry or any other
+// library that understands W3C trace context. Since the context is
+// propagated in the standard "traceparent" and "tracestate" gRPC metadata,
+// OpenTelemetry's own gRPC instrumentation picks it up as well.
+type TraceContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Flags   byte
+
+	// State is the tracestate header, passed on as-is.
+	State string
+}
+
+// IsValid returns true if the trace and span IDs are set.
+func (t TraceContext) IsValid() bool {
+	return t.TraceID != [16]byte{} && t.SpanID != [8]byte{}
+}
+
+// Traceparent formats the trace context as a traceparent header.
+func (t TraceContext) Traceparent() string {
+	return fmt.Sprintf("00-%x-%x-%02x", t.TraceID, t.SpanID, t.Flags)
+}
+
+// ParseTraceparent parses a traceparent header and the accompanying
+// tracestate header, which may be empty.
+func ParseTraceparent(traceparent, tracestate string) (TraceContext, error) {
+	var t TraceContext
+
+	parts := strings.Split(strings.TrimSpace(traceparent), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return t, fmt.Errorf("invalid traceparent %q", traceparent)
+	}
+	// Future versions may append fields, but version 00 has exactly four.
+	if parts[0] == "00" && len(parts) != 4 {
+		return t, fmt.Errorf("invalid traceparent %q", traceparent)
+	}
+
+	var flags [1]byte
+	for _, f := range []struct {
+		dst []byte
+		src string
+	}{
+		{t.TraceID[:], parts[1]},
+		{t.SpanID[:], parts[2]},
+		{flags[:], parts[3]},
+	} {
+		if len(f.src) != hex.EncodedLen(len(f.dst)) || strings.ToLower(f.src) != f.src {
+			return TraceContext{}, fmt.Errorf("invalid traceparent %q", traceparent)
+		}
+		if _, err := hex.Decode(f.dst, []byte(f.src)); err != nil {
+			return TraceContext{}, fmt.Errorf("invalid traceparent %q: %w", traceparent, err)
+		}
+	}
+	t.Flags = flags[0]
+	t.State = tracestate
+
+	if !t.IsValid() {
+		return TraceContext{}, fmt.Errorf("invalid traceparent %q: zero trace or span ID", traceparent)
+	}
+
+	return t, nil
+}
+
+type traceContextKey struct{}
+
+// ContextWithTraceContext returns a copy of ctx carrying the given trace
+// context, which go-plugin propagates to the plugin on calls made with it.
+func ContextWithTraceContext(ctx context.Context, t TraceContext) context.Context {
+	return context.WithValue(ctx, traceContextKey{}, t)
+}
+
+// TraceContextFromContext returns the trace context ctx carries, if any. In a
+// plugin's gRPC handlers, this is the trace context propagated by the host,
+// or the span go-plugin created for the call if ServeConfig.Tracing is set.
+func TraceContextFromContext(ctx context.Context) (TraceContext, bool) {
+	t, ok := ctx.Value(traceContextKey{}).(TraceContext)
+	return t, ok && t.IsValid()
+}
+
+// TracingConfig configures the spans go-plugin creates, set with
+// ClientConfig.Tracing on the host and ServeConfig.Tracing in the plugin.
+//
+// On the host, spans are created around the handshake with the plugin,
+// dispensing plugins and broker negotiation. In the plugin, spans are
+// created around broker negotiation and for each call that carries a trace
+// context. Trace context is propagated whether or not this is set.
+//
+// With net/rpc, whose calls don't take a context, tracing is scoped to the
+// dispense: every call made with a client dispensed with DispenseContext
+// carries the trace context of the ctx it was dispensed with, not that of the
+// span current when the call is made.
+// The spans the plugin creates for those calls are exported, but net/rpc
+// handlers don't take a context either, so they can't see them. To trace
+// calls individually, dispense a client for each operation, or use gRPC.
+type TracingConfig struct {
+	// Exporter receives the spans once they end.
+	Exporter SpanExporter
+}
+
+// SpanExporter receives the spans created according to a TracingConfig.
+// Implementations must be safe for concurrent use.
+type SpanExporter interface {
+	ExportSpan(span Span)
+}
+
+// Span is a finished span created by go-plugin.
+type Span struct {
+	// Name is the name of the span, such as "plugin.dispense".
+	Name string
+
+	// TraceContext is the span's own trace context, and ParentSpanID the ID
+	// of its parent span, which is zero for root spans.
+	TraceContext TraceContext
+	ParentSpanID [8]byte
+
+	Start time.Time
+	End   time.Time
+
+	// Attributes describe the operation, for example the name of the plugin
+	// that was dispensed.
+	Attributes map[string]string
+
+	// Err is the error the operation failed with, if any.
+	Err error
+}
+
+// InmemSpanExporter is a SpanExporter that keeps every span in memory. It is
+// meant for tests. The zero value is ready to use.
+type InmemSpanExporter struct {
+	l     sync.Mutex
+	spans []Span
+}
+
+// ExportSpan implements SpanExporter.
+func (e *InmemSpanExporter) ExportSpan(span Span) {
+	e.l.Lock()
+	defer e.l.Unlock()
+
+	e.spans = append(e.spans, span)
+}
+
+// Spans returns the spans exported so far, in the order they ended.
+func (e *InmemSpanExporter) Spans() []Span {
+	e.l.Lock()
+	defer e.l.Unlock()
+
+	return append([]Span(nil), e.spans...)
+}
+
+// tracer creates spans and propagates trace context. A nil tracer only
+// propagates trace context.
+type tracer struct {
+	exporter SpanExporter
+}
+
+// newTracer returns a tracer, or nil if config doesn't set an exporter.
+func newTracer(config *TracingConfig) *tracer {
+	if config == nil || config.Exporter == nil {
+		return nil
+	}
+	return &tracer{exporter: config.Exporter}
+}
+
+// span is a span that hasn't ended yet.
+type span struct {
+	tracer *tracer
+	span   Span
+}
+
+// start starts a span as a child of the trace context ctx carries, if any,
+// and returns a copy of ctx carrying the new span's trace context. If t is
+// nil, it returns ctx and a nil span, on which end does nothing.
+func (t *tracer) start(ctx context.Context, name string, attrs ...string) (context.Context, *span) {
+	if t == nil {
+		return ctx, nil
+	}
+
+	s := &span{
+		tracer: t,
+		span: Span{
+			Name:       name,
+			Start:      time.Now(),
+			Attributes: make(map[string]string, len(attrs)/2),
+		},
+	}
+	for i := 0; i+1 < len(attrs); i += 2 {
+		s.span.Attributes[attrs[i]] = attrs[i+1]
+	}
+
+	if parent, ok := TraceContextFromContext(ctx); ok {
+		s.span.TraceContext = parent
+		s.span.ParentSpanID = parent.SpanID
+	} else {
+		rand.Read(s.span.TraceContext.TraceID[:])
+		s.span.TraceContext.Flags = TraceFlagsSampled
+	}
+	rand.Read(s.span.TraceContext.SpanID[:])
+
+	return ContextWithTraceContext(ctx, s.span.TraceContext), s
+}
+
+// setAttribute sets an attribute of the span.
+func (s *span) setAttribute(key, value string) {
+	if s == nil {
+		return
+	}
+
+	s.span.Attributes[key] = value
+}
+
+// end ends the span and exports it.
+func (s *span) end(err error) {
+	if s == nil {
+		return
+	}
+
+	s.span.End = time.Now()
+	s.span.Err = err
+	s.tracer.exporter.ExportSpan(s.span)
+}
+
+// dialOptions returns the gRPC dial options that propagate the trace context
+// of each call's context.
+func (t *tracer) dialOptions() []grpc.DialOption {
+	return []grpc.DialOption{
+		grpc.WithChainUnaryInterceptor(t.unaryClientInterceptor),
+		grpc.WithChainStreamInterceptor(t.streamClientInterceptor),
+	}
+}
+
+// serverOptions returns the gRPC server options that extract the propagated
+// trace context into each call's context, creating a span for the call if
+// there is one and t is non-nil.
+func (t *tracer) serverOptions() []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(t.unaryServerInterceptor),
+		grpc.ChainStreamInterceptor(t.streamServerInterceptor),
+	}
+}
+
+// injectTraceContext adds the trace context ctx carries to its outgoing gRPC
+// metadata, unless the metadata already carries one, for example because
+// the caller uses OpenTelemetry's instrumentation.
+func injectTraceContext(ctx context.Context) context.Context {
+	tc, ok := TraceContextFromContext(ctx)
+	if !ok {
+		return ctx
+	}
+	if md, ok := metadata.FromOutgoingContext(ctx); ok && len(md.Get(traceparentHeader)) > 0 {
+		return ctx
+	}
+
+	kv := []string{traceparentHeader, tc.Traceparent()}
+	if tc.State != "" {
+		kv = append(kv, tracestateHeader, tc.State)
+	}
+	return metadata.AppendToOutgoingContext(ctx, kv...)
+}
+
+// extractTraceContext returns a copy of ctx carrying the trace context in its
+// incoming gRPC metadata, if there is a valid one.
+func extractTraceContext(ctx context.Context) (context.Context, bool) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ctx, false
+	}
+	traceparent := md.Get(traceparentHeader)
+	if len(traceparent) == 0 {
+		return ctx, false
+	}
+
+	tc, err := ParseTraceparent(traceparent[0], strings.Join(md.Get(tracestateHeader), ","))
+	if err != nil {
+		return ctx, false
+	}
+
+	return ContextWithTraceContext(ctx, tc), true
+}
+
+func (t *tracer) unaryClientInterceptor(
+	ctx context.Context,
+	method string,
+	req, reply interface{},
+	cc *grpc.ClientConn,
+	invoker grpc.UnaryInvoker,
+	opts ...grpc.CallOption,
+) error {
+	return invoker(injectTraceContext(ctx), method, req, reply, cc, opts...)
+}
+
+func (t *tracer) streamClientInterceptor(
+	ctx context.Context,
+	desc *grpc.StreamDesc,
+	cc *grpc.ClientConn,
+	method string,
+	streamer grpc.Streamer,
+	opts ...grpc.CallOption,
+) (grpc.ClientStream, error) {
+	return streamer(injectTraceContext(ctx), desc, cc, method, opts...)
+}
+
+func (t *tracer) unaryServerInterceptor(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	ctx, ok := extractTraceContext(ctx)
+	if !ok {
+		return handler(ctx, req)
+	}
+
+	ctx, s := t.start(ctx, strings.TrimPrefix(info.FullMethod, "/"), "rpc.system", "grpc")
+	resp, err := handler(ctx, req)
+	s.end(err)
+	return resp, err
+}
+
+func (t *tracer) streamServerInterceptor(
+	srv interface{},
+	ss grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	ctx, ok := extractTraceContext(ss.Context())
+	if !ok {
+		return handler(srv, ss)
+	}
+
+	ctx, s := t.start(ctx, strings.TrimPrefix(info.FullMethod, "/"), "rpc.system", "grpc")
+	err := handler(srv, &tracedServerStream{ServerStream: ss, ctx: ctx})
+	s.end(err)
+	return err
+}
+
+// tracedServerStream is a grpc.ServerStream whose context carries the
+// propagated trace context.
+type tracedServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *tracedServerStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,229 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/rpc"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+)
+
+var testTraceContext = TraceContext{
+	TraceID: [16]byte{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36},
+	SpanID:  [8]byte{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7},
+	Flags:   TraceFlagsSampled,
+	State:   "congo=t61rcWkgMzE",
+}
+
+// findSpans returns the exported spans with the given name.
+func findSpans(e *InmemSpanExporter, name string) []Span {
+	var result []Span
+	for _, span := range e.Spans() {
+		if span.Name == name {
+			result = append(result, span)
+		}
+	}
+	return result
+}
+
+func TestParseTraceparent(t *testing.T) {
+	const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	tc, err := ParseTraceparent(traceparent, testTraceContext.State)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if tc != testTraceContext {
+		t.Fatalf("bad: %#v", tc)
+	}
+	if v := tc.Traceparent(); v != traceparent {
+		t.Fatalf("bad: %s", v)
+	}
+
+	// Future versions may add fields.
+	if _, err := ParseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", ""); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	for _, invalid := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e47-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473x-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+	} {
+		if _, err := ParseTraceparent(invalid, ""); err == nil {
+			t.Fatalf("expected an error for %q", invalid)
+		}
+	}
+}
+
+func TestTracer_nil(t *testing.T) {
+	var tr *tracer
+	ctx := context.Background()
+	if v, s := tr.start(ctx, "test"); v != ctx || s != nil {
+		t.Fatalf("bad: %v %v", v, s)
+	}
+	if newTracer(&TracingConfig{}) != nil {
+		t.Fatal("expected a nil tracer without an exporter")
+	}
+}
+
+func TestTrace_netRPC(t *testing.T) {
+	serverSpans := &InmemSpanExporter{}
+	clientSpans := &InmemSpanExporter{}
+
+	clientConn, serverConn := TestConn(t)
+	server := &RPCServer{
+		Plugins: testPluginMap,
+		Stdout:  new(bytes.Buffer),
+		Stderr:  new(bytes.Buffer),
+		tracer:  newTracer(&TracingConfig{Exporter: serverSpans}),
+	}
+	go server.ServeConn(serverConn)
+
+	client, err := newRPCClientConn(clientConn, testPluginMap, false, nil,
+		newTracer(&TracingConfig{Exporter: clientSpans}), nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer client.Close()
+
+	ctx := ContextWithTraceContext(context.Background(), testTraceContext)
+	raw, err := client.DispenseContext(ctx, "test")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if v := raw.(testInterface).Double(21); v != 42 {
+		t.Fatalf("bad: %d", v)
+	}
+
+	dispense := findSpans(clientSpans, "plugin.dispense")
+	if len(dispense) != 1 {
+		t.Fatalf("bad: %#v", clientSpans.Spans())
+	}
+	if s := dispense[0]; s.TraceContext.TraceID != testTraceContext.TraceID ||
+		s.ParentSpanID != testTraceContext.SpanID ||
+		s.Attributes["plugin.name"] != "test" || s.Attributes["rpc.system"] != "netrpc" || s.Err != nil {
+		t.Fatalf("bad: %#v", s)
+	}
+	dial := findSpans(clientSpans, "plugin.broker.dial")
+	if len(dial) != 1 || dial[0].ParentSpanID != dispense[0].TraceContext.SpanID {
+		t.Fatalf("bad: %#v", clientSpans.Spans())
+	}
+
+	// Calls over the dispensed client carry the trace context it was
+	// dispensed with, including later calls, since net/rpc calls don't take
+	// a context of their own.
+	if v := raw.(testInterface).Double(2); v != 4 {
+		t.Fatalf("bad: %d", v)
+	}
+	calls := findSpans(serverSpans, "Plugin.Double")
+	if len(calls) != 2 {
+		t.Fatalf("bad: %#v", serverSpans.Spans())
+	}
+	for _, s := range calls {
+		if s.TraceContext.TraceID != testTraceContext.TraceID ||
+			s.TraceContext.State != testTraceContext.State ||
+			s.ParentSpanID != testTraceContext.SpanID || s.Attributes["rpc.system"] != "netrpc" {
+			t.Fatalf("bad: %#v", s)
+		}
+	}
+}
+
+// The trace context in the request header must not break peers that use
+// net/rpc's own codecs.
+func TestTrace_netRPCCompatibility(t *testing.T) {
+	t.Run("plain server", func(t *testing.T) {
+		clientConn, serverConn := TestConn(t)
+		server := rpc.NewServer()
+		server.RegisterName("Plugin", &testInterfaceServer{Impl: new(testInterfaceImpl)})
+		go server.ServeConn(serverConn)
+
+		client := newNetRPCClient(clientConn, nil, testTraceContext)
+		defer client.Close()
+
+		var resp int
+		if err := client.Call("Plugin.Double", 21, &resp); err != nil || resp != 42 {
+			t.Fatalf("bad: %d %v", resp, err)
+		}
+	})
+
+	t.Run("plain client", func(t *testing.T) {
+		spans := &InmemSpanExporter{}
+		clientConn, serverConn := TestConn(t)
+		server := rpc.NewServer()
+		server.RegisterName("Plugin", &testInterfaceServer{Impl: new(testInterfaceImpl)})
+		go serveRPC(server, serverConn, nil, newTracer(&TracingConfig{Exporter: spans}))
+
+		client := rpc.NewClient(clientConn)
+		defer client.Close()
+
+		var resp int
+		if err := client.Call("Plugin.Double", 21, &resp); err != nil || resp != 42 {
+			t.Fatalf("bad: %d %v", resp, err)
+		}
+		if v := spans.Spans(); len(v) != 0 {
+			t.Fatalf("bad: %#v", v)
+		}
+	})
+}
+
+func TestTrace_gRPC(t *testing.T) {
+	spans := &InmemSpanExporter{}
+
+	server := grpc.NewServer(newTracer(&TracingConfig{Exporter: spans}).serverOptions()...)
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus("test", grpc_health_v1.HealthCheckResponse_SERVING)
+	grpc_health_v1.RegisterHealthServer(server, healthServer)
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	go server.Serve(lis)
+	defer server.Stop()
+
+	var client *tracer
+	conn, err := grpc.Dial(lis.Addr().String(),
+		append(client.dialOptions(), grpc.WithInsecure(), grpc.WithBlock())...)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer conn.Close()
+	healthClient := grpc_health_v1.NewHealthClient(conn)
+
+	// Calls without a trace context don't get a span.
+	req := &grpc_health_v1.HealthCheckRequest{Service: "test"}
+	if _, err := healthClient.Check(context.Background(), req); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if v := spans.Spans(); len(v) != 0 {
+		t.Fatalf("bad: %#v", v)
+	}
+
+	ctx := ContextWithTraceContext(context.Background(), testTraceContext)
+	if _, err := healthClient.Check(ctx, req); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	calls := findSpans(spans, "grpc.health.v1.Health/Check")
+	if len(calls) != 1 {
+		t.Fatalf("bad: %#v", spans.Spans())
+	}
+	if s := calls[0]; s.TraceContext.TraceID != testTraceContext.TraceID ||
+		s.TraceContext.State != testTraceContext.State ||
+		s.ParentSpanID != testTraceContext.SpanID || s.Attributes["rpc.system"] != "grpc" {
+		t.Fatalf("bad: %#v", s)
+	}
+}
@@ -0,0 +1,239 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+var (
+	// ErrSignatureInvalid is returned when the signature of a checksums
+	// manifest doesn't verify against the key that supposedly made it, or
+	// when the signature is malformed.
+	ErrSignatureInvalid = errors.New("plugin signature is invalid")
+
+	// ErrUntrustedKey is returned when a checksums manifest is signed by a
+	// key that isn't in the trusted key set.
+	ErrUntrustedKey = errors.New("plugin is signed by an untrusted key")
+
+	// ErrKeyRevoked is returned when a checksums manifest is signed by a key
+	// that has been revoked. It wraps ErrUntrustedKey.
+	ErrKeyRevoked = fmt.Errorf("%w: key has been revoked", ErrUntrustedKey)
+
+	// ErrChecksumNotListed is returned when the plugin doesn't appear in a
+	// signed checksums manifest.
+	ErrChecksumNotListed = errors.New("plugin is not listed in the checksums manifest")
+)
+
+// KeyID returns the identifier of an ed25519 public key, which is used to
+// refer to it in signatures and revocations. It is the first 8 bytes of the
+// SHA256 hash of the key, hex encoded.
+func KeyID(key ed25519.PublicKey) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:8])
+}
+
+// TrustedKeySet is a set of ed25519 public keys trusted to sign plugins.
+// Keys can be rotated by adding the new key before plugins signed with it
+// are deployed, and revoking the old key once they are. It is safe for
+// concurrent use.
+type TrustedKeySet struct {
+	l       sync.RWMutex
+	keys    map[string]ed25519.PublicKey
+	revoked map[string]struct{}
+}
+
+// NewTrustedKeySet returns a key set trusting the given keys.
+func NewTrustedKeySet(keys ...ed25519.PublicKey) (*TrustedKeySet, error) {
+	s := &TrustedKeySet{
+		keys:    make(map[string]ed25519.PublicKey),
+		revoked: make(map[string]struct{}),
+	}
+	for _, key := range keys {
+		if _, err := s.Add(key); err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// Add trusts a key and returns its key ID. Keys that have been revoked stay
+// revoked.
+func (s *TrustedKeySet) Add(key ed25519.PublicKey) (string, error) {
+	if len(key) != ed25519.PublicKeySize {
+		return "", fmt.Errorf("invalid ed25519 public key length %d", len(key))
+	}
+
+	id := KeyID(key)
+
+	s.l.Lock()
+	defer s.l.Unlock()
+	s.keys[id] = key
+	return id, nil
+}
+
+// Revoke revokes the keys with the given key IDs. Keys don't need to have
+// been added to be revoked, so a revocation list can be loaded before or
+// after the trusted keys.
+func (s *TrustedKeySet) Revoke(keyIDs ...string) {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	for _, id := range keyIDs {
+		s.revoked[id] = struct{}{}
+	}
+}
+
+// key returns the trusted key with the given ID.
+func (s *TrustedKeySet) key(id string) (ed25519.PublicKey, error) {
+	s.l.RLock()
+	defer s.l.RUnlock()
+
+	if _, ok := s.revoked[id]; ok {
+		return nil, fmt.Errorf("%w: %s", ErrKeyRevoked, id)
+	}
+
+	key, ok := s.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUntrustedKey, id)
+	}
+
+	return key, nil
+}
+
+// SignatureConfig is used to configure a client to verify that an
+// executable is listed in a checksums manifest signed by a trusted key
+// before running it.
+//
+// The manifest uses the format of the output of sha256sum, i.e. lines of a
+// hex encoded SHA256 checksum, whitespace and a file name. The signature is
+// detached and has the format produced by SignChecksums.
+type SignatureConfig struct {
+	// Checksums is the content of the checksums manifest.
+	Checksums []byte
+
+	// Signature is the detached signature of Checksums.
+	Signature []byte
+
+	// TrustedKeys are the keys allowed to sign the manifest.
+	TrustedKeys *TrustedKeySet
+
+	// Name is the file name the plugin is listed under in the manifest. If
+	// this is empty, the base name of the executable is used.
+	Name string
+}
+
+// SignChecksums signs a checksums manifest, returning a detached signature
+// for use in SignatureConfig. The signature is a single line with the key ID
+// and the base64 encoded ed25519 signature, separated by a space.
+func SignChecksums(key ed25519.PrivateKey, checksums []byte) []byte {
+	id := KeyID(key.Public().(ed25519.PublicKey))
+	sig := base64.StdEncoding.EncodeToString(ed25519.Sign(key, checksums))
+	return []byte(id + " " + sig + "\n")
+}
+
+// Check verifies the signature of the checksums manifest and that the file
+// at filePath matches its checksum in it. It returns nil if the file can be
+// trusted.
+func (s *SignatureConfig) Check(filePath string) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return s.check(filePath, file)
+}
+
+// check verifies the signature of the checksums manifest and that the
+// executable read from r matches the checksum listed for filePath.
+func (s *SignatureConfig) check(filePath string, r io.Reader) error {
+	if s.TrustedKeys == nil {
+		return fmt.Errorf("%w: no trusted keys", ErrUntrustedKey)
+	}
+
+	fields := strings.Fields(string(s.Signature))
+	if len(fields) != 2 {
+		return fmt.Errorf("%w: malformed signature", ErrSignatureInvalid)
+	}
+	sig, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil {
+		return fmt.Errorf("%w: malformed signature: %s", ErrSignatureInvalid, err)
+	}
+
+	key, err := s.TrustedKeys.key(fields[0])
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(key, s.Checksums, sig) {
+		return ErrSignatureInvalid
+	}
+
+	name := s.Name
+	if name == "" {
+		name = filepath.Base(filePath)
+	}
+	expected, err := findChecksum(s.Checksums, name)
+	if err != nil {
+		return err
+	}
+
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return err
+	}
+
+	if subtle.ConstantTimeCompare(h.Sum(nil), expected) != 1 {
+		return ErrChecksumsDoNotMatch
+	}
+
+	return nil
+}
+
+// findChecksum returns the checksum listed for name in a sha256sum style
+// manifest.
+func findChecksum(checksums []byte, name string) ([]byte, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(checksums))
+	for scanner.Scan() {
+		// Each line is the checksum and the file name, separated by
+		// whitespace. Only the first run of whitespace separates them, since
+		// file names may contain spaces.
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		i := strings.IndexAny(line, " \t")
+		if i < 0 {
+			continue
+		}
+		checksum, file := line[:i], strings.TrimLeft(line[i:], " \t")
+
+		// sha256sum marks files hashed in binary mode with a "*".
+		if strings.TrimPrefix(file, "*") != name {
+			continue
+		}
+
+		sum, err := hex.DecodeString(checksum)
+		if err != nil || len(sum) != sha256.Size {
+			return nil, fmt.Errorf("malformed checksum for %s in manifest", name)
+		}
+		return sum, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrChecksumNotListed, name)
+}
@@ -0,0 +1,226 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func testSigningKey(t *testing.T) (ed25519.PublicKey, ed25519.PrivateKey) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	return pub, priv
+}
+
+func testChecksums(t *testing.T, path string) []byte {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	sum := sha256.Sum256(data)
+	return []byte(fmt.Sprintf("%s  other-plugin\n%s *%s\n",
+		hex.EncodeToString(make([]byte, sha256.Size)), hex.EncodeToString(sum[:]), filepath.Base(path)))
+}
+
+func TestSignatureConfig_Check(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app-plugin-foo")
+	if err := os.WriteFile(path, []byte("plugin"), 0o755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	pub, priv := testSigningKey(t)
+	otherPub, otherPriv := testSigningKey(t)
+	checksums := testChecksums(t, path)
+
+	cases := map[string]struct {
+		config   func(keys *TrustedKeySet) *SignatureConfig
+		expected error
+	}{
+		"valid": {
+			config: func(keys *TrustedKeySet) *SignatureConfig {
+				return &SignatureConfig{
+					Checksums:   checksums,
+					Signature:   SignChecksums(priv, checksums),
+					TrustedKeys: keys,
+				}
+			},
+		},
+		"rotated key": {
+			config: func(keys *TrustedKeySet) *SignatureConfig {
+				keys.Add(otherPub)
+				return &SignatureConfig{
+					Checksums:   checksums,
+					Signature:   SignChecksums(otherPriv, checksums),
+					TrustedKeys: keys,
+				}
+			},
+		},
+		"untrusted key": {
+			config: func(keys *TrustedKeySet) *SignatureConfig {
+				return &SignatureConfig{
+					Checksums:   checksums,
+					Signature:   SignChecksums(otherPriv, checksums),
+					TrustedKeys: keys,
+				}
+			},
+			expected: ErrUntrustedKey,
+		},
+		"revoked key": {
+			config: func(keys *TrustedKeySet) *SignatureConfig {
+				keys.Revoke(KeyID(pub))
+				return &SignatureConfig{
+					Checksums:   checksums,
+					Signature:   SignChecksums(priv, checksums),
+					TrustedKeys: keys,
+				}
+			},
+			expected: ErrKeyRevoked,
+		},
+		"tampered manifest": {
+			config: func(keys *TrustedKeySet) *SignatureConfig {
+				return &SignatureConfig{
+					Checksums:   append(checksums, '\n'),
+					Signature:   SignChecksums(priv, checksums),
+					TrustedKeys: keys,
+				}
+			},
+			expected: ErrSignatureInvalid,
+		},
+		"malformed signature": {
+			config: func(keys *TrustedKeySet) *SignatureConfig {
+				return &SignatureConfig{
+					Checksums:   checksums,
+					Signature:   []byte("garbage"),
+					TrustedKeys: keys,
+				}
+			},
+			expected: ErrSignatureInvalid,
+		},
+		"not listed": {
+			config: func(keys *TrustedKeySet) *SignatureConfig {
+				return &SignatureConfig{
+					Checksums:   checksums,
+					Signature:   SignChecksums(priv, checksums),
+					TrustedKeys: keys,
+					Name:        "app-plugin-bar",
+				}
+			},
+			expected: ErrChecksumNotListed,
+		},
+		"checksum mismatch": {
+			config: func(keys *TrustedKeySet) *SignatureConfig {
+				return &SignatureConfig{
+					Checksums:   checksums,
+					Signature:   SignChecksums(priv, checksums),
+					TrustedKeys: keys,
+					Name:        "other-plugin",
+				}
+			},
+			expected: ErrChecksumsDoNotMatch,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			keys, err := NewTrustedKeySet(pub)
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
+
+			err = tc.config(keys).Check(path)
+			if tc.expected == nil && err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			if !errors.Is(err, tc.expected) {
+				t.Fatalf("expected %v, got %v", tc.expected, err)
+			}
+		})
+	}
+
+	if !errors.Is(ErrKeyRevoked, ErrUntrustedKey) {
+		t.Fatal("revoked keys should be untrusted")
+	}
+}
+
+func TestFindChecksum(t *testing.T) {
+	sum := sha256.Sum256([]byte("plugin"))
+	hexSum := hex.EncodeToString(sum[:])
+
+	cases := map[string]struct {
+		checksums string
+		name      string
+		expected  error
+	}{
+		"text mode":      {hexSum + "  app-plugin-foo\n", "app-plugin-foo", nil},
+		"binary mode":    {hexSum + " *app-plugin-foo\n", "app-plugin-foo", nil},
+		"space in name":  {hexSum + "  app plugin foo\n", "app plugin foo", nil},
+		"binary space":   {hexSum + " *app plugin foo\n", "app plugin foo", nil},
+		"crlf":           {hexSum + "  app-plugin-foo\r\n", "app-plugin-foo", nil},
+		"prefix of name": {hexSum + "  app plugin foo\n", "app", ErrChecksumNotListed},
+		"no file name":   {hexSum + "\n", "app-plugin-foo", ErrChecksumNotListed},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			actual, err := findChecksum([]byte(tc.checksums), tc.name)
+			if !errors.Is(err, tc.expected) {
+				t.Fatalf("expected %v, got %v", tc.expected, err)
+			}
+			if tc.expected == nil && hex.EncodeToString(actual) != hexSum {
+				t.Fatalf("bad: %x", actual)
+			}
+		})
+	}
+}
+
+func TestClient_SignatureConfig(t *testing.T) {
+	pub, priv := testSigningKey(t)
+	keys, err := NewTrustedKeySet(pub)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	checksums := testChecksums(t, os.Args[0])
+	for name, tc := range map[string]struct {
+		signature []byte
+		expected  error
+	}{
+		"valid":   {SignChecksums(priv, checksums), nil},
+		"invalid": {SignChecksums(priv, []byte("other")), ErrSignatureInvalid},
+	} {
+		t.Run(name, func(t *testing.T) {
+			c := NewClient(&ClientConfig{
+				Cmd:             helperProcess("test-interface"),
+				HandshakeConfig: testHandshake,
+				Plugins:         testPluginMap,
+				SignatureConfig: &SignatureConfig{
+					Checksums:   checksums,
+					Signature:   tc.signature,
+					TrustedKeys: keys,
+				},
+			})
+			defer c.Kill()
+
+			_, err := c.Client()
+			if tc.expected == nil && err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			if !errors.Is(err, tc.expected) {
+				t.Fatalf("expected %v, got %v", tc.expected, err)
+			}
+		})
+	}
+}